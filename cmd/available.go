@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type availableScenario struct {
+	inputFile  string
+	outputFile string
+	isJSON     bool
+}
+
+var availableScn = availableScenario{}
+
+var availableCMD = &cobra.Command{
+	Use:   "available",
+	Short: "Check if archive sources have any capture of each URL, before link-rot remediation",
+	Run:   availableScn.run,
+}
+
+// URLs of arguments and input file, one per line
+func (as *availableScenario) urls(args []string) []string {
+	urls := append([]string{}, args...)
+	if as.inputFile == "" {
+		return urls
+	}
+
+	var input io.Reader = os.Stdin
+	if as.inputFile != "-" {
+		file, err := os.Open(as.inputFile)
+		if err != nil {
+			log.Fatalf("Cannot open URLs file: %v", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Cannot read URLs file: %v", err)
+	}
+	return urls
+}
+
+func (as *availableScenario) run(cmd *cobra.Command, args []string) {
+	urls := as.urls(args)
+	if len(urls) == 0 {
+		log.Fatalf("No URLs to check, pass them as arguments or with `--input`")
+	}
+
+	var output io.Writer = os.Stdout
+	if as.outputFile != "" {
+		file, err := common.CreateAtomic(as.outputFile)
+		if err != nil {
+			log.Fatalf("Error obtaining output: %v", err)
+		}
+		defer func() {
+			if err := file.Commit(); err != nil {
+				log.Printf("ERROR: Cannot write report: %v", err)
+			}
+		}()
+		output = file
+	}
+
+	// Flags of the query apply to every URL
+	configs := getRequestConfigs(urls[:1])
+	close(configs)
+	config := <-configs
+	initSources()
+
+	report := common.CheckAvailability(sources, urls, config, int(maxWorkers))
+	if as.isJSON {
+		for _, a := range report {
+			line, _ := jsoniter.Marshal(a)
+			if _, err := output.Write(append(line, '\n')); err != nil {
+				log.Printf("ERROR: Cannot write report: %v", err)
+				break
+			}
+		}
+	} else {
+		names := []string{}
+		for _, s := range sources {
+			names = append(names, s.Name())
+		}
+		if err := common.WriteAvailabilityCSV(output, names, report); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+	log.Printf("Summary: %v", stats.Summary())
+}
+
+func init() {
+	availableCMD.Flags().StringVarP(&availableScn.inputFile, "input", "i", "", "File with URLs to check, one per line, - for stdin")
+	availableCMD.Flags().StringVarP(&availableScn.outputFile, "output", "o", "", "Path to the output file")
+	availableCMD.Flags().BoolVarP(&availableScn.isJSON, "json", "", false, "Write report as newline-delimited JSON with errors, instead of CSV of found capture timestamps")
+	rootCmd.AddCommand(availableCMD)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"io"
+	"log"
+
+	"github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/commoncrawl"
+	"github.com/karust/gogetcrawl/process"
+	"github.com/karust/gogetcrawl/render"
+	"github.com/spf13/cobra"
+)
+
+// Values of flags with fixed choices, completed by `gogetcrawl completion` scripts
+var flagChoices = map[*cobra.Command]map[string][]string{
+	rootCmd: {
+		"sources":  {"wb\tWayback Machine", "cc\tCommon Crawl"},
+		"sort":     {common.SortAscending, common.SortDescending, common.SortClosest},
+		"json-lib": {common.JSONIter, common.JSONStd},
+	},
+	fileCMD: {
+		"stdout":          {common.StreamRaw, common.StreamLength, common.StreamWarc},
+		"link-duplicates": {common.LinkHard, common.LinkReflink},
+		"rewrite-links":   {process.RewriteLocal, process.RewriteReplay},
+	},
+	seriesCMD: {
+		"interval": {common.SeriesDay, common.SeriesMonth, common.SeriesYear},
+	},
+	renderCMD: {
+		"format": {render.PNG, render.PDF},
+	},
+}
+
+// Flags taking files of given extensions, other file flags complete any file
+var flagFiles = map[*cobra.Command]map[string][]string{
+	rootCmd: {
+		"politeness": {"json"},
+		"events":     {"ndjson", "jsonl"},
+	},
+	fileCMD: {
+		"manifest":         {"json"},
+		"replay":           {"json"},
+		"preflight-report": {"json"},
+		"asset-graph":      {"ndjson", "jsonl"},
+		"archive":          {"tar.gz", "zip", "wacz"},
+	},
+}
+
+// Register completions of flag values, called once flags of all commands are defined
+func registerCompletions() {
+	for command, flags := range flagChoices {
+		for name, choices := range flags {
+			choices := choices
+			if err := command.RegisterFlagCompletionFunc(name, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+				return choices, cobra.ShellCompDirectiveNoFileComp
+			}); err != nil {
+				log.Fatalf("[registerCompletions] %v", err)
+			}
+		}
+	}
+
+	for command, flags := range flagFiles {
+		for name, extensions := range flags {
+			mark := command.MarkFlagFilename
+			if command.PersistentFlags().Lookup(name) != nil {
+				mark = command.MarkPersistentFlagFilename
+			}
+			if err := mark(name, extensions...); err != nil {
+				log.Fatalf("[registerCompletions] %v", err)
+			}
+		}
+	}
+
+	if err := rootCmd.RegisterFlagCompletionFunc("crawl", completeCrawls); err != nil {
+		log.Fatalf("[registerCompletions] %v", err)
+	}
+}
+
+// Completes Common Crawl crawl IDs known to the index server, or of fallback listing if it cannot be reached
+func completeCrawls(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// Logs would be mixed into completions
+	log.SetOutput(io.Discard)
+
+	cc := &commoncrawl.CommonCrawl{MaxTimeout: 5, MaxRetries: 1}
+	indexes, err := cc.GetIndexes()
+	if err != nil {
+		if indexes, err = commoncrawl.FallbackIndexes(); err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+		}
+	}
+
+	crawls := []string{}
+	for _, idx := range indexes {
+		crawls = append(crawls, idx.Id+"\t"+idx.Name)
+	}
+	return crawls, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type diffScenario struct {
+	outputFile string
+	isJSON     bool
+}
+
+var diffScn = diffScenario{}
+
+var diffCMD = &cobra.Command{
+	Use:   "diff <old manifest> <new manifest>",
+	Short: "Show URLs added, removed or changed (by digest) between two harvests of the same query",
+	Args:  cobra.ExactArgs(2),
+	Run:   diffScn.run,
+}
+
+// Different queries are compared as well, but the result is rarely meaningful
+func sameQueries(older, newer *common.Manifest) bool {
+	urls := map[string]bool{}
+	for _, q := range older.Queries {
+		urls[q.URL] = true
+	}
+	for _, q := range newer.Queries {
+		if !urls[q.URL] {
+			return false
+		}
+	}
+	return len(older.Queries) == len(newer.Queries)
+}
+
+func (ds *diffScenario) run(cmd *cobra.Command, args []string) {
+	older, err := common.LoadManifest(args[0])
+	if err != nil {
+		log.Fatalf("Cannot load old manifest: %v", err)
+	}
+	newer, err := common.LoadManifest(args[1])
+	if err != nil {
+		log.Fatalf("Cannot load new manifest: %v", err)
+	}
+	if !sameQueries(older, newer) {
+		fmt.Fprintln(os.Stderr, "WARNING: manifests are of different queries")
+	}
+
+	diff := common.DiffManifests(older, newer)
+
+	if ds.outputFile != "" {
+		file, err := os.Create(ds.outputFile)
+		if err != nil {
+			log.Fatalf("Error obtaining output: %v", err)
+		}
+		defer file.Close()
+		if err := diff.WriteNDJSON(file); err != nil {
+			log.Fatalf("Cannot write report: %v", err)
+		}
+	}
+
+	if ds.isJSON {
+		out, _ := jsoniter.MarshalIndent(diff, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	for _, entries := range [][]common.DiffEntry{diff.Added, diff.Removed, diff.Changed} {
+		for _, e := range entries {
+			fmt.Printf("%-8v %v\n", e.Change, e.URL)
+		}
+	}
+	fmt.Println(diff)
+}
+
+func init() {
+	diffCMD.Flags().StringVarP(&diffScn.outputFile, "output", "o", "", "Write changes into NDJSON report file")
+	diffCMD.Flags().BoolVarP(&diffScn.isJSON, "json", "", false, "Print changes as JSON")
+	rootCmd.AddCommand(diffCMD)
+}
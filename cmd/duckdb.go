@@ -0,0 +1,11 @@
+//go:build duckdb
+
+package cmd
+
+import "github.com/karust/gogetcrawl/duckdb"
+
+func init() {
+	openDuckDB = func(path string) (recordSink, error) {
+		return duckdb.New(path)
+	}
+}
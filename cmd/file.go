@@ -1,20 +1,68 @@
 package cmd
 
 import (
+	"crypto/ed25519"
+	stderrors "errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/process"
+	"github.com/karust/gogetcrawl/wacz"
 	"github.com/spf13/cobra"
 )
 
 type fileScenario struct {
 	finishedWorkers uint
 	outputDir       string
+	s3Location      string
+	archivePath     string
+	signKey         string
+	warcDir         string
+	warcPrefix      string
+	warcSize        int64
+	manifestPath    string
+	manifest        *common.Manifest
+	skipDigests     string
+	exportDigests   string
+	digests         *common.DigestSet
+	soft404Path     string
+	soft404Report   *os.File
+	soft404         func(*common.CdxResponse, []byte) ([]byte, error)
+	extractFields   []string
+	extractPath     string
+	extractReport   *os.File
+	extract         func(*common.CdxResponse, []byte) ([]byte, error)
+	graphPath       string
+	neo4jDir        string
+	linkGraph       *process.LinkGraph
+	assetsPath      string
+	assetGraphs     *process.AssetGraphs
+	techPath        string
+	techTimeline    *process.TechTimeline
+	streamFormat    string
+	isMirror        bool
+	linkDuplicates  string
+	rewriteLinks    string
+	isMarkdown      bool
+	isRobots        bool
 	downloadRate    float32
+	isPreflight     bool
+	preflightPath   string
+	isDeterministic bool
+	replayPath      string
+	jobName         string
+	jobStore        common.JobStore
+	runErrors       int   // Errors of queries and downloads logged during the run
+	firstErr        error // First of them
+	outputErr       error // First failure of writing outputs after the harvest
+	output          common.Output
 }
 
 var fileScn = fileScenario{}
@@ -23,31 +71,26 @@ var fileCMD = &cobra.Command{
 	Use:     "file",
 	Aliases: []string{"download"},
 	Short:   "Download files located in web arhives for desired domains",
-	Args:    cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	Args:    fileArgs,
 	Run:     fileScn.spawnWorkers,
 }
 
+// Replayed queries come from the manifest, so URLs are not needed then
+func fileArgs(cmd *cobra.Command, args []string) error {
+	if fileScn.replayPath != "" {
+		return cobra.OnlyValidArgs(cmd, args)
+	}
+	return cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs)(cmd, args)
+}
+
 func (fs *fileScenario) worker(configs <-chan common.RequestConfig) {
 	for {
 		select {
 		case config, ok := <-configs:
 			if ok {
-				var wg sync.WaitGroup
-				for _, s := range sources {
-
-					wg.Add(1)
-					go func(s common.Source) {
-						defer wg.Done()
-						s.FetchPages(config, results, errors)
-					}(s)
-
-					//wg.Add(1)
-					go func() {
-						//defer wg.Done()
-						common.SaveFiles(results, fs.outputDir, errors, fs.downloadRate)
-					}()
-				}
-				wg.Wait()
+				fs.manifest.AddQuery(config, sources)
+				config.Emit(common.Event{Type: common.EventJobStarted})
+				config.EmitFinished(fs.runJob(config))
 			} else {
 				fs.finishedWorkers += 1
 				return
@@ -56,18 +99,449 @@ func (fs *fileScenario) worker(configs <-chan common.RequestConfig) {
 	}
 }
 
+// Queries all sources of the job at once, records of each source are saved by its downloader.
+// Errors are passed to the run, first one is returned once sources and downloaders of the job are done.
+func (fs *fileScenario) runJob(config common.RequestConfig) error {
+	jobResults := make(chan []*common.CdxResponse)
+	queryErrors := make(chan error)
+	jobErrors := make(chan error)
+
+	var firstErr error
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for err := range jobErrors {
+			if firstErr == nil {
+				firstErr = err
+			}
+			errors <- err
+		}
+	}()
+
+	// Query errors are spent from the budget here, download errors are by the downloaders
+	var senders sync.WaitGroup
+	senders.Add(1)
+	go func() {
+		defer senders.Done()
+		for err := range queryErrors {
+			budget.Failure()
+			jobErrors <- err
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, s := range sources {
+
+		wg.Add(1)
+		go func(s common.Source) {
+			defer wg.Done()
+			s.FetchPages(config, jobResults, queryErrors)
+		}(s)
+
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			d := fs.downloader()
+			d.SaveFiles(jobResults, jobErrors)
+		}()
+	}
+	wg.Wait()
+	close(jobResults)
+	close(queryErrors)
+	senders.Wait()
+	close(jobErrors)
+	<-forwarded
+	return firstErr
+}
+
+func (fs *fileScenario) downloader() *common.Downloader {
+	d := &common.Downloader{Output: fs.output, DownloadRate: fs.downloadRate, Budget: budget, Stats: stats, Manifest: fs.manifest, Digests: fs.digests, Scope: scope, Where: where}
+
+	if fs.isMirror {
+		d.FileName = process.MirrorFileName
+	}
+
+	// Pages are converted last, so analyzers and DuckDB see original HTML
+	var markdown func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.isMarkdown {
+		markdown = process.MarkdownProcessor
+		if d.FileName != nil {
+			d.FileName = process.MarkdownFileName(d.FileName)
+		} else {
+			d.FileName = process.MarkdownFileName(common.FileName)
+		}
+	}
+
+	var rewrite func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.rewriteLinks != "" {
+		var err error
+		if rewrite, err = process.NewLinkProcessor(fs.rewriteLinks); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	// Captures are analyzed by original content, before links are rewritten
+	var tech func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.techTimeline != nil {
+		tech = fs.techTimeline.Processor()
+	}
+
+	var graph func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.linkGraph != nil {
+		graph = fs.linkGraph.Processor()
+	}
+
+	var assets func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.assetGraphs != nil {
+		assets = fs.assetGraphs.Processor()
+	}
+
+	var db func(*common.CdxResponse, []byte) ([]byte, error)
+	if sink != nil {
+		db = sink.Processor()
+	}
+
+	var robots func(*common.CdxResponse, []byte) ([]byte, error)
+	if fs.isRobots {
+		robots = process.RobotsProcessor
+	}
+
+	if robots != nil || fs.soft404 != nil || fs.extract != nil || tech != nil || graph != nil || assets != nil || db != nil || rewrite != nil || markdown != nil {
+		d.Process = process.Chain(robots, fs.soft404, fs.extract, tech, graph, assets, db, rewrite, markdown)
+	}
+	return d
+}
+
 func (fs *fileScenario) spawnWorkers(cmd *cobra.Command, args []string) {
-	fp, _ := filepath.Abs(fs.outputDir)
-	err := os.MkdirAll(fp, os.ModePerm)
-	if err != nil {
-		log.Fatalf("Cannot get access to '%v' dir: %v", fileScn.outputDir, err)
-	} else {
-		log.Printf("Setting '%v' as output directorty", fp)
+	if fs.isDeterministic && fs.replayPath == "" && fs.manifestPath == "" {
+		log.Fatalf("Deterministic run needs `--manifest` to be repeated from")
+	}
+	if fs.jobName != "" {
+		if err := common.ValidJobName(fs.jobName); err != nil {
+			log.Fatalf("Please check `--job`: %v", err)
+		}
+		fs.jobStore = openJobStore()
 	}
 
-	configs := getRequestConfigs(args)
+	base := baseRequestConfig()
 	initSources()
+	configs := requestConfigs(base, args)
+
+	// Deterministic and replayed runs harvest planned queries one by one, so records are written in the same order
+	var plans []*common.Plan
+	epoch := time.Now().UTC().Truncate(time.Second)
+	if fs.replayPath != "" {
+		plans, epoch = fs.replayPlans(base, epoch)
+	} else if fs.isDeterministic {
+		plans = fs.pinnedPlans(configs, epoch)
+	}
+
+	// Checked before outputs are created, so failed run leaves nothing behind
+	if fs.isPreflight && plans != nil {
+		fs.preflight(plans[0].Config)
+	} else if fs.isPreflight {
+		fs.preflight(pendingConfigs(configs)[0])
+	}
+
+	var err error
+	if fs.streamFormat != "" {
+		fs.output, err = common.NewStreamOutput(os.Stdout, fs.streamFormat)
+		if err != nil {
+			log.Fatalf("Cannot use stdout output: %v", err)
+		}
+	} else if fs.warcDir != "" {
+		info := map[string]string{"software": "gogetcrawl " + version}
+		fs.output, err = common.NewWarcOutput(fs.warcDir, fs.warcPrefix, fs.warcSize<<20, info)
+		if err != nil {
+			log.Fatalf("Cannot create WARC output: %v", err)
+		}
+		log.Printf("Setting '%v' as output WARC directory", fs.warcDir)
+	} else if strings.HasSuffix(strings.ToLower(fs.archivePath), ".wacz") {
+		var key ed25519.PrivateKey
+		if fs.signKey != "" {
+			if key, err = wacz.LoadKey(fs.signKey); err != nil {
+				log.Fatalf("Cannot load signing key: %v", err)
+			}
+		}
+		fs.output, err = wacz.New(fs.archivePath, key)
+		if err != nil {
+			log.Fatalf("Cannot create WACZ package: %v", err)
+		}
+		log.Printf("Setting '%v' as output WACZ package", fs.archivePath)
+	} else if fs.archivePath != "" {
+		fs.output, err = common.NewArchiveOutput(fs.archivePath)
+		if err != nil {
+			log.Fatalf("Cannot create output archive: %v", err)
+		}
+		log.Printf("Setting '%v' as output archive", fs.archivePath)
+	} else if fs.s3Location != "" {
+		storage, err := common.NewS3Storage(newS3Client(s3Region, s3Endpoint), fs.s3Location)
+		if err != nil {
+			log.Fatalf("Please check `--s3`: %v", err)
+		}
+		fs.output = common.NewStorageOutput(storage)
+		log.Printf("Setting '%v' as output bucket", fs.s3Location)
+	} else if fs.outputDir != "" {
+		fp, _ := filepath.Abs(fs.outputDir)
+		err := os.MkdirAll(fp, os.ModePerm)
+		if err != nil {
+			log.Fatalf("Cannot get access to '%v' dir: %v", fileScn.outputDir, err)
+		} else {
+			log.Printf("Setting '%v' as output directorty", fp)
+		}
+		storage, err := common.NewLinkingDiskStorage(fp, fs.linkDuplicates)
+		if err != nil {
+			log.Fatalf("Please check `--link-duplicates`: %v", err)
+		}
+		fs.output = common.NewStorageOutput(storage)
+	} else {
+		log.Fatalf("Please provide output with `--dir`, `--s3`, `--archive`, `--warc-dir` or `--stdout`")
+	}
+
+	if fs.isDeterministic && !common.PinOutput(fs.output, epoch) {
+		log.Fatalf("Output cannot be reproduced, use `--dir`, `--s3`, `--archive` with .tar.gz or .zip, `--warc-dir` or raw `--stdout` in deterministic run")
+	}
+
+	if fs.linkDuplicates != "" && fs.outputDir == "" {
+		log.Fatalf("Duplicate linking can only be used with `--dir` output")
+	}
+
+	if fs.signKey != "" && !strings.HasSuffix(strings.ToLower(fs.archivePath), ".wacz") {
+		log.Fatalf("Signing key can only be used with `--archive` WACZ package")
+	}
+
+	if fs.rewriteLinks == process.RewriteLocal && !fs.isMirror {
+		log.Fatalf("Local link rewriting requires `--mirror` layout")
+	}
+
+	if fs.isMarkdown && fs.rewriteLinks == process.RewriteLocal {
+		log.Fatalf("Local links point to HTML pages, which are not kept with `--markdown`")
+	}
+
+	if fs.soft404Path != "" {
+		if fs.soft404Report, err = os.Create(fs.soft404Path); err != nil {
+			log.Fatalf("Cannot create soft-404 report: %v", err)
+		}
+		fs.soft404 = process.NewSoft404Reporter(fs.soft404Report)
+	}
+
+	if len(fs.extractFields) > 0 {
+		if fs.extractPath == "" {
+			log.Fatalf("Extracted fields need `--extract-report` file")
+		}
+		selectors := []*process.FieldSelector{}
+		for _, field := range fs.extractFields {
+			selector, err := process.ParseFieldSelector(field)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			selectors = append(selectors, selector)
+		}
+		if fs.extractReport, err = os.Create(fs.extractPath); err != nil {
+			log.Fatalf("Cannot create extraction report: %v", err)
+		}
+		fs.extract = process.NewFieldExtractor(fs.extractReport, selectors)
+	}
+
+	if fs.techPath != "" {
+		fs.techTimeline = process.NewTechTimeline()
+	}
+
+	if fs.graphPath != "" || fs.neo4jDir != "" {
+		fs.linkGraph = process.NewLinkGraph()
+	}
+
+	if fs.assetsPath != "" {
+		fs.assetGraphs = process.NewAssetGraphs()
+	}
+
+	if fs.skipDigests != "" {
+		if fs.digests, err = common.LoadDigests(fs.skipDigests); err != nil {
+			log.Fatalf("Cannot load digests to skip: %v", err)
+		}
+		log.Printf("Loaded %v digests to skip", fs.digests.Len())
+	} else if fs.exportDigests != "" {
+		fs.digests = common.NewDigestSet()
+	}
+
+	initSink()
+
+	if fs.manifestPath != "" {
+		fs.manifest = common.NewManifest("gogetcrawl "+version, os.Args[1:])
+		if fs.isDeterministic {
+			fs.manifest.Deterministic, fs.manifest.Epoch = true, epoch
+		}
+		fs.addInputs()
+	}
+
+	fs.recordJobStart(configs, plans)
+	if plans != nil {
+		fs.harvestPlans(plans)
+	} else {
+		fs.runWorkers(configs)
+	}
+
+	if err := fs.output.Close(); err != nil {
+		fs.writeError(fmt.Errorf("Cannot close output: %w", err))
+	}
+
+	if fs.soft404Report != nil {
+		fs.soft404Report.Close()
+	}
+	if fs.extractReport != nil {
+		fs.extractReport.Close()
+	}
+	closeSink()
+
+	if fs.techTimeline != nil {
+		data, _ := jsoniter.MarshalIndent(fs.techTimeline.Timeline(), "", "  ")
+		if err := common.WriteFileAtomic(fs.techPath, data); err != nil {
+			fs.writeError(fmt.Errorf("Cannot write technology timeline: %w", err))
+		}
+	}
+
+	if fs.linkGraph != nil {
+		if err := fs.writeLinkGraph(); err != nil {
+			fs.writeError(fmt.Errorf("Cannot write link graph: %w", err))
+		}
+	}
+
+	if fs.assetGraphs != nil {
+		if err := fs.writeAssetGraphs(); err != nil {
+			fs.writeError(fmt.Errorf("Cannot write asset graph: %w", err))
+		}
+	}
+
+	if fs.exportDigests != "" {
+		if err := fs.digests.Save(fs.exportDigests); err != nil {
+			fs.writeError(err)
+		}
+	}
+
+	if fs.manifest != nil {
+		if fs.archivePath != "" {
+			if err := fs.manifest.AddOutput(fs.archivePath); err != nil {
+				fs.writeError(err)
+			}
+		}
+		if warcs, ok := fs.output.(*common.WarcOutput); ok {
+			for _, path := range warcs.Files() {
+				if err := fs.manifest.AddOutput(path); err != nil {
+					fs.writeError(err)
+				}
+			}
+		}
+		fs.manifest.Finish(stats)
+		if err := fs.manifest.Save(fs.manifestPath); err != nil {
+			fs.writeError(err)
+		}
+	}
+	fs.recordJobFinish(fs.runOutcome())
+	log.Printf("Summary: %v", stats.Summary())
+}
+
+// Configs queued in the channel, they are kept in it
+func pendingConfigs(configs chan common.RequestConfig) []common.RequestConfig {
+	pending := make([]common.RequestConfig, 0, len(configs))
+	for len(configs) > 0 {
+		pending = append(pending, <-configs)
+	}
+	for _, config := range pending {
+		configs <- config
+	}
+	return pending
+}
+
+// Records run of `--job` in job store with its queries and outputs, so it can be listed and run again with `jobs run`
+func (fs *fileScenario) recordJobStart(configs chan common.RequestConfig, plans []*common.Plan) {
+	if fs.jobStore == nil {
+		return
+	}
+
+	job := common.StoredJob{Name: fs.jobName, Args: os.Args[1:], Outputs: fs.outputs()}
+	job.Dir, _ = os.Getwd()
+	if plans != nil {
+		for _, plan := range plans {
+			job.Queries = append(job.Queries, common.NewManifestQuery(plan.Config, sources))
+		}
+	} else {
+		for _, config := range pendingConfigs(configs) {
+			job.Queries = append(job.Queries, common.NewManifestQuery(config, sources))
+		}
+	}
+	if len(job.Queries) > 0 {
+		job.JobID = job.Queries[0].JobID
+	}
+
+	if previous, err := fs.jobStore.Get(fs.jobName); err == nil && previous.State == common.JobRunning {
+		log.Printf("WARNING: Job '%v' started at %v is still recorded as running", fs.jobName, previous.Started)
+	}
+	if err := common.RecordJobStart(fs.jobStore, job); err != nil {
+		log.Fatalf("Cannot record job '%v': %v", fs.jobName, err)
+	}
+}
+
+// Logs error of query or download, harvest goes on. Called by the goroutine reading errors of the harvest.
+func (fs *fileScenario) runError(err error) {
+	log.Printf("ERROR: %v\n", err)
+	if fs.firstErr == nil {
+		fs.firstErr = err
+	}
+	fs.runErrors++
+}
 
+// Logs failure of writing outputs once the harvest is done, results of the run are incomplete then
+func (fs *fileScenario) writeError(err error) {
+	log.Printf("ERROR: %v", err)
+	if fs.outputErr == nil {
+		fs.outputErr = err
+	}
+}
+
+// Error of the finished run: failed outputs, or errors when nothing was saved
+func (fs *fileScenario) runOutcome() error {
+	if fs.outputErr != nil {
+		return fs.outputErr
+	}
+	if fs.runErrors > 0 && stats.Summary().Records[common.RecordSaved] == 0 {
+		return fmt.Errorf("Nothing saved, %v errors, first: %w", fs.runErrors, fs.firstErr)
+	}
+	return nil
+}
+
+// Records outcome of `--job` run, aborted runs fail with their error
+func (fs *fileScenario) recordJobFinish(err error) {
+	if fs.jobStore == nil {
+		return
+	}
+	if err := common.RecordJobFinish(fs.jobStore, fs.jobName, stats, err); err != nil {
+		log.Printf("ERROR: Cannot record job '%v': %v", fs.jobName, err)
+	}
+}
+
+// Locations results of the run are written to
+func (fs *fileScenario) outputs() []string {
+	outputs := []string{}
+	if fs.streamFormat != "" {
+		outputs = append(outputs, "stdout:"+fs.streamFormat)
+	}
+	if fs.s3Location != "" {
+		outputs = append(outputs, fs.s3Location)
+	}
+	for _, path := range []string{fs.outputDir, fs.warcDir, fs.archivePath, fs.manifestPath, fs.exportDigests, fs.soft404Path, fs.extractPath, fs.graphPath, fs.neo4jDir, fs.assetsPath, fs.techPath, duckdbPath} {
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		outputs = append(outputs, path)
+	}
+	return outputs
+}
+
+// Runs jobs of configs by workers, each one queries all sources at once
+func (fs *fileScenario) runWorkers(configs chan common.RequestConfig) {
 	var wg sync.WaitGroup
 
 	// Spawn Workers
@@ -88,7 +562,8 @@ func (fs *fileScenario) spawnWorkers(cmd *cobra.Command, args []string) {
 		select {
 		case err, ok := <-errors:
 			if ok {
-				log.Printf("ERROR: %v\n", err)
+				fs.runError(err)
+				checkBudget()
 			}
 		// Unblock if no errors produced
 		case <-time.After(time.Second * 3):
@@ -97,13 +572,243 @@ func (fs *fileScenario) spawnWorkers(cmd *cobra.Command, args []string) {
 	}
 
 	wg.Wait()
-	close(errors)
-	close(results)
+}
+
+// Harvests plans one by one with single downloader, so records are written in order of the plans
+func (fs *fileScenario) harvestPlans(plans []*common.Plan) {
+	log.Printf("Harvesting %v planned queries one by one, `--workers` is not used", len(plans))
+	d := fs.downloader()
+	for _, plan := range plans {
+		log.Printf("%v", plan)
+		fs.manifest.AddPlan(plan)
+		if _, err := d.HarvestPlan(plan); err != nil {
+			// Failed downloads are already spent by the downloader
+			if !stderrors.Is(err, common.BudgetExhaustedError) {
+				budget.Failure()
+			}
+			fs.runError(err)
+			checkBudget()
+		}
+	}
+}
+
+// Plans of the queries pinned at epoch, indexes are resolved before pinning
+func (fs *fileScenario) pinnedPlans(configs chan common.RequestConfig, epoch time.Time) []*common.Plan {
+	plans := []*common.Plan{}
+	for len(configs) > 0 {
+		config := <-configs
+		plan, err := common.NewPlan(sources, config)
+		if err != nil {
+			log.Fatalf("Cannot plan query of '%v': %v", config.URL, err)
+		}
+		plan.Pin(epoch)
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// Plans repeating queries of the manifest on the same indexes, while limiters, caches and stats come from flags.
+// Deterministic harvest is repeated at its epoch.
+func (fs *fileScenario) replayPlans(base common.RequestConfig, epoch time.Time) ([]*common.Plan, time.Time) {
+	manifest, err := common.LoadManifest(fs.replayPath)
+	if err != nil {
+		log.Fatalf("Cannot load manifest to replay: %v", err)
+	}
+	for _, err := range manifest.CheckInputs() {
+		log.Printf("WARNING: %v", err)
+	}
+	log.Printf("Replaying harvest of `gogetcrawl %v`, filters of records are not in the manifest and come from flags", strings.Join(manifest.Command, " "))
+	if manifest.Deterministic {
+		fs.isDeterministic = true
+		if !manifest.Epoch.IsZero() {
+			epoch = manifest.Epoch
+		}
+	}
+
+	plans := []*common.Plan{}
+	for _, query := range manifest.Queries {
+		plan := query.Plan(sources)
+		if len(plan.Steps) == 0 {
+			log.Printf("WARNING: Sources of '%v' query are not enabled with `--sources`, skipping it", query.URL)
+			continue
+		}
+		config := &plan.Config
+		config.JobID, config.Stats, config.Politeness, config.Cooldowns = common.NewJobID(), base.Stats, base.Politeness, base.Cooldowns
+		config.IndexLimiter, config.StorageLimiter, config.FileCache, config.Events = base.IndexLimiter, base.StorageLimiter, base.FileCache, base.Events
+		if fs.isDeterministic {
+			plan.Pin(epoch)
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		log.Fatalf("No queries to replay in '%v'", fs.replayPath)
+	}
+	return plans, epoch
+}
+
+// Files the run is configured with, recorded in manifest to notice their changes when it is repeated
+func (fs *fileScenario) addInputs() {
+	inputs := [][2]string{{"allow-file", allowFile}, {"deny-file", denyFile}, {"politeness", politenessFile}, {"skip-digests", fs.skipDigests}}
+	for _, input := range inputs {
+		if input[1] == "" {
+			continue
+		}
+		if err := fs.manifest.AddInput(input[0], input[1]); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+}
+
+// Files and directories written by the run, checked by preflight
+func (fs *fileScenario) outputDirs() []string {
+	dirs := []string{}
+	if fs.outputDir != "" {
+		dirs = append(dirs, fs.outputDir)
+	}
+	if fs.warcDir != "" {
+		dirs = append(dirs, fs.warcDir)
+	}
+	if fs.neo4jDir != "" {
+		dirs = append(dirs, fs.neo4jDir)
+	}
+	for _, path := range []string{fs.archivePath, fs.manifestPath, fs.exportDigests, fs.soft404Path, fs.extractPath, fs.graphPath, fs.assetsPath, fs.techPath, fs.preflightPath} {
+		if path != "" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil && !seen[abs] {
+			seen[abs] = true
+			unique = append(unique, abs)
+		}
+	}
+	return unique
+}
+
+// Checks sources with sample of the first job and outputs of the run, aborts if any check fails
+func (fs *fileScenario) preflight(config common.RequestConfig) {
+	log.Printf("Running preflight checks with '%v'", config.URL)
+	report := common.Preflight(sources, config)
+
+	for _, dir := range fs.outputDirs() {
+		report.Check("write "+dir, func() (string, error) {
+			return common.CheckWritableDir(dir)
+		})
+	}
+	if fs.s3Location != "" {
+		report.Check("write "+fs.s3Location, func() (string, error) {
+			storage, err := common.NewS3Storage(newS3Client(s3Region, s3Endpoint), fs.s3Location)
+			if err != nil {
+				return "", err
+			}
+			return common.CheckStorage(storage)
+		})
+	}
+
+	if fs.preflightPath != "" {
+		data, _ := jsoniter.MarshalIndent(report, "", "  ")
+		if err := common.WriteFileAtomic(fs.preflightPath, data); err != nil {
+			log.Printf("ERROR: Cannot write preflight report: %v", err)
+		}
+	}
+	if !report.OK() {
+		fmt.Fprintf(os.Stderr, "Aborting: preflight checks failed:\n%v\n", report)
+		os.Exit(1)
+	}
+	log.Printf("Preflight checks passed:\n%v", report)
+}
+
+// Writes asset graphs of HTML pages as NDJSON file
+func (fs *fileScenario) writeAssetGraphs() error {
+	file, err := common.CreateAtomic(fs.assetsPath)
+	if err != nil {
+		return err
+	}
+	if err := fs.assetGraphs.WriteNDJSON(file); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// Writes link graph as GraphML file and Neo4j import files
+func (fs *fileScenario) writeLinkGraph() error {
+	if fs.graphPath != "" {
+		file, err := common.CreateAtomic(fs.graphPath)
+		if err != nil {
+			return err
+		}
+		if err := fs.linkGraph.WriteGraphML(file); err != nil {
+			file.Abort()
+			return err
+		}
+		if err := file.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if fs.neo4jDir != "" {
+		if err := os.MkdirAll(fs.neo4jDir, os.ModePerm); err != nil {
+			return err
+		}
+		nodes, err := common.CreateAtomic(filepath.Join(fs.neo4jDir, "nodes.csv"))
+		if err != nil {
+			return err
+		}
+		relationships, err := common.CreateAtomic(filepath.Join(fs.neo4jDir, "relationships.csv"))
+		if err != nil {
+			nodes.Abort()
+			return err
+		}
+		if err := fs.linkGraph.WriteNeo4jCSV(nodes, relationships); err != nil {
+			nodes.Abort()
+			relationships.Abort()
+			return err
+		}
+		if err := nodes.Commit(); err != nil {
+			relationships.Abort()
+			return err
+		}
+		return relationships.Commit()
+	}
+	return nil
 }
 
 func init() {
 	fileCMD.Flags().StringVarP(&fileScn.outputDir, "dir", "d", "", "Path to the output directory")
+	fileCMD.Flags().StringVarP(&fileScn.s3Location, "s3", "", "", "Write files with record metadata into S3 bucket, see --s3-* flags. Example: --s3 s3://bucket/prefix")
+	fileCMD.Flags().StringVarP(&fileScn.archivePath, "archive", "", "", "Write files into single .tar.gz, .zip or .wacz archive instead of directory")
+	fileCMD.Flags().StringVarP(&fileScn.warcDir, "warc-dir", "", "", "Write files as records of gzipped WARC files into directory, files are rotated at --warc-size")
+	fileCMD.Flags().StringVarP(&fileScn.warcPrefix, "warc-prefix", "", "gogetcrawl", "Prefix of WARC file names: <prefix>-<timestamp>-<serial>-<hostname>.warc.gz")
+	fileCMD.Flags().Int64VarP(&fileScn.warcSize, "warc-size", "", common.DefaultWarcSize>>20, "Size in MB to rotate WARC files at, 0 to write single file")
+	fileCMD.Flags().StringVarP(&fileScn.signKey, "sign-key", "", "", "Path to Ed25519 private key (PKCS #8 PEM) to sign WACZ package with")
+	fileCMD.Flags().StringVarP(&fileScn.streamFormat, "stdout", "", "", "Write files to stdout to pipe them into other process. Formats: raw, length (length-prefixed), warc. Ex: --stdout=warc")
+	fileCMD.Flags().Lookup("stdout").NoOptDefVal = common.StreamRaw
+	fileCMD.Flags().BoolVarP(&fileScn.isMirror, "mirror", "", false, "Save files in <host>/<path> layout instead of flat directory")
+	fileCMD.Flags().StringVarP(&fileScn.linkDuplicates, "link-duplicates", "", "", "Link files with the same content as already saved ones instead of writing copies: hardlink or reflink (copy-on-write filesystems)")
+	fileCMD.Flags().StringVarP(&fileScn.rewriteLinks, "rewrite-links", "", "", "Rewrite links of HTML pages for offline browsing: local (relative paths, needs --mirror) or replay (Wayback URLs)")
+	fileCMD.Flags().BoolVarP(&fileScn.isMarkdown, "markdown", "", false, "Convert HTML pages into Markdown with headings, links and lists kept, saved with .md extension")
+	fileCMD.Flags().BoolVarP(&fileScn.isRobots, "robots", "", false, "Record robots meta tags and X-Robots-Tag headers (Common Crawl only) of captures in manifest, WACZ pages and storage metadata")
+	fileCMD.Flags().StringVarP(&fileScn.manifestPath, "manifest", "", "", "Write JSON manifest of the harvest (query, sources, indexes, counts and digests of files) to audit or repeat it")
+	fileCMD.Flags().StringVarP(&fileScn.skipDigests, "skip-digests", "", "", "File with digests of already archived content to skip, one per line")
+	fileCMD.Flags().StringVarP(&fileScn.exportDigests, "export-digests", "", "", "Write digests of skipped and saved content into file after the run")
+	fileCMD.Flags().StringVarP(&fileScn.soft404Path, "soft404-report", "", "", "Write captures with 200 status which look like error pages into NDJSON file")
+	fileCMD.Flags().StringArrayVarP(&fileScn.extractFields, "extract", "", nil, "Extract field of HTML captures as name=selector, where selector is CSS (css: prefix is optional, @attr suffix takes attribute) or xpath:expression. Ex: --extract 'price=span.price' --extract 'author=xpath://meta[@name=\"author\"]/@content'")
+	fileCMD.Flags().StringVarP(&fileScn.extractPath, "extract-report", "", "", "Write fields extracted with --extract into NDJSON file, one row per capture")
+	fileCMD.Flags().StringVarP(&duckdbPath, "duckdb", "", "", "Write CDX records with title and text of downloaded captures into DuckDB database file (needs build with -tags duckdb)")
+	fileCMD.Flags().StringVarP(&fileScn.graphPath, "link-graph", "", "", "Write hyperlinks between HTML captures (and pages they link to) as GraphML file")
+	fileCMD.Flags().StringVarP(&fileScn.neo4jDir, "neo4j-dir", "", "", "Write link graph as nodes.csv and relationships.csv for neo4j-admin import into directory")
+	fileCMD.Flags().StringVarP(&fileScn.assetsPath, "asset-graph", "", "", "Write CSS, JS, images, frames and media of HTML captures, resolved to the closest captures of the harvest, into NDJSON file, one page capture per line")
+	fileCMD.Flags().StringVarP(&fileScn.techPath, "tech-timeline", "", "", "Detect frameworks, CMS and libraries of HTML captures and write their timeline per host into JSON file")
+	fileCMD.Flags().StringVarP(&fileScn.jobName, "job", "", "", "Record the run as named job in --job-store with its queries, state and outputs, to list it and run it again with the jobs command")
+	fileCMD.Flags().BoolVarP(&fileScn.isDeterministic, "deterministic", "", false, "Reproducible run: indexes and end date are pinned, results are sorted by time and downloaded one by one with fixed User-Agent, archives and WARC files are stamped with run time. Needs --manifest to be repeated with --replay")
+	fileCMD.Flags().StringVarP(&fileScn.replayPath, "replay", "", "", "Repeat queries of manifest on the same sources and indexes instead of querying URLs of arguments, deterministic harvest is repeated byte-for-byte (modulo upstream availability)")
+	fileCMD.Flags().BoolVarP(&fileScn.isPreflight, "preflight", "", false, "Before the run check that sources answer the first query and serve its sample record, and that outputs are writable. Aborts if any check fails")
+	fileCMD.Flags().StringVarP(&fileScn.preflightPath, "preflight-report", "", "", "Write JSON report of --preflight checks into file")
 	fileCMD.Flags().Float32VarP(&fileScn.downloadRate, "rate", "", 1.0, "Download rate in seconds for each worker (thread). Ex: 5, 1.5")
 	rootCmd.AddCommand(fileCMD)
-	fileCMD.MarkFlagRequired("dir")
+	fileCMD.MarkFlagsMutuallyExclusive("dir", "archive", "warc-dir", "stdout", "s3")
 }
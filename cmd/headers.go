@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type headersScenario struct {
+	outputFile string
+	mu         sync.Mutex
+}
+
+var headersScn = headersScenario{}
+
+var headersCMD = &cobra.Command{
+	Use:   "headers",
+	Short: "Extract archived response headers of captures as NDJSON, without storing bodies",
+	Args:  cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	Run:   headersScn.run,
+}
+
+func (hs *headersScenario) worker(records <-chan *common.CdxResponse, output io.Writer) {
+	for res := range records {
+		if budget.Exhausted() != nil {
+			continue
+		}
+
+		header, err := res.Source.(common.HeaderSource).GetHeaders(res)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			budget.Failure()
+			checkBudget()
+			continue
+		}
+		budget.Success()
+
+		line, _ := jsoniter.Marshal(common.NewCaptureHeaders(res, header))
+		hs.mu.Lock()
+		fmt.Fprintln(output, string(line))
+		hs.mu.Unlock()
+	}
+}
+
+func (hs *headersScenario) run(cmd *cobra.Command, args []string) {
+	var output io.Writer = os.Stdout
+	if hs.outputFile != "" {
+		file, err := os.Create(hs.outputFile)
+		if err != nil {
+			log.Fatalf("Error obtaining output: %v", err)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	configs := getRequestConfigs(args)
+	close(configs)
+	initSources()
+
+	records := make(chan *common.CdxResponse)
+	var wg sync.WaitGroup
+	for i := uint(0); i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hs.worker(records, output)
+		}()
+	}
+
+	for config := range configs {
+		for _, s := range sources {
+			if _, ok := s.(common.HeaderSource); !ok {
+				log.Printf("%v cannot get archived headers, skipping", s.Name())
+				continue
+			}
+
+			pages, err := s.GetPages(config)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				continue
+			}
+			for _, res := range selectRecords(pages) {
+				records <- res
+			}
+		}
+	}
+
+	close(records)
+	wg.Wait()
+	log.Printf("Summary: %v", stats.Summary())
+}
+
+func init() {
+	headersCMD.Flags().StringVarP(&headersScn.outputFile, "output", "o", "", "Path to the output file")
+	rootCmd.AddCommand(headersCMD)
+}
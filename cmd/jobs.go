@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type jobsScenario struct {
+	isJSON bool
+}
+
+var jobsScn = jobsScenario{}
+
+var jobsCMD = &cobra.Command{
+	Use:   "jobs",
+	Short: "List named harvests of job store, recorded by file --job and jobs API of serve",
+	Args:  cobra.NoArgs,
+	Run:   jobsScn.list,
+}
+
+var jobsShowCMD = &cobra.Command{
+	Use:               "show <name>",
+	Short:             "Print named harvest with its queries, state of the last run and outputs as JSON",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeJobNames,
+	Run:               jobsScn.show,
+}
+
+var jobsDeleteCMD = &cobra.Command{
+	Use:               "delete <name>...",
+	Short:             "Delete named harvests from job store, their outputs are kept",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeJobNames,
+	Run:               jobsScn.delete,
+}
+
+var jobsRunCMD = &cobra.Command{
+	Use:               "run <name>",
+	Short:             "Run named harvest again with its recorded command line",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeJobNames,
+	Run:               jobsScn.run,
+}
+
+func (js *jobsScenario) list(cmd *cobra.Command, args []string) {
+	jobs, err := openJobStore().List()
+	if err != nil {
+		log.Fatalf("Cannot list jobs: %v", err)
+	}
+
+	if js.isJSON {
+		data, _ := jsoniter.MarshalIndent(jobs, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tRUNS\tLAST RUN\tSAVED\tQUERIES\tOUTPUTS")
+	for _, job := range jobs {
+		lastRun, saved := "-", "-"
+		if !job.Started.IsZero() {
+			lastRun = job.Started.Local().Format(time.DateTime)
+		}
+		if job.Stats != nil {
+			saved = fmt.Sprint(job.Stats.Records[common.RecordSaved])
+		}
+		urls := []string{}
+		for _, q := range job.Queries {
+			urls = append(urls, q.URL)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", job.Name, job.State, job.Runs, lastRun, saved, strings.Join(urls, ","), strings.Join(job.Outputs, ","))
+	}
+	w.Flush()
+}
+
+func (js *jobsScenario) show(cmd *cobra.Command, args []string) {
+	job := getJob(args[0])
+	data, _ := jsoniter.MarshalIndent(job, "", "  ")
+	fmt.Println(string(data))
+}
+
+func (js *jobsScenario) delete(cmd *cobra.Command, args []string) {
+	store := openJobStore()
+	failed := false
+	for _, name := range args {
+		if err := store.Delete(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot delete job: %v\n", err)
+			failed = true
+			continue
+		}
+		log.Printf("Job '%v' deleted", name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Runs recorded command line of the job with this binary, so it is recorded as next run of the job
+func (js *jobsScenario) run(cmd *cobra.Command, args []string) {
+	job := getJob(args[0])
+	if len(job.Args) == 0 {
+		fmt.Fprintf(os.Stderr, "Job '%v' has no command line to run, it was not recorded by file --job\n", job.Name)
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Cannot find gogetcrawl executable: %v", err)
+	}
+	log.Printf("Running job '%v': gogetcrawl %v", job.Name, strings.Join(job.Args, " "))
+
+	run := exec.Command(executable, job.Args...)
+	run.Dir, run.Stdin, run.Stdout, run.Stderr = job.Dir, os.Stdin, os.Stdout, os.Stderr
+	if err := run.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		log.Fatalf("Cannot run job '%v': %v", job.Name, err)
+	}
+}
+
+// Job of the store by name, exits if there is none
+func getJob(name string) common.StoredJob {
+	job, err := openJobStore().Get(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot get job: %v\n", err)
+		os.Exit(1)
+	}
+	return job
+}
+
+// Completes names of jobs in the store
+func completeJobNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store, err := common.NewFileJobStore(jobStorePath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	jobs, err := store.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	names := []string{}
+	for _, job := range jobs {
+		names = append(names, job.Name+"\t"+job.State)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	jobsCMD.Flags().BoolVarP(&jobsScn.isJSON, "json", "", false, "Print jobs as JSON array")
+	jobsCMD.AddCommand(jobsShowCMD, jobsDeleteCMD, jobsRunCMD)
+	rootCmd.AddCommand(jobsCMD)
+}
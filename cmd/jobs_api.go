@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+)
+
+// Body of job creation request
+type jobRequest struct {
+	Name     string            `json:"name"` // Run of named harvest kept in job store (optional)
+	URL      string            `json:"url"`
+	Filters  []string          `json:"filters"`
+	Limit    uint              `json:"limit"`
+	Collapse bool              `json:"collapse"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Tags     map[string]string `json:"tags"`
+	Sources  []string          `json:"sources"` // Short names as in --sources, all served sources if empty
+}
+
+// jobsAPI exposes job queue over REST:
+//
+//	GET /jobs, POST /jobs, GET /jobs/<id>, POST /jobs/<id>/pause|resume|cancel
+type jobsAPI struct {
+	queue   *common.JobQueue
+	sources map[string]common.Source
+}
+
+// harvestsAPI exposes named harvests of job store over REST:
+//
+//	GET /harvests, GET /harvests/<name>, DELETE /harvests/<name>
+type harvestsAPI struct {
+	store common.JobStore
+}
+
+// Runs harvest of the job into its own directory, runs of named jobs are recorded in the store
+func newJobRunner(dir string, sources []common.Source, indexLimiter, storageLimiter *common.RateLimiter, politeness *common.Politeness, cooldowns *common.CooldownStore, events *common.EventLog, store common.JobStore) common.JobRunner {
+	return func(job common.Job, config common.RequestConfig) error {
+		config.IndexLimiter, config.StorageLimiter, config.Politeness = indexLimiter, storageLimiter, politeness
+		config.Cooldowns, config.Events = cooldowns, events
+		// Not kept by the job query, as limits of the response size belong to the server
+		config.MaxPageBytes = maxPageSize << 20
+
+		output := filepath.Join(dir, job.ID)
+		if job.Name != "" {
+			stored := common.StoredJob{Name: job.Name, JobID: job.ID, Queries: []common.ManifestQuery{job.Query}, Outputs: []string{output}}
+			if err := common.RecordJobStart(store, stored); err != nil {
+				log.Printf("ERROR: Cannot record job '%v': %v", job.Name, err)
+			}
+		}
+
+		d := &common.Downloader{Output: common.NewStorageOutput(common.NewDiskStorage(output)), Checkpoint: job.Checkpoint}
+		plan := job.Query.Plan(sources)
+		plan.Config = config
+		_, err := d.HarvestPlan(plan)
+
+		if job.Name != "" {
+			if recordErr := common.RecordJobFinish(store, job.Name, config.Stats, err); recordErr != nil {
+				log.Printf("ERROR: Cannot record job '%v': %v", job.Name, recordErr)
+			}
+		}
+		return err
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := jsoniter.Marshal(v)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (api *jobsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/"), "/")
+
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, api.queue.List())
+	case parts[0] == "" && r.Method == http.MethodPost:
+		api.create(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		job, ok := api.queue.Get(parts[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("No job '%v'", parts[0]))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		api.control(w, parts[0], parts[1])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown endpoint %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (api *jobsAPI) create(w http.ResponseWriter, r *http.Request) {
+	req := jobRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Cannot decode job: %w", err))
+		return
+	}
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Job needs url"))
+		return
+	}
+	if req.Name != "" {
+		if err := common.ValidJobName(req.Name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	config := common.RequestConfig{URL: req.URL, Filters: req.Filters, Limit: req.Limit, Tags: req.Tags}
+	if req.Collapse {
+		config.CollapseColumn = "urlkey"
+	}
+	if err := config.SetDates(req.From, req.To); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	jobSources := []common.Source{}
+	for _, name := range req.Sources {
+		source, ok := api.sources[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Unknown source '%v'", name))
+			return
+		}
+		jobSources = append(jobSources, source)
+	}
+	if len(jobSources) == 0 {
+		jobSources = sources
+	}
+
+	job := api.queue.AddNamed(req.Name, config, jobSources)
+	log.Printf("Job %v queued: %v", job.ID, job.Query.URL)
+	writeJSON(w, http.StatusCreated, job)
+}
+
+func (api *jobsAPI) control(w http.ResponseWriter, id, action string) {
+	var err error
+	switch action {
+	case "pause":
+		err = api.queue.Pause(id)
+	case "resume":
+		err = api.queue.Resume(id)
+	case "cancel":
+		err = api.queue.Cancel(id)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown action '%v'", action))
+		return
+	}
+
+	if _, ok := api.queue.Get(id); !ok {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	job, _ := api.queue.Get(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (api *harvestsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/harvests"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		jobs, err := api.store.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	case name != "" && r.Method == http.MethodGet:
+		job, err := api.store.Get(name)
+		if err != nil {
+			writeError(w, storeStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case name != "" && r.Method == http.MethodDelete:
+		if err := api.store.Delete(name); err != nil {
+			writeError(w, storeStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown endpoint %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func storeStatus(err error) int {
+	if stderrors.Is(err, common.ErrJobNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
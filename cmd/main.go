@@ -6,6 +6,7 @@ import (
 	"log"
 	"mime"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,8 +30,43 @@ var (
 	maxRetries     int
 	maxResults     uint
 	maxWorkers     uint
+	maxErrors      int
+	maxErrorRate   float64
+	politenessFile string
+	cooldownFile   string
+	eventsFile     string
+	events         *common.EventLog
+	fileCacheDir   string
+	fileCacheSize  int64
+	partitionSpec  string
+	sortOrder      string
+	closestDate    string
+	crawlDate      string
+	crawlIndexes   []string
+	indexRate      float64
+	sourceRates    []string
+	queryCacheTTL  time.Duration
+	isLogSources   bool
+	tagPairs       []string
+	resumeToken    string
+	allowHosts     []string
+	denyHosts      []string
+	allowFile      string
+	denyFile       string
+	scope          *common.HostScope
+	whereExpr      string
+	where          *common.RecordExpr
+	storageRate    float64
+	wbPageSize     int
+	indexProxy     string
+	maxPageSize    int64
+	jobStorePath   string
+	jsonLibrary    string
+	isStrict       bool
 	extensions     []string
 	sourceNames    []string
+	languages      []string
+	charsets       []string
 )
 
 var rootCmd = &cobra.Command{
@@ -44,11 +80,29 @@ You can use different filters and arguments to solve your task more effectively.
 
 var (
 	sources []common.Source
-	results = make(chan []*common.CdxResponse)
-	errors  = make(chan error)
+	// Sources by their short name, as in --sources
+	sourcesByFlag = map[string]common.Source{}
+	budget        *common.ErrorBudget
+	stats         = common.NewStats()
+	results       = make(chan []*common.CdxResponse)
+	errors        = make(chan error)
 )
 
+// Stop the whole pipeline if error budget is spent
+func checkBudget() {
+	if err := budget.Exhausted(); err != nil {
+		fmt.Fprintf(os.Stderr, "Aborting: %v\n", err)
+		fileScn.recordJobFinish(err)
+		os.Exit(1)
+	}
+}
+
 func initSources() {
+	decoding := common.CdxDecoding{Library: jsonLibrary, Strict: isStrict}
+	if err := decoding.Validate(); err != nil {
+		log.Fatalf("Please check `--json-lib`: %v", err)
+	}
+
 	for _, s := range sourceNames {
 		if s == "cc" {
 			log.Println("Initializing CommonCrawl")
@@ -56,7 +110,16 @@ func initSources() {
 			if err != nil {
 				log.Fatalf("Cannot initialize CommonCrawl source: %v", err)
 			}
-			sources = append(sources, cc)
+			cc.Decoding = decoding
+			if indexProxy != "" {
+				cc.IndexServer = strings.TrimSuffix(indexProxy, "/") + "/cc/"
+			}
+			if isCCS3 {
+				cc.S3 = newCCS3Client()
+			}
+			source := wrapSource(s, cc)
+			sources = append(sources, source)
+			sourcesByFlag[s] = source
 		}
 
 		if s == "wb" {
@@ -65,7 +128,14 @@ func initSources() {
 			if err != nil {
 				log.Fatalf("Cannot initialize Wayback source: %v", err)
 			}
-			sources = append(sources, wb)
+			wb.PageSize = wbPageSize
+			wb.Decoding = decoding
+			if indexProxy != "" {
+				wb.IndexServer = strings.TrimSuffix(indexProxy, "/") + "/wb/"
+			}
+			source := wrapSource(s, wb)
+			sources = append(sources, source)
+			sourcesByFlag[s] = source
 		}
 	}
 
@@ -74,10 +144,64 @@ func initSources() {
 	}
 }
 
+// Layers middlewares of --log-sources, --query-cache-ttl and --source-rate over the source
+func wrapSource(name string, source common.Source) common.Source {
+	rates, err := common.ParseTags(sourceRates)
+	if err != nil {
+		log.Fatalf("Please check `--source-rate`: %v", err)
+	}
+
+	middlewares := []common.SourceMiddleware{}
+	if isLogSources {
+		middlewares = append(middlewares, &common.LoggingSource{})
+	}
+	if queryCacheTTL > 0 {
+		middlewares = append(middlewares, &common.CachedSource{TTL: queryCacheTTL})
+	}
+	if rate, ok := rates[name]; ok {
+		rps, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			log.Fatalf("Please check `--source-rate` of '%v': %v", name, err)
+		}
+		middlewares = append(middlewares, &common.RateLimitedSource{Queries: common.NewRateLimiter(rps)})
+	}
+	return common.WrapSource(source, middlewares...)
+}
+
 // Prepare archive request configs
 func getRequestConfigs(args []string) chan common.RequestConfig {
+	return requestConfigs(baseRequestConfig(), args)
+}
+
+// Request configs of the domains, one job each.
+// Resume token continues only the query it was made by, so other domains start over.
+func requestConfigs(base common.RequestConfig, args []string) chan common.RequestConfig {
+	if base.Resume != nil && base.Resume.URL != "" {
+		found := false
+		for _, domain := range args {
+			found = found || domain == base.Resume.URL
+		}
+		if !found {
+			log.Fatalf("Please check `--resume` token: it continues query of '%v', which is not in arguments", base.Resume.URL)
+		}
+	}
+
 	confChan := make(chan common.RequestConfig, len(args))
+	for _, domain := range args {
+		config := base
+		config.URL, config.JobID = domain, common.NewJobID()
+		if config.CheckResume() != nil {
+			config.Resume = nil
+		}
+		log.Printf("Job %v: %v", config.JobID, domain)
+		confChan <- config
+	}
+	return confChan
+}
 
+// Config of flags shared by all jobs, limiters are shared too so rates are kept across workers.
+// Must be called once, as filters of flags are added to the --filter ones.
+func baseRequestConfig() common.RequestConfig {
 	if len(extensions) != 0 {
 		for _, ext := range extensions {
 			extRaw := mime.TypeByExtension("." + ext)
@@ -96,38 +220,99 @@ func getRequestConfigs(args []string) chan common.RequestConfig {
 	}
 
 	var err error
-	var fromDate, toDate time.Time
-
-	if fromDateFilter != "" {
-		if fromDate, err = time.Parse("20060102", fromDateFilter); err != nil {
-			log.Fatalf("Please check `--from` filter date: '%v', %v", fromDateFilter, err)
+	dates := common.RequestConfig{}
+	if err = dates.SetDates(fromDateFilter, toDateFilter); err != nil {
+		log.Fatalf("Please check `--from` and `--to` filter dates: %v", err)
+	}
+	if err = dates.SetSort(sortOrder, closestDate); err != nil {
+		log.Fatalf("Please check `--sort` and `--closest`: %v", err)
+	}
+	if crawlDate != "" && len(crawlIndexes) > 0 {
+		log.Fatalf("Please check `--crawl`: cannot be used with `--crawl-date`")
+	}
+	if crawlDate != "" {
+		from, to, err := common.ParsePeriod(crawlDate)
+		if err != nil {
+			log.Fatalf("Please check `--crawl-date`: %v", err)
 		}
+		// Month or year stands for a period, so crawl closest to its middle is taken
+		dates.IndexDate = from.Add(to.Sub(from) / 2)
 	}
 
-	if toDateFilter != "" {
-		if toDate, err = time.Parse("20060102", toDateFilter); err != nil {
-			log.Fatalf("Please check `--to` filter date: '%v', %v", toDateFilter, err)
+	tags, err := common.ParseTags(tagPairs)
+	if err != nil {
+		log.Fatalf("Please check `--tag` values: %v", err)
+	}
+
+	// Limiters are shared by all jobs, so rates are kept across workers
+	indexLimiter := common.NewRateLimiter(indexRate)
+	storageLimiter := common.NewRateLimiter(storageRate)
+
+	var resume *common.ResumeToken
+	if resumeToken != "" {
+		// Token is taken from the last complete batch of NDJSON output file
+		if info, statErr := os.Stat(resumeToken); statErr == nil && info.Mode().IsRegular() {
+			resume, err = common.ResumeFromNDJSON(resumeToken)
+		} else {
+			resume, err = common.ParseResumeToken(resumeToken)
+		}
+		if err != nil {
+			log.Fatalf("Please check `--resume` token: %v", err)
 		}
 	}
 
-	for _, domain := range args {
-		config := common.RequestConfig{
-			URL:      domain,
-			Filters:  filters,
-			Limit:    maxResults,
-			FromDate: fromDate,
-			ToDate:   toDate,
+	var politeness *common.Politeness
+	if politenessFile != "" {
+		if politeness, err = common.LoadPoliteness(politenessFile); err != nil {
+			log.Fatalf("Please check `--politeness` file: %v", err)
 		}
+	}
+	cooldowns := loadCooldowns(cooldownFile)
 
-		if isCollapse {
-			config.CollapseColumn = "urlkey"
+	var fileCache *common.FileCache
+	if fileCacheDir != "" {
+		if fileCache, err = common.NewFileCache(fileCacheDir, fileCacheSize<<20); err != nil {
+			log.Fatalf("Please check `--file-cache`: %v", err)
 		}
-		confChan <- config
 	}
-	return confChan
+
+	partition, err := common.ParsePartition(partitionSpec)
+	if err != nil {
+		log.Fatalf("Please check `--partition`: %v", err)
+	}
+
+	config := common.RequestConfig{
+		Filters:    filters,
+		Limit:      maxResults,
+		FromDate:   dates.FromDate,
+		ToDate:     dates.ToDate,
+		Stats:      stats,
+		Politeness: politeness,
+		Cooldowns:  cooldowns,
+		Partition:  partition,
+		Sort:       dates.Sort,
+		Closest:    dates.Closest,
+		IndexDate:  dates.IndexDate,
+		Indexes:    crawlIndexes,
+		FileCache:  fileCache,
+		Events:     events,
+
+		IndexLimiter:   indexLimiter,
+		StorageLimiter: storageLimiter,
+		Tags:           tags,
+		Resume:         resume,
+		Languages:      languages,
+		Charsets:       charsets,
+		MaxPageBytes:   maxPageSize << 20,
+	}
+	if isCollapse {
+		config.CollapseColumn = "urlkey"
+	}
+	return config
 }
 
 func Execute() {
+	registerCompletions()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "There was an error while executing CLI: '%s'", err)
 		os.Exit(1)
@@ -147,11 +332,81 @@ func initArgs() {
 	}
 
 	if isVerbose {
-		writers = append(writers, os.Stdout)
+		// Keep stdout clean when files are streamed into it
+		if fileScn.streamFormat != "" {
+			writers = append(writers, os.Stderr)
+		} else {
+			writers = append(writers, os.Stdout)
+		}
 	}
 
 	multi := io.MultiWriter(writers...)
 	log.SetOutput(multi)
+
+	initScope()
+
+	if maxErrors > 0 || maxErrorRate > 0 {
+		budget = common.NewErrorBudget(maxErrors, maxErrorRate)
+	}
+
+	if eventsFile != "" {
+		file, err := os.OpenFile(eventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o666)
+		if err != nil {
+			log.Fatalf("Please check `--events`: %v", err)
+		}
+		events = common.NewEventLog(file)
+	}
+}
+
+// Store of named harvests, shared by `jobs`, `file --job` and `serve`
+func openJobStore() *common.FileJobStore {
+	store, err := common.NewFileJobStore(jobStorePath)
+	if err != nil {
+		log.Fatalf("Please check `--job-store`: %v", err)
+	}
+	return store
+}
+
+// Cooldowns of throttling hosts are kept only if file to persist them is set
+func loadCooldowns(path string) *common.CooldownStore {
+	if path == "" {
+		return nil
+	}
+	cooldowns, err := common.NewCooldownStore(path)
+	if err != nil {
+		log.Fatalf("Please check `--cooldown-file`: %v", err)
+	}
+	return cooldowns
+}
+
+// Merge host rules from flags and files into single scope
+func initScope() {
+	for _, list := range []struct {
+		path  string
+		rules *[]string
+	}{{allowFile, &allowHosts}, {denyFile, &denyHosts}} {
+		if list.path == "" {
+			continue
+		}
+		rules, err := common.LoadHostRules(list.path)
+		if err != nil {
+			log.Fatalf("Please check host rules file: %v", err)
+		}
+		*list.rules = append(*list.rules, rules...)
+	}
+
+	var err error
+	if scope, err = common.NewHostScope(allowHosts, denyHosts); err != nil {
+		log.Fatalf("Please check `--allow` and `--deny` rules: %v", err)
+	}
+	if where, err = common.ParseExpr(whereExpr); err != nil {
+		log.Fatalf("Please check `--where` expression: %v", err)
+	}
+}
+
+// Keeps records which are in scope and match --where expression
+func selectRecords(records []*common.CdxResponse) []*common.CdxResponse {
+	return where.Filter(scope.Filter(records, stats), stats)
 }
 
 func init() {
@@ -164,10 +419,51 @@ func init() {
 	rootCmd.PersistentFlags().UintVarP(&maxResults, "limit", "l", 0, `Max number of results to fetch."`)
 	rootCmd.PersistentFlags().UintVarP(&maxWorkers, "workers", "w", 4, `Max number of workers (threads) to use. URL consumes 1 worker"`)
 	rootCmd.PersistentFlags().StringSliceVarP(&extensions, "ext", "e", []string{}, `Which extensions to collect. Example: --ext "pdf,xml,jpeg"`)
+	rootCmd.PersistentFlags().StringSliceVarP(&languages, "lang", "", []string{}, `Keep only Common Crawl records with any of these content languages (ISO-639-3). Example: --lang "fra,deu"`)
+	rootCmd.PersistentFlags().StringSliceVarP(&charsets, "charset", "", []string{}, `Keep only Common Crawl records with any of these charsets, aliases are matched too (latin1 = windows-1252). Example: --charset utf-8`)
 	rootCmd.PersistentFlags().StringSliceVarP(&sourceNames, "sources", "s", []string{"wb", "cc"}, `Web archive sources to use. Example: --sources "wb" to use only the Wayback`)
 	rootCmd.PersistentFlags().BoolVarP(&isVerbose, "verbose", "v", false, `Use verbose output.`)
 	rootCmd.PersistentFlags().BoolVarP(&isLogging, "log", "", false, `Print logs to ./logs.txt.`)
-	rootCmd.PersistentFlags().StringVarP(&fromDateFilter, "from", "", "", "Filter from date, example: --from 20200131 (filter from 31 Jan 2020)")
-	rootCmd.PersistentFlags().StringVarP(&toDateFilter, "to", "", "", "Filter to date, example: --to 20230401 (filter to 1 Apr 2023)")
+	rootCmd.PersistentFlags().StringVarP(&fromDateFilter, "from", "", "", "Filter from date (UTC), example: --from 20200131, --from 2020-01-31T10:00:00+02:00 or --from -30d (last 30 days)")
+	rootCmd.PersistentFlags().StringVarP(&toDateFilter, "to", "", "", "Filter to date (UTC), example: --to 20230401, --to 2023-04-01 or --to -1w (until a week ago)")
+	rootCmd.PersistentFlags().IntVarP(&maxErrors, "max-errors", "", 0, "Abort after N consecutive failures, 0 to disable")
+	rootCmd.PersistentFlags().Float64VarP(&maxErrorRate, "max-error-rate", "", 0, "Abort when failure rate exceeds given fraction, example: --max-error-rate 0.5")
+	rootCmd.PersistentFlags().Float64VarP(&indexRate, "index-rate", "", 0, "Max index server queries per second for all workers, 0 to disable. Example: --index-rate 0.5")
+	rootCmd.PersistentFlags().Float64VarP(&storageRate, "storage-rate", "", 0, "Max file downloads per second from archive storage for all workers, 0 to disable. Example: --storage-rate 5")
+	rootCmd.PersistentFlags().StringSliceVarP(&sourceRates, "source-rate", "", []string{}, "Max index queries per second of single source, on top of --index-rate. Example: --source-rate wb=0.2 --source-rate cc=1")
+	rootCmd.PersistentFlags().DurationVarP(&queryCacheTTL, "query-cache-ttl", "", 0, "Keep index query results in memory for the duration, so jobs repeating a query do not send it again, 0 to disable. Example: --query-cache-ttl 1h")
+	rootCmd.PersistentFlags().BoolVarP(&isLogSources, "log-sources", "", false, "Log each index query and download of sources with its outcome and duration")
+	rootCmd.PersistentFlags().BoolVarP(&isCCS3, "cc-s3", "", false, "Read Common Crawl files from s3://commoncrawl with signed requests (AWS_* credentials, --s3-role) instead of HTTPS, faster inside AWS")
+	rootCmd.PersistentFlags().StringVarP(&s3Region, "s3-region", "", "", "Region of S3 output bucket or store, us-east-1 if not set")
+	rootCmd.PersistentFlags().StringVarP(&s3Endpoint, "s3-endpoint", "", "", "Endpoint of S3 compatible store, like MinIO, buckets are addressed by path. Example: --s3-endpoint https://minio.local:9000")
+	rootCmd.PersistentFlags().BoolVarP(&s3PathStyle, "s3-path-style", "", false, "Address AWS buckets by path instead of host")
+	rootCmd.PersistentFlags().StringVarP(&s3Role, "s3-role", "", "", "ARN of IAM role to assume with AWS_* credentials, its temporary credentials sign S3 requests")
+	rootCmd.PersistentFlags().StringVarP(&s3ExternalID, "s3-external-id", "", "", "External ID required to assume --s3-role")
+	rootCmd.PersistentFlags().BoolVarP(&s3RequesterPays, "s3-requester-pays", "", false, "Accept charges of requester-pays buckets")
+	rootCmd.PersistentFlags().BoolVarP(&s3StrictTLS, "s3-strict-tls", "", false, "Require HTTPS S3 endpoints (and redirects) with TLS 1.2 or later")
+	rootCmd.PersistentFlags().StringVarP(&s3CAFile, "s3-ca-file", "", "", "PEM bundle of CAs to trust for S3 endpoints, for on-prem stores with private CA")
+	rootCmd.PersistentFlags().IntVarP(&wbPageSize, "wb-page-size", "", 0, "Index blocks per page of Wayback pagination API, lower it if pages of huge domains time out. 0 for server default (50)")
+	rootCmd.PersistentFlags().StringVarP(&indexProxy, "index-proxy", "", "", "URL of serve command caching proxy to send index queries through, so workers and jobs of several runs share cached responses. Example: --index-proxy http://localhost:8080")
+	rootCmd.PersistentFlags().Int64VarP(&maxPageSize, "max-page-size", "", 0, "Max size in MB of index response page, larger pages fail instead of filling memory (like huge wildcard queries), 0 to disable. Lower --wb-page-size to split them")
+	rootCmd.PersistentFlags().StringVarP(&jobStorePath, "job-store", "", common.DefaultJobStorePath(), "JSON file keeping named harvests (file --job, jobs API of serve), listed by the jobs command")
+	rootCmd.PersistentFlags().StringVarP(&jsonLibrary, "json-lib", "", common.JSONIter, "JSON library to decode index responses with: jsoniter or std (encoding/json)")
+	rootCmd.PersistentFlags().BoolVarP(&isStrict, "strict", "", false, "Fail on unknown or renamed fields of index responses instead of ignoring them, to notice archive schema changes")
+	rootCmd.PersistentFlags().StringArrayVarP(&tagPairs, "tag", "", []string{}, `Labels to attach to the query and its outputs. Example: --tag case=2023-17 --tag project=audit`)
+	rootCmd.PersistentFlags().StringArrayVarP(&allowHosts, "allow", "", []string{}, `Keep only records of these hosts: exact host, "*.example.com" with subdomains or "~regexp". Example: --allow "*.example.com"`)
+	rootCmd.PersistentFlags().StringArrayVarP(&denyHosts, "deny", "", []string{}, `Exclude records of these hosts, same syntax as --allow. Example: --deny "*.doubleclick.net" --deny "~^cdn[0-9]*\."`)
+	rootCmd.PersistentFlags().StringVarP(&whereExpr, "where", "", "", `Keep only records matching expression over record fields, evaluated locally. Example: --where 'status == 200 && mime =~ "text/html" && length > 1024'`)
+	rootCmd.PersistentFlags().StringVarP(&allowFile, "allow-file", "", "", "File with --allow rules, one per line")
+	rootCmd.PersistentFlags().StringVarP(&denyFile, "deny-file", "", "", "File with --deny rules, one per line")
+	rootCmd.PersistentFlags().StringVarP(&resumeToken, "resume", "", "", `Continue query from "resume" token of the last NDJSON record written, or from NDJSON output file, whose partial last batch is dropped. Applies to the source which made it`)
+	rootCmd.PersistentFlags().StringVarP(&politenessFile, "politeness", "", "", `JSON file with access limits per archive endpoint. Example: {"web.archive.org": {"max_rps": 1, "concurrency": 2, "active_hours": "22:00-06:00"}}`)
+	rootCmd.PersistentFlags().StringVarP(&eventsFile, "events", "", "", "Append lifecycle events (job started, index resolved, page fetched, record downloaded or failed, job finished) as NDJSON to the file")
+	rootCmd.PersistentFlags().StringVarP(&fileCacheDir, "file-cache", "", "", "Directory to cache downloaded files in, so repeated runs over the same captures do not download them again")
+	rootCmd.PersistentFlags().Int64VarP(&fileCacheSize, "file-cache-size", "", common.DefaultFileCacheSize>>20, "Size in MB of file cache, least recently used files are evicted over it")
+	rootCmd.PersistentFlags().StringVarP(&cooldownFile, "cooldown-file", "", "", "File to keep hosts cooling down after 429/503 responses in (for Retry-After or a minute), so restarted runs wait instead of re-triggering a ban")
+	rootCmd.PersistentFlags().StringVarP(&partitionSpec, "partition", "", "", "Run only slice of the harvest as [mode:]slice/count, so several machines share it. Modes: page (index pages, default), index (crawls), surt (hosts). Example: --partition surt:0/4")
+	rootCmd.PersistentFlags().StringVarP(&sortOrder, "sort", "", "", "Order of results: asc, desc (newest first) or closest (to --closest date). Common Crawl sorts pages on the server, other results are sorted locally")
+	rootCmd.PersistentFlags().StringVarP(&crawlDate, "crawl-date", "", "", "Query only the Common Crawl crawl containing (or closest to) the date, same formats as --from. Example: --crawl-date 201903")
+	rootCmd.PersistentFlags().StringSliceVarP(&crawlIndexes, "crawl", "", []string{}, "Query only these Common Crawl crawls by ID, completed from collinfo.json by shell completions. Example: --crawl CC-MAIN-2023-14")
+	rootCmd.PersistentFlags().StringVarP(&closestDate, "closest", "", "", "Date to sort results around with --sort closest, same formats as --from. Example: --closest 20200615")
 	// TODOrootCmd.PersistentFlags().BoolVarP(&isDisablePagination, "disable-pagination", "", "", "")
 }
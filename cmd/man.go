@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type manScenario struct {
+	section string
+}
+
+var manScn = manScenario{}
+
+var manCMD = &cobra.Command{
+	Use:   "man <dir>",
+	Short: "Generate man pages of gogetcrawl and its commands into directory",
+	Long: `Generate roff man pages from command definitions, one per command, like gogetcrawl-file.1.
+Install them with: gogetcrawl man /usr/local/share/man/man1`,
+	Args: cobra.ExactArgs(1),
+	Run:  manScn.run,
+}
+
+func (ms *manScenario) run(cmd *cobra.Command, args []string) {
+	dir := args[0]
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Fatalf("Please check man pages directory: %v", err)
+	}
+
+	pages, err := ms.writePages(rootCmd, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write man pages: %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Written %v man pages into %v", pages, dir)
+}
+
+// Writes page of the command and its subcommands, returns number of pages written
+func (ms *manScenario) writePages(cmd *cobra.Command, dir string) (int, error) {
+	pages := 0
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		n, err := ms.writePages(sub, dir)
+		if err != nil {
+			return pages, err
+		}
+		pages += n
+	}
+
+	path := filepath.Join(dir, ms.pageName(cmd)+"."+ms.section)
+	if err := os.WriteFile(path, ms.page(cmd), 0o644); err != nil {
+		return pages, fmt.Errorf("[writePages] %w", err)
+	}
+	return pages + 1, nil
+}
+
+// Page of "gogetcrawl file" is gogetcrawl-file
+func (ms *manScenario) pageName(cmd *cobra.Command) string {
+	return strings.ReplaceAll(cmd.CommandPath(), " ", "-")
+}
+
+// Roff page of the command, without date so pages of the same version are identical
+func (ms *manScenario) page(cmd *cobra.Command) []byte {
+	buf := &bytes.Buffer{}
+	name := ms.pageName(cmd)
+
+	fmt.Fprintf(buf, ".TH %q %q \"\" %q %q\n", strings.ToUpper(name), ms.section, "gogetcrawl "+version, "gogetcrawl manual")
+	fmt.Fprintf(buf, ".SH NAME\n%v \\- %v\n", roffEscape(name), roffEscape(cmd.Short))
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n\\fB%v\\fP\n", roffEscape(cmd.UseLine()))
+
+	description := cmd.Long
+	if description == "" {
+		description = cmd.Short
+	}
+	fmt.Fprintf(buf, ".SH DESCRIPTION\n%v\n", roffText(description))
+
+	if len(cmd.Aliases) > 0 {
+		fmt.Fprintf(buf, ".SH ALIASES\n%v\n", roffEscape(strings.Join(cmd.Aliases, ", ")))
+	}
+	if cmd.Example != "" {
+		fmt.Fprintf(buf, ".SH EXAMPLES\n.nf\n%v\n.fi\n", roffEscape(cmd.Example))
+	}
+
+	roffFlags(buf, "OPTIONS", cmd.NonInheritedFlags())
+	roffFlags(buf, "OPTIONS INHERITED FROM PARENT COMMANDS", cmd.InheritedFlags())
+
+	seeAlso := []string{}
+	if cmd.HasParent() {
+		seeAlso = append(seeAlso, ms.pageName(cmd.Parent()))
+	}
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() && !sub.IsAdditionalHelpTopicCommand() {
+			seeAlso = append(seeAlso, ms.pageName(sub))
+		}
+	}
+	if len(seeAlso) > 0 {
+		refs := []string{}
+		for _, ref := range seeAlso {
+			refs = append(refs, fmt.Sprintf("\\fB%v\\fP(%v)", roffEscape(ref), ms.section))
+		}
+		fmt.Fprintf(buf, ".SH SEE ALSO\n%v\n", strings.Join(refs, ", "))
+	}
+	return buf.Bytes()
+}
+
+// Writes section with flags of the set, nothing if it has none
+func roffFlags(buf *bytes.Buffer, title string, flags *pflag.FlagSet) {
+	if !flags.HasAvailableFlags() {
+		return
+	}
+	fmt.Fprintf(buf, ".SH %v\n", title)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden || flag.Deprecated != "" {
+			return
+		}
+		names := fmt.Sprintf("\\fB\\-\\-%v\\fP", roffEscape(flag.Name))
+		if flag.Shorthand != "" && flag.ShorthandDeprecated == "" {
+			names = fmt.Sprintf("\\fB\\-%v\\fP, %v", roffEscape(flag.Shorthand), names)
+		}
+		switch flag.Value.Type() {
+		case "bool":
+		case "string":
+			names += "=" + roffEscape(fmt.Sprintf("%q", flag.DefValue))
+		default:
+			names += "=" + roffEscape(flag.DefValue)
+		}
+		fmt.Fprintf(buf, ".TP\n%v\n%v\n", names, roffText(flag.Usage))
+	})
+}
+
+// Escapes text for roff, so dashes, backslashes and control characters at line start are printed as is
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Escapes paragraphs of text, blank lines separate them
+func roffText(s string) string {
+	s = roffEscape(strings.TrimSpace(s))
+	return strings.ReplaceAll(s, "\n\n", "\n.PP\n")
+}
+
+func init() {
+	manCMD.Flags().StringVarP(&manScn.section, "section", "", "1", "Manual section of pages, used in their file names")
+	rootCmd.AddCommand(manCMD)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type planScenario struct {
+	isJSON bool
+}
+
+var planScn = planScenario{}
+
+var planCMD = &cobra.Command{
+	Use:   "plan",
+	Short: "Preview which indexes will be queried for desired domains and estimated cost",
+	Args:  cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	Run:   planScn.run,
+}
+
+func (ps *planScenario) run(cmd *cobra.Command, args []string) {
+	configs := getRequestConfigs(args)
+	close(configs)
+	initSources()
+
+	for config := range configs {
+		plan, err := common.NewPlan(sources, config)
+		if err != nil {
+			log.Fatalf("Cannot make plan: %v", err)
+		}
+
+		if ps.isJSON {
+			out, _ := jsoniter.Marshal(plan)
+			fmt.Println(string(out))
+		} else {
+			fmt.Print(plan)
+		}
+	}
+}
+
+func init() {
+	planCMD.Flags().BoolVarP(&planScn.isJSON, "json", "", false, "Output plan as JSON")
+	rootCmd.AddCommand(planCMD)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"log"
+	"sync"
+
+	"github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/render"
+	"github.com/spf13/cobra"
+)
+
+type renderScenario struct {
+	outputDir     string
+	format        string
+	renderTimeout int
+}
+
+var renderScn = renderScenario{}
+
+var renderCMD = &cobra.Command{
+	Use:   "render",
+	Short: "Make PNG or PDF screenshots of captures with headless Chrome, Wayback captures are replayed with their assets",
+	Args:  cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	Run:   renderScn.run,
+}
+
+func (rs *renderScenario) worker(renderer *render.Renderer, records <-chan *common.CdxResponse, output common.Output) {
+	for res := range records {
+		if budget.Exhausted() != nil {
+			continue
+		}
+
+		if err := renderer.Save(res, output); err != nil {
+			log.Printf("ERROR: %v", err)
+			stats.AddRecords(common.RecordFailed, 1)
+			budget.Failure()
+			checkBudget()
+			continue
+		}
+		stats.AddRecords(common.RecordSaved, 1)
+		budget.Success()
+		log.Printf("Rendered %v %v", res.Original, res.Timestamp)
+	}
+}
+
+func (rs *renderScenario) run(cmd *cobra.Command, args []string) {
+	renderer, err := render.New(rs.format, rs.renderTimeout)
+	if err != nil {
+		log.Fatalf("Please check `--format` or Chrome installation: %v", err)
+	}
+	defer renderer.Close()
+	output := common.NewDirOutput(rs.outputDir)
+
+	configs := getRequestConfigs(args)
+	close(configs)
+	initSources()
+
+	records := make(chan *common.CdxResponse)
+	var wg sync.WaitGroup
+	for i := uint(0); i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs.worker(renderer, records, output)
+		}()
+	}
+
+	for config := range configs {
+		for _, s := range sources {
+			pages, err := s.GetPages(config)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				budget.Failure()
+				checkBudget()
+				continue
+			}
+			for _, res := range selectRecords(pages) {
+				records <- res
+			}
+		}
+	}
+
+	close(records)
+	wg.Wait()
+	log.Printf("Summary: %v", stats.Summary())
+}
+
+func init() {
+	renderCMD.Flags().StringVarP(&renderScn.outputDir, "dir", "d", "", "Path to the output directory")
+	renderCMD.Flags().StringVarP(&renderScn.format, "format", "", render.PNG, "Format of screenshots: png or pdf")
+	renderCMD.Flags().IntVarP(&renderScn.renderTimeout, "render-timeout", "", 60, "Max time in seconds to render single page")
+	renderCMD.MarkFlagRequired("dir")
+	rootCmd.AddCommand(renderCMD)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/karust/gogetcrawl/common"
+)
+
+// Access to S3 compatible stores, credentials come from AWS_* environment variables
+var (
+	s3Region        string
+	s3Endpoint      string
+	s3PathStyle     bool
+	s3Role          string
+	s3ExternalID    string
+	s3RequesterPays bool
+	s3StrictTLS     bool
+	s3CAFile        string
+	isCCS3          bool
+)
+
+// Client of --s3-* flags, region and endpoint can be overridden for buckets of known location
+func newS3Client(region, endpoint string) *common.S3Client {
+	client, err := common.NewS3Client(common.S3Config{
+		Region:        region,
+		Endpoint:      endpoint,
+		PathStyle:     s3PathStyle,
+		Credentials:   common.CredentialsFromEnv(),
+		RoleARN:       s3Role,
+		ExternalID:    s3ExternalID,
+		RequesterPays: s3RequesterPays,
+		StrictTLS:     s3StrictTLS,
+		CAFile:        s3CAFile,
+		Timeout:       maxTimeout,
+		MaxRetries:    maxRetries,
+	})
+	if err != nil {
+		log.Fatalf("Please check `--s3-*` flags: %v", err)
+	}
+	return client
+}
+
+// Common Crawl bucket is only on AWS, so its reads ignore custom endpoint
+func newCCS3Client() *common.S3Client {
+	if common.CredentialsFromEnv().AccessKey == "" {
+		log.Fatalf("Reading Common Crawl bucket needs AWS credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return newS3Client("us-east-1", "")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/karust/gogetcrawl/common"
+	"github.com/spf13/cobra"
+)
+
+type seriesScenario struct {
+	outputFile string
+	interval   string
+	isJSON     bool
+}
+
+var seriesScn = seriesScenario{}
+
+var seriesCMD = &cobra.Command{
+	Use:   "series",
+	Short: "Count captures per day, month or year from the index only, as CSV or JSON ready for plotting",
+	Args:  cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs),
+	Run:   seriesScn.run,
+}
+
+func (ss *seriesScenario) run(cmd *cobra.Command, args []string) {
+	counter, err := common.NewCaptureCounter(ss.interval)
+	if err != nil {
+		log.Fatalf("Please check `--interval`: %v", err)
+	}
+
+	var output io.Writer = os.Stdout
+	if ss.outputFile != "" {
+		file, err := common.CreateAtomic(ss.outputFile)
+		if err != nil {
+			log.Fatalf("Error obtaining output: %v", err)
+		}
+		defer func() {
+			if err := file.Commit(); err != nil {
+				log.Printf("ERROR: Cannot write series: %v", err)
+			}
+		}()
+		output = file
+	}
+
+	configs := getRequestConfigs(args)
+	close(configs)
+	initSources()
+
+	pages := make(chan []*common.CdxResponse)
+	errs := make(chan error)
+	go func() {
+		// At most `--workers` queries are sent at once
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, maxWorkers)
+		for config := range configs {
+			for _, s := range sources {
+				wg.Add(1)
+				slots <- struct{}{}
+				go func(config common.RequestConfig, s common.Source) {
+					defer wg.Done()
+					defer func() { <-slots }()
+					s.FetchPages(config, pages, errs)
+				}(config, s)
+			}
+		}
+		wg.Wait()
+		close(pages)
+	}()
+
+	for done := false; !done; {
+		select {
+		case res, ok := <-pages:
+			if !ok {
+				done = true
+				break
+			}
+			budget.Success()
+			counter.Add(selectRecords(res))
+		case err := <-errs:
+			log.Printf("ERROR: %v", err)
+			budget.Failure()
+			checkBudget()
+		}
+	}
+
+	series := counter.Series()
+	if ss.isJSON {
+		data, _ := jsoniter.MarshalIndent(series, "", "  ")
+		if _, err := output.Write(append(data, '\n')); err != nil {
+			log.Printf("ERROR: Cannot write series: %v", err)
+		}
+	} else if err := common.WriteSeriesCSV(output, series); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	log.Printf("Summary: %v", stats.Summary())
+}
+
+func init() {
+	seriesCMD.Flags().StringVarP(&seriesScn.outputFile, "output", "o", "", "Path to the output file")
+	seriesCMD.Flags().StringVarP(&seriesScn.interval, "interval", "", common.SeriesMonth, "Period to count captures per: day, month or year")
+	seriesCMD.Flags().BoolVarP(&seriesScn.isJSON, "json", "", false, "Write series as JSON array instead of CSV")
+	rootCmd.AddCommand(seriesCMD)
+}
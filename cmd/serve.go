@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/commoncrawl"
+	"github.com/karust/gogetcrawl/wayback"
+	"github.com/spf13/cobra"
+)
+
+type serveScenario struct {
+	listen     string
+	ttl        time.Duration
+	jobsDir    string
+	jobWorkers int
+}
+
+var serveScn = serveScenario{}
+
+var serveCMD = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve caching proxy of archive index servers and optional harvest job API",
+	Args:  cobra.NoArgs,
+	Run:   serveScn.run,
+}
+
+func (ss *serveScenario) run(cmd *cobra.Command, args []string) {
+	opts := common.RequestOptions{
+		Timeout:    maxTimeout,
+		MaxRetries: maxRetries,
+		Stats:      stats,
+		Phase:      common.PhaseIndex,
+		Limiter:    common.NewRateLimiter(indexRate),
+	}
+
+	wbProxy := common.NewCachingProxy(wayback.INDEX_SERVER, ss.ttl, opts)
+	ccProxy := common.NewCachingProxy(commoncrawl.INDEX_SERVER, ss.ttl, opts)
+
+	mux := http.NewServeMux()
+	mux.Handle("/wb/", http.StripPrefix("/wb", wbProxy))
+	mux.Handle("/cc/", http.StripPrefix("/cc", ccProxy))
+
+	if ss.jobsDir != "" {
+		ss.serveJobs(mux, opts.Limiter)
+	}
+
+	// Expired responses would otherwise stay in memory until queried again
+	go func() {
+		for range time.Tick(time.Minute) {
+			log.Printf("Cached responses: wb=%v cc=%v, %v", wbProxy.Purge(), ccProxy.Purge(), stats.Summary())
+		}
+	}()
+
+	log.Printf("Serving on %v", ss.listen)
+	if err := http.ListenAndServe(ss.listen, mux); err != nil {
+		log.Fatalf("Cannot serve: %v", err)
+	}
+}
+
+// Harvest jobs are persisted and their files are saved into jobs directory
+func (ss *serveScenario) serveJobs(mux *http.ServeMux, indexLimiter *common.RateLimiter) {
+	var err error
+	var politeness *common.Politeness
+	if politenessFile != "" {
+		if politeness, err = common.LoadPoliteness(politenessFile); err != nil {
+			log.Fatalf("Please check `--politeness` file: %v", err)
+		}
+	}
+
+	initSources()
+	if err := os.MkdirAll(ss.jobsDir, os.ModePerm); err != nil {
+		log.Fatalf("Cannot create jobs directory: %v", err)
+	}
+
+	// Cooldowns are kept beside jobs, so jobs resumed after restart do not hit throttling hosts again
+	if cooldownFile == "" {
+		cooldownFile = filepath.Join(ss.jobsDir, "cooldowns.json")
+	}
+	store := openJobStore()
+	run := newJobRunner(ss.jobsDir, sources, indexLimiter, common.NewRateLimiter(storageRate), politeness, loadCooldowns(cooldownFile), events, store)
+	queue, err := common.NewJobQueue(filepath.Join(ss.jobsDir, "jobs.json"), ss.jobWorkers, run)
+	if err != nil {
+		log.Fatalf("Cannot load jobs: %v", err)
+	}
+
+	api := &jobsAPI{queue: queue, sources: sourcesByFlag}
+	mux.Handle("/jobs", api)
+	mux.Handle("/jobs/", api)
+
+	harvests := &harvestsAPI{store: store}
+	mux.Handle("/harvests", harvests)
+	mux.Handle("/harvests/", harvests)
+}
+
+func init() {
+	serveCMD.Flags().StringVarP(&serveScn.listen, "listen", "", "127.0.0.1:8080", "Address to listen on")
+	serveCMD.Flags().DurationVarP(&serveScn.ttl, "ttl", "", 10*time.Minute, "How long index responses are cached, 0 to only share identical in-flight queries")
+	serveCMD.Flags().StringVarP(&serveScn.jobsDir, "jobs-dir", "", "", "Serve harvest job API at /jobs, jobs and their files are kept in the directory")
+	serveCMD.Flags().IntVarP(&serveScn.jobWorkers, "job-workers", "", 2, "Number of jobs run at once")
+	rootCmd.AddCommand(serveCMD)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/karust/gogetcrawl/common"
+)
+
+// Database records are written into, like DuckDB file
+type recordSink interface {
+	WriteRecords(records []*common.CdxResponse) error
+	Processor() func(*common.CdxResponse, []byte) ([]byte, error)
+	Failed() int // Captures processor could not insert
+	Close() error
+}
+
+// Set by DuckDB support when built with "duckdb" tag
+var openDuckDB func(path string) (recordSink, error)
+
+var (
+	duckdbPath string
+	sink       recordSink
+)
+
+// Opens database of --duckdb flag, nil if it is not set
+func initSink() {
+	if duckdbPath == "" {
+		return
+	}
+	if openDuckDB == nil {
+		log.Fatalf("Built without DuckDB support, rebuild with `-tags duckdb` to use `--duckdb`")
+	}
+
+	var err error
+	if sink, err = openDuckDB(duckdbPath); err != nil {
+		log.Fatalf("Cannot open DuckDB database: %v", err)
+	}
+	log.Printf("Writing records into '%v' DuckDB database", duckdbPath)
+}
+
+func closeSink() {
+	if sink == nil {
+		return
+	}
+	if failed := sink.Failed(); failed > 0 {
+		log.Printf("ERROR: %v captures were saved but not inserted into '%v' DuckDB database", failed, duckdbPath)
+	}
+	if err := sink.Close(); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
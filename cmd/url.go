@@ -13,6 +13,7 @@ import (
 
 type urlScenario struct {
 	outputFile      string
+	isJSON          bool
 	finishedWorkers uint
 }
 
@@ -32,6 +33,7 @@ func (us *urlScenario) worker(configs chan common.RequestConfig) {
 		case config, ok := <-configs:
 			if ok {
 				var wg sync.WaitGroup
+				config.Emit(common.Event{Type: common.EventJobStarted})
 
 				for _, s := range sources {
 					wg.Add(1)
@@ -41,6 +43,7 @@ func (us *urlScenario) worker(configs chan common.RequestConfig) {
 					}(s)
 				}
 				wg.Wait()
+				config.EmitFinished(nil)
 			} else {
 				us.finishedWorkers += 1
 				return
@@ -55,8 +58,14 @@ func (us *urlScenario) spawnWorkers(cmd *cobra.Command, args []string) {
 		log.Fatalf("Error obtaining output: %v", err)
 	}
 
+	var jsonWriter *common.NDJSONWriter
+	if us.isJSON {
+		jsonWriter = common.NewNDJSONWriter(output)
+	}
+
 	configs := getRequestConfigs(args)
 	initSources()
+	initSink()
 
 	var wg sync.WaitGroup
 
@@ -78,11 +87,26 @@ func (us *urlScenario) spawnWorkers(cmd *cobra.Command, args []string) {
 		select {
 		case res, ok := <-results:
 			if ok {
-				fmt.Fprintf(output, "%v", us.formatResultOutput(res))
+				budget.Success()
+				res = selectRecords(res)
+				if sink != nil {
+					if err := sink.WriteRecords(res); err != nil {
+						log.Println(err)
+					}
+				}
+				if jsonWriter != nil {
+					if err := jsonWriter.Write(res); err != nil {
+						log.Println(err)
+					}
+				} else {
+					fmt.Fprintf(output, "%v", us.formatResultOutput(res))
+				}
 			}
 		case err, ok := <-errors:
 			if ok {
 				log.Println(err)
+				budget.Failure()
+				checkBudget()
 			}
 		}
 	}
@@ -90,6 +114,8 @@ func (us *urlScenario) spawnWorkers(cmd *cobra.Command, args []string) {
 	wg.Wait()
 	close(results)
 	close(errors)
+	closeSink()
+	log.Printf("Summary: %v", stats.Summary())
 }
 
 func (us *urlScenario) getOutputTarget() (io.Writer, error) {
@@ -114,5 +140,7 @@ func (us *urlScenario) formatResultOutput(results []*common.CdxResponse) string
 
 func init() {
 	urlCMD.Flags().StringVarP(&urlScn.outputFile, "output", "o", "", "Path to the output file")
+	urlCMD.Flags().BoolVarP(&urlScn.isJSON, "json", "", false, "Output full CDX records as newline-delimited JSON")
+	urlCMD.Flags().StringVarP(&duckdbPath, "duckdb", "", "", "Also write CDX records into table of DuckDB database file (needs build with -tags duckdb)")
 	rootCmd.AddCommand(urlCMD)
 }
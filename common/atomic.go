@@ -0,0 +1,67 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written under temporary name next to its path and renamed to the path on Commit,
+// so interrupted or retried writes never leave partial file which looks like a complete one.
+// Temporary files are hidden and end with ".part".
+type AtomicFile struct {
+	*os.File
+	path string
+}
+
+// CreateAtomic ... Creates temporary file to be committed to the path
+func CreateAtomic(path string) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// Commit ... Flushes file to disk and replaces the path with it
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort ... Removes temporary file, the path is left as it was
+func (f *AtomicFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// WriteFileAtomic ... Writes file so it appears either complete or not at all
+func WriteFileAtomic(path string, data []byte) error {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return fmt.Errorf("[WriteFileAtomic] Cannot create file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Abort()
+		return fmt.Errorf("[WriteFileAtomic] Cannot write file: %w", err)
+	}
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("[WriteFileAtomic] Cannot commit file: %w", err)
+	}
+	return nil
+}
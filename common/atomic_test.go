@@ -0,0 +1,59 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := CreateAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("partial"))
+	if err := file.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Fatalf("Aborted write changed the file: %q", data)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Fatalf("Unexpected content: %q", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Temporary files left: %v", entries)
+	}
+}
+
+func TestArchiveOutputAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.zip")
+	output, err := NewArchiveOutput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Write("a.html", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Archive should not appear before it is closed")
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Archive should appear once closed: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SourceAvailability tells if source has any capture of the URL
+type SourceAvailability struct {
+	Available bool   `json:"available"`
+	Timestamp string `json:"timestamp,omitempty"` // Capture found, the first one in server order
+	Index     string `json:"index,omitempty"`     // Index the capture was found in, for sources with several
+	Error     string `json:"error,omitempty"`     // Why the source could not be checked
+}
+
+// Availability is a report of the URL captures in sources, keyed by source name
+type Availability struct {
+	URL     string                        `json:"url"`
+	Sources map[string]SourceAvailability `json:"sources"`
+}
+
+// Available ... Tells if any source has capture of the URL
+func (a Availability) Available() bool {
+	for _, s := range a.Sources {
+		if s.Available {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAvailability ... Checks for each URL if sources have any capture of it, a step before link-rot remediation.
+// Each source is asked with single limit=1 query per index, crawls of sources with several are tried until capture is found in any of them.
+// Filters, dates, limiters and stats of config apply to the queries. URLs are checked by workers at once, report keeps their order.
+func CheckAvailability(sources []Source, urls []string, config RequestConfig, workers int) []Availability {
+	if workers < 1 {
+		workers = 1
+	}
+
+	report := make([]Availability, len(urls))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				report[i] = checkURL(sources, urls[i], config)
+			}
+		}()
+	}
+	for i := range urls {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return report
+}
+
+func checkURL(sources []Source, url string, config RequestConfig) Availability {
+	config.URL, config.Limit, config.SinglePage, config.Resume = url, 1, true, nil
+
+	availability := Availability{URL: url, Sources: map[string]SourceAvailability{}}
+	for _, source := range sources {
+		availability.Sources[source.Name()] = checkSource(source, config)
+	}
+	return availability
+}
+
+// Crawls of a source checked at once for single URL
+const availabilityIndexWorkers = 4
+
+// Source with several indexes, like CommonCrawl, has the URL available if any of its crawls captured it.
+// Without dates in config all crawls are checked, crawls are queried concurrently until capture is found.
+func checkSource(source Source, config RequestConfig) SourceAvailability {
+	lister, isLister := source.(IndexLister)
+	indexed, isIndexed := source.(IndexedSource)
+	if !isLister || !isIndexed {
+		records, err := source.GetPages(config)
+		return sourceAvailability(records, "", err)
+	}
+
+	// Query without dates is limited to the newest crawl, so it is made to match all of them
+	if config.FromDate.IsZero() && config.ToDate.IsZero() && config.IndexDate.IsZero() && len(config.Indexes) == 0 {
+		config.FromDate = time.Unix(0, 0).UTC()
+	}
+
+	indexes := make(chan string)
+	found := make(chan SourceAvailability, 1)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var lastErr error
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < availabilityIndexWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				records, err := indexed.GetPagesIndex(config, index)
+				availability := sourceAvailability(records, index, err)
+				if availability.Available {
+					select {
+					case found <- availability:
+						close(done)
+					default:
+					}
+					continue
+				}
+				if availability.Error != "" {
+					mu.Lock()
+					lastErr = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+queue:
+	for _, index := range lister.Indexes(config) {
+		select {
+		case indexes <- index:
+		case <-done:
+			break queue
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	select {
+	case availability := <-found:
+		return availability
+	default:
+		return sourceAvailability(nil, "", lastErr)
+	}
+}
+
+// Error of the query is only reported when no capture is found
+func sourceAvailability(records []*CdxResponse, index string, err error) SourceAvailability {
+	for _, r := range records {
+		// Servers answer missing captures with message objects decoded as empty records
+		if r.Timestamp != "" {
+			return SourceAvailability{Available: true, Timestamp: r.Timestamp, Index: index}
+		}
+	}
+	// Servers answer missing captures with 404, which is not a failure of the check
+	var statusErr *StatusError
+	if err != nil && !(errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound) {
+		return SourceAvailability{Error: err.Error()}
+	}
+	return SourceAvailability{}
+}
+
+// WriteAvailabilityCSV ... Writes report as CSV with "url" and source columns, holding timestamp of found capture or empty
+func WriteAvailabilityCSV(w io.Writer, sourceNames []string, report []Availability) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"url"}, sourceNames...))
+	for _, a := range report {
+		row := []string{a.URL}
+		for _, name := range sourceNames {
+			row = append(row, a.Sources[name].Timestamp)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("[WriteAvailabilityCSV] Cannot write report: %w", err)
+	}
+	return nil
+}
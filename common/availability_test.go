@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Source stub with captures of fixed URLs in its indexes
+type availabilitySource struct {
+	Source
+	name     string
+	captures map[string]map[string]string // URL -> index -> timestamp
+	indexes  []string
+}
+
+func (s availabilitySource) Name() string { return s.name }
+
+func (s availabilitySource) GetPages(config RequestConfig) ([]*CdxResponse, error) {
+	return s.GetPagesIndex(config, "")
+}
+
+func (s availabilitySource) GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error) {
+	if config.Limit != 1 || !config.SinglePage {
+		return nil, errors.New("availability query should be limited to single record")
+	}
+	if config.URL == "broken.example.com" {
+		return nil, errors.New("server error")
+	}
+	if ts, ok := s.captures[config.URL][index]; ok {
+		return []*CdxResponse{{Original: config.URL, Timestamp: ts}}, nil
+	}
+	// Message object of missing captures
+	return []*CdxResponse{{}}, nil
+}
+
+type indexedAvailabilitySource struct{ availabilitySource }
+
+// Like CommonCrawl, query without dates goes to the newest index only
+func (s indexedAvailabilitySource) Indexes(config RequestConfig) []string {
+	if config.FromDate.IsZero() && config.ToDate.IsZero() && len(s.indexes) > 0 {
+		return s.indexes[:1]
+	}
+	return s.indexes
+}
+
+// Missing captures are answered with 404 by CommonCrawl
+func (s indexedAvailabilitySource) GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error) {
+	records, err := s.availabilitySource.GetPagesIndex(config, index)
+	if err == nil && records[0].Timestamp == "" {
+		return nil, fmt.Errorf("[GetPagesIndex] Request error: %w", &StatusError{URL: config.URL, Status: 404})
+	}
+	return records, err
+}
+
+func TestCheckAvailability(t *testing.T) {
+	wb := availabilitySource{name: "wb", captures: map[string]map[string]string{"a.example.com": {"": "20200101000000"}}}
+	cc := indexedAvailabilitySource{availabilitySource{
+		name:     "cc",
+		indexes:  []string{"CC-MAIN-2023-14", "CC-MAIN-2022-49", "CC-MAIN-2022-33", "CC-MAIN-2022-21", "CC-MAIN-2022-05"},
+		captures: map[string]map[string]string{"b.example.com": {"CC-MAIN-2022-05": "20220120000000"}},
+	}}
+	urls := []string{"a.example.com", "b.example.com", "c.example.com", "broken.example.com"}
+
+	report := CheckAvailability([]Source{wb, cc}, urls, RequestConfig{Limit: 100}, 3)
+	if len(report) != len(urls) {
+		t.Fatalf("Unexpected report: %v", report)
+	}
+	for i, url := range urls {
+		if report[i].URL != url {
+			t.Fatalf("Report is not in order of URLs: %v", report)
+		}
+	}
+
+	if !report[0].Available() || report[0].Sources["wb"].Timestamp != "20200101000000" || report[0].Sources["cc"].Available {
+		t.Fatalf("Unexpected availability of a: %+v", report[0])
+	}
+	if b := report[1].Sources["cc"]; !b.Available || b.Index != "CC-MAIN-2022-05" {
+		t.Fatalf("Capture in older index is not found: %+v", b)
+	}
+	if report[2].Available() || report[2].Sources["wb"].Error != "" || report[2].Sources["cc"].Error != "" {
+		t.Fatalf("Unexpected availability of c: %+v", report[2])
+	}
+	if report[3].Sources["cc"].Error == "" {
+		t.Fatalf("Error is not reported: %+v", report[3])
+	}
+
+	out := bytes.Buffer{}
+	if err := WriteAvailabilityCSV(&out, []string{"wb", "cc"}, report[:3]); err != nil {
+		t.Fatal(err)
+	}
+	want := "url,wb,cc\na.example.com,20200101000000,\nb.example.com,,20220120000000\nc.example.com,,\n"
+	if out.String() != want {
+		t.Fatalf("Unexpected CSV:\n%v", out.String())
+	}
+}
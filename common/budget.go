@@ -0,0 +1,94 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var BudgetExhaustedError = errors.New("Error budget exhausted")
+
+// Minimal number of outcomes observed before failure rate is taken into account
+const defaultMinSamples = 10
+
+// ErrorBudget tracks outcomes of pipeline operations and decides when to give up.
+// Nil budget is valid and never gets exhausted.
+type ErrorBudget struct {
+	MaxConsecutive int     // Abort after N consecutive failures (0 - disabled)
+	MaxFailureRate float64 // Abort when failures/total exceeds this fraction (0 - disabled)
+	MinSamples     int     // Outcomes to observe before checking failure rate
+
+	mu          sync.Mutex
+	consecutive int
+	failures    int
+	total       int
+	exhausted   error
+}
+
+func NewErrorBudget(maxConsecutive int, maxFailureRate float64) *ErrorBudget {
+	return &ErrorBudget{
+		MaxConsecutive: maxConsecutive,
+		MaxFailureRate: maxFailureRate,
+		MinSamples:     defaultMinSamples,
+	}
+}
+
+// Success records successful operation and resets the consecutive failures counter
+func (b *ErrorBudget) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive = 0
+	b.total += 1
+}
+
+// Failure records failed operation.
+// Returns BudgetExhaustedError once the budget is spent, all following calls return it too.
+func (b *ErrorBudget) Failure() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive += 1
+	b.failures += 1
+	b.total += 1
+
+	if b.exhausted != nil {
+		return b.exhausted
+	}
+
+	if b.MaxConsecutive > 0 && b.consecutive >= b.MaxConsecutive {
+		b.exhausted = fmt.Errorf("%w: %v consecutive failures", BudgetExhaustedError, b.consecutive)
+	}
+
+	rate := float64(b.failures) / float64(b.total)
+	if b.MaxFailureRate > 0 && b.total >= b.MinSamples && rate > b.MaxFailureRate {
+		b.exhausted = fmt.Errorf("%w: failure rate %.2f (%v of %v)", BudgetExhaustedError, rate, b.failures, b.total)
+	}
+
+	return b.exhausted
+}
+
+// Record is a shortcut to register outcome of an operation by its error
+func (b *ErrorBudget) Record(err error) error {
+	if err != nil {
+		return b.Failure()
+	}
+	b.Success()
+	return nil
+}
+
+// Exhausted returns non nil error if the budget is already spent
+func (b *ErrorBudget) Exhausted() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
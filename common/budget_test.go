@@ -0,0 +1,58 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorBudgetConsecutive(t *testing.T) {
+	b := NewErrorBudget(3, 0)
+
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if err := b.Failure(); err != nil {
+		t.Fatalf("Budget exhausted too early: %v", err)
+	}
+
+	err := b.Failure()
+	if !errors.Is(err, BudgetExhaustedError) {
+		t.Fatalf("Budget should be exhausted after 3 consecutive failures, got: %v", err)
+	}
+
+	b.Success()
+	if b.Exhausted() == nil {
+		t.Fatalf("Exhausted budget must stay exhausted")
+	}
+}
+
+func TestErrorBudgetRate(t *testing.T) {
+	b := NewErrorBudget(0, 0.5)
+
+	for i := 0; i < 5; i++ {
+		b.Success()
+	}
+	for i := 0; i < 4; i++ {
+		if err := b.Failure(); err != nil {
+			t.Fatalf("Budget exhausted before min samples: %v", err)
+		}
+	}
+
+	// 5 failures of 10 outcomes
+	if err := b.Failure(); err != nil {
+		t.Fatalf("Budget exhausted on failure rate limit: %v", err)
+	}
+
+	if err := b.Failure(); !errors.Is(err, BudgetExhaustedError) {
+		t.Fatalf("Budget should be exhausted above failure rate, got: %v", err)
+	}
+}
+
+func TestErrorBudgetNil(t *testing.T) {
+	var b *ErrorBudget
+	b.Success()
+	if err := b.Failure(); err != nil {
+		t.Fatalf("Nil budget must never be exhausted: %v", err)
+	}
+}
@@ -5,11 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"mime"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/corpix/uarand"
@@ -23,19 +20,59 @@ var (
 
 // WebArchive and Common Crawl (index.commoncrawl.org) CDX API Response structure from
 type CdxResponse struct {
-	Urlkey       string `json:"urlkey,omitempty"`
-	Timestamp    string `json:"timestamp,omitempty"`
-	Charset      string `json:"charset,omitempty"`
-	MimeType     string `json:"mime,omitempty"`
-	Languages    string `json:"languages,omitempty"`
-	MimeDetected string `json:"mimedetected,omitempty"`
-	Digest       string `json:"digest,omitempty"`
-	Offset       string `json:"offset,omitempty"`
-	Original     string `json:"url,omitempty"` // Original URL
-	Length       string `json:"length,omitempty"`
-	StatusCode   string `json:"status,omitempty"`
-	Filename     string `json:"filename,omitempty"`
-	Source       Source
+	Urlkey       string            `json:"urlkey,omitempty"`
+	Timestamp    string            `json:"timestamp,omitempty"`
+	Charset      string            `json:"charset,omitempty"`
+	MimeType     string            `json:"mime,omitempty"`
+	Languages    string            `json:"languages,omitempty"`
+	MimeDetected string            `json:"mimedetected,omitempty"`
+	Digest       string            `json:"digest,omitempty"`
+	Offset       string            `json:"offset,omitempty"`
+	Original     string            `json:"url,omitempty"` // Original URL
+	Length       string            `json:"length,omitempty"`
+	StatusCode   string            `json:"status,omitempty"`
+	Filename     string            `json:"filename,omitempty"`
+	Robots       *RobotsDirectives `json:"robots,omitempty"` // Set by robots processor of downloaded capture
+	Fetch        *FetchInfo        `json:"fetch,omitempty"`  // Set by Downloader once capture is downloaded
+	Source       Source            `json:"-"`
+	Config       *RequestConfig    `json:"-"` // Request config the record was found with
+	Resume       *ResumeToken      `json:"-"` // Position to continue the query after batch of the record
+}
+
+// Stats of the operation record belongs to, nil if record was created manually
+func (r *CdxResponse) Stats() *Stats {
+	if r.Config == nil {
+		return nil
+	}
+	return r.Config.Stats
+}
+
+// RequestOptions composes HTTP request options of file download using config the record was found with
+func (r *CdxResponse) RequestOptions(timeout, retries int) RequestOptions {
+	if r.Config == nil {
+		return RequestOptions{Timeout: timeout, MaxRetries: retries, Phase: PhaseDownload}
+	}
+	opts := r.Config.RequestOptions(timeout, retries)
+	// MaxPageBytes limits index pages only, captures may be of any size
+	opts.Phase, opts.Limiter, opts.MaxBytes = PhaseDownload, r.Config.StorageLimiter, 0
+	if fetch := r.Fetch; fetch != nil {
+		hook := opts.Hook
+		opts.Hook = func(event RequestEvent) {
+			fetch.observe(event)
+			if hook != nil {
+				hook(event)
+			}
+		}
+	}
+	return opts
+}
+
+// Errorf formats error and binds it to the job record belongs to
+func (r *CdxResponse) Errorf(format string, a ...any) error {
+	if r.Config == nil {
+		return fmt.Errorf(format, a...)
+	}
+	return r.Config.Errorf(format, a...)
 }
 
 // Source of web archive data
@@ -49,13 +86,60 @@ type Source interface {
 }
 
 type RequestConfig struct {
-	URL            string    // Url to parse
-	Filters        []string  // Extenstion to search
-	Limit          uint      // Max number of results per page
-	CollapseColumn string    // Which column to use to collapse results
-	SinglePage     bool      // Get results only from 1st page (mostly used for tests)
-	FromDate       time.Time // Filter results from Date
-	ToDate         time.Time // Filter results to Date
+	URL            string            // Url to parse
+	Filters        []string          // Extenstion to search
+	Limit          uint              // Max number of results per page
+	CollapseColumn string            // Which column to use to collapse results
+	SinglePage     bool              // Get results only from 1st page (mostly used for tests)
+	FromDate       time.Time         // Filter results from Date (UTC, as CDX timestamps)
+	ToDate         time.Time         // Filter results to Date (UTC, as CDX timestamps)
+	Stats          *Stats            // Accounting of requests made with this config (optional)
+	JobID          string            // ID to correlate logs, errors and hooks of the job (optional)
+	Hook           RequestHook       // Called after each HTTP request attempt (optional)
+	Politeness     *Politeness       // Per endpoint access limits (optional)
+	IndexLimiter   *RateLimiter      // Rate limit of index server queries (optional)
+	StorageLimiter *RateLimiter      // Rate limit of file downloads from archive storage (optional)
+	Tags           map[string]string // User labels, like case number, propagated to outputs (optional)
+	Resume         *ResumeToken      // Continue query from position returned with an earlier batch (optional)
+	Gate           *JobGate          // Pauses and cancels requests of the job (optional)
+	Languages      []string          // Keep only records with any of these languages, like "eng" (optional)
+	Charsets       []string          // Keep only records with any of these charsets, names are normalized (optional)
+	Cooldowns      *CooldownStore    // Hosts cooling down after throttling requests, shared across restarts (optional)
+	Partition      *Partition        // Slice of the harvest run by this machine, when it is split across several (optional)
+	Sort           string            // SortAscending, SortDescending or SortClosest, server order if empty (optional)
+	Closest        time.Time         // Date to sort results around with SortClosest
+	IndexDate      time.Time         // Query only the index closest to this date, for sources with several (optional)
+	Indexes        []string          // Query only these indexes of sources with several, like "CC-MAIN-2023-14" (optional)
+	FileCache      *FileCache        // Disk cache of downloaded payloads, reused across runs (optional)
+	Events         *EventLog         // Lifecycle events of the job are streamed into it (optional)
+	UserAgent      string            // User-Agent of requests, random browser one if empty (optional)
+	MaxPageBytes   int64             // Max accepted size of index response page, larger fail with ResponseTooLargeError (optional)
+}
+
+// AttachRecords binds found records to the config and counts them in its stats
+func (config *RequestConfig) AttachRecords(records []*CdxResponse) {
+	for _, r := range records {
+		r.Config = config
+	}
+	config.Stats.AddRecords(RecordFound, len(records))
+}
+
+// RequestOptions composes HTTP request options of index queries for the config
+func (config *RequestConfig) RequestOptions(timeout, retries int) RequestOptions {
+	return RequestOptions{
+		Timeout:    timeout,
+		MaxRetries: retries,
+		Stats:      config.Stats,
+		JobID:      config.JobID,
+		Hook:       config.Hook,
+		Politeness: config.Politeness,
+		Phase:      PhaseIndex,
+		Limiter:    config.IndexLimiter,
+		Gate:       config.Gate,
+		Cooldowns:  config.Cooldowns,
+		UserAgent:  config.UserAgent,
+		MaxBytes:   config.MaxPageBytes,
+	}
 }
 
 // GetUrlFromConfig ... Compose URL with CDX server request parameters
@@ -77,11 +161,11 @@ func (config RequestConfig) GetUrl(serverURL string, page int) string {
 	}
 
 	if !config.FromDate.IsZero() {
-		reqURL = fmt.Sprintf("%v&from=%v", reqURL, config.FromDate.Format("20060102"))
+		reqURL = fmt.Sprintf("%v&from=%v", reqURL, cdxDate(config.FromDate))
 	}
 
 	if !config.ToDate.IsZero() {
-		reqURL = fmt.Sprintf("%v&to=%v", reqURL, config.ToDate.Format("20060102"))
+		reqURL = fmt.Sprintf("%v&to=%v", reqURL, cdxDate(config.ToDate))
 	}
 
 	if !config.SinglePage {
@@ -90,14 +174,86 @@ func (config RequestConfig) GetUrl(serverURL string, page int) string {
 	return reqURL
 }
 
+// Remaining ... Returns number of records left to reach the limit after found ones, 0 if there is no limit
+func (config *RequestConfig) Remaining(found int) int {
+	if config.Limit == 0 {
+		return 0
+	}
+	if left := int(config.Limit) - found; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Options of HTTP requests made to archive servers
+type RequestOptions struct {
+	Timeout    int               // Request timeout in seconds
+	MaxRetries int               // Max number of request retries
+	Headers    map[string]string // Additional request headers
+	Stats      *Stats            // Requests accounting (optional)
+	JobID      string            // Job ID to put into logs and hook events (optional)
+	Hook       RequestHook       // Called after each request attempt (optional)
+	Politeness *Politeness       // Per endpoint access limits (optional)
+	Phase      string            // PhaseIndex or PhaseDownload, to account requests per phase (optional)
+	Limiter    *RateLimiter      // Rate limit of the phase requests (optional)
+	Gate       *JobGate          // Blocks requests while the job is paused, fails them once it is canceled (optional)
+	Cooldowns  *CooldownStore    // Delays requests to hosts cooling down, throttled responses start cooldown (optional)
+	UserAgent  string            // User-Agent header, random browser one if empty (optional)
+	MaxBytes   int64             // Max accepted size of response body, larger fail with ResponseTooLargeError (optional)
+	Expect     []int             // Accepted response statuses, like 206 of ranged requests or AnyStatus, only 200 if empty (optional)
+}
+
+// AnyStatus in RequestOptions.Expect accepts responses of every status, like archived 404 or 3xx captures
+const AnyStatus = -1
+
+// StatusError is returned when server responds with status not accepted by the request, after retries are over
+type StatusError struct {
+	URL    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Got %v status response from %v", e.Status, e.URL)
+}
+
+// Tells if response status is accepted by the request
+func (opts RequestOptions) accepts(status int) bool {
+	if len(opts.Expect) == 0 {
+		return status == http.StatusOK
+	}
+	for _, expected := range opts.Expect {
+		if status == expected || expected == AnyStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// Client errors are not going to change with retries, except timeouts and throttling
+func isRetried(status int) bool {
+	return status < 400 || status >= 500 || status == http.StatusRequestTimeout || isThrottled(status)
+}
+
+func (opts RequestOptions) userAgent() string {
+	if opts.UserAgent != "" {
+		return opts.UserAgent
+	}
+	return uarand.GetRandom()
+}
+
 func DoRequest(url string, timeout int, headers map[string]string) ([]byte, error) {
-	timeoutDuration := time.Second * time.Duration(timeout)
+	return DoRequestWithOptions(url, RequestOptions{Timeout: timeout, Headers: headers})
+}
+
+// DoRequestWithOptions ... Makes single HTTP GET request using fasthttp client, it is reported to the hook rather than logged
+func DoRequestWithOptions(url string, opts RequestOptions) ([]byte, error) {
+	timeoutDuration := time.Second * time.Duration(opts.Timeout)
 
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(url)
 	req.Header.SetMethod(fasthttp.MethodGet)
-	req.Header.Set(fasthttp.HeaderUserAgent, uarand.GetRandom())
-	for k, v := range headers {
+	req.Header.Set(fasthttp.HeaderUserAgent, opts.userAgent())
+	for k, v := range opts.Headers {
 		req.Header.Set(k, v)
 	}
 	defer fasthttp.ReleaseRequest(req)
@@ -107,10 +263,27 @@ func DoRequest(url string, timeout int, headers map[string]string) ([]byte, erro
 
 	client := &fasthttp.Client{}
 	client.ReadTimeout = timeoutDuration
-	err := client.DoTimeout(req, resp, timeoutDuration)
+
+	if err := opts.Gate.Wait(); err != nil {
+		return nil, fmt.Errorf("[GetRequest] %w", err)
+	}
+	release, err := opts.acquire(url)
 	if err != nil {
+		return nil, fmt.Errorf("[GetRequest] %w", err)
+	}
+	start := time.Now()
+	err = client.DoTimeout(req, resp, timeoutDuration)
+	release()
+	if err != nil {
+		opts.Stats.AddPhaseRequest(opts.Phase, 0)
+		opts.emit(RequestEvent{URL: url, Attempt: 1, Duration: time.Since(start), Err: err})
 		return nil, fmt.Errorf("[GetRequest] Error making request: %v", err)
 	}
+	opts.Stats.AddPhaseRequest(opts.Phase, len(resp.Body()))
+	opts.emit(RequestEvent{URL: url, Attempt: 1, Status: resp.StatusCode(), Bytes: len(resp.Body()), Duration: time.Since(start)})
+	if isThrottled(resp.StatusCode()) {
+		opts.Cooldowns.Throttled(url, http.Header{"Retry-After": {string(resp.Header.Peek("Retry-After"))}})
+	}
 
 	switch resp.StatusCode() {
 	case 500:
@@ -119,12 +292,8 @@ func DoRequest(url string, timeout int, headers map[string]string) ([]byte, erro
 		return resp.Body(), Status503Error
 	}
 
-	if len(resp.Body()) > 0 {
-		return resp.Body(), nil
-	}
-
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("[GetRequest] Got %v status response", resp.StatusCode())
+	if !opts.accepts(resp.StatusCode()) {
+		return nil, fmt.Errorf("[GetRequest] %w", &StatusError{URL: url, Status: resp.StatusCode()})
 	}
 
 	if resp.Body() == nil {
@@ -136,30 +305,256 @@ func DoRequest(url string, timeout int, headers map[string]string) ([]byte, erro
 
 // Get ... Performs HTTP GET request and returns response bytes
 func Get(url string, timeout int, maxRetries int) ([]byte, error) {
+	return GetWithOptions(url, RequestOptions{Timeout: timeout, MaxRetries: maxRetries})
+}
+
+// GetWithOptions ... Performs HTTP GET request with retries and returns response bytes
+func GetWithOptions(url string, opts RequestOptions) ([]byte, error) {
 	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+		Timeout: time.Duration(opts.Timeout) * time.Second,
+	}
+
+	resp, event, err := doWithRetries(client, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	limited, err := opts.limitBody(url, resp)
+	if err != nil {
+		opts.Stats.AddPhaseRequest(opts.Phase, 0)
+		event.Duration, event.Err = time.Since(event.start), err
+		opts.emit(event)
+		return nil, err
+	}
+	body, err := io.ReadAll(limited)
+	opts.Stats.AddPhaseRequest(opts.Phase, len(body))
+	event.Bytes, event.Duration, event.Err = len(body), time.Since(event.start), err
+	opts.emit(event)
+	return body, err
+}
+
+// GetStream ... Performs HTTP GET request with retries and returns response body to be read by caller.
+// Timeout is applied to receiving response headers only, so large files can be streamed.
+func GetStream(url string, opts RequestOptions) (io.ReadCloser, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: time.Duration(opts.Timeout) * time.Second,
+		},
+	}
+
+	resp, event, err := doWithRetries(client, url, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Stats.AddPhaseRequest(opts.Phase, 0)
+	event.Duration = time.Since(event.start)
+	opts.emit(event)
+	return resp.Body, nil
+}
+
+// GetHeaders ... Performs HTTP GET request with retries and returns response headers, body is not read.
+// Redirects are not followed, so headers of redirect response itself are returned.
+func GetHeaders(url string, opts RequestOptions) (http.Header, error) {
+	client := &http.Client{
+		Timeout: time.Duration(opts.Timeout) * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, event, err := doWithRetries(client, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	opts.Stats.AddPhaseRequest(opts.Phase, 0)
+	event.Duration = time.Since(event.start)
+	opts.emit(event)
+	return resp.Header, nil
+}
+
+// GetDecoded ... Performs HTTP GET request with retries and passes response body to decode, without reading it into memory.
+// Rest of the body is discarded once decode returns, so decoding can stop early.
+func GetDecoded(url string, opts RequestOptions, decode func(io.Reader) error) error {
+	client := &http.Client{
+		Timeout: time.Duration(opts.Timeout) * time.Second,
+	}
+
+	resp, event, err := doWithRetries(client, url, opts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := &countingReader{r: resp.Body}
+	limited, err := opts.limitBody(url, resp)
+	if err == nil {
+		limited.R = body
+		err = decode(limited)
+		// Decoders may wrap read errors, losing their type
+		if tooLarge := limited.Err(); tooLarge != nil {
+			err = tooLarge
+		}
+	}
+	opts.Stats.AddPhaseRequest(opts.Phase, int(body.n))
+	event.Bytes, event.Duration, event.Err = int(body.n), time.Since(event.start), err
+	opts.emit(event)
+	return err
+}
+
+// ResponseTooLargeError is returned when response body exceeds RequestOptions.MaxBytes,
+// like index page of wildcard query which would not fit into memory of the worker
+type ResponseTooLargeError struct {
+	URL   string
+	Limit int64 // Max accepted size in bytes
+	Size  int64 // Size announced by server, 0 if it was found while reading
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("Response of %v is %v bytes, over limit of %v bytes", e.URL, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("Response of %v exceeds limit of %v bytes", e.URL, e.Limit)
+}
+
+// LimitedReader fails reads past Limit bytes with ResponseTooLargeError, so decoders stop on oversized responses
+type LimitedReader struct {
+	R     io.Reader
+	URL   string
+	Limit int64 // Not limited if not positive
+
+	n   int64
+	err error
+}
+
+// NewLimitedReader ... Limits reader of the URL response to limit bytes
+func NewLimitedReader(r io.Reader, url string, limit int64) *LimitedReader {
+	return &LimitedReader{R: r, URL: url, Limit: limit}
+}
+
+func (l *LimitedReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.Limit <= 0 {
+		return l.R.Read(p)
+	}
+	// Single byte over the limit tells it is exceeded
+	if left := l.Limit - l.n + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.R.Read(p)
+	l.n += int64(n)
+	if l.n > l.Limit {
+		n -= int(l.n - l.Limit)
+		l.n = l.Limit
+		l.err = &ResponseTooLargeError{URL: l.URL, Limit: l.Limit}
+		return n, l.err
+	}
+	return n, err
+}
+
+// Err ... Returns ResponseTooLargeError if the limit was exceeded, nil otherwise
+func (l *LimitedReader) Err() error {
+	return l.err
+}
+
+// Limits body of the response to MaxBytes, responses announcing larger size fail before they are read
+func (opts RequestOptions) limitBody(url string, resp *http.Response) (*LimitedReader, error) {
+	if opts.MaxBytes > 0 && resp.ContentLength > opts.MaxBytes {
+		return nil, &ResponseTooLargeError{URL: url, Limit: opts.MaxBytes, Size: resp.ContentLength}
 	}
+	return NewLimitedReader(resp.Body, url, opts.MaxBytes), nil
+}
 
-	var resp *http.Response
+// Counts bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Makes request attempts until response of accepted status is received or retries are over, at least one attempt is made.
+// Returns the response and event of the last attempt, StatusError if the last response was not accepted.
+func doWithRetries(client *http.Client, url string, opts RequestOptions) (*http.Response, RequestEvent, error) {
 	var err error
+	var event RequestEvent
+
+	attempts := opts.MaxRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		log.Printf("%vGET [t=%v] [r=%v]: %v", opts.logPrefix(), opts.Timeout, opts.MaxRetries, url)
+
+		if err := opts.Gate.Wait(); err != nil {
+			return nil, event, fmt.Errorf("[Get] %w", err)
+		}
+		if i > 0 {
+			opts.Stats.AddRetry()
+		}
 
-	for i := 0; i < maxRetries; i++ {
-		log.Printf("GET [t=%v] [r=%v]: %v", timeout, maxRetries, url)
+		req, reqErr := http.NewRequest(http.MethodGet, url, nil)
+		if reqErr != nil {
+			return nil, event, fmt.Errorf("[Get] Cannot create request: %w", reqErr)
+		}
+		if opts.UserAgent != "" {
+			req.Header.Set("User-Agent", opts.UserAgent)
+		}
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
+		}
 
-		resp, err = client.Get(url)
-		if err == nil && resp.StatusCode == 200 {
+		release, waitErr := opts.acquire(url)
+		if waitErr != nil {
+			return nil, event, fmt.Errorf("[Get] %w", waitErr)
+		}
+		start := time.Now()
+		event = RequestEvent{URL: url, Attempt: i + 1, start: start}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		release()
+		if err == nil && opts.accepts(resp.StatusCode) {
+			event.Status = resp.StatusCode
+			return resp, event, nil
+		}
+
+		retried := true
+		if err == nil {
+			if isThrottled(resp.StatusCode) {
+				opts.Cooldowns.Throttled(url, resp.Header)
+			}
+			resp.Body.Close()
+			retried = isRetried(resp.StatusCode)
+			event.Status, err = resp.StatusCode, &StatusError{URL: url, Status: resp.StatusCode}
+		}
+		opts.Stats.AddPhaseRequest(opts.Phase, 0)
+		event.Duration, event.Err = time.Since(start), err
+		opts.emit(event)
+		log.Printf("%vAttempt %d failed: %v", opts.logPrefix(), event.Attempt, err)
+		if !retried {
 			break
 		}
-		log.Printf("Attempt %d failed: %v", i+1, err)
-		time.Sleep(time.Second * time.Duration(i+1))
+		if i < attempts-1 {
+			time.Sleep(time.Second * time.Duration(i+1))
+		}
 	}
-	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+
+	return nil, event, fmt.Errorf("[Get] Request failed after %v attempts: %w", event.Attempt, err)
 }
 
-// Save data using file fullpath
+// Save data using file fullpath, file is replaced atomically
 func SaveFile(data []byte, path string) error {
-	err := os.WriteFile(path, data, 0o644)
+	err := WriteFileAtomic(path, data)
 	if err != nil {
 		return err
 	}
@@ -167,30 +562,231 @@ func SaveFile(data []byte, path string) error {
 	return nil
 }
 
-// Save files from CDX Response channel into output directory
-func SaveFiles(results <-chan []*CdxResponse, outputDir string, errors chan error, downloadRate float32) {
+// Downloader saves files found in CDX responses into output directory
+type Downloader struct {
+	OutputDir    string       // Directory to save files into
+	DownloadRate float32      // Delay between downloads in seconds
+	Budget       *ErrorBudget // Stop downloading when budget is exhausted (optional)
+	Stats        *Stats       // Accounting of downloaded records (optional)
+	Output       Output       // Target to write files into, disk storage of OutputDir is used if not set
+	Manifest     *Manifest    // Records saved files (optional)
+	Digests      *DigestSet   // Records with these digests are skipped, digests of saved records are added (optional)
+	Scope        *HostScope   // Records of hosts out of scope are skipped (optional)
+	Where        *RecordExpr  // Records not matching the expression are skipped (optional)
+	// Composes name of the file to save record into, FileName is used if not set
+	FileName func(*CdxResponse) (string, error)
+	// Transforms payload before it is written, like HTML link rewriting (optional)
+	Process func(*CdxResponse, []byte) ([]byte, error)
+	// Called before record is downloaded, after other skip checks passed. Lets application skip records
+	// it already has or which are out of its own scope. Error fails the record like failed download (optional).
+	// Must be safe for concurrent use, as several savers may run at once.
+	PreDownload func(*CdxResponse) (skip bool, err error)
+	// Called by HarvestPlan once all records of the batch are handled, with token to continue the query after it.
+	// Harvest resumed with the token does not repeat saved batches. Not called for sorted queries (optional).
+	Checkpoint func(*ResumeToken)
+}
+
+func (d *Downloader) output() Output {
+	if d.Output != nil {
+		return d.Output
+	}
+	return NewStorageOutput(NewDiskStorage(d.OutputDir))
+}
+
+// FileName ... Composes name of the file to save record into.
+// Extension is taken from MIME type, use DetectMimeType for records without it.
+//
+//	ex: http%3A%2F%2Fexample.com%2F-20130522121421-Wayback.html
+func FileName(res *CdxResponse) (string, error) {
+	ext := extensionOf(res.MimeType)
+	if ext == "" {
+		return "", fmt.Errorf("Cannot get extension from file")
+	}
+
+	filename := fmt.Sprintf("%v-%v-%v%v", res.Original, res.Timestamp, res.Source.Name(), ext)
+	return url.QueryEscape(filename), nil
+}
+
+// Save files from CDX Response channel into output directory.
+// If budget gets exhausted, BudgetExhaustedError is sent and the rest of the results are discarded.
+func (d *Downloader) SaveFiles(results <-chan []*CdxResponse, errors chan error) {
 	for resBatch := range results {
 		for _, res := range resBatch {
-			data, err := res.Source.GetFile(res)
-			if err != nil {
-				errors <- err
+			if d.Budget.Exhausted() != nil {
 				continue
 			}
-
-			exts, err := mime.ExtensionsByType(res.MimeType)
-			if err != nil || len(exts) == 0 {
-				errors <- fmt.Errorf("Cannot get extension from file")
+			skip, err := d.skip(res, d.Stats)
+			if skip {
 				continue
 			}
 
-			filename := fmt.Sprintf("%v-%v-%v%v", res.Original, res.Timestamp, res.Source.Name(), exts[0])
-			fullPath := filepath.Join(outputDir, url.QueryEscape(filename))
-
-			if err := SaveFile(data, fullPath); err != nil {
+			if err == nil {
+				err = d.saveFile(res, d.Stats)
+			}
+			if budgetErr := d.Budget.Record(err); budgetErr != nil {
+				errors <- budgetErr
+			} else if err != nil {
 				errors <- err
 			}
 
-			time.Sleep(time.Duration(downloadRate * float32(time.Second)))
+			time.Sleep(time.Duration(d.DownloadRate * float32(time.Second)))
 		}
 	}
 }
+
+// Checks if record is out of scope, filtered out, its content is already archived or PreDownload hook skips it.
+// Error of the hook is returned with the record counted as failed.
+func (d *Downloader) skip(res *CdxResponse, stats *Stats) (bool, error) {
+	if !d.Scope.Allowed(res) {
+		stats.AddRecords(RecordOutOfScope, 1)
+		return true, nil
+	}
+	if !d.Where.Match(res) {
+		stats.AddRecords(RecordFiltered, 1)
+		return true, nil
+	}
+	if d.Digests.Has(res.Digest) {
+		stats.AddRecords(RecordSkipped, 1)
+		return true, nil
+	}
+	if d.PreDownload == nil {
+		return false, nil
+	}
+
+	skip, err := d.PreDownload(res)
+	if err != nil {
+		stats.AddRecords(RecordFailed, 1)
+		err = res.Errorf("[PreDownload] %w", err)
+		res.emit(EventRecordFailed, "", 0, err)
+		return false, err
+	}
+	if skip {
+		stats.AddRecords(RecordSkipped, 1)
+	}
+	return skip, nil
+}
+
+func (d *Downloader) saveFile(res *CdxResponse, stats *Stats) error {
+	err := d.writeFile(res, stats)
+	if err != nil {
+		stats.AddRecords(RecordFailed, 1)
+		err = res.Errorf("%w", err)
+		res.emit(EventRecordFailed, "", 0, err)
+		return err
+	}
+	stats.AddRecords(RecordSaved, 1)
+	d.Digests.Add(res.Digest)
+	return nil
+}
+
+func (d *Downloader) writeFile(res *CdxResponse, stats *Stats) error {
+	defer stats.StartPhase(PhaseDownload)()
+
+	finishFetch := res.startFetch()
+	data, err := res.Source.GetFile(res)
+	if err != nil {
+		return err
+	}
+	finishFetch(data)
+
+	// Records with missing or meaningless mime, like "warc/revisit", are named by detected type
+	if mimeType := DetectMimeType(res, data); mimeType != res.MimeType {
+		detected := *res
+		detected.MimeType = mimeType
+		res = &detected
+	}
+
+	fileName := FileName
+	if d.FileName != nil {
+		fileName = d.FileName
+	}
+	filename, err := fileName(res)
+	if err != nil {
+		return err
+	}
+
+	if d.Process != nil {
+		if data, err = d.Process(res, data); err != nil {
+			return err
+		}
+	}
+
+	output := d.output()
+	if ro, ok := output.(RecordOutput); ok {
+		err = ro.WriteRecord(filename, res, data)
+	} else {
+		err = output.Write(filename, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.Manifest.AddFile(filename, res, data)
+	res.emit(EventRecordDownloaded, filename, len(data), nil)
+	return nil
+}
+
+// Harvest gets all records found by the source using config and downloads them.
+// Returns accounting for both index queries and downloads, config.Stats is used if provided.
+func (d *Downloader) Harvest(source Source, config RequestConfig) (*Stats, error) {
+	config.Emit(Event{Type: EventJobStarted, Source: source.Name()})
+	stats, err := d.harvest(config, source.GetPages)
+	config.EmitFinished(err)
+	return stats, err
+}
+
+func (d *Downloader) harvest(config RequestConfig, getPages func(RequestConfig) ([]*CdxResponse, error)) (*Stats, error) {
+	if config.Stats == nil {
+		config.Stats = NewStats()
+	}
+	stats := config.Stats
+
+	records, err := getPages(config)
+	if err != nil {
+		return stats, fmt.Errorf("[Harvest] Cannot get pages: %w", err)
+	}
+
+	// Records of a batch share its token, batch before the record is done once token changes.
+	// Sorted records of batches are mixed, so their positions are not known.
+	checkpoint := d.Checkpoint
+	if config.Sort != "" {
+		checkpoint = nil
+	}
+	var batch *ResumeToken
+	for _, res := range records {
+		if err := config.Gate.Wait(); err != nil {
+			return stats, fmt.Errorf("[Harvest] %w", err)
+		}
+		if checkpoint != nil && batch != nil && res.Resume != batch {
+			checkpoint(batch)
+		}
+		batch = res.Resume
+		skip, err := d.skip(res, stats)
+		if skip {
+			continue
+		}
+
+		if err == nil {
+			err = d.saveFile(res, stats)
+		}
+		if budgetErr := d.Budget.Record(err); budgetErr != nil {
+			return stats, fmt.Errorf("[Harvest] %w", budgetErr)
+		}
+		if err != nil {
+			log.Printf("[Harvest] %v", err)
+		}
+
+		time.Sleep(time.Duration(d.DownloadRate * float32(time.Second)))
+	}
+
+	if checkpoint != nil && batch != nil {
+		checkpoint(batch)
+	}
+	return stats, nil
+}
+
+// Save files from CDX Response channel into output directory
+func SaveFiles(results <-chan []*CdxResponse, outputDir string, errors chan error, downloadRate float32) {
+	d := &Downloader{OutputDir: outputDir, DownloadRate: downloadRate}
+	d.SaveFiles(results, errors)
+}
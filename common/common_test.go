@@ -0,0 +1,231 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetDecoded(t *testing.T) {
+	body := strings.Repeat("line\n", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	stats := NewStats()
+	opts := RequestOptions{Timeout: 5, MaxRetries: 1, Stats: stats, Phase: PhaseIndex}
+
+	// Decoding stops after first line, the rest is not read
+	var first string
+	err := GetDecoded(server.URL, opts, func(r io.Reader) error {
+		line, err := bufio.NewReaderSize(r, 16).ReadString('\n')
+		first = line
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "line\n" {
+		t.Fatalf("Unexpected first line %q", first)
+	}
+
+	summary := stats.Summary()
+	if summary.PhaseRequests[PhaseIndex] != 1 || summary.Bytes == 0 || summary.Bytes >= int64(len(body)) {
+		t.Fatalf("Unexpected accounting: %+v", summary)
+	}
+}
+
+func TestResponseLimit(t *testing.T) {
+	body := strings.Repeat("line\n", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") != "" {
+			// Size is not announced, so limit is found while reading
+			w.Write([]byte(body[:10]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[10:]))
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	readAll := func(r io.Reader) error {
+		_, err := io.ReadAll(bufio.NewReader(r))
+		return err
+	}
+	for _, url := range []string{server.URL, server.URL + "?chunked=1"} {
+		opts := RequestOptions{Timeout: 5, MaxRetries: 1, MaxBytes: int64(len(body))}
+		if err := GetDecoded(url, opts, readAll); err != nil {
+			t.Fatalf("Response of limit size should pass: %v", err)
+		}
+		if data, err := GetWithOptions(url, opts); err != nil || len(data) != len(body) {
+			t.Fatalf("Response of limit size should pass: %v, %v bytes", err, len(data))
+		}
+
+		opts.MaxBytes--
+		var tooLarge *ResponseTooLargeError
+		if err := GetDecoded(url, opts, readAll); !errors.As(err, &tooLarge) || tooLarge.Limit != opts.MaxBytes {
+			t.Fatalf("Expected ResponseTooLargeError for %v, got %v", url, err)
+		}
+		if _, err := GetWithOptions(url, opts); !errors.As(err, &tooLarge) {
+			t.Fatalf("Expected ResponseTooLargeError for %v, got %v", url, err)
+		}
+	}
+
+	// Decoders wrapping read errors still fail with ResponseTooLargeError
+	opts := RequestOptions{Timeout: 5, MaxRetries: 1, MaxBytes: 100}
+	err := GetDecoded(server.URL+"?chunked=1", opts, func(r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return fmt.Errorf("decoding failed: %v", err)
+	})
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 0 {
+		t.Fatalf("Expected ResponseTooLargeError, got %v", err)
+	}
+
+	// Limit of index pages does not apply to downloads of captures
+	res := CdxResponse{Config: &RequestConfig{MaxPageBytes: 100}}
+	if data, err := GetWithOptions(server.URL, res.RequestOptions(5, 1)); err != nil || len(data) != len(body) {
+		t.Fatalf("Download larger than MaxPageBytes should pass: %v, %v bytes", err, len(data))
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/flaky":
+			if n == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("data"))
+		case "/range":
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("part"))
+		}
+	}))
+	defer server.Close()
+
+	// Error body is not returned as data, client errors are not retried
+	var statusErr *StatusError
+	data, err := GetWithOptions(server.URL+"/missing", RequestOptions{Timeout: 5, MaxRetries: 3})
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusNotFound || data != nil {
+		t.Fatalf("Expected 404 StatusError, got %q, %v", data, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("404 response should not be retried, made %v requests", n)
+	}
+
+	// Server errors are retried
+	atomic.StoreInt32(&requests, 0)
+	if data, err := GetWithOptions(server.URL+"/flaky", RequestOptions{Timeout: 5, MaxRetries: 2}); err != nil || string(data) != "data" {
+		t.Fatalf("Expected data after retry, got %q, %v", data, err)
+	}
+
+	// Single attempt is made without retries
+	atomic.StoreInt32(&requests, 0)
+	err = GetDecoded(server.URL+"/missing", RequestOptions{Timeout: 5}, func(io.Reader) error { return nil })
+	if !errors.As(err, &statusErr) || atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("Expected single attempt failing with StatusError, got %v after %v requests", err, atomic.LoadInt32(&requests))
+	}
+
+	// Ranged requests accept partial content
+	if _, err := GetWithOptions(server.URL+"/range", RequestOptions{Timeout: 5, MaxRetries: 1}); !errors.As(err, &statusErr) {
+		t.Fatalf("Expected 206 StatusError, got %v", err)
+	}
+	opts := RequestOptions{Timeout: 5, MaxRetries: 1, Expect: []int{http.StatusOK, http.StatusPartialContent}}
+	if data, err := GetWithOptions(server.URL+"/range", opts); err != nil || string(data) != "part" {
+		t.Fatalf("Expected partial content, got %q, %v", data, err)
+	}
+	if data, err := DoRequestWithOptions(server.URL+"/missing", opts); !errors.As(err, &statusErr) || data != nil {
+		t.Fatalf("Expected 404 StatusError, got %q, %v", data, err)
+	}
+}
+
+func TestGetHeaders(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-Path", r.URL.Path)
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/target", http.StatusMovedPermanently)
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/error":
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	// Headers of the redirect itself, not of its target
+	header, err := GetHeaders(server.URL+"/redirect", RequestOptions{Timeout: 5, MaxRetries: 1, Expect: []int{AnyStatus}})
+	if err != nil || header.Get("X-Path") != "/redirect" || header.Get("Location") != "/target" {
+		t.Fatalf("Unexpected headers: %v, %v", header, err)
+	}
+
+	// Any status is accepted without retries
+	for _, path := range []string{"/missing", "/error"} {
+		atomic.StoreInt32(&requests, 0)
+		header, err := GetHeaders(server.URL+path, RequestOptions{Timeout: 5, MaxRetries: 3, Expect: []int{AnyStatus}})
+		if err != nil || header.Get("X-Path") != path || atomic.LoadInt32(&requests) != 1 {
+			t.Fatalf("Unexpected headers of %v after %v requests: %v, %v", path, atomic.LoadInt32(&requests), header, err)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	config := RequestConfig{Limit: 10}
+	if config.Remaining(4) != 6 || config.Remaining(12) != 0 {
+		t.Fatal("Unexpected remaining records")
+	}
+	if (&RequestConfig{}).Remaining(4) != 0 {
+		t.Fatal("No limit should have no remaining records")
+	}
+}
+
+func TestDownloaderPreDownload(t *testing.T) {
+	source := &fileSource{}
+	results := make(chan []*CdxResponse, 1)
+	results <- []*CdxResponse{
+		{Original: "http://example.com/have", MimeType: "text/html", Source: source},
+		{Original: "http://example.com/broken", MimeType: "text/html", Source: source},
+		{Original: "http://example.com/new", MimeType: "text/html", Source: source},
+	}
+	close(results)
+
+	stats := NewStats()
+	errs := make(chan error, 3)
+	d := &Downloader{OutputDir: t.TempDir(), Stats: stats}
+	d.PreDownload = func(res *CdxResponse) (bool, error) {
+		switch res.Original {
+		case "http://example.com/have":
+			return true, nil
+		case "http://example.com/broken":
+			return false, fmt.Errorf("database is down")
+		}
+		return false, nil
+	}
+	d.SaveFiles(results, errs)
+	close(errs)
+
+	summary := stats.Summary()
+	if source.downloads != 1 || summary.Records[RecordSkipped] != 1 || summary.Records[RecordFailed] != 1 || summary.Records[RecordSaved] != 1 {
+		t.Fatalf("Unexpected outcomes: downloads=%v, %v", source.downloads, summary.Records)
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "database is down") {
+		t.Fatalf("Hook error should be reported, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+type decompressReader struct {
+	io.Reader
+	close func() error
+}
+
+func (d *decompressReader) Close() error {
+	if d.close == nil {
+		return nil
+	}
+	return d.close()
+}
+
+// Decompress ... Detects compression of the stream by magic bytes and returns decompressing reader.
+// Supports gzip, zstd and xz, uncompressed streams are returned as is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(xzMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("[Decompress] Cannot read stream header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		// Multistream is on by default, so concatenated gzip members (like in cc-index shards) are read as one
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("[Decompress] Cannot open gzip stream: %w", err)
+		}
+		return gz, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("[Decompress] Cannot open zstd stream: %w", err)
+		}
+		return &decompressReader{Reader: zr, close: func() error { zr.Close(); return nil }}, nil
+	case bytes.HasPrefix(magic, xzMagic):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("[Decompress] Cannot open xz stream: %w", err)
+		}
+		return &decompressReader{Reader: xr}, nil
+	}
+
+	return &decompressReader{Reader: br}, nil
+}
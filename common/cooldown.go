@@ -0,0 +1,165 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Cooldown of host which returned 429 or 503 response without Retry-After header
+const DefaultCooldown = time.Minute
+
+// CooldownStore keeps hosts cooling down after they throttled requests, safe for concurrent use.
+// Cooldowns are persisted into JSON file, so restarted job waits them out instead of re-triggering a ban.
+// Nil store does not wait.
+type CooldownStore struct {
+	Path    string        // File cooldowns are persisted to, not persisted if empty
+	Default time.Duration // Cooldown when throttled response has no Retry-After header, DefaultCooldown if 0
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// NewCooldownStore ... Loads cooldowns persisted into the file, missing file is an empty store
+func NewCooldownStore(path string) (*CooldownStore, error) {
+	s := &CooldownStore{Path: path, until: map[string]time.Time{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[NewCooldownStore] Cannot read cooldowns: %w", err)
+	}
+	if err := jsoniter.Unmarshal(data, &s.until); err != nil {
+		return nil, fmt.Errorf("[NewCooldownStore] Cannot decode cooldowns: %w", err)
+	}
+	return s, nil
+}
+
+// Until ... Returns time the host cools down until, zero if it is not cooling down
+func (s *CooldownStore) Until(host string) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.until[strings.ToLower(host)]
+	if time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// Set ... Makes the host cool down until given time, earlier time does not shorten current cooldown
+func (s *CooldownStore) Set(host string, until time.Time) {
+	if s == nil {
+		return
+	}
+	host = strings.ToLower(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !until.After(s.until[host]) {
+		return
+	}
+	s.until[host] = until.UTC()
+	s.save()
+}
+
+// Throttled ... Starts cooldown of URL host for Retry-After duration, or default one if header is not set or bad
+func (s *CooldownStore) Throttled(rawURL string, header http.Header) {
+	if s == nil {
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	wait, ok := parseRetryAfter(header.Get("Retry-After"), now)
+	if !ok {
+		wait = s.Default
+		if wait <= 0 {
+			wait = DefaultCooldown
+		}
+	}
+	log.Printf("[CooldownStore] %v throttled requests, cooling down for %v", u.Host, wait.Round(time.Second))
+	s.Set(u.Host, now.Add(wait))
+}
+
+// Wait ... Blocks until URL host cools down, returns time waited.
+// Wait ends early with ErrJobCanceled once job of the gate is canceled, paused job waits until it is resumed.
+func (s *CooldownStore) Wait(rawURL string, gate *JobGate) (time.Duration, error) {
+	if s == nil {
+		return 0, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, nil
+	}
+
+	wait := time.Until(s.Until(u.Host))
+	if wait <= 0 {
+		return 0, nil
+	}
+	log.Printf("[CooldownStore] Waiting %v for %v to cool down", wait.Round(time.Second), u.Host)
+	start := time.Now()
+	if err := gate.Sleep(wait); err != nil {
+		return time.Since(start), err
+	}
+	return wait, nil
+}
+
+// Writes cooldowns which have not passed yet into file, must be called with lock held
+func (s *CooldownStore) save() {
+	now := time.Now()
+	for host, until := range s.until {
+		if now.After(until) {
+			delete(s.until, host)
+		}
+	}
+	if s.Path == "" {
+		return
+	}
+
+	data, err := jsoniter.MarshalIndent(s.until, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(s.Path, data)
+	}
+	if err != nil {
+		log.Printf("[CooldownStore] Cannot persist cooldowns: %v", err)
+	}
+}
+
+// Statuses archives use to throttle requests
+func isThrottled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// Parses Retry-After given in seconds or as HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, seconds >= 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), date.After(now)
+	}
+	return 0, false
+}
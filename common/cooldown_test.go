@@ -0,0 +1,94 @@
+package common
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCooldownStorePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cooldowns.json")
+	store, err := NewCooldownStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Throttled("https://web.archive.org/cdx/search/cdx?url=example.com", http.Header{"Retry-After": {"120"}})
+	store.Set("index.commoncrawl.org", time.Now().Add(-time.Minute))
+	until := store.Until("web.archive.org")
+	if wait := time.Until(until); wait < 110*time.Second || wait > 120*time.Second {
+		t.Fatalf("Unexpected cooldown: %v", wait)
+	}
+
+	// Shorter cooldown does not cut the current one
+	store.Set("WEB.archive.org", time.Now().Add(time.Second))
+	if !store.Until("web.archive.org").Equal(until) {
+		t.Fatalf("Cooldown was shortened")
+	}
+
+	restarted, err := NewCooldownStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Until("web.archive.org").Equal(until) {
+		t.Fatalf("Cooldown was not persisted: %v", restarted.Until("web.archive.org"))
+	}
+	if !restarted.Until("index.commoncrawl.org").IsZero() {
+		t.Fatalf("Passed cooldown should not be kept")
+	}
+}
+
+func TestCooldownStoreWait(t *testing.T) {
+	store, _ := NewCooldownStore("")
+	store.Default = 50 * time.Millisecond
+	store.Throttled("http://archive.test/file", http.Header{})
+
+	if wait, err := store.Wait("http://archive.test/other", nil); err != nil || wait <= 0 || wait > store.Default {
+		t.Fatalf("Unexpected wait: %v, %v", wait, err)
+	}
+	if wait, _ := store.Wait("http://archive.test/other", nil); wait != 0 {
+		t.Fatalf("Cooldown should be over, waited %v", wait)
+	}
+
+	var nilStore *CooldownStore
+	nilStore.Throttled("http://archive.test/file", http.Header{})
+	if wait, _ := nilStore.Wait("http://archive.test/file", nil); wait != 0 {
+		t.Fatalf("Nil store should not wait")
+	}
+}
+
+func TestCooldownStoreWaitGate(t *testing.T) {
+	store, _ := NewCooldownStore("")
+	store.Default = time.Minute
+	store.Throttled("http://archive.test/file", http.Header{})
+
+	// Canceled job stops waiting for the cooldown
+	gate := NewJobGate()
+	gate.Pause()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		gate.Cancel()
+	}()
+	wait, err := store.Wait("http://archive.test/file", gate)
+	if err != ErrJobCanceled || wait > time.Second {
+		t.Fatalf("Wait should end with cancel: %v, %v", wait, err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"30":                            30 * time.Second,
+		"Mon, 01 May 2023 10:05:00 GMT": 5 * time.Minute,
+	} {
+		if got, ok := parseRetryAfter(value, now); !ok || got != want {
+			t.Fatalf("%v: got %v", value, got)
+		}
+	}
+	for _, value := range []string{"", "soon", "-5", "Mon, 01 May 2023 09:00:00 GMT"} {
+		if _, ok := parseRetryAfter(value, now); ok {
+			t.Fatalf("%v should not be parsed", value)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDX timestamps (and from/to server parameters) are always in UTC.
+// All dates parsed here are normalized to UTC, so local date math matches archive data.
+
+var relativeDate = regexp.MustCompile(`^-(\d+)([hdwmy])$`)
+
+// Layouts of absolute dates, tried in order
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	CdxTimeFormat,
+	"200601021504",
+	"2006010215",
+	"20060102",
+	"200601",
+	"2006",
+}
+
+// ParseDate ... Parses date in one of the formats (dates without zone are considered UTC):
+//
+//	RFC3339: 2020-01-31T10:00:00+02:00
+//	ISO date: 2020-01-31
+//	CDX timestamp of any precision: 20200131, 20200131100000, 2020
+//	Relative to now: -12h, -30d, -2w, -6m, -1y
+//	now, today
+func ParseDate(s string) (time.Time, error) {
+	return parseDate(s, time.Now())
+}
+
+func parseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	now = now.UTC()
+
+	switch s {
+	case "now":
+		return now, nil
+	case "today":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+
+	if m := relativeDate.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "m":
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	for _, layout := range dateLayouts {
+		if len(layout) != len(s) && layout != time.RFC3339 {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("[ParseDate] Unknown date format '%v', use RFC3339, yyyy-mm-dd, yyyymmdd[hhmmss] or relative like -30d", s)
+}
+
+// ParsePeriod ... Parses date with ParseDate and returns the period its precision stands for, end excluded:
+// 2019 is the whole year, 201903 the month, 2019-03-20 (or today) the day.
+// Dates with time of day, relative dates and now are periods of zero length.
+func ParsePeriod(s string) (from, to time.Time, err error) {
+	return parsePeriod(s, time.Now())
+}
+
+func parsePeriod(s string, now time.Time) (time.Time, time.Time, error) {
+	from, err := parseDate(s, now)
+	if err != nil {
+		return from, from, err
+	}
+
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "now" || relativeDate.MatchString(s) {
+		return from, from, nil
+	}
+	switch len(s) {
+	case len("2006"):
+		return from, from.AddDate(1, 0, 0), nil
+	case len("200601"):
+		return from, from.AddDate(0, 1, 0), nil
+	case len("today"), len("20060102"), len("2006-01-02"):
+		return from, from.AddDate(0, 0, 1), nil
+	}
+	return from, from, nil
+}
+
+// Formats date as CDX server from/to parameter, with day precision if time of day is not set
+func cdxDate(t time.Time) string {
+	t = t.UTC()
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("20060102")
+	}
+	return t.Format(CdxTimeFormat)
+}
+
+// SetDates ... Parses and sets date range of the config with ParseDate, empty strings are ignored
+func (config *RequestConfig) SetDates(from, to string) error {
+	if from != "" {
+		t, err := ParseDate(from)
+		if err != nil {
+			return fmt.Errorf("[SetDates] Bad from date: %w", err)
+		}
+		config.FromDate = t
+	}
+	if to != "" {
+		t, err := ParseDate(to)
+		if err != nil {
+			return fmt.Errorf("[SetDates] Bad to date: %w", err)
+		}
+		config.ToDate = t
+	}
+	if !config.FromDate.IsZero() && !config.ToDate.IsZero() && config.ToDate.Before(config.FromDate) {
+		return fmt.Errorf("[SetDates] To date %v is before from date %v", config.ToDate, config.FromDate)
+	}
+	return nil
+}
+
+// Time ... Returns capture time of the record in UTC
+func (r *CdxResponse) Time() (time.Time, error) {
+	t, err := time.ParseInLocation(CdxTimeFormat, r.Timestamp, time.UTC)
+	if err != nil {
+		return t, fmt.Errorf("[Time] Bad timestamp '%v': %w", r.Timestamp, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2023, 3, 31, 12, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	cases := map[string]time.Time{
+		"20200131":                  time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		"2020-01-31":                time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		"20200131101500":            time.Date(2020, 1, 31, 10, 15, 0, 0, time.UTC),
+		"2020-01-31T10:00:00+02:00": time.Date(2020, 1, 31, 8, 0, 0, 0, time.UTC),
+		"2020":                      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		"-30d":                      time.Date(2023, 3, 1, 17, 30, 0, 0, time.UTC),
+		"-12h":                      time.Date(2023, 3, 31, 5, 30, 0, 0, time.UTC),
+		"-1y":                       time.Date(2022, 3, 31, 17, 30, 0, 0, time.UTC),
+		"today":                     time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	for in, expected := range cases {
+		got, err := parseDate(in, now)
+		if err != nil {
+			t.Fatalf("%v: %v", in, err)
+		}
+		if !got.Equal(expected) || got.Location() != time.UTC {
+			t.Fatalf("parseDate(%v) = %v, expected %v", in, got, expected)
+		}
+	}
+
+	if _, err := parseDate("31/01/2020", now); err == nil {
+		t.Fatalf("Unknown format should fail")
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Date(2023, 3, 31, 12, 30, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	cases := map[string][2]time.Time{
+		"2019":           {day(2019, 1, 1), day(2020, 1, 1)},
+		"201903":         {day(2019, 3, 1), day(2019, 4, 1)},
+		"20190320":       {day(2019, 3, 20), day(2019, 3, 21)},
+		"2019-03-20":     {day(2019, 3, 20), day(2019, 3, 21)},
+		"today":          {day(2023, 3, 31), day(2023, 4, 1)},
+		"20190320101500": {time.Date(2019, 3, 20, 10, 15, 0, 0, time.UTC), time.Date(2019, 3, 20, 10, 15, 0, 0, time.UTC)},
+		"-12h":           {now.Add(-12 * time.Hour), now.Add(-12 * time.Hour)},
+		"-1000d":         {now.AddDate(0, 0, -1000), now.AddDate(0, 0, -1000)},
+	}
+
+	for in, expected := range cases {
+		from, to, err := parsePeriod(in, now)
+		if err != nil || !from.Equal(expected[0]) || !to.Equal(expected[1]) {
+			t.Fatalf("parsePeriod(%v) = %v - %v, %v, expected %v", in, from, to, err, expected)
+		}
+	}
+}
+
+func TestConfigDates(t *testing.T) {
+	config := RequestConfig{URL: "example.com", SinglePage: true}
+	if err := config.SetDates("2020-01-31T10:00:00+02:00", "20200201"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "http://cdx?url=example.com&output=json&from=20200131080000&to=20200201"
+	if got := config.GetUrl("http://cdx", 0); got != expected {
+		t.Fatalf("Got %v, expected %v", got, expected)
+	}
+
+	if err := config.SetDates("20200201", "20200101"); err == nil {
+		t.Fatalf("Reversed range should fail")
+	}
+}
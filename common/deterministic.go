@@ -0,0 +1,50 @@
+package common
+
+import "time"
+
+// DeterministicUserAgent is sent by reproducible runs instead of random browser User-Agents
+const DeterministicUserAgent = "gogetcrawl (+https://github.com/karust/gogetcrawl)"
+
+// Pin ... Fixes what makes results of the query change between runs, so the harvest can be repeated from its manifest.
+// Open end date is set to epoch, so captures archived later are not found, results are ordered by time
+// if no order is set and requests are sent with fixed User-Agent. Indexes are pinned by plan of the query, see Plan.Pin.
+func (config RequestConfig) Pin(epoch time.Time) RequestConfig {
+	if config.ToDate.IsZero() {
+		config.ToDate = epoch.UTC().Truncate(time.Second)
+	}
+	if config.Sort == "" {
+		config.Sort = SortAscending
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = DeterministicUserAgent
+	}
+	return config
+}
+
+// Pin ... Pins config of the planned query, its steps keep indexes resolved before the end date was set.
+// Otherwise pinned end date would change them, like querying all Common Crawl crawls instead of the newest one.
+func (plan *Plan) Pin(epoch time.Time) {
+	plan.Config = plan.Config.Pin(epoch)
+}
+
+// PinOutput ... Makes output write the same bytes for the same records, stamping them with epoch instead of the time of writing.
+// Returns false for outputs which cannot be reproduced, like WACZ packages.
+func PinOutput(output Output, epoch time.Time) bool {
+	epoch = epoch.UTC()
+	switch o := output.(type) {
+	case *StorageOutput, *DirOutput:
+		return true
+	case *StreamOutput:
+		// Payloads are written as is, WARC records get IDs and dates of writing
+		return o.format != StreamWarc
+	case *TarOutput:
+		o.Epoch = epoch
+	case *ZipOutput:
+		o.Epoch = epoch
+	case *WarcOutput:
+		o.Epoch = epoch
+	default:
+		return false
+	}
+	return true
+}
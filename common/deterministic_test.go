@@ -0,0 +1,109 @@
+package common
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	epoch := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	source := indexedSource{}
+	plan := &Plan{Config: RequestConfig{URL: "example.com"}, Steps: []PlanStep{
+		{Source: source, SourceName: "Stub", Index: "CC-MAIN-2023-14"},
+		{Source: source, SourceName: "Stub", Index: "CC-MAIN-2023-06"},
+	}}
+	plan.Pin(epoch)
+
+	config := plan.Config
+	if !config.ToDate.Equal(epoch) || config.Sort != SortAscending || config.UserAgent != DeterministicUserAgent {
+		t.Fatalf("Config is not pinned: %+v", config)
+	}
+	if pinned := (RequestConfig{ToDate: epoch.Add(-time.Hour), Sort: SortDescending}).Pin(epoch); !pinned.ToDate.Equal(epoch.Add(-time.Hour)) || pinned.Sort != SortDescending {
+		t.Fatalf("Set end date and order should be kept: %+v", pinned)
+	}
+
+	m := NewManifest("gogetcrawl test", nil)
+	m.AddPlan(plan)
+	query := m.Queries[0]
+	if !query.ToDate.Equal(epoch) || query.UserAgent != DeterministicUserAgent || len(query.Sources) != 1 || len(query.Sources[0].Indexes) != 2 {
+		t.Fatalf("Plan is not recorded: %+v", query)
+	}
+	if replayed := query.Plan([]Source{source}); len(replayed.Steps) != 2 || replayed.Config.UserAgent != DeterministicUserAgent {
+		t.Fatalf("Replayed plan differs: %+v", replayed)
+	}
+}
+
+func TestPinOutput(t *testing.T) {
+	epoch := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20230101000000", MimeType: "text/html"}
+
+	write := func(dir string) (string, []byte) {
+		warcs, _ := NewWarcOutput(filepath.Join(dir, "warc"), "test", 0, nil)
+		tar, _ := NewTarOutput(filepath.Join(dir, "files.tar.gz"))
+		for _, output := range []Output{warcs, tar} {
+			if !PinOutput(output, epoch) {
+				t.Fatalf("Output should be pinned: %T", output)
+			}
+		}
+		warcs.WriteRecord("a.html", res, []byte("<html></html>"))
+		tar.Write("a.html", []byte("<html></html>"))
+		warcs.Close()
+		tar.Close()
+
+		warc, _ := os.ReadFile(warcs.Files()[0])
+		archive, _ := os.ReadFile(filepath.Join(dir, "files.tar.gz"))
+		return filepath.Base(warcs.Files()[0]), append(warc, archive...)
+	}
+
+	name1, data1 := write(t.TempDir())
+	time.Sleep(time.Second)
+	name2, data2 := write(t.TempDir())
+	if name1 != name2 || name1 != "test-20230501120000-00000-localhost.warc.gz" {
+		t.Fatalf("Unexpected WARC names: %v, %v", name1, name2)
+	}
+	if !bytes.Equal(data1, data2) {
+		t.Fatalf("Pinned outputs should be identical")
+	}
+
+	stream, _ := NewStreamOutput(&bytes.Buffer{}, StreamWarc)
+	if PinOutput(stream, epoch) {
+		t.Fatalf("WARC stream cannot be reproduced")
+	}
+}
+
+func TestManifestInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allow.txt")
+	os.WriteFile(path, []byte("*.example.com\n"), 0o644)
+
+	m := NewManifest("gogetcrawl test", nil)
+	if err := m.AddInput("allow-file", path); err != nil {
+		t.Fatal(err)
+	}
+	if errs := m.CheckInputs(); len(errs) != 0 {
+		t.Fatalf("Input is not changed: %v", errs)
+	}
+	os.WriteFile(path, []byte("*.example.org\n"), 0o644)
+	if errs := m.CheckInputs(); len(errs) != 1 {
+		t.Fatalf("Changed input should be reported: %v", errs)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	agents := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.UserAgent()
+	}))
+	defer server.Close()
+
+	if _, err := DoRequestWithOptions(server.URL, RequestOptions{Timeout: 5, UserAgent: DeterministicUserAgent}); err != nil {
+		t.Fatal(err)
+	}
+	if agent := <-agents; agent != DeterministicUserAgent {
+		t.Fatalf("Unexpected User-Agent: %v", agent)
+	}
+}
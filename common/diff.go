@@ -0,0 +1,102 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Kinds of changes between harvests
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// DiffEntry is URL which differs between harvests, with its latest files in each of them
+type DiffEntry struct {
+	URL    string        `json:"url"`
+	Change string        `json:"change"`
+	Old    *ManifestFile `json:"old,omitempty"`
+	New    *ManifestFile `json:"new,omitempty"`
+}
+
+// HarvestDiff is what changed between two runs of the same query
+type HarvestDiff struct {
+	Added     []DiffEntry `json:"added"`
+	Removed   []DiffEntry `json:"removed"`
+	Changed   []DiffEntry `json:"changed"`
+	Unchanged int         `json:"unchanged"`
+}
+
+// DiffManifests ... Compares files of two harvest manifests by URL.
+// URL is changed if content digest of its latest capture differs.
+func DiffManifests(older, newer *Manifest) *HarvestDiff {
+	oldFiles, newFiles := latestFiles(older), latestFiles(newer)
+	diff := &HarvestDiff{Added: []DiffEntry{}, Removed: []DiffEntry{}, Changed: []DiffEntry{}}
+
+	for url, nf := range newFiles {
+		of, ok := oldFiles[url]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, DiffEntry{URL: url, Change: DiffAdded, New: nf})
+		case !sameContent(of, nf):
+			diff.Changed = append(diff.Changed, DiffEntry{URL: url, Change: DiffChanged, Old: of, New: nf})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for url, of := range oldFiles {
+		if _, ok := newFiles[url]; !ok {
+			diff.Removed = append(diff.Removed, DiffEntry{URL: url, Change: DiffRemoved, Old: of})
+		}
+	}
+
+	for _, entries := range [][]DiffEntry{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	}
+	return diff
+}
+
+// Returns latest capture file of each URL
+func latestFiles(m *Manifest) map[string]*ManifestFile {
+	files := map[string]*ManifestFile{}
+	for i := range m.Files {
+		f := &m.Files[i]
+		if prev, ok := files[f.Original]; !ok || prev.Timestamp < f.Timestamp {
+			files[f.Original] = f
+		}
+	}
+	return files
+}
+
+// Index server digests are compared if both are known, so payload processing does not make a change.
+// Otherwise SHA-256 digests of the written contents are.
+func sameContent(a, b *ManifestFile) bool {
+	if a.Digest != "" && b.Digest != "" {
+		return normalizeDigest(a.Digest) == normalizeDigest(b.Digest)
+	}
+	return a.SHA256 == b.SHA256
+}
+
+// WriteNDJSON ... Writes changes as newline-delimited JSON, one entry per line
+func (d *HarvestDiff) WriteNDJSON(w io.Writer) error {
+	for _, entries := range [][]DiffEntry{d.Added, d.Removed, d.Changed} {
+		for _, e := range entries {
+			line, err := jsoniter.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("[WriteNDJSON] Cannot encode entry: %w", err)
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("[WriteNDJSON] Cannot write entry: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *HarvestDiff) String() string {
+	return fmt.Sprintf("added: %v, removed: %v, changed: %v, unchanged: %v", len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+}
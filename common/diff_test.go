@@ -0,0 +1,46 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffManifests(t *testing.T) {
+	older := &Manifest{Files: []ManifestFile{
+		{Original: "http://example.com/", Timestamp: "20230101000000", Digest: "AAA"},
+		{Original: "http://example.com/", Timestamp: "20230201000000", Digest: "BBB"},
+		{Original: "http://example.com/about", Timestamp: "20230101000000", Digest: "CCC"},
+		{Original: "http://example.com/old", Timestamp: "20230101000000", SHA256: "x"},
+		{Original: "http://example.com/page", Timestamp: "20230101000000", Digest: "EEE", SHA256: "z"},
+	}}
+	newer := &Manifest{Files: []ManifestFile{
+		{Original: "http://example.com/", Timestamp: "20230301000000", Digest: "sha1:bbb"},
+		{Original: "http://example.com/about", Timestamp: "20230301000000", Digest: "DDD"},
+		{Original: "http://example.com/new", Timestamp: "20230301000000", SHA256: "y"},
+		// Source without index digest is compared by written content
+		{Original: "http://example.com/page", Timestamp: "20230301000000", SHA256: "z"},
+	}}
+
+	diff := DiffManifests(older, newer)
+	if diff.Unchanged != 2 {
+		t.Fatalf("Expected 2 unchanged URLs, got %v", diff.Unchanged)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].URL != "http://example.com/new" {
+		t.Fatalf("Unexpected added: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].URL != "http://example.com/old" {
+		t.Fatalf("Unexpected removed: %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Old.Digest != "CCC" || diff.Changed[0].New.Digest != "DDD" {
+		t.Fatalf("Unexpected changed: %+v", diff.Changed)
+	}
+
+	var buf bytes.Buffer
+	if err := diff.WriteNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Fatalf("Expected 3 report lines, got %v", lines)
+	}
+}
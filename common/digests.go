@@ -0,0 +1,112 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DigestSet is a set of payload digests, as reported by CDX servers, safe for concurrent use.
+// Nil set contains nothing and ignores additions.
+type DigestSet struct {
+	mu      sync.Mutex
+	digests map[string]bool
+}
+
+func NewDigestSet() *DigestSet {
+	return &DigestSet{digests: map[string]bool{}}
+}
+
+// LoadDigests ... Reads digests from file with one digest per line, like the one made by DigestSet.Save.
+// Empty lines and lines starting with # are skipped, "sha1:" prefixes are ignored.
+func LoadDigests(path string) (*DigestSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadDigests] Cannot open file: %w", err)
+	}
+	defer file.Close()
+
+	set := NewDigestSet()
+	if err := set.Import(file); err != nil {
+		return nil, fmt.Errorf("[LoadDigests] %w", err)
+	}
+	return set, nil
+}
+
+// Import ... Adds digests listed in reader, one per line
+func (s *DigestSet) Import(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s.Add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Cannot read digests: %w", err)
+	}
+	return nil
+}
+
+func normalizeDigest(digest string) string {
+	digest = strings.TrimSpace(digest)
+	if i := strings.Index(digest, ":"); i != -1 {
+		digest = digest[i+1:]
+	}
+	return strings.ToUpper(digest)
+}
+
+func (s *DigestSet) Add(digest string) {
+	if s == nil || digest == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.digests[normalizeDigest(digest)] = true
+}
+
+func (s *DigestSet) Has(digest string) bool {
+	if s == nil || digest == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.digests[normalizeDigest(digest)]
+}
+
+func (s *DigestSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.digests)
+}
+
+// Save ... Writes sorted digests into file, one per line
+func (s *DigestSet) Save(path string) error {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return fmt.Errorf("[Save] Cannot create file: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	s.mu.Lock()
+	for _, digest := range sortedKeys(s.digests) {
+		fmt.Fprintln(w, digest)
+	}
+	s.mu.Unlock()
+
+	if err := w.Flush(); err != nil {
+		file.Abort()
+		return fmt.Errorf("[Save] Cannot write digests: %w", err)
+	}
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("[Save] Cannot commit digests: %w", err)
+	}
+	return nil
+}
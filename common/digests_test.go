@@ -0,0 +1,61 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Source stub returning fixed file
+type fileSource struct {
+	planSource
+	downloads int
+}
+
+func (s *fileSource) GetFile(res *CdxResponse) ([]byte, error) {
+	s.downloads++
+	return []byte("<html></html>"), nil
+}
+
+func TestDigestSet(t *testing.T) {
+	set := NewDigestSet()
+	if err := set.Import(strings.NewReader("# previous harvest\nsha1:AAAA\n\nbbbb\n")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !set.Has("AAAA") || !set.Has("sha1:BBBB") || set.Has("CCCC") || set.Len() != 2 {
+		t.Fatalf("Incorrect digest set")
+	}
+
+	path := filepath.Join(t.TempDir(), "digests.txt")
+	set.Add("CCCC")
+	if err := set.Save(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "AAAA\nBBBB\nCCCC\n" {
+		t.Fatalf("Incorrect export: %q", data)
+	}
+}
+
+func TestDownloaderSkipsDigests(t *testing.T) {
+	source := &fileSource{}
+	digests := NewDigestSet()
+	digests.Add("AAAA")
+
+	results := make(chan []*CdxResponse, 1)
+	results <- []*CdxResponse{
+		{Original: "http://example.com/1", MimeType: "text/html", Digest: "AAAA", Source: source},
+		{Original: "http://example.com/2", MimeType: "text/html", Digest: "BBBB", Source: source},
+		{Original: "http://example.com/3", MimeType: "text/html", Digest: "BBBB", Source: source},
+	}
+	close(results)
+
+	stats := NewStats()
+	d := &Downloader{OutputDir: t.TempDir(), Digests: digests, Stats: stats}
+	d.SaveFiles(results, make(chan error, 3))
+
+	summary := stats.Summary()
+	if source.downloads != 1 || summary.Records[RecordSkipped] != 2 || summary.Records[RecordSaved] != 1 {
+		t.Fatalf("Duplicates are not skipped: downloads=%v, %v", source.downloads, summary)
+	}
+}
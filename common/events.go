@@ -0,0 +1,144 @@
+package common
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Types of pipeline lifecycle events
+const (
+	EventJobStarted       = "job_started"
+	EventIndexResolved    = "index_resolved"    // Number of pages of the index is known
+	EventPageFetched      = "page_fetched"      // Index page is queried, Error is set if it failed
+	EventRecordDownloaded = "record_downloaded" // Record file is saved
+	EventRecordFailed     = "record_failed"
+	EventJobFinished      = "job_finished" // Error is set if job stopped early
+)
+
+// Event of the pipeline lifecycle, fields not related to the event type are empty
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	JobID     string    `json:"job,omitempty"`
+	URL       string    `json:"url,omitempty"` // Query URL, or original URL of record events
+	Source    string    `json:"source,omitempty"`
+	Index     string    `json:"index,omitempty"`
+	Page      *int      `json:"page,omitempty"` // Index page number, starting from 0
+	Pages     int       `json:"pages,omitempty"`
+	Records   int       `json:"records,omitempty"` // Records selected from the page
+	Timestamp string    `json:"timestamp,omitempty"`
+	File      string    `json:"file,omitempty"` // Name record was saved under
+	Bytes     int       `json:"bytes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// EventLog streams lifecycle events as newline-delimited JSON into writer and/or into channel,
+// so orchestration can tail the pipeline instead of parsing logs. Safe for concurrent use, nil log drops events.
+type EventLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	ch     chan Event
+	closed bool
+}
+
+// NewEventLog ... Writes events to w as NDJSON, each event is written with single Write call
+func NewEventLog(w io.Writer) *EventLog {
+	return &EventLog{w: w}
+}
+
+// NewEventChannel ... Sends events into returned channel with given buffer, closed by EventLog.Close.
+// Pipeline blocks while buffer is full, so channel must be drained.
+func NewEventChannel(buffer int) (*EventLog, <-chan Event) {
+	l := &EventLog{ch: make(chan Event, buffer)}
+	return l, l.ch
+}
+
+// Emit ... Stamps event with current time and sends it, events emitted after Close are dropped
+func (l *EventLog) Emit(event Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	if l.w != nil {
+		line, err := jsoniter.Marshal(event)
+		if err == nil {
+			_, err = l.w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			log.Printf("[EventLog] Cannot write event: %v", err)
+		}
+	}
+	if l.ch != nil {
+		l.ch <- event
+	}
+}
+
+// Close ... Closes event channel, events are not sent anymore
+func (l *EventLog) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed && l.ch != nil {
+		close(l.ch)
+	}
+	l.closed = true
+}
+
+// Emit ... Sends event of the job to config event log, binding it to the job and its query URL
+func (config *RequestConfig) Emit(event Event) {
+	if config.Events == nil {
+		return
+	}
+	event.JobID = config.JobID
+	if event.URL == "" {
+		event.URL = config.URL
+	}
+	config.Events.Emit(event)
+}
+
+// EmitFinished ... Sends job_finished event with error of the job, if any
+func (config *RequestConfig) EmitFinished(err error) {
+	event := Event{Type: EventJobFinished}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	config.Emit(event)
+}
+
+// EmitPage ... Sends page_fetched event of the source index page
+func (config *RequestConfig) EmitPage(source, index string, page, records int, err error) {
+	event := Event{Type: EventPageFetched, Source: source, Index: index, Page: &page, Records: records}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	config.Emit(event)
+}
+
+// Sends record event to event log of the config record was found with
+func (r *CdxResponse) emit(eventType, file string, bytes int, err error) {
+	if r.Config == nil || r.Config.Events == nil {
+		return
+	}
+	event := Event{Type: eventType, URL: r.Original, Timestamp: r.Timestamp, File: file, Bytes: bytes}
+	if r.Source != nil {
+		event.Source = r.Source.Name()
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	r.Config.Emit(event)
+}
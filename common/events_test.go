@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Source stub finding two records, second one fails PreDownload
+type eventSource struct {
+	fileSource
+}
+
+func (s *eventSource) GetPages(config RequestConfig) ([]*CdxResponse, error) {
+	records := []*CdxResponse{
+		{Original: "http://example.com/1", Timestamp: "20200101000000", MimeType: "text/html", Source: s},
+		{Original: "http://example.com/2", Timestamp: "20200101000000", MimeType: "text/html", Source: s},
+	}
+	config.AttachRecords(records)
+	config.EmitPage(s.Name(), "", 0, len(records), nil)
+	return records, nil
+}
+
+func TestHarvestEvents(t *testing.T) {
+	events, ch := NewEventChannel(10)
+	d := &Downloader{OutputDir: t.TempDir(), PreDownload: func(res *CdxResponse) (bool, error) {
+		if strings.HasSuffix(res.Original, "/2") {
+			return false, errors.New("denied")
+		}
+		return false, nil
+	}}
+	config := RequestConfig{URL: "example.com/*", JobID: "job1", Events: events}
+	if _, err := d.Harvest(&eventSource{}, config); err != nil {
+		t.Fatal(err)
+	}
+	events.Close()
+
+	types := []string{}
+	for event := range ch {
+		if event.JobID != "job1" || event.Time.IsZero() {
+			t.Fatalf("Event is not bound to the job: %+v", event)
+		}
+		types = append(types, event.Type)
+		switch event.Type {
+		case EventPageFetched:
+			if *event.Page != 0 || event.Records != 2 || event.URL != "example.com/*" {
+				t.Fatalf("Unexpected page event: %+v", event)
+			}
+		case EventRecordDownloaded:
+			if event.URL != "http://example.com/1" || event.File == "" || event.Bytes != len("<html></html>") {
+				t.Fatalf("Unexpected download event: %+v", event)
+			}
+		case EventRecordFailed:
+			if event.URL != "http://example.com/2" || !strings.Contains(event.Error, "denied") {
+				t.Fatalf("Unexpected failure event: %+v", event)
+			}
+		}
+	}
+
+	expected := []string{EventJobStarted, EventPageFetched, EventRecordDownloaded, EventRecordFailed, EventJobFinished}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Unexpected events: %v", types)
+	}
+
+	// Closed log drops events
+	events.Emit(Event{Type: EventJobStarted})
+}
+
+func TestEventLogNDJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := RequestConfig{URL: "example.com", JobID: "job1", Events: NewEventLog(buf)}
+	config.Emit(Event{Type: EventIndexResolved, Source: "CommonCrawl", Index: "CC-MAIN-2023-50", Pages: 3})
+	config.EmitFinished(errors.New("budget exhausted"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Unexpected output: %q", buf.String())
+	}
+	if !strings.Contains(lines[0], `"type":"index_resolved","job":"job1","url":"example.com","source":"CommonCrawl","index":"CC-MAIN-2023-50","pages":3}`) {
+		t.Fatalf("Unexpected event: %v", lines[0])
+	}
+	if !strings.Contains(lines[1], `"type":"job_finished"`) || !strings.Contains(lines[1], `"error":"budget exhausted"`) {
+		t.Fatalf("Unexpected event: %v", lines[1])
+	}
+
+	var nilLog *EventLog
+	nilLog.Emit(Event{Type: EventJobStarted})
+	nilLog.Close()
+}
@@ -0,0 +1,321 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RecordExpr is a filter expression evaluated locally over record fields, for cases CDX server filters cannot express.
+// Comparisons are "field op value", where value is quoted string or number, joined with &&, || and !, grouped with parentheses.
+// Operators: ==, != (numeric if both sides are numbers), <, <=, >, >= (numeric), =~, !~ (regular expression).
+//
+//	ex: status == 200 && mime =~ "text/html" && length > 1024
+//	ex: !(url =~ "\.(css|js)$") || timestamp >= 20200101000000
+type RecordExpr struct {
+	source string
+	root   exprNode
+}
+
+type exprNode interface {
+	eval(res *CdxResponse) bool
+}
+
+type exprAnd struct{ left, right exprNode }
+type exprOr struct{ left, right exprNode }
+type exprNot struct{ node exprNode }
+
+func (n exprAnd) eval(res *CdxResponse) bool { return n.left.eval(res) && n.right.eval(res) }
+func (n exprOr) eval(res *CdxResponse) bool  { return n.left.eval(res) || n.right.eval(res) }
+func (n exprNot) eval(res *CdxResponse) bool { return !n.node.eval(res) }
+
+// Comparison of record field with literal value
+type exprCompare struct {
+	field    string
+	op       string
+	value    string
+	number   float64
+	isNumber bool
+	regex    *regexp.Regexp
+}
+
+func (n exprCompare) eval(res *CdxResponse) bool {
+	value := *RecordField(res, n.field)
+
+	switch n.op {
+	case "=~":
+		return n.regex.MatchString(value)
+	case "!~":
+		return !n.regex.MatchString(value)
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	isNumber := err == nil && n.isNumber
+	switch n.op {
+	case "==":
+		if isNumber {
+			return number == n.number
+		}
+		return value == n.value
+	case "!=":
+		if isNumber {
+			return number != n.number
+		}
+		return value != n.value
+	}
+
+	// Ordering of missing or non-numeric values is false
+	if !isNumber {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return number < n.number
+	case "<=":
+		return number <= n.number
+	case ">":
+		return number > n.number
+	default:
+		return number >= n.number
+	}
+}
+
+// Token kinds
+const (
+	tokenIdent = iota
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenEnd
+)
+
+type exprToken struct {
+	kind  int
+	value string
+	pos   int
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("[ParseExpr] Unterminated string at %v", i)
+			}
+			raw := s[i+1 : end]
+			if c == '"' {
+				// Backslashes matter in regular expressions, so only quotes are unescaped
+				raw = strings.ReplaceAll(raw, `\"`, `"`)
+			}
+			tokens = append(tokens, exprToken{tokenString, raw, i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			end := i + 1
+			for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, s[i:end], i})
+			i = end
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || s[end] == '-' || s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' || s[end] >= '0' && s[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokenIdent, s[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("[ParseExpr] Unexpected '%c' at %v", c, i)
+			}
+			tokens = append(tokens, exprToken{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{tokenEnd, "", len(s)}), nil
+}
+
+// Recursive descent parser, precedence from lowest: ||, &&, !
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOp && t.value == op
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.isOp("||") {
+		p.next()
+		var right exprNode
+		if right, err = p.parseAnd(); err == nil {
+			left = exprOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.isOp("&&") {
+		p.next()
+		var right exprNode
+		if right, err = p.parseUnary(); err == nil {
+			left = exprAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!") {
+		p.next()
+		node, err := p.parseUnary()
+		return exprNot{node}, err
+	}
+
+	if p.isOp("(") {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, fmt.Errorf("[ParseExpr] Expected ')' at %v", p.peek().pos)
+		}
+		p.next()
+		return node, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	field := p.next()
+	if field.kind != tokenIdent {
+		return nil, fmt.Errorf("[ParseExpr] Expected field name at %v", field.pos)
+	}
+	if RecordField(&CdxResponse{}, field.value) == nil {
+		return nil, fmt.Errorf("[ParseExpr] Unknown field '%v'", field.value)
+	}
+
+	op := p.next()
+	switch op.value {
+	case "==", "!=", "=~", "!~", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("[ParseExpr] Expected comparison operator at %v", op.pos)
+	}
+
+	value := p.next()
+	if value.kind != tokenString && value.kind != tokenNumber {
+		return nil, fmt.Errorf("[ParseExpr] Expected quoted string or number at %v", value.pos)
+	}
+
+	node := exprCompare{field: field.value, op: op.value, value: value.value}
+	if number, err := strconv.ParseFloat(value.value, 64); err == nil && value.kind == tokenNumber {
+		node.number, node.isNumber = number, true
+	} else if value.kind == tokenNumber {
+		return nil, fmt.Errorf("[ParseExpr] Bad number '%v'", value.value)
+	}
+
+	switch op.value {
+	case "=~", "!~":
+		regex, err := regexp.Compile(value.value)
+		if err != nil {
+			return nil, fmt.Errorf("[ParseExpr] Bad regexp '%v': %w", value.value, err)
+		}
+		node.regex = regex
+	case "<", "<=", ">", ">=":
+		if !node.isNumber {
+			return nil, fmt.Errorf("[ParseExpr] '%v' needs number at %v", op.value, value.pos)
+		}
+	}
+	return node, nil
+}
+
+// ParseExpr ... Compiles filter expression, empty expression matches every record
+func ParseExpr(s string) (*RecordExpr, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, fmt.Errorf("[ParseExpr] Unexpected '%v' at %v", t.value, t.pos)
+	}
+	return &RecordExpr{source: s, root: root}, nil
+}
+
+// Match ... Evaluates expression over the record, nil expression matches every record
+func (e *RecordExpr) Match(res *CdxResponse) bool {
+	if e == nil {
+		return true
+	}
+	return e.root.eval(res)
+}
+
+// Filter ... Returns records matching the expression, counting the rest into stats
+func (e *RecordExpr) Filter(records []*CdxResponse, stats *Stats) []*CdxResponse {
+	if e == nil {
+		return records
+	}
+
+	matched := make([]*CdxResponse, 0, len(records))
+	for _, res := range records {
+		if e.Match(res) {
+			matched = append(matched, res)
+		}
+	}
+	stats.AddRecords(RecordFiltered, len(records)-len(matched))
+	return matched
+}
+
+func (e *RecordExpr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.source
+}
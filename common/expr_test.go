@@ -0,0 +1,64 @@
+package common
+
+import "testing"
+
+func TestRecordExpr(t *testing.T) {
+	page := &CdxResponse{StatusCode: "200", MimeType: "text/html", Length: "2048", Original: "http://example.com/", Timestamp: "20210101000000"}
+	script := &CdxResponse{StatusCode: "200", MimeType: "application/javascript", Length: "512", Original: "http://example.com/app.js", Timestamp: "20190101000000"}
+	redirect := &CdxResponse{StatusCode: "301", MimeType: "text/html", Length: "300", Original: "http://example.com/old"}
+
+	cases := []struct {
+		expr string
+		want []bool // page, script, redirect
+	}{
+		{`status == 200 && mime =~ "text/html" && length > 1024`, []bool{true, false, false}},
+		{`status != 200 || length <= 512`, []bool{false, true, true}},
+		{`!(url =~ "\.(css|js)$")`, []bool{true, false, true}},
+		{`timestamp >= 20200101000000`, []bool{true, false, false}},
+		{`mime !~ '^text/' || status == "200"`, []bool{true, true, false}},
+		{`status == 200 || status == 301 && length > 1000`, []bool{true, true, false}},
+	}
+	for _, c := range cases {
+		e, err := ParseExpr(c.expr)
+		if err != nil {
+			t.Fatalf("%v: %v", c.expr, err)
+		}
+		for i, res := range []*CdxResponse{page, script, redirect} {
+			if got := e.Match(res); got != c.want[i] {
+				t.Errorf("%v: record %v got %v, want %v", c.expr, i, got, c.want[i])
+			}
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, s := range []string{
+		`size > 10`,
+		`status ==`,
+		`status == 200 &&`,
+		`(status == 200`,
+		`mime =~ "["`,
+		`mime > "text"`,
+		`status == "200`,
+		`status = 200`,
+	} {
+		if _, err := ParseExpr(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+
+	e, err := ParseExpr("  ")
+	if err != nil || e != nil || !e.Match(&CdxResponse{}) {
+		t.Fatal("Empty expression should match everything")
+	}
+}
+
+func TestRecordExprFilter(t *testing.T) {
+	e, _ := ParseExpr(`status == 200`)
+	stats := NewStats()
+
+	records := e.Filter([]*CdxResponse{{StatusCode: "200"}, {StatusCode: "404"}}, stats)
+	if len(records) != 1 || stats.Summary().Records[RecordFiltered] != 1 {
+		t.Fatalf("Unexpected filtering: %v", records)
+	}
+}
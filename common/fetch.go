@@ -0,0 +1,86 @@
+package common
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verification statuses of downloaded payload against digest reported by index server
+const (
+	VerifyOK         = "ok"
+	VerifyMismatch   = "mismatch"
+	VerifyUnverified = "unverified" // Index has no digest, or it is not SHA-1
+)
+
+// FetchInfo is provenance of downloaded record, to audit harvest quality and performance afterwards
+type FetchInfo struct {
+	LatencyMs int64  `json:"latency_ms"`         // Time taken by the download with retries
+	Endpoint  string `json:"endpoint,omitempty"` // Host file was downloaded from, empty if served from file cache
+	Attempts  int    `json:"attempts"`           // Requests made, 0 if served from file cache
+	Verified  string `json:"verified"`           // VerifyOK, VerifyMismatch or VerifyUnverified
+}
+
+// Retries ... Returns number of requests repeated after the first one
+func (f *FetchInfo) Retries() int {
+	if f == nil || f.Attempts < 1 {
+		return 0
+	}
+	return f.Attempts - 1
+}
+
+// Metadata ... Returns fetch fields as string metadata, empty for nil info
+func (f *FetchInfo) Metadata() map[string]string {
+	if f == nil {
+		return map[string]string{}
+	}
+	metadata := map[string]string{
+		"fetch-latency-ms": strconv.FormatInt(f.LatencyMs, 10),
+		"fetch-attempts":   strconv.Itoa(f.Attempts),
+		"fetch-retries":    strconv.Itoa(f.Retries()),
+		"verified":         f.Verified,
+	}
+	if f.Endpoint != "" {
+		metadata["fetch-endpoint"] = f.Endpoint
+	}
+	return metadata
+}
+
+// Records request attempts of the download, hook events come in order of attempts
+func (f *FetchInfo) observe(event RequestEvent) {
+	f.Attempts++
+	if u, err := url.Parse(event.URL); err == nil {
+		f.Endpoint = u.Host
+	}
+}
+
+// PayloadDigest ... Returns base32 SHA-1 digest of payload, as CDX servers report it
+func PayloadDigest(payload []byte) string {
+	sum := sha1.Sum(payload)
+	return base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPayload ... Compares digest of the record with downloaded payload, HTTP headers of full responses are skipped
+func VerifyPayload(res *CdxResponse, data []byte) string {
+	digest := normalizeDigest(res.Digest)
+	if len(digest) != 32 || strings.Trim(digest, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		return VerifyUnverified
+	}
+	if PayloadDigest(HTTPBody(data)) == digest {
+		return VerifyOK
+	}
+	return VerifyMismatch
+}
+
+// Starts collecting fetch info of the download, finished by the returned function
+func (r *CdxResponse) startFetch() func(data []byte) {
+	r.Fetch = &FetchInfo{}
+	start := time.Now()
+	return func(data []byte) {
+		r.Fetch.LatencyMs = time.Since(start).Milliseconds()
+		r.Fetch.Verified = VerifyPayload(r, data)
+	}
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Source stub downloading files from test server
+type httpSource struct {
+	planSource
+	server string
+}
+
+func (s *httpSource) GetFile(res *CdxResponse) ([]byte, error) {
+	return GetWithOptions(s.server+"/file", res.RequestOptions(5, 3))
+}
+
+func TestVerifyPayload(t *testing.T) {
+	payload := []byte("<html></html>")
+	digest := PayloadDigest(payload)
+
+	cases := []struct {
+		digest   string
+		data     []byte
+		expected string
+	}{
+		{digest, payload, VerifyOK},
+		{"sha1:" + digest, append([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n"), payload...), VerifyOK},
+		{digest, []byte("<html>changed</html>"), VerifyMismatch},
+		{"", payload, VerifyUnverified},
+		{"d41d8cd98f00b204e9800998ecf8427e", payload, VerifyUnverified}, // MD5
+	}
+	for _, c := range cases {
+		if status := VerifyPayload(&CdxResponse{Digest: c.digest}, c.data); status != c.expected {
+			t.Fatalf("Digest %q: %v, expected %v", c.digest, status, c.expected)
+		}
+	}
+}
+
+func TestDownloaderFetchInfo(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	source := &httpSource{server: server.URL}
+	config := &RequestConfig{}
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20200101000000", MimeType: "text/html", Digest: PayloadDigest([]byte("<html></html>")), Source: source, Config: config}
+
+	manifest := NewManifest("test", nil)
+	d := &Downloader{OutputDir: t.TempDir(), Manifest: manifest}
+	if err := d.saveFile(res, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	host, _ := url.Parse(server.URL)
+	fetch := manifest.Files[0].Fetch
+	if fetch == nil || fetch.Attempts != 2 || fetch.Retries() != 1 || fetch.Endpoint != host.Host || fetch.Verified != VerifyOK {
+		t.Fatalf("Unexpected fetch info: %+v", fetch)
+	}
+
+	metadata := RecordMetadata(res)
+	if metadata["fetch-retries"] != "1" || metadata["fetch-endpoint"] != host.Host || metadata["verified"] != VerifyOK || metadata["fetch-latency-ms"] == "" {
+		t.Fatalf("Unexpected metadata: %v", metadata)
+	}
+}
@@ -0,0 +1,207 @@
+package common
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Size cap of file cache when none is given
+const DefaultFileCacheSize = 1 << 30
+
+// FileCache is a disk cache of downloaded capture payloads, safe for concurrent use.
+// Least recently used files are evicted once cache grows over its size cap, so repeated runs
+// over the same records are served from disk instead of archive storage. Nil cache stores nothing.
+type FileCache struct {
+	Dir     string // Directory files are kept in, survives restarts
+	MaxSize int64  // Size cap in bytes
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type fileCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewFileCache ... Opens cache in directory, files already there are kept in order they were last used
+func NewFileCache(dir string, maxSize int64) (*FileCache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultFileCacheSize
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("[NewFileCache] Cannot create cache directory: %w", err)
+	}
+
+	type cached struct {
+		key  string
+		size int64
+		used time.Time
+	}
+	found := []cached{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".bin" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key := d.Name()[:len(d.Name())-len(".bin")]
+		if len(key) != sha1.Size*2 {
+			return nil
+		}
+		found = append(found, cached{key, info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[NewFileCache] Cannot read cache directory: %w", err)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].used.After(found[j].used) })
+
+	c := &FileCache{Dir: dir, MaxSize: maxSize, order: list.New(), entries: map[string]*list.Element{}}
+	for _, f := range found {
+		c.entries[f.key] = c.order.PushBack(&fileCacheEntry{f.key, f.size})
+		c.size += f.size
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	return c, nil
+}
+
+// FileCacheKey ... Returns cache key of the capture: WARC filename, offset and length when index gives them,
+// timestamp and URL otherwise, as for Wayback captures
+func FileCacheKey(page *CdxResponse) string {
+	id := page.Timestamp + " " + page.Original
+	if page.Filename != "" {
+		id = page.Filename + " " + page.Offset + " " + page.Length
+	}
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Files are spread over subdirectories by first byte of key
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".bin")
+}
+
+// Get ... Returns cached payload of the capture, marking it as recently used
+func (c *FileCache) Get(page *CdxResponse) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key := FileCacheKey(page)
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.remove(key)
+		return nil, false
+	}
+	// Last use is kept in modification time, so order survives restarts
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return data, true
+}
+
+// Put ... Stores payload of the capture, evicting least recently used files over size cap.
+// Payloads larger than the cap are not stored.
+func (c *FileCache) Put(page *CdxResponse, data []byte) {
+	if c == nil || int64(len(data)) > c.MaxSize {
+		return
+	}
+	key := FileCacheKey(page)
+	path := c.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		log.Printf("[FileCache] Cannot store file: %v", err)
+		return
+	}
+	if err := WriteFileAtomic(path, data); err != nil {
+		log.Printf("[FileCache] Cannot store file: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*fileCacheEntry)
+		c.size += int64(len(data)) - entry.size
+		entry.size = int64(len(data))
+		c.order.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.order.PushFront(&fileCacheEntry{key, int64(len(data))})
+		c.size += int64(len(data))
+	}
+	c.evict()
+}
+
+// Size ... Returns total size of cached files in bytes
+func (c *FileCache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *FileCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*fileCacheEntry).size
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Removes least recently used files until cache fits its cap, must be called with lock held
+func (c *FileCache) evict() {
+	for c.size > c.MaxSize && c.order.Len() > 0 {
+		entry := c.order.Remove(c.order.Back()).(*fileCacheEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		if err := os.Remove(c.path(entry.key)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[FileCache] Cannot evict file: %v", err)
+		}
+	}
+}
+
+// FileCache ... Returns payload cache of the config the record was found with, nil if it has none
+func (r *CdxResponse) FileCache() *FileCache {
+	if r.Config == nil {
+		return nil
+	}
+	return r.Config.FileCache
+}
+
+// CachedFile ... Returns payload of the record from file cache of its config, hit is accounted in download phase stats
+func (r *CdxResponse) CachedFile() ([]byte, bool) {
+	data, ok := r.FileCache().Get(r)
+	if ok {
+		r.Config.Stats.AddCacheHit(PhaseDownload)
+	}
+	return data, ok
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFileCacheLRU(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &CdxResponse{Filename: "crawl/a.warc.gz", Offset: "100", Length: "4"}
+	b := &CdxResponse{Timestamp: "20200101000000", Original: "https://example.com/"}
+	c := &CdxResponse{Filename: "crawl/a.warc.gz", Offset: "200", Length: "4"}
+
+	if _, ok := cache.Get(a); ok {
+		t.Fatalf("Empty cache should miss")
+	}
+	cache.Put(a, []byte("aaaa"))
+	cache.Put(b, []byte("bbbb"))
+	if data, ok := cache.Get(a); !ok || !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("Unexpected cached file: %q, %v", data, ok)
+	}
+
+	// b is least recently used now
+	cache.Put(c, []byte("cccc"))
+	if _, ok := cache.Get(b); ok {
+		t.Fatalf("Least recently used file should be evicted")
+	}
+	if cache.Size() != 8 {
+		t.Fatalf("Unexpected cache size: %v", cache.Size())
+	}
+
+	cache.Put(b, []byte("too large file"))
+	if _, ok := cache.Get(b); ok {
+		t.Fatalf("File over size cap should not be cached")
+	}
+
+	reopened, err := NewFileCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := reopened.Get(c); !ok || !bytes.Equal(data, []byte("cccc")) {
+		t.Fatalf("Cached file was not kept: %q, %v", data, ok)
+	}
+	if reopened.Size() != 8 {
+		t.Fatalf("Unexpected reopened cache size: %v", reopened.Size())
+	}
+}
+
+func TestFileCacheNil(t *testing.T) {
+	var cache *FileCache
+	page := &CdxResponse{Timestamp: "20200101000000", Original: "https://example.com/"}
+	cache.Put(page, []byte("data"))
+	if _, ok := cache.Get(page); ok {
+		t.Fatalf("Nil cache should miss")
+	}
+	if page.FileCache() != nil {
+		t.Fatalf("Record without config has no cache")
+	}
+}
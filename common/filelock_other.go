@@ -0,0 +1,8 @@
+//go:build !unix
+
+package common
+
+// Files are not locked across processes outside Unix, only within the process
+func lockFile(path string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package common
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Takes exclusive flock of the file, created if missing, waiting while other process holds it.
+// Returned function releases the lock.
+func lockFile(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Lock is released with the last descriptor of the file
+	return file.Close, nil
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RecordFilter matches records locally, with syntax of CDX server filters: [!][=|~]field:value.
+// Value is a regular expression matched from the start of the field, "=" requires exact match and "~" containment,
+// "!" inverts the result.
+//
+//	ex: "statuscode:200", "!mimetype:text/.*", "~languages:por"
+type RecordFilter struct {
+	field   string
+	invert  bool
+	exact   string
+	contain string
+	regex   *regexp.Regexp
+}
+
+// ParseFilter ... Parses filter in CDX server syntax
+func ParseFilter(filter string) (*RecordFilter, error) {
+	f := &RecordFilter{}
+	if strings.HasPrefix(filter, "!") {
+		f.invert, filter = true, filter[1:]
+	}
+
+	mode := ""
+	if strings.HasPrefix(filter, "=") || strings.HasPrefix(filter, "~") {
+		mode, filter = filter[:1], filter[1:]
+	}
+
+	field, value, found := strings.Cut(filter, ":")
+	if !found || field == "" {
+		return nil, fmt.Errorf("[ParseFilter] Filter must look like field:value, got '%v'", filter)
+	}
+	if RecordField(&CdxResponse{}, field) == nil {
+		return nil, fmt.Errorf("[ParseFilter] Unknown field '%v'", field)
+	}
+	f.field = field
+
+	switch mode {
+	case "=":
+		f.exact = value
+	case "~":
+		// Every value contains empty pattern, such filter is a mistake
+		if value == "" {
+			return nil, fmt.Errorf("[ParseFilter] Empty pattern of '~%v:'", field)
+		}
+		f.contain = value
+	default:
+		regex, err := regexp.Compile("^(?:" + value + ")")
+		if err != nil {
+			return nil, fmt.Errorf("[ParseFilter] Bad regexp '%v': %w", value, err)
+		}
+		f.regex = regex
+	}
+	return f, nil
+}
+
+// ParseFilters ... Parses list of filters, empty ones are skipped
+func ParseFilters(filters []string) ([]*RecordFilter, error) {
+	parsed := []*RecordFilter{}
+	for _, filter := range filters {
+		if filter == "" {
+			continue
+		}
+		f, err := ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+func (f *RecordFilter) Match(res *CdxResponse) bool {
+	value := *RecordField(res, f.field)
+
+	var matched bool
+	switch {
+	case f.regex != nil:
+		matched = f.regex.MatchString(value)
+	case f.contain != "":
+		matched = strings.Contains(value, f.contain)
+	default:
+		matched = value == f.exact
+	}
+	return matched != f.invert
+}
+
+// MatchAll ... Checks if record passes all filters
+func MatchAll(res *CdxResponse, filters []*RecordFilter) bool {
+	for _, f := range filters {
+		if !f.Match(res) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordField ... Returns pointer to record field by CDX name, nil if there is no such field
+func RecordField(res *CdxResponse, name string) *string {
+	switch strings.ToLower(name) {
+	case "urlkey":
+		return &res.Urlkey
+	case "timestamp":
+		return &res.Timestamp
+	case "url", "original":
+		return &res.Original
+	case "mime", "mimetype":
+		return &res.MimeType
+	case "mimedetected", "mime-detected":
+		return &res.MimeDetected
+	case "status", "statuscode":
+		return &res.StatusCode
+	case "digest":
+		return &res.Digest
+	case "length":
+		return &res.Length
+	case "offset":
+		return &res.Offset
+	case "filename":
+		return &res.Filename
+	case "languages":
+		return &res.Languages
+	case "charset":
+		return &res.Charset
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package common
+
+import "testing"
+
+func TestRecordFilters(t *testing.T) {
+	res := &CdxResponse{Original: "http://example.com/", StatusCode: "200", MimeType: "text/html", Languages: "por,eng"}
+
+	cases := map[string]bool{
+		"statuscode:200":    true,
+		"status:2":          true,
+		"!statuscode:200":   false,
+		"mimetype:text/.*":  true,
+		"=mime:text/htm":    false,
+		"~languages:eng":    true,
+		"!~languages:spa":   true,
+		"url:.*example.org": false,
+	}
+	for filter, expected := range cases {
+		f, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatalf("%v: %v", filter, err)
+		}
+		if f.Match(res) != expected {
+			t.Fatalf("%v: expected %v", filter, expected)
+		}
+	}
+
+	if _, err := ParseFilter("size:100"); err == nil {
+		t.Fatalf("Unknown field should fail")
+	}
+	for _, filter := range []string{"~languages:", "!~mime:"} {
+		if _, err := ParseFilter(filter); err == nil {
+			t.Fatalf("Empty pattern of %v should fail", filter)
+		}
+	}
+
+	// Empty exact value matches records without the field
+	f, err := ParseFilter("=charset:")
+	if err != nil || !f.Match(res) || f.Match(&CdxResponse{Charset: "utf-8"}) {
+		t.Fatalf("Empty exact value should match empty field only: %v", err)
+	}
+}
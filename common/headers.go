@@ -0,0 +1,107 @@
+package common
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Prefix Wayback puts to archived response headers in replay responses
+const archivedHeaderPrefix = "X-Archive-Orig-"
+
+// Security related response headers
+var securityHeaders = []string{
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"X-Xss-Protection",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Cross-Origin-Opener-Policy",
+	"Cross-Origin-Embedder-Policy",
+	"Cross-Origin-Resource-Policy",
+	"Access-Control-Allow-Origin",
+}
+
+// HeaderSource is implemented by sources able to get archived response headers of captures
+type HeaderSource interface {
+	GetHeaders(*CdxResponse) (http.Header, error)
+}
+
+// CaptureHeaders is a catalog entry of archived response headers of the capture
+type CaptureHeaders struct {
+	URL       string            `json:"url"`
+	Timestamp string            `json:"timestamp"`
+	Source    string            `json:"source,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Server    string            `json:"server,omitempty"`
+	PoweredBy string            `json:"powered_by,omitempty"`
+	Cookies   []string          `json:"cookies,omitempty"` // Names of cookies set
+	Security  map[string]string `json:"security"`          // Security headers present
+	Missing   []string          `json:"missing,omitempty"` // Security headers absent
+	Headers   map[string]string `json:"headers,omitempty"` // All headers, multiple values are joined with ", "
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// NewCaptureHeaders ... Catalogs archived response headers of the capture
+func NewCaptureHeaders(res *CdxResponse, header http.Header) CaptureHeaders {
+	entry := CaptureHeaders{
+		URL:       res.Original,
+		Timestamp: res.Timestamp,
+		Status:    res.StatusCode,
+		Server:    header.Get("Server"),
+		PoweredBy: header.Get("X-Powered-By"),
+		Security:  map[string]string{},
+		Headers:   map[string]string{},
+		Tags:      res.Tags(),
+	}
+	if res.Source != nil {
+		entry.Source = res.Source.Name()
+	}
+
+	for _, cookie := range header.Values("Set-Cookie") {
+		name, _, _ := strings.Cut(cookie, "=")
+		entry.Cookies = append(entry.Cookies, strings.TrimSpace(name))
+	}
+	sort.Strings(entry.Cookies)
+
+	for _, name := range securityHeaders {
+		if value := header.Get(name); value != "" {
+			entry.Security[name] = value
+		} else {
+			entry.Missing = append(entry.Missing, name)
+		}
+	}
+
+	for name, values := range header {
+		entry.Headers[name] = strings.Join(values, ", ")
+	}
+	return entry
+}
+
+// ArchivedHeaders ... Extracts archived response headers from Wayback replay response headers
+func ArchivedHeaders(replay http.Header) http.Header {
+	header := http.Header{}
+	for name, values := range replay {
+		if strings.HasPrefix(name, archivedHeaderPrefix) {
+			header[http.CanonicalHeaderKey(strings.TrimPrefix(name, archivedHeaderPrefix))] = values
+		}
+	}
+	return header
+}
+
+// ParseHTTPHeaders ... Parses headers of the full HTTP response, like CommonCrawl GetFile returns, ok is false if data is not an HTTP response
+func ParseHTTPHeaders(data []byte) (http.Header, bool) {
+	header, _, ok := splitHTTPResponse(data)
+	return http.Header(header), ok
+}
+
+// HTTPBody ... Returns body of the full HTTP response, data itself if it is not an HTTP response
+func HTTPBody(data []byte) []byte {
+	if _, body, ok := splitHTTPResponse(data); ok {
+		return body
+	}
+	return data
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestArchivedHeaders(t *testing.T) {
+	replay := http.Header{}
+	replay.Set("Server", "Wayback")
+	replay.Set("X-Archive-Orig-Server", "nginx")
+	replay.Add("X-Archive-Orig-Set-Cookie", "session=1; Path=/")
+	replay.Add("X-Archive-Orig-Set-Cookie", "lang=en")
+	replay.Set("X-Archive-Orig-Strict-Transport-Security", "max-age=31536000")
+
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20200101000000", StatusCode: "200"}
+	entry := NewCaptureHeaders(res, ArchivedHeaders(replay))
+
+	if entry.Server != "nginx" || len(entry.Headers) != 3 {
+		t.Fatalf("Replay headers are not stripped: %+v", entry)
+	}
+	if len(entry.Cookies) != 2 || entry.Cookies[0] != "lang" || entry.Cookies[1] != "session" {
+		t.Fatalf("Incorrect cookie names: %v", entry.Cookies)
+	}
+	if entry.Security["Strict-Transport-Security"] != "max-age=31536000" || len(entry.Missing) != len(securityHeaders)-1 {
+		t.Fatalf("Incorrect security headers: %v, missing: %v", entry.Security, entry.Missing)
+	}
+}
+
+func TestParseHTTPHeaders(t *testing.T) {
+	header, ok := ParseHTTPHeaders([]byte("HTTP/1.1 200 OK\r\nServer: Apache\r\nX-Frame-Options: DENY\r\n\r\n<html>"))
+	if !ok || header.Get("Server") != "Apache" || header.Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("Incorrect headers: %v", header)
+	}
+
+	if _, ok := ParseHTTPHeaders([]byte("<html>")); ok {
+		t.Fatalf("Payload without headers should not be parsed")
+	}
+}
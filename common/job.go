@@ -0,0 +1,83 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NewJobID ... Generates random ID to correlate requests, retries and errors of a single job
+func NewJobID() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// JobError wraps error that happened while processing a job
+type JobError struct {
+	JobID string
+	Err   error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("[job=%v] %v", e.JobID, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// JobIDFromError returns ID of the job error belongs to, empty if there is none
+func JobIDFromError(err error) string {
+	var jobErr *JobError
+	if errors.As(err, &jobErr) {
+		return jobErr.JobID
+	}
+	return ""
+}
+
+// Info about single HTTP request attempt passed to hooks
+type RequestEvent struct {
+	JobID    string        // ID of the job request belongs to, may be empty
+	URL      string        // Requested URL
+	Attempt  int           // Attempt number starting from 1
+	Status   int           // Response status code, 0 if no response received
+	Bytes    int           // Size of response body
+	Duration time.Duration // Time taken by the attempt
+	Err      error         // Attempt error if any
+
+	start time.Time
+}
+
+// RequestHook is called after each HTTP request attempt, must be safe for concurrent use
+type RequestHook func(event RequestEvent)
+
+// Errorf formats error and binds it to the config job if JobID is set
+func (config *RequestConfig) Errorf(format string, a ...any) error {
+	err := fmt.Errorf(format, a...)
+	if config.JobID == "" || JobIDFromError(err) == config.JobID {
+		return err
+	}
+	return &JobError{JobID: config.JobID, Err: err}
+}
+
+// Log prefix to correlate messages of the job
+func (opts RequestOptions) logPrefix() string {
+	if opts.JobID == "" {
+		return ""
+	}
+	return fmt.Sprintf("[job=%v] ", opts.JobID)
+}
+
+func (opts RequestOptions) emit(event RequestEvent) {
+	opts.Stats.AddEvent(event)
+	if opts.Hook == nil {
+		return
+	}
+	event.JobID = opts.JobID
+	opts.Hook(event)
+}
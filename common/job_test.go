@@ -0,0 +1,59 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestJobErrorf(t *testing.T) {
+	config := RequestConfig{JobID: "abc"}
+	base := errors.New("boom")
+
+	err := config.Errorf("[Test] Failed: %w", base)
+	if got := JobIDFromError(err); got != "abc" {
+		t.Fatalf("Incorrect job ID: want=abc, got=%v", got)
+	}
+	if !errors.Is(err, base) {
+		t.Fatalf("Job error must wrap original error")
+	}
+
+	// Already bound errors are not wrapped twice
+	wrapped := config.Errorf("%w", err)
+	if wrapped.Error() != err.Error() {
+		t.Fatalf("Error wrapped twice: %v", wrapped)
+	}
+}
+
+func TestRequestHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	events := []RequestEvent{}
+
+	config := RequestConfig{JobID: "job1", Stats: NewStats(), Hook: func(e RequestEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}}
+
+	body, err := GetWithOptions(server.URL, config.RequestOptions(5, 2))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(body) != "hello" {
+		t.Fatalf("Incorrect body: %s", body)
+	}
+	if len(events) != 1 || events[0].JobID != "job1" || events[0].Status != 200 || events[0].Bytes != 5 {
+		t.Fatalf("Incorrect hook events: %+v", events)
+	}
+	if config.Stats.Summary().Requests != 1 {
+		t.Fatalf("Request is not counted")
+	}
+}
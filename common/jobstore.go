@@ -0,0 +1,236 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// StoredJob is a named harvest kept in job store: its queries, state of the last run and where it was written to
+type StoredJob struct {
+	Name     string          `json:"name"`
+	JobID    string          `json:"job_id,omitempty"` // ID of the last run, as in logs and events
+	Queries  []ManifestQuery `json:"queries"`
+	Args     []string        `json:"args,omitempty"` // Command line of CLI harvests, so they can be run again
+	Dir      string          `json:"dir,omitempty"`  // Working directory of CLI harvests, relative paths of args are in it
+	Outputs  []string        `json:"outputs,omitempty"`
+	State    string          `json:"state"`
+	Error    string          `json:"error,omitempty"`
+	Runs     int             `json:"runs"`
+	Created  time.Time       `json:"created"`
+	Started  time.Time       `json:"started,omitempty"`
+	Finished time.Time       `json:"finished,omitempty"`
+	Stats    *StatsSummary   `json:"stats,omitempty"`
+}
+
+// JobStore keeps named harvests, so recurring ones are managed by their names across runs.
+// Implementations are safe for concurrent use.
+type JobStore interface {
+	Put(job StoredJob) error
+	Get(name string) (StoredJob, error) // ErrJobNotFound if there is no such job
+	List() ([]StoredJob, error)         // Sorted by name
+	Delete(name string) error           // ErrJobNotFound if there is no such job
+}
+
+var jobNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,63}$`)
+
+// ValidJobName ... Checks that name of the job has up to 64 letters, digits, '.', '_' or '-', so it can name files too
+func ValidJobName(name string) error {
+	if !jobNameRe.MatchString(name) {
+		return fmt.Errorf("[ValidJobName] Invalid job name '%v', use up to 64 letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+// DefaultJobStorePath ... Returns path of job store in user config directory, shared by CLI and server
+func DefaultJobStorePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "gogetcrawl-jobs.json"
+	}
+	return filepath.Join(dir, "gogetcrawl", "jobs.json")
+}
+
+// FileJobStore keeps jobs in JSON file, read on every call so jobs changed by other processes are seen.
+// Changes are written atomically while holding lock of the ".lock" file beside it (flock, on Unix only),
+// so CLI runs and server changing jobs at once do not overwrite each other's records.
+type FileJobStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileJobStore ... Opens store of the file, it is created with the first job
+func NewFileJobStore(path string) (*FileJobStore, error) {
+	store := &FileJobStore{Path: path}
+	if _, err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *FileJobStore) load() (map[string]StoredJob, error) {
+	jobs := map[string]StoredJob{}
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[FileJobStore] Cannot read jobs: %w", err)
+	}
+
+	list := []StoredJob{}
+	if err := jsoniter.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("[FileJobStore] Cannot decode jobs: %w", err)
+	}
+	for _, job := range list {
+		jobs[job.Name] = job
+	}
+	return jobs, nil
+}
+
+func (s *FileJobStore) save(jobs map[string]StoredJob) error {
+	data, err := jsoniter.MarshalIndent(sortedJobs(jobs), "", "  ")
+	if err != nil {
+		return fmt.Errorf("[FileJobStore] Cannot encode jobs: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), os.ModePerm); err != nil {
+		return fmt.Errorf("[FileJobStore] %w", err)
+	}
+	return WriteFileAtomic(s.Path, data)
+}
+
+// Locks store for read-modify-write of the file, within the process and across processes
+func (s *FileJobStore) lock() (func(), error) {
+	s.mu.Lock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), os.ModePerm); err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("[FileJobStore] %w", err)
+	}
+	unlock, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("[FileJobStore] Cannot lock jobs: %w", err)
+	}
+	return func() {
+		unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+func sortedJobs(jobs map[string]StoredJob) []StoredJob {
+	list := make([]StoredJob, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (s *FileJobStore) Put(job StoredJob) error {
+	if err := ValidJobName(job.Name); err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	jobs[job.Name] = job
+	return s.save(jobs)
+}
+
+func (s *FileJobStore) Get(name string) (StoredJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return StoredJob{}, err
+	}
+	job, ok := jobs[name]
+	if !ok {
+		return StoredJob{}, fmt.Errorf("[FileJobStore] '%v': %w", name, ErrJobNotFound)
+	}
+	return job, nil
+}
+
+func (s *FileJobStore) List() ([]StoredJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortedJobs(jobs), nil
+}
+
+func (s *FileJobStore) Delete(name string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := jobs[name]; !ok {
+		return fmt.Errorf("[FileJobStore] '%v': %w", name, ErrJobNotFound)
+	}
+	delete(jobs, name)
+	return s.save(jobs)
+}
+
+// RecordJobStart ... Records new run of the job as running, creation time is kept and runs are counted across runs
+func RecordJobStart(store JobStore, job StoredJob) error {
+	if store == nil {
+		return nil
+	}
+	job.Created, job.Runs = time.Now().UTC(), 1
+	if previous, err := store.Get(job.Name); err == nil {
+		job.Created, job.Runs = previous.Created, previous.Runs+1
+	} else if !errors.Is(err, ErrJobNotFound) {
+		return err
+	}
+	job.State, job.Error, job.Started, job.Finished, job.Stats = JobRunning, "", time.Now().UTC(), time.Time{}, nil
+	return store.Put(job)
+}
+
+// RecordJobFinish ... Records outcome of the last run of the job, canceled if it failed with ErrJobCanceled
+func RecordJobFinish(store JobStore, name string, stats *Stats, err error) error {
+	if store == nil {
+		return nil
+	}
+	job, getErr := store.Get(name)
+	if getErr != nil {
+		return getErr
+	}
+
+	job.Finished = time.Now().UTC()
+	if stats != nil {
+		summary := stats.Summary()
+		job.Stats = &summary
+	}
+	switch {
+	case errors.Is(err, ErrJobCanceled):
+		job.State = JobCanceled
+	case err != nil:
+		job.State, job.Error = JobFailed, err.Error()
+	default:
+		job.State = JobDone
+	}
+	return store.Put(job)
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileJobStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store", "jobs.json")
+	store, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := store.List(); err != nil || len(jobs) != 0 {
+		t.Fatalf("New store should be empty: %v, %v", jobs, err)
+	}
+
+	for _, name := range []string{"weekly", "audit-2023", "daily"} {
+		job := StoredJob{Name: name, Queries: []ManifestQuery{{URL: name + ".com/*"}}, Outputs: []string{"/data/" + name}}
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put(StoredJob{Name: "../escape"}); err == nil {
+		t.Fatalf("Invalid name should be rejected")
+	}
+
+	// Other processes see jobs through the file
+	other, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := other.List()
+	if err != nil || len(jobs) != 3 || jobs[0].Name != "audit-2023" || jobs[2].Name != "weekly" {
+		t.Fatalf("Unexpected jobs: %+v, %v", jobs, err)
+	}
+	job, err := other.Get("daily")
+	if err != nil || job.Queries[0].URL != "daily.com/*" || job.Outputs[0] != "/data/daily" {
+		t.Fatalf("Unexpected job: %+v, %v", job, err)
+	}
+
+	if err := store.Delete("daily"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get("daily"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Deleted job should not be found: %v", err)
+	}
+	if err := other.Delete("daily"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Deleting missing job should fail with ErrJobNotFound: %v", err)
+	}
+}
+
+func TestFileJobStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	// Stores of different processes changing the file at once keep all jobs
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		store, err := NewFileJobStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if err := store.Put(StoredJob{Name: name}); err != nil {
+					t.Error(err)
+				}
+			}(fmt.Sprintf("job-%v-%v", i, j))
+		}
+	}
+	wg.Wait()
+
+	store, _ := NewFileJobStore(path)
+	if jobs, err := store.List(); err != nil || len(jobs) != 20 {
+		t.Fatalf("Expected 20 jobs, got %v: %v", len(jobs), err)
+	}
+}
+
+func TestRecordJob(t *testing.T) {
+	store, err := NewFileJobStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecordJobStart(store, StoredJob{Name: "weekly", JobID: "run1"}); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := store.Get("weekly")
+	if first.State != JobRunning || first.Runs != 1 || first.Created.IsZero() || first.Started.IsZero() {
+		t.Fatalf("Unexpected started job: %+v", first)
+	}
+
+	stats := NewStats()
+	stats.AddRecords(RecordSaved, 5)
+	if err := RecordJobFinish(store, "weekly", stats, fmt.Errorf("budget exhausted")); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := store.Get("weekly")
+	if failed.State != JobFailed || failed.Error != "budget exhausted" || failed.Stats.Records[RecordSaved] != 5 || failed.Finished.IsZero() {
+		t.Fatalf("Unexpected failed job: %+v", failed)
+	}
+
+	// Next run keeps creation time and counts runs, outcome of the last one is cleared
+	if err := RecordJobStart(store, StoredJob{Name: "weekly", JobID: "run2"}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := store.Get("weekly")
+	if second.Runs != 2 || !second.Created.Equal(first.Created) || second.JobID != "run2" || second.Error != "" || second.Stats != nil || !second.Finished.IsZero() {
+		t.Fatalf("Unexpected second run: %+v", second)
+	}
+
+	RecordJobFinish(store, "weekly", nil, fmt.Errorf("[Get] %w", ErrJobCanceled))
+	if job, _ := store.Get("weekly"); job.State != JobCanceled {
+		t.Fatalf("Canceled run should be recorded as canceled: %v", job.State)
+	}
+	RecordJobFinish(store, "weekly", nil, nil)
+	if job, _ := store.Get("weekly"); job.State != JobDone {
+		t.Fatalf("Finished run should be recorded as done: %v", job.State)
+	}
+
+	if err := RecordJobFinish(store, "missing", nil, nil); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Finishing unknown job should fail: %v", err)
+	}
+	if err := RecordJobStart(nil, StoredJob{Name: "weekly"}); err != nil {
+		t.Fatalf("Nil store should not record: %v", err)
+	}
+}
+
+func TestValidJobName(t *testing.T) {
+	for _, name := range []string{"weekly", "audit_2023.v2", "A-1"} {
+		if err := ValidJobName(name); err != nil {
+			t.Fatalf("Name '%v' should be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".hidden", "-flag", "a b", "a/b", string(make([]byte, 65))} {
+		if err := ValidJobName(name); err == nil {
+			t.Fatalf("Name %q should be invalid", name)
+		}
+	}
+}
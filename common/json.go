@@ -0,0 +1,151 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSON libraries index responses can be decoded with
+const (
+	JSONIter = "jsoniter" // github.com/json-iterator/go, default
+	JSONStd  = "std"      // encoding/json of standard library
+)
+
+// Fields of Common Crawl index records which are known but not kept in CdxResponse
+var unmappedFields = map[string]bool{"redirect": true, "truncated": true}
+
+// CdxDecoding chooses how source decodes index server responses.
+// In lenient mode, which is default, unknown fields are ignored. Strict mode fails on them,
+// to notice when archive renames fields or changes its response schema.
+type CdxDecoding struct {
+	Library string // JSONIter or JSONStd, JSONIter if empty
+	Strict  bool   // Fail on unknown fields and values which are not strings
+}
+
+// Validate ... Checks that library is known
+func (d CdxDecoding) Validate() error {
+	switch d.Library {
+	case "", JSONIter, JSONStd:
+		return nil
+	}
+	return fmt.Errorf("[CdxDecoding] Unknown JSON library '%v', use %v or %v", d.Library, JSONIter, JSONStd)
+}
+
+// Decoder of JSON values following each other, like lines of NDJSON
+type JSONDecoder interface {
+	More() bool
+	Decode(v any) error
+}
+
+// NewDecoder ... Returns decoder of JSON values read from r with chosen library
+func (d CdxDecoding) NewDecoder(r io.Reader) JSONDecoder {
+	if d.Library == JSONStd {
+		return json.NewDecoder(r)
+	}
+	return jsoniter.ConfigCompatibleWithStandardLibrary.NewDecoder(r)
+}
+
+// DecodeArray ... Reads top-level JSON array while it is streamed, fn decodes each element with decode.
+// Reading stops without error once fn returns false.
+func (d CdxDecoding) DecodeArray(r io.Reader, fn func(decode func(v any) error) (bool, error)) error {
+	if d.Library == JSONStd {
+		return decodeArrayStd(r, fn)
+	}
+
+	iter := jsoniter.Parse(jsoniter.ConfigDefault, r, 4096)
+	var fnErr error
+	complete := iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+		more, err := fn(func(v any) error {
+			iter.ReadVal(v)
+			return iter.Error
+		})
+		fnErr = err
+		return more && err == nil
+	})
+	switch {
+	case fnErr != nil:
+		return fnErr
+	case !complete && iter.Error != nil:
+		return iter.Error
+	}
+	return nil
+}
+
+func decodeArrayStd(r io.Reader, fn func(decode func(v any) error) (bool, error)) error {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('[') {
+		return fmt.Errorf("expected JSON array, got %v", token)
+	}
+
+	for decoder.More() {
+		more, err := fn(decoder.Decode)
+		if err != nil || !more {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// SetField ... Sets record field by its CDX name, like "mime-detected". Unknown fields fail in strict mode.
+func (d CdxDecoding) SetField(res *CdxResponse, name string, value any) error {
+	field := RecordField(res, name)
+	if field == nil {
+		if d.Strict && !unmappedFields[name] {
+			return fmt.Errorf("unknown field '%v'", name)
+		}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		*field = v
+	case nil:
+	default:
+		if d.Strict {
+			return fmt.Errorf("field '%v' is %T, not string", name, value)
+		}
+		*field = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// SetFields ... Sets record fields named by header to values of the same position
+func (d CdxDecoding) SetFields(res *CdxResponse, header []string, values []any) error {
+	for i, name := range header {
+		if err := d.SetField(res, name, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetObject ... Sets record fields from decoded JSON object, like line of Common Crawl index
+func (d CdxDecoding) SetObject(res *CdxResponse, fields map[string]any) error {
+	for name, value := range fields {
+		if err := d.SetField(res, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalRecord ... Decodes JSON object of record fields with chosen library
+func (d CdxDecoding) UnmarshalRecord(data []byte, res *CdxResponse) error {
+	var fields map[string]any
+	var err error
+	if d.Library == JSONStd {
+		err = json.Unmarshal(data, &fields)
+	} else {
+		err = jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		return err
+	}
+	return d.SetObject(res, fields)
+}
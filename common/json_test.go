@@ -0,0 +1,57 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeArray(t *testing.T) {
+	for _, library := range []string{JSONIter, JSONStd} {
+		d := CdxDecoding{Library: library}
+		values := []int{}
+		err := d.DecodeArray(strings.NewReader("[1, 2, 3, 4]"), func(decode func(v any) error) (bool, error) {
+			var v int
+			if err := decode(&v); err != nil {
+				return false, err
+			}
+			values = append(values, v)
+			return len(values) < 3, nil
+		})
+		if err != nil || len(values) != 3 {
+			t.Fatalf("%v: expected to stop after 3 values, got %v, %v", library, values, err)
+		}
+
+		err = d.DecodeArray(strings.NewReader("[1, 2"), func(decode func(v any) error) (bool, error) {
+			var v int
+			return true, decode(&v)
+		})
+		if err == nil {
+			t.Fatalf("%v: expected error for truncated array", library)
+		}
+	}
+
+	if err := (CdxDecoding{Library: "sonic"}).Validate(); err == nil {
+		t.Fatal("Unknown library should fail validation")
+	}
+}
+
+func TestUnmarshalRecord(t *testing.T) {
+	line := []byte(`{"url": "http://example.com/", "mime-detected": "text/html", "redirect": "http://example.com/new", "length": 120}`)
+
+	res := &CdxResponse{}
+	if err := (CdxDecoding{}).UnmarshalRecord(line, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Original != "http://example.com/" || res.MimeDetected != "text/html" || res.Length != "120" {
+		t.Fatalf("Unexpected record: %+v", res)
+	}
+
+	// Known fields pass strict mode, values must be strings there
+	strict := CdxDecoding{Library: JSONStd, Strict: true}
+	if err := strict.UnmarshalRecord(line, &CdxResponse{}); err == nil || !strings.Contains(err.Error(), "length") {
+		t.Fatalf("Strict mode should fail on number value, got %v", err)
+	}
+	if err := strict.UnmarshalRecord([]byte(`{"url": "http://example.com/", "redirect": "http://example.com/new"}`), &CdxResponse{}); err != nil {
+		t.Fatalf("Known field should pass strict mode: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// LanguageList ... Returns languages of the record (Common Crawl "languages" column), like [eng deu].
+// Codes are ISO-639-3 in the order of their share in the content, nil if the column is empty.
+func (r *CdxResponse) LanguageList() []string {
+	var languages []string
+	for _, lang := range strings.Split(r.Languages, ",") {
+		if lang = strings.ToLower(strings.TrimSpace(lang)); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// NormalizeCharset ... Returns canonical name of the charset as browsers understand it, like "utf-8" for "UTF8".
+// Unknown names are only lowercased and trimmed.
+//
+//	ex: "ISO-8859-1" -> "windows-1252", "Shift_JIS" -> "shift_jis"
+func NormalizeCharset(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ""
+	}
+	if _, canonical := charset.Lookup(name); canonical != "" {
+		return canonical
+	}
+	return name
+}
+
+// NormalizedCharset ... Returns canonical name of the record charset (Common Crawl "charset" column)
+func (r *CdxResponse) NormalizedCharset() string {
+	return NormalizeCharset(r.Charset)
+}
+
+// MatchRecord ... Checks if record has any of config languages and charsets, if they are set.
+// Records without these columns, like Wayback ones, do not match then.
+func (config *RequestConfig) MatchRecord(res *CdxResponse) bool {
+	if !config.Partition.HasRecord(res) {
+		return false
+	}
+	if len(config.Languages) > 0 && !containsAny(res.LanguageList(), config.Languages) {
+		return false
+	}
+	if len(config.Charsets) > 0 {
+		charset := res.NormalizedCharset()
+		for _, c := range config.Charsets {
+			if charset != "" && NormalizeCharset(c) == charset {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SelectRecords ... Returns records matching config languages and charsets, counting the rest as filtered
+func (config *RequestConfig) SelectRecords(records []*CdxResponse) []*CdxResponse {
+	if len(config.Languages) == 0 && len(config.Charsets) == 0 && config.Partition == nil {
+		return records
+	}
+
+	selected := make([]*CdxResponse, 0, len(records))
+	for _, res := range records {
+		if config.MatchRecord(res) {
+			selected = append(selected, res)
+		}
+	}
+	config.Stats.AddRecords(RecordFiltered, len(records)-len(selected))
+	return selected
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if strings.EqualFold(v, strings.TrimSpace(w)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLanguageList(t *testing.T) {
+	res := &CdxResponse{Languages: "eng, DEU,,fra"}
+	if got := res.LanguageList(); !reflect.DeepEqual(got, []string{"eng", "deu", "fra"}) {
+		t.Fatalf("Unexpected languages: %v", got)
+	}
+	if got := (&CdxResponse{}).LanguageList(); got != nil {
+		t.Fatalf("Empty column should have no languages: %v", got)
+	}
+}
+
+func TestNormalizeCharset(t *testing.T) {
+	for name, want := range map[string]string{
+		"UTF-8":      "utf-8",
+		" utf8 ":     "utf-8",
+		"ISO-8859-1": "windows-1252",
+		"latin1":     "windows-1252",
+		"Shift_JIS":  "shift_jis",
+		"x-unknown":  "x-unknown",
+		"":           "",
+	} {
+		if got := NormalizeCharset(name); got != want {
+			t.Fatalf("NormalizeCharset(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSelectRecords(t *testing.T) {
+	stats := NewStats()
+	config := &RequestConfig{Languages: []string{"fra"}, Charsets: []string{"latin1"}, Stats: stats}
+	records := []*CdxResponse{
+		{Original: "a", Languages: "eng,fra", Charset: "ISO-8859-1"},
+		{Original: "b", Languages: "fra", Charset: "UTF-8"},
+		{Original: "c", Languages: "eng", Charset: "windows-1252"},
+		{Original: "d"},
+	}
+
+	selected := config.SelectRecords(records)
+	if len(selected) != 1 || selected[0].Original != "a" {
+		t.Fatalf("Unexpected records: %v", selected)
+	}
+	if got := stats.Summary().Records[RecordFiltered]; got != 3 {
+		t.Fatalf("Expected 3 filtered records, got %v", got)
+	}
+
+	if got := (&RequestConfig{}).SelectRecords(records); len(got) != 4 {
+		t.Fatalf("Config without languages and charsets should keep all records, got %v", len(got))
+	}
+}
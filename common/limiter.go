@@ -0,0 +1,66 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests evenly to keep their rate under the limit, safe for concurrent use.
+// Nil limiter does not limit.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter ... Creates limiter of rps requests per second, nil if rps is not positive
+func NewRateLimiter(rps float64) *RateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Interval ... Returns minimal interval between requests, 0 if not limited
+func (l *RateLimiter) Interval() time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.interval
+}
+
+// Wait ... Blocks until next request is allowed, returns time waited
+func (l *RateLimiter) Wait() time.Duration {
+	if l == nil || l.interval == 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := time.Until(start)
+	time.Sleep(wait)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Waits for cooldown of the host, politeness of the endpoint and rate limiter of the phase.
+// Returned function must be called when request is finished. Error is returned if the job is canceled during cooldown.
+func (opts RequestOptions) acquire(url string) (func(), error) {
+	wait, err := opts.Cooldowns.Wait(url, opts.Gate)
+	opts.Stats.AddWait(opts.Phase, wait)
+	if err != nil {
+		return nil, err
+	}
+	release := opts.Politeness.Acquire(url)
+	opts.Stats.AddWait(opts.Phase, opts.Limiter.Wait())
+	return release, nil
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Wait()
+	}
+
+	// First request goes right away, next ones are spaced by 50ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Requests are not spaced: %v", elapsed)
+	}
+
+	if NewRateLimiter(0) != nil || NewRateLimiter(0).Wait() != 0 {
+		t.Fatalf("Zero rate should not limit")
+	}
+}
+
+func TestPhaseAccounting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	config := RequestConfig{Stats: NewStats(), StorageLimiter: NewRateLimiter(20)}
+	res := &CdxResponse{Config: &config}
+
+	GetWithOptions(server.URL, config.RequestOptions(5, 1))
+	GetWithOptions(server.URL, res.RequestOptions(5, 1))
+	GetWithOptions(server.URL, res.RequestOptions(5, 1))
+
+	summary := config.Stats.Summary()
+	if summary.Requests != 3 || summary.PhaseRequests[PhaseIndex] != 1 || summary.PhaseRequests[PhaseDownload] != 2 {
+		t.Fatalf("Incorrect phase accounting: %v", summary)
+	}
+	if summary.PhaseBytes[PhaseDownload] != 4 || summary.Waits[PhaseDownload] == 0 || summary.Waits[PhaseIndex] != 0 {
+		t.Fatalf("Incorrect phase bytes or waits: %v", summary)
+	}
+}
@@ -0,0 +1,362 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// IndexLister is implemented by sources with multiple indexes, like CommonCrawl.
+// Returns IDs of indexes which are queried for the config.
+type IndexLister interface {
+	Indexes(config RequestConfig) []string
+}
+
+// ManifestSource is a source queried by the harvest, with exact indexes used
+type ManifestSource struct {
+	Name    string   `json:"name"`
+	Indexes []string `json:"indexes,omitempty"`
+}
+
+// ManifestQuery contains everything needed to repeat the query
+type ManifestQuery struct {
+	JobID          string            `json:"job_id,omitempty"`
+	URL            string            `json:"url"`
+	Filters        []string          `json:"filters,omitempty"`
+	Limit          uint              `json:"limit,omitempty"`
+	CollapseColumn string            `json:"collapse,omitempty"`
+	SinglePage     bool              `json:"single_page,omitempty"`
+	FromDate       time.Time         `json:"from,omitempty"`
+	ToDate         time.Time         `json:"to,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Languages      []string          `json:"languages,omitempty"`
+	Charsets       []string          `json:"charsets,omitempty"`
+	Partition      *Partition        `json:"partition,omitempty"`
+	Sort           string            `json:"sort,omitempty"`
+	Closest        time.Time         `json:"closest,omitempty"`
+	IndexDate      time.Time         `json:"index_date,omitempty"`
+	Indexes        []string          `json:"indexes,omitempty"`
+	UserAgent      string            `json:"user_agent,omitempty"`
+	Sources        []ManifestSource  `json:"sources"`
+}
+
+// ManifestFile is a saved record file
+type ManifestFile struct {
+	Name      string            `json:"name"`
+	Original  string            `json:"original"`
+	Timestamp string            `json:"timestamp"`
+	Source    string            `json:"source"`
+	Digest    string            `json:"digest,omitempty"` // Digest reported by the index server
+	SHA256    string            `json:"sha256"`           // Digest of the written content
+	Size      int               `json:"size"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Robots    *RobotsDirectives `json:"robots,omitempty"` // Directives of the page if robots processor was used
+	Fetch     *FetchInfo        `json:"fetch,omitempty"`  // Latency, endpoint, attempts and verification of the download
+}
+
+// ManifestInput is a file the harvest was configured with, like list of hosts to keep
+type ManifestInput struct {
+	Name   string `json:"name"` // What the file is, like flag it was given with
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// ManifestOutput is a file produced by the harvest, like an archive
+type ManifestOutput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest is a machine-readable record of the harvest to audit and repeat it, safe for concurrent use.
+// Nil manifest ignores all updates.
+type Manifest struct {
+	mu            sync.Mutex
+	Software      string           `json:"software"` // Name and version of the harvesting tool
+	Command       []string         `json:"command,omitempty"`
+	Started       time.Time        `json:"started"`
+	Finished      time.Time        `json:"finished"`
+	Deterministic bool             `json:"deterministic,omitempty"` // Run was pinned to be reproduced from the manifest
+	Epoch         time.Time        `json:"epoch,omitempty"`         // Time queries and outputs of deterministic run were pinned at
+	Queries       []ManifestQuery  `json:"queries"`
+	Inputs        []ManifestInput  `json:"inputs,omitempty"`
+	Files         []ManifestFile   `json:"files"`
+	Outputs       []ManifestOutput `json:"outputs,omitempty"`
+	Stats         *StatsSummary    `json:"stats,omitempty"`
+}
+
+// NewManifest ... Starts manifest of the harvest
+//
+//	software: ex. "gogetcrawl 1.1.2"
+//	command: command line arguments of the harvest (optional)
+func NewManifest(software string, command []string) *Manifest {
+	return &Manifest{
+		Software: software,
+		Command:  command,
+		Started:  time.Now().UTC(),
+		Queries:  []ManifestQuery{},
+		Files:    []ManifestFile{},
+	}
+}
+
+// LoadManifest ... Reads manifest from JSON file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadManifest] Cannot read file: %w", err)
+	}
+
+	m := &Manifest{}
+	if err := jsoniter.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("[LoadManifest] Cannot decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// AddQuery ... Records query of the config made to sources
+func (m *Manifest) AddQuery(config RequestConfig, sources []Source) {
+	if m == nil {
+		return
+	}
+
+	query := NewManifestQuery(config, sources)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Queries = append(m.Queries, query)
+}
+
+// AddPlan ... Records planned query with indexes of its steps
+func (m *Manifest) AddPlan(plan *Plan) {
+	if m == nil {
+		return
+	}
+
+	query := NewManifestQuery(plan.Config, nil)
+	positions := map[string]int{}
+	for _, step := range plan.Steps {
+		i, ok := positions[step.SourceName]
+		if !ok {
+			i = len(query.Sources)
+			positions[step.SourceName] = i
+			query.Sources = append(query.Sources, ManifestSource{Name: step.SourceName})
+		}
+		if step.Index != "" {
+			query.Sources[i].Indexes = append(query.Sources[i].Indexes, step.Index)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Queries = append(m.Queries, query)
+}
+
+// NewManifestQuery ... Describes query of the config made to sources, with indexes they query
+func NewManifestQuery(config RequestConfig, sources []Source) ManifestQuery {
+	query := ManifestQuery{
+		JobID:          config.JobID,
+		URL:            config.URL,
+		Filters:        config.Filters,
+		Limit:          config.Limit,
+		CollapseColumn: config.CollapseColumn,
+		SinglePage:     config.SinglePage,
+		FromDate:       config.FromDate,
+		ToDate:         config.ToDate,
+		Tags:           config.Tags,
+		Languages:      config.Languages,
+		Charsets:       config.Charsets,
+		Partition:      config.Partition,
+		Sort:           config.Sort,
+		Closest:        config.Closest,
+		IndexDate:      config.IndexDate,
+		Indexes:        config.Indexes,
+		UserAgent:      config.UserAgent,
+		Sources:        []ManifestSource{},
+	}
+	for _, source := range sources {
+		ms := ManifestSource{Name: source.Name()}
+		if lister, ok := source.(IndexLister); ok {
+			ms.Indexes = lister.Indexes(config)
+		}
+		query.Sources = append(query.Sources, ms)
+	}
+	return query
+}
+
+// AddFile ... Records saved file of the record
+func (m *Manifest) AddFile(name string, res *CdxResponse, data []byte) {
+	if m == nil {
+		return
+	}
+
+	file := ManifestFile{
+		Name:      name,
+		Original:  res.Original,
+		Timestamp: res.Timestamp,
+		Digest:    res.Digest,
+		SHA256:    hashBytes(data),
+		Size:      len(data),
+		Tags:      res.Tags(),
+		Robots:    res.Robots,
+		Fetch:     res.Fetch,
+	}
+	if res.Source != nil {
+		file.Source = res.Source.Name()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files = append(m.Files, file)
+}
+
+// AddOutput ... Records digest of the output file, must be called after the output is closed
+func (m *Manifest) AddOutput(path string) error {
+	if m == nil {
+		return nil
+	}
+
+	digest, size, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("[AddOutput] %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Outputs = append(m.Outputs, ManifestOutput{Path: path, SHA256: digest, Size: size})
+	return nil
+}
+
+// AddInput ... Records digest of the file the harvest was configured with, so its changes are noticed when repeating it
+func (m *Manifest) AddInput(name, path string) error {
+	if m == nil {
+		return nil
+	}
+
+	digest, size, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("[AddInput] %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Inputs = append(m.Inputs, ManifestInput{Name: name, Path: path, SHA256: digest, Size: size})
+	return nil
+}
+
+// CheckInputs ... Tells which input files are missing or changed since the harvest
+func (m *Manifest) CheckInputs() []error {
+	errs := []error{}
+	for _, input := range m.Inputs {
+		digest, _, err := hashFile(input.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[CheckInputs] %v: %w", input.Name, err))
+		} else if digest != input.SHA256 {
+			errs = append(errs, fmt.Errorf("[CheckInputs] %v: '%v' changed since the harvest", input.Name, input.Path))
+		}
+	}
+	return errs
+}
+
+// Finish ... Records end of the harvest and its stats
+func (m *Manifest) Finish(stats *Stats) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Finished = time.Now().UTC()
+	if stats != nil {
+		summary := stats.Summary()
+		m.Stats = &summary
+	}
+}
+
+// Save ... Writes manifest into JSON file
+func (m *Manifest) Save(path string) error {
+	m.mu.Lock()
+	data, err := jsoniter.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("[Save] Cannot encode manifest: %w", err)
+	}
+
+	if err := WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("[Save] Cannot write manifest: %w", err)
+	}
+	return nil
+}
+
+// Config ... Returns request config of the query
+func (q ManifestQuery) Config() RequestConfig {
+	return RequestConfig{
+		URL:            q.URL,
+		Filters:        q.Filters,
+		Limit:          q.Limit,
+		CollapseColumn: q.CollapseColumn,
+		SinglePage:     q.SinglePage,
+		FromDate:       q.FromDate,
+		ToDate:         q.ToDate,
+		JobID:          q.JobID,
+		Tags:           q.Tags,
+		Languages:      q.Languages,
+		Charsets:       q.Charsets,
+		Partition:      q.Partition,
+		Sort:           q.Sort,
+		Closest:        q.Closest,
+		IndexDate:      q.IndexDate,
+		Indexes:        q.Indexes,
+		UserAgent:      q.UserAgent,
+	}
+}
+
+// Plan ... Returns plan repeating the query on the same sources and indexes, to be run with Downloader.HarvestPlan.
+// Sources are matched by name, the ones not provided are skipped.
+func (q ManifestQuery) Plan(sources []Source) *Plan {
+	byName := map[string]Source{}
+	for _, s := range sources {
+		byName[s.Name()] = s
+	}
+
+	plan := &Plan{Config: q.Config(), URL: q.URL}
+	for _, ms := range q.Sources {
+		source, ok := byName[ms.Name]
+		if !ok {
+			continue
+		}
+
+		if len(ms.Indexes) == 0 {
+			plan.Steps = append(plan.Steps, PlanStep{Source: source, SourceName: ms.Name})
+		}
+		for _, index := range ms.Indexes {
+			plan.Steps = append(plan.Steps, PlanStep{Source: source, SourceName: ms.Name, Index: index})
+		}
+	}
+	return plan
+}
+
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("Cannot open file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("Cannot read file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Source stub with multiple indexes
+type indexedSource struct {
+	planSource
+	indexes []string
+}
+
+func (s indexedSource) Indexes(config RequestConfig) []string {
+	return s.indexes
+}
+
+func TestManifest(t *testing.T) {
+	source := indexedSource{indexes: []string{"CC-MAIN-2023-14", "CC-MAIN-2023-06"}}
+	config := RequestConfig{URL: "example.com/*", Filters: []string{"statuscode:200"}, FromDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	m := NewManifest("gogetcrawl test", []string{"download", "example.com/*"})
+	m.AddQuery(config, []Source{source})
+	m.AddFile("a.html", &CdxResponse{Original: "http://example.com/", Timestamp: "20230101000000", Source: source}, []byte("abc"))
+	m.Finish(NewStats())
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := m.Save(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	file := loaded.Files[0]
+	if file.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" || file.Source != "Stub" || file.Size != 3 {
+		t.Fatalf("Incorrect file entry: %+v", file)
+	}
+
+	query := loaded.Queries[0]
+	if !query.Config().FromDate.Equal(config.FromDate) || query.Config().Filters[0] != "statuscode:200" {
+		t.Fatalf("Config is not restored: %+v", query.Config())
+	}
+
+	plan := query.Plan([]Source{source})
+	if len(plan.Steps) != 2 || plan.Steps[1].Index != "CC-MAIN-2023-06" {
+		t.Fatalf("Plan does not repeat indexes: %+v", plan.Steps)
+	}
+}
@@ -0,0 +1,372 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PagesFunc queries the index of source, empty index for sources with single one
+type PagesFunc func(config RequestConfig, index string) ([]*CdxResponse, error)
+
+// FetchFunc streams records of the query page by page, as Source.FetchPages does
+type FetchFunc func(config RequestConfig, results chan []*CdxResponse, errors chan error)
+
+// FileFunc downloads file of the record
+type FileFunc func(res *CdxResponse) ([]byte, error)
+
+// SourceMiddleware intercepts queries and downloads of wrapped source, passing them on with next.
+// Source is the wrapper, so middlewares can tell backends apart by its name.
+type SourceMiddleware interface {
+	GetPages(source Source, config RequestConfig, index string, next PagesFunc) ([]*CdxResponse, error)
+	FetchPages(source Source, config RequestConfig, results chan []*CdxResponse, errors chan error, next FetchFunc)
+	GetFile(source Source, res *CdxResponse, next FileFunc) ([]byte, error)
+}
+
+// WrappedSource layers middleware over source, other calls are passed to the source as is.
+// Records found through it point to the wrapper, so their downloads go through the middleware too.
+type WrappedSource struct {
+	Source
+	Middleware SourceMiddleware
+
+	self Source // Wrapper exposing optional interfaces of the source
+}
+
+// Wrapper of source with indexes, so IndexLister and IndexedSource checks see them through it
+type indexedWrappedSource struct {
+	*WrappedSource
+}
+
+// Wrappers of sources serving response headers, so HeaderSource checks see it through them
+type headerWrappedSource struct {
+	*WrappedSource
+}
+
+type indexedHeaderWrappedSource struct {
+	*indexedWrappedSource
+}
+
+// WrapSource ... Layers middlewares over source, the first one is the outermost.
+// Wrappers keep Planner, HeaderSource, IndexLister and IndexedSource of the source.
+func WrapSource(source Source, middlewares ...SourceMiddleware) Source {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		w := &WrappedSource{Source: source, Middleware: middlewares[i]}
+		_, isLister := source.(IndexLister)
+		_, isIndexed := source.(IndexedSource)
+		_, isHeaders := source.(HeaderSource)
+		switch {
+		case isLister && isIndexed && isHeaders:
+			w.self = &indexedHeaderWrappedSource{&indexedWrappedSource{w}}
+		case isLister && isIndexed:
+			w.self = &indexedWrappedSource{w}
+		case isHeaders:
+			w.self = &headerWrappedSource{w}
+		default:
+			w.self = w
+		}
+		source = w.self
+	}
+	return source
+}
+
+// UnwrapSource ... Returns source under all middleware layers
+func UnwrapSource(source Source) Source {
+	for {
+		switch w := source.(type) {
+		case *WrappedSource:
+			source = w.Source
+		case *indexedWrappedSource:
+			source = w.Source
+		case *headerWrappedSource:
+			source = w.Source
+		case *indexedHeaderWrappedSource:
+			source = w.Source
+		default:
+			return source
+		}
+	}
+}
+
+func (w *WrappedSource) outer() Source {
+	if w.self == nil {
+		return w
+	}
+	return w.self
+}
+
+func (w *WrappedSource) next(config RequestConfig, index string) ([]*CdxResponse, error) {
+	if index == "" {
+		return w.Source.GetPages(config)
+	}
+	indexed, ok := w.Source.(IndexedSource)
+	if !ok {
+		return nil, config.Errorf("[WrappedSource] %v has no indexes to query '%v'", w.Name(), index)
+	}
+	return indexed.GetPagesIndex(config, index)
+}
+
+func (w *WrappedSource) pages(config RequestConfig, index string) ([]*CdxResponse, error) {
+	records, err := w.Middleware.GetPages(w.outer(), config, index, w.next)
+	for _, r := range records {
+		r.Source = w.outer()
+	}
+	return records, err
+}
+
+func (w *WrappedSource) GetPages(config RequestConfig) ([]*CdxResponse, error) {
+	return w.pages(config, "")
+}
+
+// FetchPages ... Streams records of the source through the middleware, batches are sent as the source finds them
+func (w *WrappedSource) FetchPages(config RequestConfig, results chan []*CdxResponse, errors chan error) {
+	outer := w.outer()
+	w.Middleware.FetchPages(outer, config, results, errors, func(config RequestConfig, results chan []*CdxResponse, errors chan error) {
+		relayFetch(config, results, errors, w.Source.FetchPages, func(records []*CdxResponse) {
+			for _, r := range records {
+				r.Source = outer
+			}
+		}, nil)
+	})
+}
+
+// Runs fetch with its own channels, passing batches and errors on to results and errors once callbacks saw them.
+// Callbacks are optional and called from single goroutine.
+func relayFetch(config RequestConfig, results chan []*CdxResponse, errors chan error, fetch FetchFunc, onRecords func([]*CdxResponse), onError func(error)) {
+	innerResults, innerErrors := make(chan []*CdxResponse), make(chan error)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		records, errs := innerResults, innerErrors
+		for records != nil || errs != nil {
+			select {
+			case batch, ok := <-records:
+				if !ok {
+					records = nil
+					continue
+				}
+				if onRecords != nil {
+					onRecords(batch)
+				}
+				results <- batch
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				if onError != nil {
+					onError(err)
+				}
+				errors <- err
+			}
+		}
+	}()
+
+	fetch(config, innerResults, innerErrors)
+	close(innerResults)
+	close(innerErrors)
+	<-done
+}
+
+func (w *WrappedSource) GetFile(res *CdxResponse) ([]byte, error) {
+	return w.Middleware.GetFile(w.outer(), res, w.Source.GetFile)
+}
+
+// PlanSteps ... Plans the query with the source, sources without plans have single step
+func (w *WrappedSource) PlanSteps(config RequestConfig) ([]PlanStep, error) {
+	if planner, ok := w.Source.(Planner); ok {
+		return planner.PlanSteps(config)
+	}
+	return singleStep(w.outer(), config)
+}
+
+func (w *headerWrappedSource) GetHeaders(res *CdxResponse) (http.Header, error) {
+	return w.Source.(HeaderSource).GetHeaders(res)
+}
+
+func (w *indexedHeaderWrappedSource) GetHeaders(res *CdxResponse) (http.Header, error) {
+	return w.Source.(HeaderSource).GetHeaders(res)
+}
+
+func (w *indexedWrappedSource) Indexes(config RequestConfig) []string {
+	return w.Source.(IndexLister).Indexes(config)
+}
+
+func (w *indexedWrappedSource) GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error) {
+	return w.pages(config, index)
+}
+
+// CachedSource keeps query results in memory for TTL, so repeated queries of jobs are not sent again.
+// Failed queries are not kept. Files are not cached, see FileCache for them. Safe for concurrent use.
+type CachedSource struct {
+	TTL time.Duration // How long results are kept, forever if 0
+
+	mu      sync.Mutex
+	entries map[string]cachedPages
+	fetches map[string]cachedFetch
+}
+
+type cachedPages struct {
+	records []*CdxResponse
+	expires time.Time
+}
+
+type cachedFetch struct {
+	batches [][]*CdxResponse
+	expires time.Time
+}
+
+// Query parameters which change results, config pointers are compared by value
+func pagesKey(source Source, config RequestConfig, index string) string {
+	return fmt.Sprintf("%v|%v|%v%v|%v|%v|%v|%v|%v|%+v|%+v", source.Name(), index, config.GetUrl("", 0), config.SortParams(),
+		config.SinglePage, config.Languages, config.Charsets, config.IndexDate, config.Indexes, config.Partition, config.Resume)
+}
+
+// Copies of records are bound to the config of the query, as if they were just found
+func copyRecords(records []*CdxResponse) []*CdxResponse {
+	copies := make([]*CdxResponse, len(records))
+	for i, r := range records {
+		c := *r
+		copies[i] = &c
+	}
+	return copies
+}
+
+func (c *CachedSource) GetPages(source Source, config RequestConfig, index string, next PagesFunc) ([]*CdxResponse, error) {
+	key := pagesKey(source, config, index)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && (c.TTL <= 0 || time.Now().Before(entry.expires)) {
+		records := copyRecords(entry.records)
+		config.AttachRecords(records)
+		return records, nil
+	}
+
+	records, err := next(config, index)
+	if err != nil {
+		return records, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cachedPages{}
+	}
+	c.entries[key] = cachedPages{records: copyRecords(records), expires: time.Now().Add(c.TTL)}
+	return records, nil
+}
+
+// FetchPages ... Streams cached batches of the query, or the ones fetched which are kept if no page failed
+func (c *CachedSource) FetchPages(source Source, config RequestConfig, results chan []*CdxResponse, errors chan error, next FetchFunc) {
+	key := "fetch|" + pagesKey(source, config, "")
+
+	c.mu.Lock()
+	entry, ok := c.fetches[key]
+	c.mu.Unlock()
+	if ok && (c.TTL <= 0 || time.Now().Before(entry.expires)) {
+		for _, batch := range entry.batches {
+			records := copyRecords(batch)
+			config.AttachRecords(records)
+			results <- records
+		}
+		return
+	}
+
+	batches, failed := [][]*CdxResponse{}, false
+	relayFetch(config, results, errors, next, func(records []*CdxResponse) {
+		batches = append(batches, copyRecords(records))
+	}, func(error) {
+		failed = true
+	})
+	if failed {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetches == nil {
+		c.fetches = map[string]cachedFetch{}
+	}
+	c.fetches[key] = cachedFetch{batches: batches, expires: time.Now().Add(c.TTL)}
+}
+
+func (c *CachedSource) GetFile(source Source, res *CdxResponse, next FileFunc) ([]byte, error) {
+	return next(res)
+}
+
+// RateLimitedSource spaces queries and downloads of the source, on top of limiters of request configs.
+// Waits are accounted in stats of the config. Nil limiters do not limit.
+type RateLimitedSource struct {
+	Queries *RateLimiter
+	Files   *RateLimiter
+}
+
+func (l *RateLimitedSource) GetPages(source Source, config RequestConfig, index string, next PagesFunc) ([]*CdxResponse, error) {
+	config.Stats.AddWait(PhaseIndex, l.Queries.Wait())
+	return next(config, index)
+}
+
+// FetchPages ... Waits once before the streamed query, its pages are spaced by IndexLimiter of the config
+func (l *RateLimitedSource) FetchPages(source Source, config RequestConfig, results chan []*CdxResponse, errors chan error, next FetchFunc) {
+	config.Stats.AddWait(PhaseIndex, l.Queries.Wait())
+	next(config, results, errors)
+}
+
+func (l *RateLimitedSource) GetFile(source Source, res *CdxResponse, next FileFunc) ([]byte, error) {
+	waited := l.Files.Wait()
+	if res.Config != nil {
+		res.Config.Stats.AddWait(PhaseDownload, waited)
+	}
+	return next(res)
+}
+
+// LoggingSource logs each query and download of the source with its outcome and duration
+type LoggingSource struct {
+	Logger *log.Logger // Standard logger if nil
+}
+
+func (l *LoggingSource) printf(format string, a ...any) {
+	if l.Logger == nil {
+		log.Printf(format, a...)
+		return
+	}
+	l.Logger.Printf(format, a...)
+}
+
+func (l *LoggingSource) GetPages(source Source, config RequestConfig, index string, next PagesFunc) ([]*CdxResponse, error) {
+	start := time.Now()
+	records, err := next(config, index)
+	if err != nil {
+		l.printf("[%v] Query '%v' %v failed in %v: %v", source.Name(), config.URL, index, time.Since(start), err)
+	} else {
+		l.printf("[%v] Query '%v' %v found %v records in %v", source.Name(), config.URL, index, len(records), time.Since(start))
+	}
+	return records, err
+}
+
+// FetchPages ... Logs failed pages of the streamed query and its outcome once it is done
+func (l *LoggingSource) FetchPages(source Source, config RequestConfig, results chan []*CdxResponse, errors chan error, next FetchFunc) {
+	start := time.Now()
+	found, failed := 0, 0
+	relayFetch(config, results, errors, next, func(records []*CdxResponse) {
+		found += len(records)
+	}, func(err error) {
+		failed++
+		l.printf("[%v] Query '%v' page failed: %v", source.Name(), config.URL, err)
+	})
+	l.printf("[%v] Query '%v' found %v records in %v, %v pages failed", source.Name(), config.URL, found, time.Since(start), failed)
+}
+
+func (l *LoggingSource) GetFile(source Source, res *CdxResponse, next FileFunc) ([]byte, error) {
+	start := time.Now()
+	data, err := next(res)
+	if err != nil {
+		l.printf("[%v] Download %v %v failed in %v: %v", source.Name(), res.Original, res.Timestamp, time.Since(start), err)
+	} else {
+		l.printf("[%v] Downloaded %v %v, %v bytes in %v", source.Name(), res.Original, res.Timestamp, len(data), time.Since(start))
+	}
+	return data, err
+}
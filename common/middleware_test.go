@@ -0,0 +1,190 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Source stub with two records in each index
+type middlewareSource struct {
+	Source
+	indexes []string
+}
+
+func (s middlewareSource) Name() string { return "stub" }
+
+func (s middlewareSource) GetPages(config RequestConfig) ([]*CdxResponse, error) {
+	return s.GetPagesIndex(config, "")
+}
+
+func (s middlewareSource) GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error) {
+	records := []*CdxResponse{
+		{Original: config.URL, Timestamp: "20200101000000", Filename: index, Source: s},
+		{Original: config.URL, Timestamp: "20210101000000", Filename: index, Source: s},
+	}
+	config.AttachRecords(records)
+	return records, nil
+}
+
+// Streams each index as one batch, the index named "fail" fails
+func (s middlewareSource) FetchPages(config RequestConfig, results chan []*CdxResponse, errors chan error) {
+	for _, index := range s.indexes {
+		if index == "fail" {
+			errors <- fmt.Errorf("index %v failed", index)
+			continue
+		}
+		records, _ := s.GetPagesIndex(config, index)
+		results <- records
+	}
+}
+
+func (s middlewareSource) GetFile(res *CdxResponse) ([]byte, error) {
+	return []byte(res.Timestamp), nil
+}
+
+type indexedMiddlewareSource struct{ middlewareSource }
+
+func (s indexedMiddlewareSource) Indexes(config RequestConfig) []string { return s.indexes }
+
+type headerMiddlewareSource struct{ middlewareSource }
+
+func (s headerMiddlewareSource) GetHeaders(res *CdxResponse) (http.Header, error) {
+	return http.Header{"Server": {"stub"}}, nil
+}
+
+// Middleware counting calls which reach it
+type countingMiddleware struct {
+	pages, fetches, files int32
+}
+
+func (c *countingMiddleware) FetchPages(source Source, config RequestConfig, results chan []*CdxResponse, errors chan error, next FetchFunc) {
+	atomic.AddInt32(&c.fetches, 1)
+	next(config, results, errors)
+}
+
+func (c *countingMiddleware) GetPages(source Source, config RequestConfig, index string, next PagesFunc) ([]*CdxResponse, error) {
+	atomic.AddInt32(&c.pages, 1)
+	return next(config, index)
+}
+
+func (c *countingMiddleware) GetFile(source Source, res *CdxResponse, next FileFunc) ([]byte, error) {
+	atomic.AddInt32(&c.files, 1)
+	return next(res)
+}
+
+func TestWrapSource(t *testing.T) {
+	base := indexedMiddlewareSource{middlewareSource{indexes: []string{"CC-1", "CC-2"}}}
+	counter := &countingMiddleware{}
+	logs := &bytes.Buffer{}
+	source := WrapSource(base, &LoggingSource{Logger: log.New(logs, "", 0)}, &CachedSource{}, counter)
+
+	if _, ok := source.(IndexLister); !ok {
+		t.Fatalf("Wrapper should keep indexes of the source")
+	}
+	if _, ok := WrapSource(base.middlewareSource, counter).(IndexLister); ok {
+		t.Fatalf("Wrapper should not add indexes to the source")
+	}
+	if _, ok := source.(HeaderSource); ok {
+		t.Fatalf("Wrapper should not add response headers to the source")
+	}
+	headers := WrapSource(headerMiddlewareSource{}, counter)
+	if h, ok := headers.(HeaderSource); !ok {
+		t.Fatalf("Wrapper should keep response headers of the source")
+	} else if header, err := h.GetHeaders(&CdxResponse{}); err != nil || header.Get("Server") != "stub" {
+		t.Fatalf("Unexpected headers: %v, %v", header, err)
+	}
+	if _, ok := UnwrapSource(headers).(headerMiddlewareSource); !ok {
+		t.Fatalf("Unexpected unwrapped source: %v", UnwrapSource(headers))
+	}
+	if _, ok := UnwrapSource(source).(indexedMiddlewareSource); !ok {
+		t.Fatalf("Unexpected unwrapped source: %v", UnwrapSource(source))
+	}
+
+	stats := NewStats()
+	first, _ := source.(IndexedSource).GetPagesIndex(RequestConfig{URL: "example.com", Stats: stats}, "CC-1")
+	second, _ := source.(IndexedSource).GetPagesIndex(RequestConfig{URL: "example.com", Stats: stats}, "CC-1")
+	if counter.pages != 1 || len(second) != 2 {
+		t.Fatalf("Repeated query should be served from cache: %v queries, %v records", counter.pages, len(second))
+	}
+	if first[0] == second[0] || second[0].Config == nil {
+		t.Fatalf("Cached records should be copies bound to the query config")
+	}
+	if second[0].Source != source {
+		t.Fatalf("Records should point to the outermost wrapper")
+	}
+
+	data, err := second[0].Source.GetFile(second[0])
+	if err != nil || string(data) != "20200101000000" || counter.files != 1 {
+		t.Fatalf("Download should go through middleware: %q, %v", data, err)
+	}
+	if !strings.Contains(logs.String(), "[stub] Query 'example.com' CC-1 found 2 records") || !strings.Contains(logs.String(), "Downloaded example.com 20200101000000, 14 bytes") {
+		t.Fatalf("Unexpected logs:\n%v", logs)
+	}
+}
+
+func TestWrappedFetchPages(t *testing.T) {
+	base := indexedMiddlewareSource{middlewareSource{indexes: []string{"CC-1", "fail", "CC-2"}}}
+	counter := &countingMiddleware{}
+	logs := &bytes.Buffer{}
+	source := WrapSource(base, &LoggingSource{Logger: log.New(logs, "", 0)}, &CachedSource{}, &RateLimitedSource{Queries: NewRateLimiter(1000)}, counter)
+
+	fetch := func() ([][]*CdxResponse, []error) {
+		results := make(chan []*CdxResponse)
+		errors := make(chan error)
+		done := make(chan struct{})
+		batches, errs := [][]*CdxResponse{}, []error{}
+		go func() {
+			defer close(done)
+			for results != nil || errors != nil {
+				select {
+				case records, ok := <-results:
+					if !ok {
+						results = nil
+						continue
+					}
+					batches = append(batches, records)
+				case err, ok := <-errors:
+					if !ok {
+						errors = nil
+						continue
+					}
+					errs = append(errs, err)
+				}
+			}
+		}()
+		source.FetchPages(RequestConfig{URL: "example.com"}, results, errors)
+		close(results)
+		close(errors)
+		<-done
+		return batches, errs
+	}
+
+	// Batches of the source are passed on as streamed, failed index does not stop the next one
+	batches, errs := fetch()
+	if len(batches) != 2 || batches[0][0].Filename != "CC-1" || batches[1][0].Filename != "CC-2" || len(errs) != 1 {
+		t.Fatalf("Unexpected fetch: %v batches, %v", len(batches), errs)
+	}
+	if batches[1][0].Source != source || counter.fetches != 1 || counter.pages != 0 {
+		t.Fatalf("Fetch should go through middleware to records pointing to the wrapper: %v fetches", counter.fetches)
+	}
+	if !strings.Contains(logs.String(), "[stub] Query 'example.com' page failed: index fail failed") || !strings.Contains(logs.String(), "found 4 records") {
+		t.Fatalf("Unexpected logs:\n%v", logs)
+	}
+
+	// Fetch with failed page is not cached
+	fetch()
+	if counter.fetches != 2 {
+		t.Fatalf("Failed fetch should not be cached: %v fetches", counter.fetches)
+	}
+	base.indexes = []string{"CC-1", "CC-2"}
+	source = WrapSource(base, &CachedSource{}, counter)
+	fetch()
+	if batches, errs := fetch(); len(batches) != 2 || len(errs) != 0 || counter.fetches != 3 || batches[0][0].Config == nil {
+		t.Fatalf("Repeated fetch should be served from cache: %v fetches", counter.fetches)
+	}
+}
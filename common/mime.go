@@ -0,0 +1,104 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// MIME values of CDX records which tell nothing about the content
+var unknownMimeTypes = map[string]bool{
+	"":             true,
+	"unk":          true,
+	"warc/revisit": true,
+}
+
+// DetectMimeType ... Returns MIME type of the record content, trying in order:
+// CDX mime field, Content-Type of archived HTTP response, URL extension and content sniffing.
+// HTTP headers are considered when data is the full response, as CommonCrawl GetFile returns.
+func DetectMimeType(res *CdxResponse, data []byte) string {
+	if mimeType := baseMimeType(res.MimeType); !unknownMimeTypes[mimeType] && hasExtension(mimeType) {
+		return mimeType
+	}
+
+	body := data
+	if header, rest, ok := splitHTTPResponse(data); ok {
+		body = rest
+		if mimeType := baseMimeType(header.Get("Content-Type")); mimeType != "" && hasExtension(mimeType) {
+			return mimeType
+		}
+	}
+
+	if u, err := url.Parse(res.Original); err == nil {
+		if ext := path.Ext(u.Path); ext != "" {
+			if mimeType := baseMimeType(mime.TypeByExtension(ext)); mimeType != "" {
+				return mimeType
+			}
+		}
+	}
+
+	return baseMimeType(http.DetectContentType(body))
+}
+
+func baseMimeType(mimeType string) string {
+	return strings.TrimSpace(strings.ToLower(strings.Split(mimeType, ";")[0]))
+}
+
+// Extensions of types returned by content sniffing, which can be missing or ambiguous in system MIME tables
+var sniffedExtensions = map[string]string{
+	"text/plain":               ".txt",
+	"application/octet-stream": ".bin",
+	"application/zip":          ".zip",
+	"application/x-gzip":       ".gz",
+	"application/postscript":   ".ps",
+	"application/ogg":          ".ogg",
+	"audio/mpeg":               ".mp3",
+	"audio/wave":               ".wav",
+	"video/mp4":                ".mp4",
+	"video/webm":               ".webm",
+	"image/bmp":                ".bmp",
+	"image/x-icon":             ".ico",
+	"font/woff":                ".woff",
+	"font/woff2":               ".woff2",
+}
+
+// Returns file extension of MIME type, empty if unknown
+func extensionOf(mimeType string) string {
+	mimeType = baseMimeType(mimeType)
+	if ext, ok := sniffedExtensions[mimeType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func hasExtension(mimeType string) bool {
+	return extensionOf(mimeType) != ""
+}
+
+// Splits HTTP response into headers and body, ok is false if data is not an HTTP response
+func splitHTTPResponse(data []byte) (textproto.MIMEHeader, []byte, bool) {
+	if !bytes.HasPrefix(data, []byte("HTTP/")) {
+		return nil, nil, false
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	tp := textproto.NewReader(reader)
+	if _, err := tp.ReadLine(); err != nil {
+		return nil, nil, false
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, false
+	}
+
+	consumed := len(data) - reader.Buffered()
+	return header, data[consumed:], true
+}
@@ -0,0 +1,31 @@
+package common
+
+import "testing"
+
+func TestDetectMimeType(t *testing.T) {
+	cases := []struct {
+		res      *CdxResponse
+		data     string
+		expected string
+	}{
+		{&CdxResponse{Original: "http://example.com/", MimeType: "text/html"}, "{}", "text/html"},
+		{&CdxResponse{Original: "http://example.com/a", MimeType: "warc/revisit"}, "HTTP/1.1 200 OK\r\nContent-Type: application/pdf\r\n\r\n%PDF", "application/pdf"},
+		{&CdxResponse{Original: "http://example.com/a.json", MimeType: "unk"}, "[]", "application/json"},
+		{&CdxResponse{Original: "http://example.com/a", MimeType: ""}, "<!DOCTYPE html><html></html>", "text/html"},
+		{&CdxResponse{Original: "http://example.com/a", MimeType: ""}, "HTTP/1.1 200 OK\r\nServer: x\r\n\r\n\x89PNG\r\n\x1a\n", "image/png"},
+	}
+
+	for _, c := range cases {
+		if got := DetectMimeType(c.res, []byte(c.data)); got != c.expected {
+			t.Fatalf("%v: got %v, expected %v", c.res.Original, got, c.expected)
+		}
+	}
+}
+
+func TestFileNameSniffed(t *testing.T) {
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", MimeType: "text/plain", Source: planSource{}}
+	name, err := FileName(res)
+	if err != nil || name != "http%3A%2F%2Fexample.com%2F-20130522121421-Stub.txt" {
+		t.Fatalf("Got %v, err: %v", name, err)
+	}
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Record representation in NDJSON output
+type ndjsonRecord struct {
+	*CdxResponse
+	SourceName string            `json:"source,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Resume     string            `json:"resume,omitempty"` // Token to continue the query after batch of the record
+}
+
+// NDJSONWriter streams CDX records to writer as newline-delimited JSON, safe for concurrent use
+type NDJSONWriter struct {
+	mu     sync.Mutex
+	buf    *bufio.Writer
+	stream *jsoniter.Stream
+}
+
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	buf := bufio.NewWriter(w)
+	return &NDJSONWriter{
+		buf:    buf,
+		stream: jsoniter.NewStream(jsoniter.ConfigCompatibleWithStandardLibrary, buf, 4096),
+	}
+}
+
+// Write ... Encodes records, one JSON object per line, and flushes them to the underlying writer
+func (nw *NDJSONWriter) Write(records []*CdxResponse) error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	for _, r := range records {
+		rec := ndjsonRecord{CdxResponse: r, Tags: r.Tags()}
+		if r.Source != nil {
+			rec.SourceName = r.Source.Name()
+		}
+		if r.Resume != nil {
+			rec.Resume = r.Resume.String()
+		}
+
+		nw.stream.WriteVal(rec)
+		nw.stream.WriteRaw("\n")
+		if nw.stream.Error != nil {
+			err := nw.stream.Error
+			nw.stream.Error = nil
+			return fmt.Errorf("[NDJSONWriter] Cannot encode record: %w", err)
+		}
+	}
+
+	return nw.Flush()
+}
+
+func (nw *NDJSONWriter) Flush() error {
+	if err := nw.stream.Flush(); err != nil {
+		return fmt.Errorf("[NDJSONWriter] Cannot flush: %w", err)
+	}
+	if err := nw.buf.Flush(); err != nil {
+		return fmt.Errorf("[NDJSONWriter] Cannot flush: %w", err)
+	}
+	return nil
+}
+
+// ResumeFromNDJSON ... Returns resume token of the last record of NDJSON output file.
+// Line cut off by interrupted run is dropped from the file with the rest of its batch, which may be incomplete too,
+// and the token of the batch before it is returned, so resumed run appended to the file writes each record once.
+// Nil token is returned if output has no complete batch, then query starts over.
+func ResumeFromNDJSON(path string) (*ResumeToken, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("[ResumeFromNDJSON] Cannot open output: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("[ResumeFromNDJSON] %w", err)
+	}
+
+	lines := &reverseLines{file: file, offset: info.Size()}
+	partial, end, err := lines.prev()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("[ResumeFromNDJSON] Cannot read output: %w", err)
+	}
+	cut := len(partial) > 0
+
+	var last, resume string
+	for {
+		line, start, err := lines.prev()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[ResumeFromNDJSON] Cannot read output: %w", err)
+		}
+
+		record := struct {
+			Resume string `json:"resume"`
+		}{}
+		if err := jsoniter.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("[ResumeFromNDJSON] Cannot decode record at offset %v: %w", start, err)
+		}
+		if record.Resume == "" {
+			return nil, fmt.Errorf("[ResumeFromNDJSON] Record at offset %v has no resume token", start)
+		}
+		if !cut || (last != "" && record.Resume != last) {
+			resume = record.Resume
+			break
+		}
+		last, end = record.Resume, start
+	}
+
+	if end < info.Size() {
+		log.Printf("[ResumeFromNDJSON] Dropping partial last batch of '%v' from offset %v", path, end)
+		if err := file.Truncate(end); err != nil {
+			return nil, fmt.Errorf("[ResumeFromNDJSON] Cannot drop partial batch: %w", err)
+		}
+	}
+	if resume == "" {
+		if !cut {
+			return nil, fmt.Errorf("[ResumeFromNDJSON] No records in '%v'", path)
+		}
+		return nil, nil
+	}
+	return ParseResumeToken(resume)
+}
+
+// Reads lines of the file from its end
+type reverseLines struct {
+	file   *os.File
+	offset int64  // File offset of the tail
+	tail   []byte // Read part of the file before the returned lines
+	done   bool
+}
+
+// Returns previous line without newline and its file offset, first call returns text after the last newline.
+// Returns io.EOF once the start of the file is passed.
+func (r *reverseLines) prev() ([]byte, int64, error) {
+	const chunk = 64 * 1024
+	for {
+		if i := bytes.LastIndexByte(r.tail, '\n'); i >= 0 {
+			line := r.tail[i+1:]
+			r.tail = r.tail[:i]
+			return line, r.offset + int64(i) + 1, nil
+		}
+		if r.offset == 0 {
+			if r.done {
+				return nil, 0, io.EOF
+			}
+			r.done = true
+			return r.tail, 0, nil
+		}
+
+		size := int64(chunk)
+		if r.offset < size {
+			size = r.offset
+		}
+		r.offset -= size
+		buf := make([]byte, size, int(size)+len(r.tail))
+		if _, err := r.file.ReadAt(buf, r.offset); err != nil {
+			return nil, 0, err
+		}
+		r.tail = append(buf, r.tail...)
+	}
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := NewNDJSONWriter(&buf)
+
+	records := []*CdxResponse{
+		{Original: "http://example.com/", Timestamp: "20130522121421", StatusCode: "200"},
+		{Original: "http://example.com/1", Timestamp: "20130522121422", Config: &RequestConfig{URL: "example.com"}},
+	}
+	if err := w.Write(records); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Incorrect number of lines: %v", len(lines))
+	}
+
+	parsed := CdxResponse{}
+	if err := jsoniter.Unmarshal([]byte(lines[1]), &parsed); err != nil {
+		t.Fatalf("Cannot decode line: %v", err)
+	}
+	if parsed.Original != records[1].Original || parsed.Config != nil {
+		t.Fatalf("Incorrectly encoded record: %v", lines[1])
+	}
+}
+
+// Writes batches of 3 records, tokens of batches have their pages
+func writeBatches(t *testing.T, path string, batches int, partial string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := NewNDJSONWriter(file)
+	for page := 1; page <= batches; page++ {
+		token := &ResumeToken{Source: "Wayback", URL: "example.com/*", Page: page}
+		batch := []*CdxResponse{}
+		for i := 0; i < 3; i++ {
+			batch = append(batch, &CdxResponse{Original: "http://example.com/", Resume: token})
+		}
+		if err := writer.Write(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.WriteString(partial)
+}
+
+func TestResumeFromNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+
+	// Complete output continues after its last batch, batches span several chunks of the tail read
+	writeBatches(t, path, 700, "")
+	if token, err := ResumeFromNDJSON(path); err != nil || token.Page != 700 {
+		t.Fatalf("Unexpected token: %+v, %v", token, err)
+	}
+
+	// Batch of the cut line is dropped, query continues after the batch before it
+	writeBatches(t, path, 700, `{"urlkey":"com,example)/","resume":"eyJzb3VyY2Ui`)
+	token, err := ResumeFromNDJSON(path)
+	if err != nil || token.Page != 699 {
+		t.Fatalf("Unexpected token: %+v, %v", token, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasSuffix(data, []byte("\n")) || bytes.Count(data, []byte("\n")) != 699*3 {
+		t.Fatalf("Partial batch should be dropped")
+	}
+
+	// Query starts over without complete batch
+	writeBatches(t, path, 1, `{"urlkey"`)
+	if token, err := ResumeFromNDJSON(path); err != nil || token != nil {
+		t.Fatalf("Query should start over: %+v, %v", token, err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("Partial batch should be dropped: %q", data)
+	}
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output is a target downloaded files are written to, must be safe for concurrent use
+type Output interface {
+	Write(name string, data []byte) error
+	Close() error
+}
+
+// Writes files into directory
+type DirOutput struct {
+	Dir string
+}
+
+func NewDirOutput(dir string) *DirOutput {
+	return &DirOutput{Dir: dir}
+}
+
+// Write ... Saves file, name may contain slash separated subdirectories
+func (o *DirOutput) Write(name string, data []byte) error {
+	return NewDiskStorage(o.Dir).Put(name, bytes.NewReader(data), nil)
+}
+
+func (o *DirOutput) Close() error {
+	return nil
+}
+
+// Streams files into single tar.gz archive, archive appears at its path once it is closed
+type TarOutput struct {
+	Epoch time.Time // Fixed modification time of entries for reproducible archives, time of writing if zero
+
+	mu   sync.Mutex
+	file *AtomicFile
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func NewTarOutput(path string) (*TarOutput, error) {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return nil, fmt.Errorf("[NewTarOutput] Cannot create archive: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	return &TarOutput{file: file, gz: gz, tw: tar.NewWriter(gz)}, nil
+}
+
+func (o *TarOutput) Write(name string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modTime(o.Epoch),
+	}
+	if err := o.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("[TarOutput] Cannot write header of '%v': %w", name, err)
+	}
+	if _, err := o.tw.Write(data); err != nil {
+		return fmt.Errorf("[TarOutput] Cannot write '%v': %w", name, err)
+	}
+	return nil
+}
+
+func (o *TarOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.tw.Close(); err != nil {
+		o.file.Abort()
+		return err
+	}
+	if err := o.gz.Close(); err != nil {
+		o.file.Abort()
+		return err
+	}
+	return o.file.Commit()
+}
+
+// Streams files into single zip archive, archive appears at its path once it is closed
+type ZipOutput struct {
+	Epoch time.Time // Fixed modification time of entries for reproducible archives, time of writing if zero
+
+	mu   sync.Mutex
+	file *AtomicFile
+	zw   *zip.Writer
+}
+
+func NewZipOutput(path string) (*ZipOutput, error) {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return nil, fmt.Errorf("[NewZipOutput] Cannot create archive: %w", err)
+	}
+	return &ZipOutput{file: file, zw: zip.NewWriter(file)}, nil
+}
+
+func (o *ZipOutput) Write(name string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w, err := o.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime(o.Epoch)})
+	if err != nil {
+		return fmt.Errorf("[ZipOutput] Cannot create '%v': %w", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("[ZipOutput] Cannot write '%v': %w", name, err)
+	}
+	return nil
+}
+
+func (o *ZipOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.zw.Close(); err != nil {
+		o.file.Abort()
+		return err
+	}
+	return o.file.Commit()
+}
+
+func modTime(epoch time.Time) time.Time {
+	if epoch.IsZero() {
+		return time.Now()
+	}
+	return epoch
+}
+
+// NewArchiveOutput ... Chooses archive format by path extension: .tar.gz, .tgz or .zip
+func NewArchiveOutput(path string) (Output, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return NewTarOutput(path)
+	case strings.HasSuffix(lower, ".zip"):
+		return NewZipOutput(path)
+	}
+	return nil, fmt.Errorf("[NewArchiveOutput] Unsupported archive format: '%v', use .tar.gz or .zip", path)
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.tar.gz")
+	output, err := NewArchiveOutput(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	output.Write("a.html", []byte("<html>a</html>"))
+	output.Write("b.html", []byte("<html>b</html>"))
+	if err := output.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tr := tar.NewReader(gz)
+	names := []string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		names = append(names, header.Name)
+	}
+
+	if len(names) != 2 || names[1] != "b.html" {
+		t.Fatalf("Incorrect archive content: %v", names)
+	}
+}
+
+func TestZipOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.zip")
+	output, err := NewArchiveOutput(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	output.Write("a.html", []byte("<html>a</html>"))
+	if err := output.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer zr.Close()
+
+	if len(zr.File) != 1 || zr.File[0].Name != "a.html" {
+		t.Fatalf("Incorrect archive content: %v", zr.File)
+	}
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Ways to partition harvest
+const (
+	PartitionIndex = "index" // Whole indexes (Common Crawl crawls, bulk CDX shards) by their position
+	PartitionPage  = "page"  // Index pages by page number modulo slice count
+	PartitionSURT  = "surt"  // Records by hash of SURT host, so captures of a host stay in one slice
+)
+
+// Partition is a deterministic slice of the harvest, so several machines can each run disjoint share of it
+// without a coordinator: every machine runs the same query with the same count and its own slice.
+// Nil partition takes the whole harvest.
+type Partition struct {
+	Mode  string `json:"mode"`
+	Slice int    `json:"slice"` // Slice taken by this run, from 0
+	Count int    `json:"count"` // Number of slices
+}
+
+// NewPartition ... Creates partition taking slice of count slices
+func NewPartition(mode string, slice, count int) (*Partition, error) {
+	switch mode {
+	case PartitionIndex, PartitionPage, PartitionSURT:
+	default:
+		return nil, fmt.Errorf("[NewPartition] Unknown mode '%v', use %v, %v or %v", mode, PartitionIndex, PartitionPage, PartitionSURT)
+	}
+	if count < 1 || slice < 0 || slice >= count {
+		return nil, fmt.Errorf("[NewPartition] Slice must be in 0..%v, got %v", count-1, slice)
+	}
+	return &Partition{Mode: mode, Slice: slice, Count: count}, nil
+}
+
+// ParsePartition ... Parses partition given as [mode:]slice/count, page mode by default. Empty string is no partition.
+//
+//	ex: "0/4", "page:3/4", "surt:1/8", "index:0/2"
+func ParsePartition(s string) (*Partition, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	mode := PartitionPage
+	if before, after, found := strings.Cut(s, ":"); found {
+		mode, s = strings.ToLower(strings.TrimSpace(before)), after
+	}
+	slice, count, found := strings.Cut(s, "/")
+	if !found {
+		return nil, fmt.Errorf("[ParsePartition] Partition must look like [mode:]slice/count, got '%v'", s)
+	}
+	sliceNum, err := strconv.Atoi(strings.TrimSpace(slice))
+	if err != nil {
+		return nil, fmt.Errorf("[ParsePartition] Bad slice '%v': %w", slice, err)
+	}
+	countNum, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return nil, fmt.Errorf("[ParsePartition] Bad count '%v': %w", count, err)
+	}
+	return NewPartition(mode, sliceNum, countNum)
+}
+
+func (p *Partition) String() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v:%v/%v", p.Mode, p.Slice, p.Count)
+}
+
+func (p *Partition) owns(n int) bool {
+	return n%p.Count == p.Slice
+}
+
+// HasIndex ... Tells if index at the position of source indexes belongs to the slice
+func (p *Partition) HasIndex(position int) bool {
+	return p == nil || p.Mode != PartitionIndex || p.owns(position)
+}
+
+// HasPage ... Tells if index page belongs to the slice
+func (p *Partition) HasPage(page int) bool {
+	return p == nil || p.Mode != PartitionPage || p.owns(page)
+}
+
+// HasRecord ... Tells if record belongs to the slice by its SURT host
+func (p *Partition) HasRecord(res *CdxResponse) bool {
+	if p == nil || p.Mode != PartitionSURT {
+		return true
+	}
+
+	key := res.Urlkey
+	if key == "" {
+		key = SURT(res.Original)
+	}
+	host, _, _ := strings.Cut(key, ")")
+
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	return p.owns(int(h.Sum32() % uint32(p.Count)))
+}
+
+// Shards ... Returns bulk CDX shards or other index files of the slice, only index mode splits them
+func (p *Partition) Shards(paths []string) []string {
+	if p == nil || p.Mode != PartitionIndex {
+		return paths
+	}
+
+	owned := []string{}
+	for i, path := range paths {
+		if p.owns(i) {
+			owned = append(owned, path)
+		}
+	}
+	return owned
+}
+
+// Pages ... Returns number of pages out of total which belong to the slice
+func (p *Partition) Pages(total int) int {
+	if p == nil || p.Mode != PartitionPage {
+		return total
+	}
+
+	pages := total / p.Count
+	if p.Slice < total%p.Count {
+		pages++
+	}
+	return pages
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePartition(t *testing.T) {
+	for s, want := range map[string]string{"1/4": "page:1/4", "surt:0/2": "surt:0/2", " INDEX: 2 / 3 ": "index:2/3"} {
+		p, err := ParsePartition(s)
+		if err != nil || p.String() != want {
+			t.Fatalf("%q: got %v, %v", s, p, err)
+		}
+	}
+	if p, err := ParsePartition(""); p != nil || err != nil {
+		t.Fatalf("Empty partition should be nil")
+	}
+	for _, s := range []string{"4/4", "-1/4", "0/0", "1", "shard:0/2", "a/b"} {
+		if _, err := ParsePartition(s); err == nil {
+			t.Fatalf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestPartitionDisjoint(t *testing.T) {
+	const count = 3
+	records := []*CdxResponse{}
+	for i := 0; i < 30; i++ {
+		records = append(records, &CdxResponse{Original: fmt.Sprintf("http://host%v.example.com/page%v", i%7, i)})
+	}
+
+	pages, owners := 0, map[string]int{}
+	for slice := 0; slice < count; slice++ {
+		pageSlice, _ := NewPartition(PartitionPage, slice, count)
+		for page := 0; page < 10; page++ {
+			if pageSlice.HasPage(page) {
+				pages++
+			}
+		}
+		if pageSlice.Pages(10) != map[int]int{0: 4, 1: 3, 2: 3}[slice] {
+			t.Fatalf("Slice %v: unexpected page count %v", slice, pageSlice.Pages(10))
+		}
+
+		surtSlice, _ := NewPartition(PartitionSURT, slice, count)
+		config := RequestConfig{Partition: surtSlice}
+		for _, res := range config.SelectRecords(records) {
+			host := SURT(res.Original)[:len("com,example,hostN")]
+			if owner, ok := owners[host]; ok && owner != slice {
+				t.Fatalf("Host %v is split between slices %v and %v", host, owner, slice)
+			}
+			owners[host] = slice
+		}
+	}
+	if pages != 10 || len(owners) != 7 {
+		t.Fatalf("Slices do not cover everything: pages=%v hosts=%v", pages, len(owners))
+	}
+
+	indexSlice, _ := NewPartition(PartitionIndex, 1, 2)
+	if shards := indexSlice.Shards([]string{"cdx-00000.gz", "cdx-00001.gz", "cdx-00002.gz", "cdx-00003.gz"}); len(shards) != 2 || shards[0] != "cdx-00001.gz" {
+		t.Fatalf("Unexpected shards: %v", shards)
+	}
+	if !indexSlice.HasPage(0) || !indexSlice.HasRecord(records[0]) {
+		t.Fatalf("Index partition should not split pages or records")
+	}
+}
+
+func TestNewPlanPartition(t *testing.T) {
+	pageSlice, _ := NewPartition(PartitionPage, 1, 4)
+	plan, err := NewPlan([]Source{planSource{pages: 10}}, RequestConfig{URL: "example.com/*", Partition: pageSlice})
+	if err != nil || plan.Steps[0].Pages != 3 {
+		t.Fatalf("Unexpected plan: %v, %v", plan, err)
+	}
+
+	indexSlice, _ := NewPartition(PartitionIndex, 1, 2)
+	if plan, _ := NewPlan([]Source{planSource{pages: 10}}, RequestConfig{URL: "example.com/*", Partition: indexSlice}); len(plan.Steps) != 0 {
+		t.Fatalf("Single index source belongs to the first slice: %v", plan.Steps)
+	}
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rough estimates used when source cannot tell better
+const (
+	estimatedRecordsPerPage = 15000           // pywb index page is 5 blocks of 3000 lines by default
+	estimatedRecordBytes    = 350             // Average size of single CDX JSON record
+	estimatedLatency        = time.Second * 2 // Average index server response time
+)
+
+// PlanStep is a single index query of the plan
+type PlanStep struct {
+	Source         Source `json:"-"`
+	SourceName     string `json:"source"`
+	Index          string `json:"index,omitempty"` // Index ID for sources with multiple indexes, like CommonCrawl
+	Endpoint       string `json:"endpoint"`        // Index server URL
+	Pages          int    `json:"pages"`
+	RecordsPerPage int    `json:"records_per_page"`
+}
+
+// Plan describes work needed to run the query and its estimated cost
+type Plan struct {
+	Config            RequestConfig `json:"-"`
+	URL               string        `json:"url"`
+	Steps             []PlanStep    `json:"steps"`
+	Requests          int           `json:"requests"`           // Estimated index requests
+	Records           int           `json:"records"`            // Estimated number of records, capped by limit
+	Bytes             int64         `json:"bytes"`              // Estimated bytes of index responses
+	Duration          time.Duration `json:"duration"`           // Estimated time of index queries under rate limits
+	DurationFormatted string        `json:"duration_formatted"` // Human readable duration
+}
+
+// Planner is implemented by sources which query several indexes and can break the query down by them
+type Planner interface {
+	PlanSteps(config RequestConfig) ([]PlanStep, error)
+}
+
+// IndexedSource is implemented by sources able to query specific index
+type IndexedSource interface {
+	GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error)
+}
+
+// NewPlan ... Resolves which sources and indexes will be queried for the config and estimates the cost
+func NewPlan(sources []Source, config RequestConfig) (*Plan, error) {
+	plan := &Plan{Config: config, URL: config.URL}
+
+	for _, source := range sources {
+		var steps []PlanStep
+
+		var err error
+		if planner, ok := source.(Planner); ok {
+			steps, err = planner.PlanSteps(config)
+		} else {
+			steps, err = singleStep(source, config)
+		}
+		if err != nil {
+			return nil, config.Errorf("[NewPlan] %v: %w", source.Name(), err)
+		}
+
+		for _, step := range steps {
+			step.Source = source
+			step.SourceName = source.Name()
+			step.Pages = config.Partition.Pages(step.Pages)
+			if step.RecordsPerPage == 0 {
+				step.RecordsPerPage = estimatedRecordsPerPage
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+
+	plan.estimate()
+	return plan, nil
+}
+
+// Source without indexes to break query down by has single one
+func singleStep(source Source, config RequestConfig) ([]PlanStep, error) {
+	if !config.Partition.HasIndex(0) {
+		return nil, nil
+	}
+	pages := 1
+	if !config.SinglePage {
+		var err error
+		if pages, err = source.GetNumPages(config.URL); err != nil {
+			return nil, err
+		}
+	}
+	return []PlanStep{{Source: source, Pages: pages}}, nil
+}
+
+func (plan *Plan) estimate() {
+	plan.Requests, plan.Records, plan.Bytes, plan.Duration = 0, 0, 0, 0
+	limit := int(plan.Config.Limit)
+
+	for _, step := range plan.Steps {
+		pages := step.Pages
+		records := pages * step.RecordsPerPage
+
+		// Limit applies to each source query, so the rest of the pages is not requested
+		if limit > 0 && records > limit {
+			records = limit
+			pages = (limit + step.RecordsPerPage - 1) / step.RecordsPerPage
+		}
+
+		requests := pages
+		if !plan.Config.SinglePage {
+			requests += 1 // Number of pages request
+		}
+
+		plan.Requests += requests
+		plan.Records += records
+		plan.Bytes += int64(records) * estimatedRecordBytes
+
+		latency := estimatedLatency
+		if interval := plan.Config.Politeness.MinInterval(step.Endpoint); interval > latency {
+			latency = interval
+		}
+		if interval := plan.Config.IndexLimiter.Interval(); interval > latency {
+			latency = interval
+		}
+		plan.Duration += time.Duration(requests) * latency
+	}
+	plan.DurationFormatted = plan.Duration.String()
+}
+
+func (plan *Plan) String() string {
+	s := fmt.Sprintf("Plan for %v: %v steps, ~%v requests, ~%v records, ~%v bytes, ~%v\n",
+		plan.URL, len(plan.Steps), plan.Requests, plan.Records, plan.Bytes, plan.Duration.Round(time.Second))
+	for _, step := range plan.Steps {
+		index := ""
+		if step.Index != "" {
+			index = " " + step.Index
+		}
+		s += fmt.Sprintf("  %v%v: %v pages\n", step.SourceName, index, step.Pages)
+	}
+	return s
+}
+
+// HarvestPlan ... Executes plan steps, downloading all records found.
+// Resumed plan starts from the step of the resume token, steps before it are done.
+func (d *Downloader) HarvestPlan(plan *Plan) (*Stats, error) {
+	config := plan.Config
+	if config.Stats == nil {
+		config.Stats = NewStats()
+	}
+
+	steps := plan.Steps
+	if token := config.Resume; token != nil && config.CheckResume() == nil {
+		for i, step := range steps {
+			if step.SourceName == token.Source && step.Index == token.Index {
+				steps = steps[i:]
+				break
+			}
+		}
+	}
+
+	config.Emit(Event{Type: EventJobStarted})
+	for _, step := range steps {
+		var err error
+		if indexed, ok := step.Source.(IndexedSource); ok && step.Index != "" {
+			_, err = d.harvest(config, func(c RequestConfig) ([]*CdxResponse, error) {
+				return indexed.GetPagesIndex(c, step.Index)
+			})
+		} else {
+			_, err = d.harvest(config, step.Source.GetPages)
+		}
+
+		if err != nil {
+			config.EmitFinished(err)
+			return config.Stats, err
+		}
+	}
+	config.EmitFinished(nil)
+	return config.Stats, nil
+}
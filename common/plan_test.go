@@ -0,0 +1,101 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Source stub with fixed number of pages
+type planSource struct {
+	Source
+	pages int
+}
+
+func (s planSource) Name() string {
+	return "Stub"
+}
+
+func (s planSource) GetNumPages(url string) (int, error) {
+	return s.pages, nil
+}
+
+func TestNewPlan(t *testing.T) {
+	politeness, _ := NewPoliteness(map[string]PolitenessProfile{"example.com": {MaxRPS: 0.1}})
+	config := RequestConfig{URL: "example.com/*", Limit: 20000, Politeness: politeness}
+
+	plan, err := NewPlan([]Source{planSource{pages: 10}}, config)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Limit needs 2 pages of 15000 records, plus number of pages request
+	if plan.Requests != 3 || plan.Records != 20000 {
+		t.Fatalf("Incorrect estimate: requests=%v, records=%v", plan.Requests, plan.Records)
+	}
+	if plan.Duration != 3*estimatedLatency {
+		t.Fatalf("Incorrect duration: %v", plan.Duration)
+	}
+
+	plan.Steps[0].Endpoint = "https://example.com/cdx"
+	plan.estimate()
+	if plan.Duration != 30*time.Second {
+		t.Fatalf("Rate limit is not applied to duration: %v", plan.Duration)
+	}
+}
+
+// Source stub with two pages of two records in each index, resumed by page
+type checkpointSource struct {
+	Source
+}
+
+func (s checkpointSource) Name() string {
+	return "Stub"
+}
+
+func (s checkpointSource) GetPagesIndex(config RequestConfig, index string) ([]*CdxResponse, error) {
+	records := []*CdxResponse{}
+	for page := config.ResumePage(s.Name(), index); page < 2; page++ {
+		batch := []*CdxResponse{}
+		for i := 0; i < 2; i++ {
+			batch = append(batch, &CdxResponse{Original: fmt.Sprintf("http://example.com/%v/%v/%v", index, page, i), Timestamp: "20200101000000", Source: s})
+		}
+		SetResumeToken(batch, config.NextPageToken(s.Name(), index, page, false))
+		records = append(records, batch...)
+	}
+	config.AttachRecords(records)
+	return records, nil
+}
+
+func (s checkpointSource) GetFile(res *CdxResponse) ([]byte, error) {
+	return []byte(res.Original), nil
+}
+
+func TestHarvestPlanCheckpoint(t *testing.T) {
+	source := checkpointSource{}
+	plan := func(config RequestConfig) *Plan {
+		return &Plan{Config: config, Steps: []PlanStep{{Source: source, SourceName: "Stub", Index: "A"}, {Source: source, SourceName: "Stub", Index: "B"}}}
+	}
+
+	tokens := []*ResumeToken{}
+	d := &Downloader{OutputDir: t.TempDir(), Checkpoint: func(token *ResumeToken) { tokens = append(tokens, token) }}
+	if _, err := d.HarvestPlan(plan(RequestConfig{URL: "example.com/*"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 4 || tokens[1].Index != "A" || tokens[1].Page != 2 || tokens[2].Index != "B" || tokens[2].Page != 1 {
+		t.Fatalf("Each saved batch should be checkpointed: %+v", tokens)
+	}
+
+	// Resumed harvest skips indexes and pages before the checkpoint
+	stats, err := d.HarvestPlan(plan(RequestConfig{URL: "example.com/*", Resume: tokens[2]}))
+	if err != nil || stats.Summary().Records[RecordSaved] != 2 {
+		t.Fatalf("Only the last batch should be saved again: %v, %+v", err, stats.Summary().Records)
+	}
+
+	// Batches of sorted records are mixed
+	tokens = nil
+	d.HarvestPlan(plan(RequestConfig{URL: "example.com/*", Sort: SortDescending}))
+	if len(tokens) != 0 {
+		t.Fatalf("Sorted harvest should not be checkpointed: %+v", tokens)
+	}
+}
@@ -0,0 +1,205 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// PolitenessProfile describes access agreement with an archive endpoint
+type PolitenessProfile struct {
+	MaxRPS      float64 `json:"max_rps"`      // Max requests per second (0 - unlimited)
+	Concurrency int     `json:"concurrency"`  // Max simultaneous requests (0 - unlimited)
+	ActiveHours string  `json:"active_hours"` // Window when requests are allowed, like "22:00-06:00" (empty - always)
+	Timezone    string  `json:"timezone"`     // IANA timezone of active hours, UTC by default
+}
+
+// Politeness enforces profiles for endpoints, safe for concurrent use.
+// Nil politeness allows all requests right away.
+type Politeness struct {
+	endpoints map[string]*endpointLimiter
+}
+
+type endpointLimiter struct {
+	mu       sync.Mutex // Requests take window, slot and rate in turn
+	rate     *RateLimiter
+	slots    chan struct{}
+	from, to time.Duration // Active hours as offsets from midnight
+	location *time.Location
+	windowed bool
+}
+
+// NewPoliteness ... Creates politeness from profiles keyed by endpoint.
+// Endpoint is a host, optionally with path prefix, like "web.archive.org" or "web.archive.org/cdx".
+func NewPoliteness(profiles map[string]PolitenessProfile) (*Politeness, error) {
+	p := &Politeness{endpoints: map[string]*endpointLimiter{}}
+
+	for endpoint, profile := range profiles {
+		limiter, err := newEndpointLimiter(profile)
+		if err != nil {
+			return nil, fmt.Errorf("[NewPoliteness] Bad profile of '%v': %w", endpoint, err)
+		}
+		p.endpoints[strings.ToLower(strings.TrimSuffix(endpoint, "/"))] = limiter
+	}
+	return p, nil
+}
+
+// LoadPoliteness ... Reads politeness profiles from JSON file like:
+//
+//	{"web.archive.org": {"max_rps": 1, "concurrency": 2, "active_hours": "22:00-06:00", "timezone": "America/Los_Angeles"}}
+func LoadPoliteness(path string) (*Politeness, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadPoliteness] Cannot read file: %w", err)
+	}
+
+	profiles := map[string]PolitenessProfile{}
+	if err := jsoniter.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("[LoadPoliteness] Cannot decode profiles: %w", err)
+	}
+	return NewPoliteness(profiles)
+}
+
+func newEndpointLimiter(profile PolitenessProfile) (*endpointLimiter, error) {
+	limiter := &endpointLimiter{location: time.UTC}
+
+	limiter.rate = NewRateLimiter(profile.MaxRPS)
+	if profile.Concurrency > 0 {
+		limiter.slots = make(chan struct{}, profile.Concurrency)
+	}
+
+	if profile.Timezone != "" {
+		loc, err := time.LoadLocation(profile.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		limiter.location = loc
+	}
+
+	if profile.ActiveHours != "" {
+		bounds := strings.Split(profile.ActiveHours, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("active hours must look like 22:00-06:00, got '%v'", profile.ActiveHours)
+		}
+		var err error
+		if limiter.from, err = parseClock(bounds[0]); err != nil {
+			return nil, err
+		}
+		if limiter.to, err = parseClock(bounds[1]); err != nil {
+			return nil, err
+		}
+		limiter.windowed = true
+	}
+	return limiter, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time '%v': %w", s, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Finds profile of the longest endpoint matching URL
+func (p *Politeness) limiter(rawURL string) *endpointLimiter {
+	if p == nil || len(p.endpoints) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Host)
+	target := host + u.Path
+
+	var found *endpointLimiter
+	longest := -1
+	for endpoint, limiter := range p.endpoints {
+		matches := endpoint == host || endpoint == target || strings.HasPrefix(target, endpoint+"/")
+		if matches && len(endpoint) > longest {
+			found, longest = limiter, len(endpoint)
+		}
+	}
+	return found
+}
+
+// MinInterval ... Returns minimal interval between requests to URL endpoint, 0 if not limited
+func (p *Politeness) MinInterval(rawURL string) time.Duration {
+	limiter := p.limiter(rawURL)
+	if limiter == nil {
+		return 0
+	}
+	return limiter.rate.Interval()
+}
+
+// Acquire ... Blocks until request to URL is allowed by its endpoint profile.
+// Returned function must be called when request is finished.
+func (p *Politeness) Acquire(rawURL string) func() {
+	limiter := p.limiter(rawURL)
+	if limiter == nil {
+		return func() {}
+	}
+
+	// Waiters are let in one by one once the window opens, so they cannot exceed the rate together.
+	// Window may close while waiting for a slot, then the slot is given back until it opens again.
+	limiter.mu.Lock()
+	for {
+		limiter.waitWindow()
+		if limiter.slots != nil {
+			limiter.slots <- struct{}{}
+		}
+		if !limiter.windowed || limiter.untilWindow(time.Now()) == 0 {
+			break
+		}
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+	limiter.rate.Wait()
+	limiter.mu.Unlock()
+
+	return func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+}
+
+// Sleeps until active hours window opens
+func (l *endpointLimiter) waitWindow() {
+	if !l.windowed {
+		return
+	}
+	if wait := l.untilWindow(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (l *endpointLimiter) untilWindow(now time.Time) time.Duration {
+	local := now.In(l.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, l.location)
+	offset := local.Sub(midnight)
+
+	inWindow := false
+	if l.from <= l.to {
+		inWindow = offset >= l.from && offset < l.to
+	} else {
+		// Window passes midnight
+		inWindow = offset >= l.from || offset < l.to
+	}
+	if inWindow {
+		return 0
+	}
+
+	if offset < l.from {
+		return l.from - offset
+	}
+	return 24*time.Hour - offset + l.from
+}
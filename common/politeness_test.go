@@ -0,0 +1,86 @@
+package common
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolitenessEndpoints(t *testing.T) {
+	p, err := NewPoliteness(map[string]PolitenessProfile{
+		"web.archive.org":     {MaxRPS: 1},
+		"web.archive.org/cdx": {MaxRPS: 5},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cdx := p.limiter("https://web.archive.org/cdx/search/cdx?url=example.com")
+	storage := p.limiter("https://web.archive.org/web/2013id_/http://example.com/")
+	if cdx == nil || storage == nil || cdx == storage {
+		t.Fatalf("Endpoints are matched incorrectly")
+	}
+	if p.limiter("https://web.archive.org.example.com/") != nil {
+		t.Fatalf("Different host must not match")
+	}
+}
+
+func TestPolitenessRate(t *testing.T) {
+	p, _ := NewPoliteness(map[string]PolitenessProfile{"example.com": {MaxRPS: 20, Concurrency: 1}})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release := p.Acquire("http://example.com/")
+		release()
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Requests are not paced: %v", elapsed)
+	}
+}
+
+func TestPolitenessRateConcurrent(t *testing.T) {
+	p, _ := NewPoliteness(map[string]PolitenessProfile{"example.com": {MaxRPS: 20, Concurrency: 2}})
+
+	// Concurrent requests are let in one by one at the rate
+	var mu sync.Mutex
+	var grants []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := p.Acquire("http://example.com/")
+			mu.Lock()
+			grants = append(grants, time.Now())
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Before(grants[j]) })
+	for i := 1; i < len(grants); i++ {
+		if gap := grants[i].Sub(grants[i-1]); gap < 40*time.Millisecond {
+			t.Fatalf("Requests exceed the rate, granted %v apart", gap)
+		}
+	}
+}
+
+func TestPolitenessActiveHours(t *testing.T) {
+	limiter, err := newEndpointLimiter(PolitenessProfile{ActiveHours: "22:00-06:00"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	night := time.Date(2023, 1, 1, 23, 0, 0, 0, time.UTC)
+	if wait := limiter.untilWindow(night); wait != 0 {
+		t.Fatalf("Request must be allowed at night, wait=%v", wait)
+	}
+
+	noon := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	if wait := limiter.untilWindow(noon); wait != 10*time.Hour {
+		t.Fatalf("Incorrect wait until window: %v", wait)
+	}
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PreflightCheck is a result of single preflight check
+type PreflightCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// PreflightReport tells if the job can run, before committing hours to it. Safe for concurrent use.
+type PreflightReport struct {
+	mu     sync.Mutex
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// Check ... Runs the check and records its result, detail describes what was checked on success
+func (r *PreflightReport) Check(name string, check func() (detail string, err error)) bool {
+	start := time.Now()
+	detail, err := check()
+	result := PreflightCheck{Name: name, OK: err == nil, Detail: detail, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Checks = append(r.Checks, result)
+	return result.OK
+}
+
+// OK ... Tells if all checks passed
+func (r *PreflightReport) OK() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *PreflightReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := []string{}
+	for _, c := range r.Checks {
+		status, note := "ok", c.Detail
+		if !c.OK {
+			status, note = "FAILED", c.Error
+		}
+		lines = append(lines, fmt.Sprintf("  %-6v %v (%vms) %v", status, c.Name, c.DurationMs, note))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Preflight ... Checks that each source answers the query and serves a sample record of it: endpoints are reachable,
+// credentials of storage are accepted and records are decoded. Query runs with limit=1 on the first page, not reported to events.
+func Preflight(sources []Source, config RequestConfig) *PreflightReport {
+	config.Limit, config.SinglePage, config.Resume, config.Events = 1, true, nil, nil
+	report := &PreflightReport{}
+
+	for _, source := range sources {
+		var sample *CdxResponse
+		ok := report.Check("index "+source.Name(), func() (string, error) {
+			var err error
+			sample, err = sampleRecord(source, config)
+			if err != nil {
+				return "", err
+			}
+			if sample == nil {
+				return "no records to sample", nil
+			}
+			return fmt.Sprintf("found %v %v", sample.Original, sample.Timestamp), nil
+		})
+		if !ok || sample == nil {
+			continue
+		}
+
+		report.Check("download "+source.Name(), func() (string, error) {
+			data, err := source.GetFile(sample)
+			if err != nil {
+				return "", err
+			}
+			if len(data) == 0 {
+				return "", fmt.Errorf("Sample record is empty")
+			}
+			return fmt.Sprintf("%v bytes, digest %v", len(data), VerifyPayload(sample, data)), nil
+		})
+	}
+	return report
+}
+
+// Indexes of sources with several are tried until a record is found, like availability checks do
+func sampleRecord(source Source, config RequestConfig) (*CdxResponse, error) {
+	lister, isLister := source.(IndexLister)
+	indexed, isIndexed := source.(IndexedSource)
+	if !isLister || !isIndexed {
+		records, err := source.GetPages(config)
+		return firstCapture(records), err
+	}
+
+	indexes := lister.Indexes(config)
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("No indexes match the query")
+	}
+	var err error
+	for _, index := range indexes {
+		var records []*CdxResponse
+		if records, err = indexed.GetPagesIndex(config, index); firstCapture(records) != nil {
+			return firstCapture(records), nil
+		}
+	}
+	return nil, err
+}
+
+// Servers answer missing captures with message objects decoded as empty records
+func firstCapture(records []*CdxResponse) *CdxResponse {
+	for _, r := range records {
+		if r.Timestamp != "" {
+			return r
+		}
+	}
+	return nil
+}
+
+// CheckWritableDir ... Checks that files can be created in the directory, creating it if needed
+func CheckWritableDir(dir string) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	return dir + " is writable", os.Remove(file.Name())
+}
+
+// CheckStorage ... Checks that storage answers queries, like S3 bucket accepting credentials
+func CheckStorage(storage Storage) (string, error) {
+	if _, err := storage.Exists(".gogetcrawl-preflight"); err != nil {
+		return "", err
+	}
+	return "storage is reachable", nil
+}
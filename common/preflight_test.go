@@ -0,0 +1,70 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Availability stub serving fixed body of its records
+type preflightSource struct {
+	indexedAvailabilitySource
+	body []byte
+}
+
+func (s preflightSource) GetFile(res *CdxResponse) ([]byte, error) {
+	if s.body == nil {
+		return nil, errors.New("access denied")
+	}
+	return s.body, nil
+}
+
+func TestPreflight(t *testing.T) {
+	captures := map[string]map[string]string{"example.com": {"CC-2": "20200101000000"}}
+	ok := preflightSource{indexedAvailabilitySource{availabilitySource{name: "cc", captures: captures, indexes: []string{"CC-1", "CC-2"}}}, []byte("<html></html>")}
+	denied := preflightSource{indexedAvailabilitySource{availabilitySource{name: "wb", captures: captures, indexes: []string{"CC-2"}}}, nil}
+	broken := preflightSource{indexedAvailabilitySource{availabilitySource{name: "broken", indexes: []string{}}}, nil}
+
+	report := Preflight([]Source{ok, denied, broken}, RequestConfig{URL: "example.com", Limit: 100, FromDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if report.OK() {
+		t.Fatalf("Report should fail:\n%v", report)
+	}
+	results := map[string]PreflightCheck{}
+	for _, c := range report.Checks {
+		results[c.Name] = c
+	}
+	if c := results["index cc"]; !c.OK || !strings.Contains(c.Detail, "20200101000000") {
+		t.Fatalf("Record should be found in the second index: %+v", c)
+	}
+	if c := results["download cc"]; !c.OK {
+		t.Fatalf("Sample download should pass: %+v", c)
+	}
+	if c := results["download wb"]; c.OK || c.Error != "access denied" {
+		t.Fatalf("Sample download should fail: %+v", c)
+	}
+	if c, found := results["index broken"]; !found || c.OK {
+		t.Fatalf("Source without indexes should fail: %+v", c)
+	}
+	if _, found := results["download broken"]; found {
+		t.Fatalf("Download should be skipped when index check fails")
+	}
+}
+
+func TestCheckWritableDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	if _, err := CheckWritableDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("Probe file should be removed: %v", entries)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if _, err := CheckWritableDir(file); err == nil {
+		t.Fatalf("File should not pass as directory")
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachingProxy serves CDX queries from upstream index server, safe for concurrent use.
+// Identical queries in flight share single upstream request, successful responses are cached for TTL.
+type CachingProxy struct {
+	Upstream string         // Base URL of index server, request path and query are appended to it
+	TTL      time.Duration  // How long responses are kept, 0 to only share in-flight queries
+	Options  RequestOptions // Options of upstream requests
+
+	mu      sync.Mutex
+	entries map[string]*proxyEntry
+}
+
+// Upstream response shared by identical queries
+type proxyEntry struct {
+	done    chan struct{}
+	status  int
+	header  http.Header
+	body    []byte
+	err     error
+	expires time.Time
+}
+
+func NewCachingProxy(upstream string, ttl time.Duration, opts RequestOptions) *CachingProxy {
+	return &CachingProxy{
+		Upstream: strings.TrimSuffix(upstream, "/"),
+		TTL:      ttl,
+		Options:  opts,
+		entries:  map[string]*proxyEntry{},
+	}
+}
+
+// Builds cache key from path and query with sorted parameters, so their order does not matter.
+// Root path is the upstream URL itself.
+func proxyKey(path string, query url.Values) string {
+	return strings.TrimSuffix(path, "/") + "?" + query.Encode()
+}
+
+// Returns upstream response for the path and query, and whether it was served without new upstream request
+func (p *CachingProxy) get(path string, query url.Values) (*proxyEntry, bool) {
+	key := proxyKey(path, query)
+
+	p.mu.Lock()
+	entry, ok := p.entries[key]
+	if ok && entry.isExpired() {
+		ok = false
+	}
+	if !ok {
+		entry = &proxyEntry{done: make(chan struct{})}
+		p.entries[key] = entry
+	}
+	p.mu.Unlock()
+
+	if ok {
+		<-entry.done
+		return entry, true
+	}
+
+	entry.status, entry.header, entry.body, entry.err = p.fetch(p.Upstream + key)
+	entry.expires = time.Now().Add(p.TTL)
+	close(entry.done)
+
+	// Failed or uncached responses are not kept for later queries
+	if entry.err != nil || entry.status != http.StatusOK || p.TTL <= 0 {
+		p.mu.Lock()
+		if p.entries[key] == entry {
+			delete(p.entries, key)
+		}
+		p.mu.Unlock()
+	}
+	return entry, false
+}
+
+// Purge ... Drops expired responses, returns number of responses left
+func (p *CachingProxy) Purge() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, entry := range p.entries {
+		if entry.isExpired() {
+			delete(p.entries, key)
+		}
+	}
+	return len(p.entries)
+}
+
+func (e *proxyEntry) isExpired() bool {
+	select {
+	case <-e.done:
+		return time.Now().After(e.expires)
+	default:
+		// Still in flight
+		return false
+	}
+}
+
+func (p *CachingProxy) fetch(reqURL string) (int, http.Header, []byte, error) {
+	client := &http.Client{Timeout: time.Duration(p.Options.Timeout) * time.Second}
+
+	resp, event, err := doWithRetries(client, reqURL, p.Options)
+	// Upstream status is passed to clients, like 404 of missing captures
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(err.Error() + "\n"), nil
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	p.Options.Stats.AddPhaseRequest(p.Options.Phase, len(body))
+	event.Bytes, event.Duration, event.Err = len(body), time.Since(event.start), err
+	p.Options.emit(event)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("[CachingProxy] Cannot read upstream response: %w", err)
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// ServeHTTP ... Proxies GET queries to upstream, X-Cache header tells if response was shared (HIT) or fetched (MISS)
+func (p *CachingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET queries are proxied", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entry, hit := p.get(r.URL.Path, r.URL.Query())
+	if entry.err != nil {
+		log.Printf("[CachingProxy] Upstream error: %v", entry.err)
+		http.Error(w, entry.err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if ct := entry.header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachingProxyDeduplicates(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer upstream.Close()
+
+	proxy := httptest.NewServer(NewCachingProxy(upstream.URL, time.Minute, RequestOptions{Timeout: 5, MaxRetries: 1}))
+	defer proxy.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(proxy.URL + "/cdx?url=example.com&output=json")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Parameters order does not matter
+	resp, err := http.Get(proxy.URL + "/cdx?output=json&url=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected cached response, got X-Cache %q", resp.Header.Get("X-Cache"))
+	}
+
+	if calls != 1 {
+		t.Fatalf("Expected 1 upstream request, got %v", calls)
+	}
+}
+
+func TestCachingProxyExpires(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	proxy := NewCachingProxy(upstream.URL, 50*time.Millisecond, RequestOptions{Timeout: 5, MaxRetries: 1})
+	get := func() string {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cdx?url=example.com", nil))
+		return rec.Header().Get("X-Cache")
+	}
+
+	// Failed response is not cached, its status is passed
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cdx?url=example.com", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Upstream status should be passed, got %v", rec.Code)
+	}
+	if get() != "MISS" || get() != "HIT" {
+		t.Fatal("Unexpected cache state")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if proxy.Purge() != 0 {
+		t.Fatal("Expired response not purged")
+	}
+	if get() != "MISS" {
+		t.Fatal("Expired response served")
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 upstream requests, got %v", calls)
+	}
+}
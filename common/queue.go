@@ -0,0 +1,390 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// States of queued jobs
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobPaused   = "paused"
+	JobFailed   = "failed"
+	JobDone     = "done"
+	JobCanceled = "canceled"
+)
+
+var ErrJobCanceled = errors.New("job canceled")
+
+// JobGate lets running job be paused and canceled from outside, safe for concurrent use.
+// Nil gate never blocks.
+type JobGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	paused   bool
+	canceled bool
+	changed  chan struct{} // Closed on the next change of the gate
+}
+
+func NewJobGate() *JobGate {
+	g := &JobGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// Wait ... Blocks while the job is paused, returns ErrJobCanceled once it is canceled
+func (g *JobGate) Wait() error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.paused && !g.canceled {
+		g.cond.Wait()
+	}
+	if g.canceled {
+		return ErrJobCanceled
+	}
+	return nil
+}
+
+// Sleep ... Blocks for the duration, returns ErrJobCanceled as soon as the job is canceled.
+// Job paused meanwhile is blocked until it is resumed.
+func (g *JobGate) Sleep(d time.Duration) error {
+	if g == nil {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		g.mu.Lock()
+		canceled := g.canceled
+		if g.changed == nil {
+			g.changed = make(chan struct{})
+		}
+		changed := g.changed
+		g.mu.Unlock()
+		if canceled {
+			return ErrJobCanceled
+		}
+
+		select {
+		case <-timer.C:
+			return g.Wait()
+		case <-changed:
+		}
+	}
+}
+
+func (g *JobGate) Pause() {
+	g.set(func() { g.paused = true })
+}
+
+func (g *JobGate) Resume() {
+	g.set(func() { g.paused = false })
+}
+
+func (g *JobGate) Cancel() {
+	g.set(func() { g.canceled = true })
+}
+
+func (g *JobGate) Canceled() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.canceled
+}
+
+func (g *JobGate) set(change func()) {
+	g.mu.Lock()
+	change()
+	if g.changed != nil {
+		close(g.changed)
+		g.changed = nil
+	}
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// Job is a harvest managed by the queue
+type Job struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name,omitempty"` // Name of recurring harvest in JobStore, if the job is one of its runs
+	Query    ManifestQuery `json:"query"`
+	State    string        `json:"state"`
+	Error    string        `json:"error,omitempty"`
+	Created  time.Time     `json:"created"`
+	Started  time.Time     `json:"started,omitempty"`
+	Finished time.Time     `json:"finished,omitempty"`
+	Stats    *StatsSummary `json:"stats,omitempty"`
+	Resume   *ResumeToken  `json:"resume,omitempty"` // Position after the last saved batch, the job continues from it
+
+	gate       *JobGate
+	stats      *Stats
+	checkpoint func(*ResumeToken)
+}
+
+// Checkpoint ... Records position after the saved batch of the running job, see Downloader.Checkpoint.
+// Job interrupted by restart, or paused and resumed after it, continues from the position.
+func (j Job) Checkpoint(token *ResumeToken) {
+	if j.checkpoint != nil && token != nil {
+		j.checkpoint(token)
+	}
+}
+
+// JobRunner runs harvest of the job, config is made from the job query with job gate and stats set
+type JobRunner func(job Job, config RequestConfig) error
+
+// JobQueue runs jobs by several workers in order they were added, safe for concurrent use.
+// Jobs are persisted into JSON file, so they survive restarts: running ones are queued again
+// and continue from their last Checkpoint, with stats of the new run only.
+type JobQueue struct {
+	Path string // File jobs are persisted to, not persisted if empty
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	run    JobRunner
+	jobs   map[string]*Job
+	queued []string
+}
+
+// NewJobQueue ... Loads persisted jobs and starts workers running them
+func NewJobQueue(path string, workers int, run JobRunner) (*JobQueue, error) {
+	q := &JobQueue{Path: path, run: run, jobs: map[string]*Job{}}
+	q.cond = sync.NewCond(&q.mu)
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q, nil
+}
+
+func (q *JobQueue) load() error {
+	if q.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("[NewJobQueue] Cannot read jobs: %w", err)
+	}
+
+	jobs := []*Job{}
+	if err := jsoniter.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("[NewJobQueue] Cannot decode jobs: %w", err)
+	}
+	for _, job := range jobs {
+		// Interrupted jobs start over
+		if job.State == JobRunning {
+			job.State = JobQueued
+		}
+		if job.State == JobQueued {
+			q.queued = append(q.queued, job.ID)
+		}
+		q.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// Writes jobs into file, must be called with lock held
+func (q *JobQueue) save() {
+	if q.Path == "" {
+		return
+	}
+	data, err := jsoniter.MarshalIndent(q.list(), "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(q.Path, data)
+	}
+	if err != nil {
+		log.Printf("[JobQueue] Cannot persist jobs: %v", err)
+	}
+}
+
+// Add ... Queues harvest of the config from sources
+func (q *JobQueue) Add(config RequestConfig, sources []Source) Job {
+	return q.AddNamed("", config, sources)
+}
+
+// AddNamed ... Queues harvest as a run of the named job, see JobStore
+func (q *JobQueue) AddNamed(name string, config RequestConfig, sources []Source) Job {
+	if config.JobID == "" {
+		config.JobID = NewJobID()
+	}
+	job := &Job{ID: config.JobID, Name: name, Query: NewManifestQuery(config, sources), State: JobQueued, Created: time.Now().UTC()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[job.ID] = job
+	q.enqueue(job)
+	return q.snapshot(job)
+}
+
+func (q *JobQueue) enqueue(job *Job) {
+	job.State = JobQueued
+	q.queued = append(q.queued, job.ID)
+	q.save()
+	q.cond.Signal()
+}
+
+// Get ... Returns the job by ID
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return q.snapshot(job), true
+}
+
+// List ... Returns all jobs, oldest first
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.list()
+}
+
+func (q *JobQueue) list() []Job {
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, q.snapshot(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// Copy of the job with current stats of running jobs
+func (q *JobQueue) snapshot(job *Job) Job {
+	copied := *job
+	if job.stats != nil {
+		summary := job.stats.Summary()
+		copied.Stats = &summary
+	}
+	return copied
+}
+
+// Pause ... Pauses queued or running job, running one stops before its next request
+func (q *JobQueue) Pause(id string) error {
+	return q.change(id, func(job *Job) error {
+		if job.State != JobQueued && job.State != JobRunning {
+			return fmt.Errorf("[Pause] Cannot pause %v job", job.State)
+		}
+		if job.gate != nil {
+			job.gate.Pause()
+		}
+		job.State = JobPaused
+		return nil
+	})
+}
+
+// Resume ... Continues paused job. The one paused before it started, or before restart, is queued again
+// and continues from its last Checkpoint, from the start if runner records none.
+func (q *JobQueue) Resume(id string) error {
+	return q.change(id, func(job *Job) error {
+		if job.State != JobPaused {
+			return fmt.Errorf("[Resume] Cannot resume %v job", job.State)
+		}
+		if job.gate == nil {
+			q.enqueue(job)
+			return nil
+		}
+		job.gate.Resume()
+		job.State = JobRunning
+		return nil
+	})
+}
+
+// Cancel ... Cancels job which is not finished, running one stops before its next request
+func (q *JobQueue) Cancel(id string) error {
+	return q.change(id, func(job *Job) error {
+		switch job.State {
+		case JobDone, JobFailed, JobCanceled:
+			return fmt.Errorf("[Cancel] Cannot cancel %v job", job.State)
+		}
+		if job.gate != nil {
+			// The worker marks job as canceled when its harvest returns
+			job.gate.Cancel()
+			return nil
+		}
+		job.State, job.Finished = JobCanceled, time.Now().UTC()
+		return nil
+	})
+}
+
+func (q *JobQueue) change(id string, fn func(job *Job) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("[JobQueue] No job '%v'", id)
+	}
+	if err := fn(job); err != nil {
+		return err
+	}
+	q.save()
+	return nil
+}
+
+func (q *JobQueue) setCheckpoint(job *Job, token *ResumeToken) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.Resume = token
+	q.save()
+}
+
+func (q *JobQueue) worker() {
+	for {
+		q.mu.Lock()
+		for len(q.queued) == 0 {
+			q.cond.Wait()
+		}
+		job := q.jobs[q.queued[0]]
+		q.queued = q.queued[1:]
+
+		// Job was paused or canceled while queued
+		if job.State != JobQueued {
+			q.mu.Unlock()
+			continue
+		}
+		job.State, job.Started, job.Error = JobRunning, time.Now().UTC(), ""
+		job.gate, job.stats = NewJobGate(), NewStats()
+		q.save()
+
+		config := job.Query.Config()
+		config.Gate, config.Stats, config.Resume = job.gate, job.stats, job.Resume
+		snapshot := *job
+		snapshot.checkpoint = func(token *ResumeToken) { q.setCheckpoint(job, token) }
+		q.mu.Unlock()
+
+		err := q.run(snapshot, config)
+
+		q.mu.Lock()
+		job.Finished = time.Now().UTC()
+		summary := job.stats.Summary()
+		job.Stats = &summary
+		switch {
+		case job.gate.Canceled():
+			job.State = JobCanceled
+		case err != nil:
+			job.State, job.Error = JobFailed, err.Error()
+		default:
+			job.State = JobDone
+		}
+		job.gate, job.stats = nil, nil
+		q.save()
+		q.mu.Unlock()
+	}
+}
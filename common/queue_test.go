@@ -0,0 +1,196 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Waits until the job gets the state
+func waitState(t *testing.T, q *JobQueue, id, state string) Job {
+	for i := 0; i < 200; i++ {
+		if job, _ := q.Get(id); job.State == state {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := q.Get(id)
+	t.Fatalf("Job is %v, expected %v", job.State, state)
+	return job
+}
+
+func TestJobGate(t *testing.T) {
+	var gate *JobGate
+	if gate.Wait() != nil {
+		t.Fatal("Nil gate should not block")
+	}
+
+	gate = NewJobGate()
+	gate.Pause()
+	done := make(chan error)
+	go func() { done <- gate.Wait() }()
+
+	select {
+	case <-done:
+		t.Fatal("Paused gate should block")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	gate.Cancel()
+	if err := <-done; err != ErrJobCanceled {
+		t.Fatalf("Expected cancel, got %v", err)
+	}
+}
+
+func TestJobGateSleep(t *testing.T) {
+	gate := NewJobGate()
+	gate.Pause()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		gate.Resume()
+	}()
+
+	// Paused job is blocked until resumed, even if the duration is over
+	start := time.Now()
+	if err := gate.Sleep(10 * time.Millisecond); err != nil || time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("Sleep should last until resume: %v, %v", time.Since(start), err)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	release := make(chan struct{})
+	run := func(job Job, config RequestConfig) error {
+		for {
+			if err := config.Gate.Wait(); err != nil {
+				return err
+			}
+			select {
+			case <-release:
+				config.Stats.AddRecords(RecordSaved, 1)
+				return nil
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewJobQueue(path, 1, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := q.Add(RequestConfig{URL: "example.com/*"}, nil)
+	second := q.Add(RequestConfig{URL: "example.org/*"}, nil)
+	waitState(t, q, first.ID, JobRunning)
+
+	// Queued job is canceled without running
+	if err := q.Cancel(second.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Pause(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Resume(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	job := waitState(t, q, first.ID, JobDone)
+	if job.Stats == nil || job.Stats.Records[RecordSaved] != 1 {
+		t.Fatalf("Job stats are not recorded: %+v", job.Stats)
+	}
+	if q.Pause(first.ID) == nil {
+		t.Fatal("Finished job should not be paused")
+	}
+
+	// Jobs are persisted
+	loaded, err := NewJobQueue(path, 0, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := loaded.List()
+	if len(jobs) != 2 || jobs[0].State != JobDone || jobs[1].State != JobCanceled || jobs[1].Query.URL != "example.org/*" {
+		t.Fatalf("Unexpected persisted jobs: %+v", jobs)
+	}
+}
+
+func TestJobQueueNamed(t *testing.T) {
+	run := func(job Job, config RequestConfig) error { return nil }
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewJobQueue(path, 1, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := q.AddNamed("weekly", RequestConfig{URL: "example.org/*"}, nil)
+	waitState(t, q, job.ID, JobDone)
+
+	// Name of the job is persisted
+	loaded, err := NewJobQueue(path, 0, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := loaded.List()
+	if len(jobs) != 1 || jobs[0].Name != "weekly" || jobs[0].Query.URL != "example.org/*" {
+		t.Fatalf("Unexpected persisted jobs: %+v", jobs)
+	}
+}
+
+func TestJobQueueCancelRunning(t *testing.T) {
+	run := func(job Job, config RequestConfig) error {
+		for {
+			if err := config.Gate.Wait(); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	q, _ := NewJobQueue("", 1, run)
+	job := q.Add(RequestConfig{URL: "example.com/*"}, nil)
+	waitState(t, q, job.ID, JobRunning)
+	q.Pause(job.ID)
+
+	if err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, job.ID, JobCanceled)
+}
+
+func TestJobQueueCheckpoint(t *testing.T) {
+	token := &ResumeToken{Source: "Wayback", URL: "example.com/*", Page: 3}
+	checkpointed := make(chan struct{})
+	run := func(job Job, config RequestConfig) error {
+		job.Checkpoint(token)
+		close(checkpointed)
+		for {
+			if err := config.Gate.Wait(); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, _ := NewJobQueue(path, 1, run)
+	job := q.Add(RequestConfig{URL: "example.com/*"}, nil)
+	<-checkpointed
+
+	// Job interrupted by restart continues from its checkpoint
+	var resumed *ResumeToken
+	restarted, err := NewJobQueue(path, 1, func(job Job, config RequestConfig) error {
+		resumed = config.Resume
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, restarted, job.ID, JobDone)
+	if resumed == nil || *resumed != *token {
+		t.Fatalf("Restarted job should continue from checkpoint: %+v", resumed)
+	}
+
+	q.Cancel(job.ID)
+	waitState(t, q, job.ID, JobCanceled)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package common
+
+import "fmt"
+
+func reflink(src, dst string) error {
+	return fmt.Errorf("reflinks are supported only on Linux")
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ResumeToken marks where the query of the source should continue from.
+// Fields are interpreted only by the source which made the token, so it can be stored and passed around as opaque string.
+type ResumeToken struct {
+	Source string `json:"source"`
+	URL    string `json:"url,omitempty"`    // URL of the query, token continues only it
+	Index  string `json:"index,omitempty"`  // Index of sources with multiple ones, like CommonCrawl crawl ID
+	Page   int    `json:"page,omitempty"`   // Next page of the index server, both CommonCrawl and Wayback are paged
+	Shard  string `json:"shard,omitempty"`  // Bulk index shard
+	Offset int64  `json:"offset,omitempty"` // Offset of the next block in the bulk index shard
+}
+
+// String ... Encodes token into opaque URL-safe string
+func (t *ResumeToken) String() string {
+	data, _ := jsoniter.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseResumeToken ... Decodes token made by ResumeToken.String
+func ParseResumeToken(s string) (*ResumeToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("[ParseResumeToken] Bad token encoding: %w", err)
+	}
+
+	token := &ResumeToken{}
+	if err := jsoniter.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("[ParseResumeToken] Bad token: %w", err)
+	}
+	if token.Source == "" {
+		return nil, fmt.Errorf("[ParseResumeToken] Token has no source")
+	}
+	return token, nil
+}
+
+// CheckResume ... Fails if resume token of the config was made by query of other URL
+func (config *RequestConfig) CheckResume() error {
+	if config.Resume != nil && config.Resume.URL != "" && config.Resume.URL != config.URL {
+		return fmt.Errorf("[CheckResume] Token continues query of '%v', not '%v'", config.Resume.URL, config.URL)
+	}
+	return nil
+}
+
+// ResumeFor ... Returns resume token of the config if it was made by the source for the query URL, nil otherwise
+func (config *RequestConfig) ResumeFor(source string) *ResumeToken {
+	if config.Resume == nil || config.Resume.Source != source || config.CheckResume() != nil {
+		return nil
+	}
+	return config.Resume
+}
+
+// ResumePage ... Returns page of the source index to start from, 0 if query is not resumed there
+func (config *RequestConfig) ResumePage(source, index string) int {
+	token := config.ResumeFor(source)
+	if token == nil || token.Index != index {
+		return 0
+	}
+	return token.Page
+}
+
+// NextPageToken ... Returns token to continue the query after the page of the index.
+// If decoding stopped at the limit, the page may have more records, so it is repeated.
+func (config *RequestConfig) NextPageToken(source, index string, page int, stopped bool) *ResumeToken {
+	if !stopped {
+		page++
+	}
+	return &ResumeToken{Source: source, URL: config.URL, Index: index, Page: page}
+}
+
+// SetResumeToken ... Binds token of the position after the batch to its records
+func SetResumeToken(records []*CdxResponse, token *ResumeToken) {
+	for _, r := range records {
+		r.Resume = token
+	}
+}
+
+// BatchResumeToken ... Returns token to continue query after the batch, nil if it has none
+func BatchResumeToken(records []*CdxResponse) *ResumeToken {
+	if len(records) == 0 {
+		return nil
+	}
+	return records[len(records)-1].Resume
+}
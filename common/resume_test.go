@@ -0,0 +1,72 @@
+package common
+
+import "testing"
+
+func TestResumeTokenRoundTrip(t *testing.T) {
+	token := &ResumeToken{Source: "CommonCrawl", URL: "example.com/*", Index: "CC-MAIN-2023-06", Page: 3}
+
+	parsed, err := ParseResumeToken(token.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *token {
+		t.Fatalf("Got %+v, want %+v", parsed, token)
+	}
+}
+
+func TestParseResumeTokenInvalid(t *testing.T) {
+	for _, s := range []string{"", "not base64!", "e30"} {
+		if _, err := ParseResumeToken(s); err == nil {
+			t.Fatalf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestResumePage(t *testing.T) {
+	config := RequestConfig{Resume: &ResumeToken{Source: "CommonCrawl", Index: "CC-MAIN-2023-06", Page: 3}}
+
+	if page := config.ResumePage("CommonCrawl", "CC-MAIN-2023-06"); page != 3 {
+		t.Fatalf("Expected page 3, got %v", page)
+	}
+	if page := config.ResumePage("CommonCrawl", "CC-MAIN-2023-14"); page != 0 {
+		t.Fatalf("Other index should start from 0, got %v", page)
+	}
+	if page := config.ResumePage("Wayback", ""); page != 0 {
+		t.Fatalf("Other source should start from 0, got %v", page)
+	}
+}
+
+func TestResumeURL(t *testing.T) {
+	config := RequestConfig{URL: "example.com/*"}
+	token := config.NextPageToken("Wayback", "", 2, false)
+	if token.URL != "example.com/*" || token.Page != 3 {
+		t.Fatalf("Unexpected token: %+v", token)
+	}
+
+	config.Resume = token
+	if err := config.CheckResume(); err != nil || config.ResumePage("Wayback", "") != 3 {
+		t.Fatalf("Token should continue its query: %v", err)
+	}
+
+	// Query of other URL does not skip pages it never fetched
+	other := RequestConfig{URL: "other.com/*", Resume: token}
+	if err := other.CheckResume(); err == nil {
+		t.Fatalf("Token of other URL should be rejected")
+	}
+	if other.ResumeFor("Wayback") != nil || other.ResumePage("Wayback", "") != 0 {
+		t.Fatalf("Query of other URL should start over")
+	}
+}
+
+func TestBatchResumeToken(t *testing.T) {
+	if BatchResumeToken(nil) != nil {
+		t.Fatal("Empty batch should have no token")
+	}
+
+	records := []*CdxResponse{{}, {}}
+	token := &ResumeToken{Source: "Wayback", Page: 2}
+	SetResumeToken(records, token)
+	if BatchResumeToken(records) != token {
+		t.Fatal("Batch token not returned")
+	}
+}
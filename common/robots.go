@@ -0,0 +1,78 @@
+package common
+
+import (
+	"strings"
+)
+
+// Directives which take a value after colon, so colon does not start user agent prefix there
+var robotsValueDirectives = map[string]bool{
+	"unavailable_after": true, "max-snippet": true, "max-image-preview": true, "max-video-preview": true,
+}
+
+// RobotsDirectives are indexing and archiving directives page had when it was captured.
+// Directives for specific crawler are prefixed with its name, like "googlebot: nosnippet".
+type RobotsDirectives struct {
+	Meta   []string `json:"meta,omitempty"`   // From robots meta tags
+	Header []string `json:"header,omitempty"` // From X-Robots-Tag headers
+}
+
+// ParseRobotsDirectives ... Splits robots meta content or X-Robots-Tag values into lowercased directives.
+// Crawler name given as prefix, like "googlebot: noindex, nofollow", applies to the rest of the value.
+func ParseRobotsDirectives(agent string, values ...string) []string {
+	agent = strings.ToLower(strings.TrimSpace(agent))
+	directives := []string{}
+
+	for _, value := range values {
+		prefix := agent
+		for _, part := range strings.Split(value, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if name, rest, found := strings.Cut(part, ":"); found && !robotsValueDirectives[strings.TrimSpace(name)] {
+				prefix, part = strings.TrimSpace(name), strings.TrimSpace(rest)
+			}
+			if part == "" {
+				continue
+			}
+			if prefix != "" && prefix != "robots" {
+				part = prefix + ": " + part
+			}
+			directives = append(directives, part)
+		}
+	}
+	return directives
+}
+
+// Has ... Tells if directive is given for all crawlers by meta tag or header. "none" means noindex and nofollow.
+func (r *RobotsDirectives) Has(directive string) bool {
+	if r == nil {
+		return false
+	}
+	directive = strings.ToLower(directive)
+	for _, list := range [][]string{r.Meta, r.Header} {
+		for _, d := range list {
+			if d == directive || d == "none" && (directive == "noindex" || directive == "nofollow") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// All ... Returns unique directives of meta tags and headers
+func (r *RobotsDirectives) All() []string {
+	if r == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	all := []string{}
+	for _, d := range append(append([]string{}, r.Meta...), r.Header...) {
+		if !seen[d] {
+			seen[d] = true
+			all = append(all, d)
+		}
+	}
+	return all
+}
+
+func (r *RobotsDirectives) String() string {
+	return strings.Join(r.All(), ", ")
+}
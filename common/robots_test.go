@@ -0,0 +1,33 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRobotsDirectives(t *testing.T) {
+	got := ParseRobotsDirectives("", "NoIndex, nofollow", "googlebot: noarchive, nosnippet", "unavailable_after: 2010-06-25, max-snippet: 20")
+	want := []string{"noindex", "nofollow", "googlebot: noarchive", "googlebot: nosnippet", "unavailable_after: 2010-06-25", "max-snippet: 20"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected directives: %q", got)
+	}
+
+	if got := ParseRobotsDirectives("Bingbot", "noindex"); !reflect.DeepEqual(got, []string{"bingbot: noindex"}) {
+		t.Fatalf("Unexpected directives of crawler: %q", got)
+	}
+}
+
+func TestRobotsDirectives(t *testing.T) {
+	robots := &RobotsDirectives{Meta: []string{"none", "googlebot: noarchive"}, Header: []string{"noarchive", "none"}}
+	if !robots.Has("noindex") || !robots.Has("NOARCHIVE") || robots.Has("nosnippet") {
+		t.Fatalf("Unexpected directives check")
+	}
+	if robots.String() != "none, googlebot: noarchive, noarchive" {
+		t.Fatalf("Unexpected directives: %v", robots)
+	}
+
+	var empty *RobotsDirectives
+	if empty.Has("noindex") || empty.String() != "" {
+		t.Fatalf("Nil directives should be empty")
+	}
+}
@@ -0,0 +1,290 @@
+package common
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Config configures access to AWS S3 or compatible store, like MinIO
+type S3Config struct {
+	Region        string         // "us-east-1" if empty
+	Endpoint      string         // Custom endpoint of compatible store, like "https://minio.local:9000", AWS if empty
+	PathStyle     bool           // Address buckets by path instead of host, always used with custom endpoint
+	Credentials   AWSCredentials // Requests are not signed if empty
+	RoleARN       string         // IAM role assumed with Credentials, requests are signed with its credentials (optional)
+	ExternalID    string         // External ID of the role (optional)
+	RequesterPays bool           // Accept charges of requester-pays buckets
+	StrictTLS     bool           // Require HTTPS endpoints and TLS 1.2 or later
+	CAFile        string         // PEM bundle of CAs to trust instead of system ones, for on-prem stores (optional)
+	Timeout       int            // Request timeout in seconds, 60 if 0
+	MaxRetries    int            // Attempts of each request, 3 if 0
+}
+
+// S3Client makes signed requests to S3 compatible store, safe for concurrent use
+type S3Client struct {
+	Config S3Config
+
+	client *http.Client
+	role   *RoleProvider
+}
+
+// NewS3Client ... Validates config and prepares HTTP client with its TLS settings
+func NewS3Client(config S3Config) (*S3Client, error) {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 3
+	}
+	if config.Endpoint != "" {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("[NewS3Client] Bad endpoint '%v'", config.Endpoint)
+		}
+		if config.StrictTLS && u.Scheme != "https" {
+			return nil, fmt.Errorf("[NewS3Client] Strict TLS requires HTTPS endpoint, got '%v'", config.Endpoint)
+		}
+		config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.StrictTLS {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("[NewS3Client] Cannot read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("[NewS3Client] No certificates in CA file '%v'", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	c := &S3Client{Config: config, client: &http.Client{Transport: transport, Timeout: time.Duration(config.Timeout) * time.Second}}
+	if config.StrictTLS {
+		// Redirects could leave HTTPS otherwise
+		c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("[S3Client] Redirect to '%v' is not HTTPS", req.URL)
+			}
+			return nil
+		}
+	}
+	if config.RoleARN != "" {
+		if config.Credentials.AccessKey == "" {
+			return nil, fmt.Errorf("[NewS3Client] Assuming role needs base credentials")
+		}
+		c.role = &RoleProvider{Base: config.Credentials, RoleARN: config.RoleARN, ExternalID: config.ExternalID, Region: config.Region, Client: c.client}
+		if config.Endpoint != "" {
+			c.role.Endpoint = config.Endpoint + "/"
+		}
+	}
+	return c, nil
+}
+
+// ObjectURL ... Returns URL of the object, bucket is addressed by host on AWS and by path elsewhere
+func (c *S3Client) ObjectURL(bucket, key string) string {
+	key = sigV4Escape(strings.TrimPrefix(key, "/"), true)
+	if c.Config.Endpoint != "" {
+		return fmt.Sprintf("%v/%v/%v", c.Config.Endpoint, bucket, key)
+	}
+	if c.Config.PathStyle || strings.Contains(bucket, ".") {
+		return fmt.Sprintf("https://s3.%v.amazonaws.com/%v/%v", c.Config.Region, bucket, key)
+	}
+	return fmt.Sprintf("https://%v.s3.%v.amazonaws.com/%v", bucket, c.Config.Region, key)
+}
+
+func (c *S3Client) credentials() (AWSCredentials, error) {
+	if c.role != nil {
+		return c.role.Credentials()
+	}
+	return c.Config.Credentials, nil
+}
+
+// Makes signed request with retries of network errors and 5xx responses, accounted like other requests of opts
+func (c *S3Client) do(method, rawURL string, body []byte, headers map[string]string, opts RequestOptions) (*http.Response, []byte, error) {
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		payloadHash = hashHex(body)
+	}
+
+	var lastErr error
+	for i := 0; i < c.Config.MaxRetries; i++ {
+		if err := opts.Gate.Wait(); err != nil {
+			return nil, nil, fmt.Errorf("[S3Client] %w", err)
+		}
+		if i > 0 {
+			opts.Stats.AddRetry()
+			time.Sleep(time.Second * time.Duration(i))
+		}
+
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("[S3Client] Cannot create request: %w", err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if c.Config.RequesterPays {
+			req.Header.Set("X-Amz-Request-Payer", "requester")
+		}
+		creds, err := c.credentials()
+		if err != nil {
+			return nil, nil, err
+		}
+		if creds.AccessKey != "" {
+			SignV4(req, creds, c.Config.Region, "s3", payloadHash, time.Now())
+		}
+
+		log.Printf("%v%v [t=%v]: %v", opts.logPrefix(), method, c.Config.Timeout, rawURL)
+		release, err := opts.acquire(rawURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[S3Client] %w", err)
+		}
+		start := time.Now()
+		resp, err := c.client.Do(req)
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		release()
+
+		event := RequestEvent{URL: rawURL, Attempt: i + 1, Bytes: len(data), Duration: time.Since(start), Err: err}
+		if resp != nil {
+			event.Status = resp.StatusCode
+		}
+		opts.Stats.AddPhaseRequest(opts.Phase, len(data))
+		opts.emit(event)
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if isThrottled(resp.StatusCode) {
+			opts.Cooldowns.Throttled(rawURL, resp.Header)
+		}
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("got %v status: %s", resp.StatusCode, data)
+			continue
+		}
+		return resp, data, nil
+	}
+	return nil, nil, fmt.Errorf("[S3Client] %v %v failed after %v attempts: %w", method, rawURL, c.Config.MaxRetries, lastErr)
+}
+
+func s3StatusError(resp *http.Response, data []byte) error {
+	return fmt.Errorf("[S3Client] Got %v status: %s", resp.StatusCode, bytes.TrimSpace(data))
+}
+
+// GetRange ... Downloads length bytes of the object starting from offset
+func (c *S3Client) GetRange(bucket, key string, offset, length int64, opts RequestOptions) ([]byte, error) {
+	headers := map[string]string{"Range": fmt.Sprintf("bytes=%v-%v", offset, offset+length-1)}
+	resp, data, err := c.do(http.MethodGet, c.ObjectURL(bucket, key), nil, headers, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, s3StatusError(resp, data)
+	}
+	return data, nil
+}
+
+// PutObject ... Uploads object with single request, so readers never see it partially written.
+// Metadata is stored as x-amz-meta-* headers.
+func (c *S3Client) PutObject(bucket, key string, data []byte, metadata map[string]string, opts RequestOptions) error {
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	for k, v := range metadata {
+		headers["X-Amz-Meta-"+k] = v
+	}
+	resp, body, err := c.do(http.MethodPut, c.ObjectURL(bucket, key), data, headers, opts)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3StatusError(resp, body)
+	}
+	return nil
+}
+
+// HeadObject ... Returns size, modification time and metadata of the object, os.ErrNotExist if there is none
+func (c *S3Client) HeadObject(bucket, key string, opts RequestOptions) (*StorageInfo, error) {
+	resp, data, err := c.do(http.MethodHead, c.ObjectURL(bucket, key), nil, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3StatusError(resp, data)
+	}
+
+	info := &StorageInfo{Metadata: map[string]string{}}
+	info.Size = resp.ContentLength
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	for name, values := range resp.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") && len(values) > 0 {
+			info.Metadata[strings.ToLower(strings.TrimPrefix(strings.ToLower(name), "x-amz-meta-"))] = values[0]
+		}
+	}
+	return info, nil
+}
+
+// S3Storage stores files as objects under prefix of the bucket, with record metadata as object metadata
+type S3Storage struct {
+	Client *S3Client
+	Bucket string
+	Prefix string // Key prefix, like "harvests/2023/"
+}
+
+// NewS3Storage ... Creates storage of s3://bucket/prefix location
+func NewS3Storage(client *S3Client, location string) (*S3Storage, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("[NewS3Storage] Location should look like s3://bucket/prefix, got '%v'", location)
+	}
+	return &S3Storage{Client: client, Bucket: u.Host, Prefix: strings.TrimPrefix(u.Path, "/")}, nil
+}
+
+func (s *S3Storage) key(p string) string {
+	return path.Join(s.Prefix, p)
+}
+
+func (s *S3Storage) Put(p string, r io.Reader, metadata map[string]string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("[S3Storage] Cannot read file: %w", err)
+	}
+	return s.Client.PutObject(s.Bucket, s.key(p), data, metadata, RequestOptions{})
+}
+
+func (s *S3Storage) Exists(p string) (bool, error) {
+	_, err := s.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *S3Storage) Stat(p string) (*StorageInfo, error) {
+	return s.Client.HeadObject(s.Bucket, s.key(p), RequestOptions{})
+}
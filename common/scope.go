@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// HostRule matches host of the record URL: exact host ("example.com"), host with its subdomains ("*.example.com"
+// or ".example.com") or regular expression of the whole host ("~^cdn[0-9]*\.").
+type HostRule struct {
+	exact  string
+	suffix string
+	regex  *regexp.Regexp
+}
+
+// ParseHostRule ... Parses host rule, hosts are case insensitive
+func ParseHostRule(rule string) (*HostRule, error) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return nil, fmt.Errorf("[ParseHostRule] Empty rule")
+	}
+
+	if strings.HasPrefix(rule, "~") {
+		regex, err := regexp.Compile("(?i)" + rule[1:])
+		if err != nil {
+			return nil, fmt.Errorf("[ParseHostRule] Bad regexp '%v': %w", rule[1:], err)
+		}
+		return &HostRule{regex: regex}, nil
+	}
+
+	rule = strings.ToLower(rule)
+	if strings.HasPrefix(rule, "*.") || strings.HasPrefix(rule, ".") {
+		return &HostRule{suffix: strings.TrimPrefix(rule, "*.")}, nil
+	}
+	return &HostRule{exact: rule}, nil
+}
+
+// Match ... Checks if host matches the rule, suffix rule matches the domain itself too
+func (r *HostRule) Match(host string) bool {
+	host = strings.ToLower(host)
+	switch {
+	case r.regex != nil:
+		return r.regex.MatchString(host)
+	case r.suffix != "":
+		suffix := strings.TrimPrefix(r.suffix, ".")
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	default:
+		return host == r.exact
+	}
+}
+
+// HostScope limits records to allowed hosts which are not denied. Nil scope allows everything.
+type HostScope struct {
+	Allow []*HostRule // If set, only hosts matching any of the rules are allowed
+	Deny  []*HostRule // Hosts matching any of the rules are excluded, even if allowed
+}
+
+// NewHostScope ... Parses allow and deny rules, nil is returned if there are none
+func NewHostScope(allow, deny []string) (*HostScope, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	scope := &HostScope{}
+	for _, list := range []struct {
+		rules  []string
+		parsed *[]*HostRule
+	}{{allow, &scope.Allow}, {deny, &scope.Deny}} {
+		for _, rule := range list.rules {
+			parsed, err := ParseHostRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("[NewHostScope] %w", err)
+			}
+			*list.parsed = append(*list.parsed, parsed)
+		}
+	}
+	return scope, nil
+}
+
+// LoadHostRules ... Reads host rules from file, one per line. Empty lines and lines starting with # are skipped.
+func LoadHostRules(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadHostRules] Cannot open file: %w", err)
+	}
+	defer file.Close()
+
+	rules := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("[LoadHostRules] Cannot read file: %w", err)
+	}
+	return rules, nil
+}
+
+// Allowed ... Checks if host of the record URL is in scope, records with unparsable URLs are not
+func (s *HostScope) Allowed(res *CdxResponse) bool {
+	if s == nil {
+		return true
+	}
+
+	host, ok := recordHost(res.Original)
+	if !ok {
+		return false
+	}
+
+	for _, rule := range s.Deny {
+		if rule.Match(host) {
+			return false
+		}
+	}
+	if len(s.Allow) == 0 {
+		return true
+	}
+	for _, rule := range s.Allow {
+		if rule.Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter ... Returns records which are in scope, counting the rest into stats
+func (s *HostScope) Filter(records []*CdxResponse, stats *Stats) []*CdxResponse {
+	if s == nil {
+		return records
+	}
+
+	allowed := make([]*CdxResponse, 0, len(records))
+	for _, res := range records {
+		if s.Allowed(res) {
+			allowed = append(allowed, res)
+		}
+	}
+	stats.AddRecords(RecordOutOfScope, len(records)-len(allowed))
+	return allowed
+}
+
+// Archived URLs often miss scheme, like "example.com:80/path"
+func recordHost(rawURL string) (string, bool) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	return strings.TrimSuffix(u.Hostname(), "."), true
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostScope(t *testing.T) {
+	scope, err := NewHostScope([]string{"*.example.com", "partner.org"}, []string{"~^cdn[0-9]*\\.", "tracker.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"http://example.com/":              true,
+		"https://www.Example.com/a":        true,
+		"example.com:80/path":              true,
+		"http://tracker.example.com/p.gif": false,
+		"http://cdn2.example.com/app.js":   false,
+		"http://partner.org/":              true,
+		"http://sub.partner.org/":          false,
+		"http://notexample.com/":           false,
+		"":                                 false,
+	}
+	for u, want := range cases {
+		if got := scope.Allowed(&CdxResponse{Original: u}); got != want {
+			t.Errorf("%q: got %v, want %v", u, got, want)
+		}
+	}
+}
+
+func TestHostScopeFilter(t *testing.T) {
+	scope, _ := NewHostScope(nil, []string{".doubleclick.net"})
+	stats := NewStats()
+
+	records := []*CdxResponse{{Original: "http://example.com/"}, {Original: "http://ad.doubleclick.net/x"}}
+	if got := scope.Filter(records, stats); len(got) != 1 || got[0].Original != "http://example.com/" {
+		t.Fatalf("Unexpected records: %v", got)
+	}
+	if stats.Summary().Records[RecordOutOfScope] != 1 {
+		t.Fatal("Out of scope record is not counted")
+	}
+
+	var nilScope *HostScope
+	if len(nilScope.Filter(records, nil)) != 2 {
+		t.Fatal("Nil scope should allow everything")
+	}
+}
+
+func TestLoadHostRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scope.txt")
+	os.WriteFile(path, []byte("# authorized scope\nexample.com\n\n*.example.org\n"), 0o644)
+
+	rules, err := LoadHostRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[1] != "*.example.org" {
+		t.Fatalf("Unexpected rules: %v", rules)
+	}
+}
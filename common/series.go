@@ -0,0 +1,133 @@
+package common
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Periods of capture count series
+const (
+	SeriesDay   = "day"
+	SeriesMonth = "month"
+	SeriesYear  = "year"
+)
+
+// SeriesPoint is number of captures made in the period
+type SeriesPoint struct {
+	Period string    `json:"period"` // Like "2023-04-01", "2023-04" or "2023"
+	Start  time.Time `json:"start"`  // Start of the period in UTC
+	Count  int       `json:"count"`
+}
+
+// CaptureCounter counts captures per period, to chart archiving intensity over time. Safe for concurrent use.
+type CaptureCounter struct {
+	Interval string // SeriesDay, SeriesMonth or SeriesYear
+
+	mu     sync.Mutex
+	counts map[time.Time]int
+}
+
+func NewCaptureCounter(interval string) (*CaptureCounter, error) {
+	switch interval {
+	case SeriesDay, SeriesMonth, SeriesYear:
+	default:
+		return nil, fmt.Errorf("[CaptureCounter] Unknown interval '%v', use %v, %v or %v", interval, SeriesDay, SeriesMonth, SeriesYear)
+	}
+	return &CaptureCounter{Interval: interval, counts: map[time.Time]int{}}, nil
+}
+
+// Start of the period time belongs to
+func (c *CaptureCounter) truncate(t time.Time) time.Time {
+	switch c.Interval {
+	case SeriesDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case SeriesMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (c *CaptureCounter) next(t time.Time) time.Time {
+	switch c.Interval {
+	case SeriesDay:
+		return t.AddDate(0, 0, 1)
+	case SeriesMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(1, 0, 0)
+}
+
+func (c *CaptureCounter) label(t time.Time) string {
+	switch c.Interval {
+	case SeriesDay:
+		return t.Format("2006-01-02")
+	case SeriesMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006")
+}
+
+// Add ... Counts records by their capture time, records with bad timestamps are skipped
+func (c *CaptureCounter) Add(records []*CdxResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, res := range records {
+		t, err := res.Time()
+		if err != nil {
+			continue
+		}
+		c.counts[c.truncate(t)]++
+	}
+}
+
+// Series ... Returns counts from the first to the last period with captures, periods without them have 0 count
+func (c *CaptureCounter) Series() []SeriesPoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series := []SeriesPoint{}
+	if len(c.counts) == 0 {
+		return series
+	}
+
+	periods := make([]time.Time, 0, len(c.counts))
+	for t := range c.counts {
+		periods = append(periods, t)
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Before(periods[j]) })
+
+	last := periods[len(periods)-1]
+	for t := periods[0]; !t.After(last); t = c.next(t) {
+		series = append(series, SeriesPoint{Period: c.label(t), Start: t, Count: c.counts[t]})
+	}
+	return series
+}
+
+// CaptureSeries ... Counts captures of records per period
+func CaptureSeries(records []*CdxResponse, interval string) ([]SeriesPoint, error) {
+	counter, err := NewCaptureCounter(interval)
+	if err != nil {
+		return nil, err
+	}
+	counter.Add(records)
+	return counter.Series(), nil
+}
+
+// WriteSeriesCSV ... Writes series as CSV with "period,count" header, ready for plotting tools
+func WriteSeriesCSV(w io.Writer, series []SeriesPoint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"period", "count"})
+	for _, p := range series {
+		cw.Write([]string{p.Period, strconv.Itoa(p.Count)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("[WriteSeriesCSV] Cannot write series: %w", err)
+	}
+	return nil
+}
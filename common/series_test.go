@@ -0,0 +1,52 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCaptureSeries(t *testing.T) {
+	records := []*CdxResponse{
+		{Timestamp: "20230115120000"},
+		{Timestamp: "20230131235959"},
+		{Timestamp: "20230402000000"},
+		{Timestamp: "bad"},
+	}
+
+	series, err := CaptureSeries(records, SeriesMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		period string
+		count  int
+	}{{"2023-01", 2}, {"2023-02", 0}, {"2023-03", 0}, {"2023-04", 1}}
+	if len(series) != len(want) {
+		t.Fatalf("Unexpected series: %v", series)
+	}
+	for i, w := range want {
+		if series[i].Period != w.period || series[i].Count != w.count {
+			t.Fatalf("Unexpected point %v: %+v", i, series[i])
+		}
+	}
+
+	days, _ := CaptureSeries(records[:2], SeriesDay)
+	if len(days) != 17 || days[0].Period != "2023-01-15" || days[16].Count != 1 {
+		t.Fatalf("Unexpected daily series: %v", days)
+	}
+
+	out := bytes.Buffer{}
+	if err := WriteSeriesCSV(&out, series[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "period,count\n2023-01,2\n2023-02,0\n" {
+		t.Fatalf("Unexpected CSV: %q", out.String())
+	}
+
+	if _, err := NewCaptureCounter("week"); err == nil {
+		t.Fatal("Unknown interval should fail")
+	}
+	if series, _ := CaptureSeries(nil, SeriesYear); len(series) != 0 {
+		t.Fatalf("No captures should give empty series: %v", series)
+	}
+}
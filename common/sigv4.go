@@ -0,0 +1,238 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SHA-256 of empty payload, used for requests without body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+const sigV4Time = "20060102T150405Z"
+
+// AWSCredentials sign requests to S3 compatible stores, session token is set for temporary ones
+type AWSCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expires      time.Time // Zero for long-term credentials
+}
+
+// CredentialsFromEnv ... Reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables
+func CredentialsFromEnv() AWSCredentials {
+	return AWSCredentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (c AWSCredentials) expired(now time.Time) bool {
+	// Temporary credentials are refreshed a bit before they expire, so signed requests do not race it
+	return !c.Expires.IsZero() && now.Add(5*time.Minute).After(c.Expires)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Encodes path or query part per RFC 3986, as SigV4 canonical request expects
+func sigV4Escape(s string, path bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && path:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, sigV4Escape(k, false)+"="+sigV4Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// SignV4 ... Signs request with AWS Signature Version 4 for the region and service, like "s3" or "sts".
+// Host, Range, Content-Type and all X-Amz-* headers are signed, payloadHash is hex SHA-256 of the body.
+func SignV4(req *http.Request, creds AWSCredentials, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(sigV4Time)
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = sigV4Escape(unescaped, true)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method, path, canonicalQuery(req.URL.Query()), canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{day, region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.AccessKey, scope, signedHeaders, signature))
+}
+
+// RoleProvider assumes IAM role with STS and keeps its temporary credentials, refreshing them before they expire.
+// Safe for concurrent use.
+type RoleProvider struct {
+	Base        AWSCredentials // Credentials allowed to assume the role
+	RoleARN     string
+	SessionName string // "gogetcrawl" if empty
+	ExternalID  string // Required by some cross-account roles (optional)
+	Region      string
+	Endpoint    string // STS endpoint, regional AWS one if empty
+	Client      *http.Client
+
+	mu    sync.Mutex
+	creds AWSCredentials
+}
+
+type assumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	} `xml:"AssumeRoleResult>Credentials"`
+}
+
+// Credentials ... Returns temporary credentials of the role, assuming it again once they are about to expire
+func (p *RoleProvider) Credentials() (AWSCredentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.creds.AccessKey != "" && !p.creds.expired(time.Now()) {
+		return p.creds, nil
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sts.%v.amazonaws.com/", p.Region)
+	}
+	session := p.SessionName
+	if session == "" {
+		session = "gogetcrawl"
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {p.RoleARN},
+		"RoleSessionName": {session},
+		"DurationSeconds": {"3600"},
+	}
+	if p.ExternalID != "" {
+		form.Set("ExternalId", p.ExternalID)
+	}
+	body := form.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("[AssumeRole] Cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	SignV4(req, p.Base, p.Region, "sts", hashHex([]byte(body)), time.Now())
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("[AssumeRole] Request error: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("[AssumeRole] Cannot read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return AWSCredentials{}, fmt.Errorf("[AssumeRole] Got %v status: %s", resp.StatusCode, data)
+	}
+
+	parsed := assumeRoleResponse{}
+	if err := xml.Unmarshal(data, &parsed); err != nil || parsed.Credentials.AccessKeyId == "" {
+		return AWSCredentials{}, fmt.Errorf("[AssumeRole] Cannot decode credentials: %v", err)
+	}
+	p.creds = AWSCredentials{
+		AccessKey:    parsed.Credentials.AccessKeyId,
+		SecretKey:    parsed.Credentials.SecretAccessKey,
+		SessionToken: parsed.Credentials.SessionToken,
+		Expires:      parsed.Credentials.Expiration,
+	}
+	return p.creds, nil
+}
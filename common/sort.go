@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Orders of query results
+const (
+	SortAscending  = "asc"     // Oldest captures first
+	SortDescending = "desc"    // Newest captures first
+	SortClosest    = "closest" // Captures closest to RequestConfig.Closest first
+)
+
+// SetSort ... Sets order of the config results, closest date is parsed with ParseDate and needed for closest order only.
+// Empty order keeps the order index server returns.
+func (config *RequestConfig) SetSort(order, closest string) error {
+	order = strings.ToLower(strings.TrimSpace(order))
+	switch order {
+	case "", SortAscending, SortDescending:
+		if closest != "" {
+			return fmt.Errorf("[SetSort] Closest date needs %v order", SortClosest)
+		}
+	case SortClosest:
+		date, err := ParseDate(closest)
+		if err != nil || closest == "" {
+			return fmt.Errorf("[SetSort] %v order needs closest date: %v", SortClosest, err)
+		}
+		config.Closest = date
+	default:
+		return fmt.Errorf("[SetSort] Unknown order '%v', use %v, %v or %v", order, SortAscending, SortDescending, SortClosest)
+	}
+	config.Sort = order
+	return nil
+}
+
+// SortParams ... Returns sort parameters of pywb index servers, like Common Crawl one, for the config order.
+// Each page is sorted by the server then, records across pages are sorted by SortRecords.
+func (config *RequestConfig) SortParams() string {
+	switch config.Sort {
+	case SortDescending:
+		return "&sort=reverse"
+	case SortClosest:
+		return "&sort=closest&closest=" + config.Closest.UTC().Format(CdxTimeFormat)
+	}
+	return ""
+}
+
+// SortRecords ... Sorts records in place by the config order, stable so captures of the same time keep server order.
+// Records with bad timestamps go last in closest order.
+func (config *RequestConfig) SortRecords(records []*CdxResponse) {
+	switch config.Sort {
+	case SortAscending:
+		sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp < records[j].Timestamp })
+	case SortDescending:
+		sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp > records[j].Timestamp })
+	case SortClosest:
+		distances := make(map[*CdxResponse]time.Duration, len(records))
+		for _, r := range records {
+			distances[r] = config.distance(r)
+		}
+		sort.SliceStable(records, func(i, j int) bool { return distances[records[i]] < distances[records[j]] })
+	}
+}
+
+// Time between capture of the record and closest date, maximal duration for bad timestamps
+func (config *RequestConfig) distance(r *CdxResponse) time.Duration {
+	t, err := r.Time()
+	if err != nil {
+		return time.Duration(1<<63 - 1)
+	}
+	if d := t.Sub(config.Closest); d >= 0 {
+		return d
+	}
+	return config.Closest.Sub(t)
+}
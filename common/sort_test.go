@@ -0,0 +1,62 @@
+package common
+
+import (
+	"testing"
+)
+
+func sortedTimestamps(config RequestConfig, timestamps ...string) []string {
+	records := []*CdxResponse{}
+	for _, ts := range timestamps {
+		records = append(records, &CdxResponse{Timestamp: ts})
+	}
+	config.SortRecords(records)
+
+	sorted := []string{}
+	for _, r := range records {
+		sorted = append(sorted, r.Timestamp)
+	}
+	return sorted
+}
+
+func TestSortRecords(t *testing.T) {
+	captures := []string{"20200101000000", "20230101000000", "bad", "20210601000000"}
+
+	for order, want := range map[string][]string{
+		"":             captures,
+		SortAscending:  {"20200101000000", "20210601000000", "20230101000000", "bad"},
+		SortDescending: {"bad", "20230101000000", "20210601000000", "20200101000000"},
+		SortClosest:    {"20210601000000", "20200101000000", "20230101000000", "bad"},
+	} {
+		config := RequestConfig{}
+		closest := ""
+		if order == SortClosest {
+			closest = "2021-01-01"
+		}
+		if err := config.SetSort(order, closest); err != nil {
+			t.Fatal(err)
+		}
+
+		got := sortedTimestamps(config, captures...)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%q order: got %v, want %v", order, got, want)
+			}
+		}
+	}
+}
+
+func TestSetSort(t *testing.T) {
+	config := RequestConfig{}
+	if err := config.SetSort("Closest", "20210101"); err != nil || config.SortParams() != "&sort=closest&closest=20210101000000" {
+		t.Fatalf("Unexpected params: %v, %v", config.SortParams(), err)
+	}
+	if err := config.SetSort(SortDescending, ""); err != nil || config.SortParams() != "&sort=reverse" {
+		t.Fatalf("Unexpected params: %v, %v", config.SortParams(), err)
+	}
+
+	for _, bad := range [][2]string{{"random", ""}, {SortClosest, ""}, {SortClosest, "someday"}, {SortAscending, "2021"}} {
+		if err := config.SetSort(bad[0], bad[1]); err == nil {
+			t.Fatalf("Expected error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record outcomes
+const (
+	RecordFound   = "found"   // Record returned by index server
+	RecordSaved   = "saved"   // Record file downloaded and saved
+	RecordFailed  = "failed"  // Record file failed to download or save
+	RecordSkipped = "skipped" // Record skipped as its content was already archived or by PreDownload hook
+
+	RecordOutOfScope = "out_of_scope" // Record host is denied or not allowed
+	RecordFiltered   = "filtered"     // Record does not match filter expression
+)
+
+// Phases of operation
+const (
+	PhaseIndex    = "index"    // Index (CDX) server queries
+	PhaseDownload = "download" // File downloads from archive storage
+)
+
+// Stats accumulates accounting for a single operation, safe for concurrent use.
+// Nil stats is valid and ignores all updates.
+type Stats struct {
+	mu       sync.Mutex
+	requests int
+	retries  int
+	bytes    int64
+	phases   map[string]time.Duration
+	records  map[string]int
+	started  time.Time
+
+	phaseRequests map[string]int
+	phaseBytes    map[string]int64
+	waits         map[string]time.Duration
+	endpoints     map[string]*endpointTelemetry
+	cacheHits     map[string]int
+}
+
+// Snapshot of Stats values
+type StatsSummary struct {
+	Requests int                      `json:"requests"` // HTTP requests made, retries included
+	Retries  int                      `json:"retries"`  // Number of retried requests
+	Bytes    int64                    `json:"bytes"`    // Bytes of response bodies received
+	Phases   map[string]time.Duration `json:"phases"`   // Time spent per phase
+	Records  map[string]int           `json:"records"`  // Records by outcome
+	WallTime time.Duration            `json:"wall_time"`
+
+	PhaseRequests map[string]int             `json:"phase_requests"` // Requests per phase, index queries and storage downloads
+	PhaseBytes    map[string]int64           `json:"phase_bytes"`    // Bytes received per phase
+	Waits         map[string]time.Duration   `json:"waits"`          // Time spent waiting for rate limiters per phase
+	Endpoints     map[string]EndpointSummary `json:"endpoints"`      // Observed throttling and latency per endpoint host, with advice
+	CacheHits     map[string]int             `json:"cache_hits"`     // Requests per phase served from file cache instead
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		phases:  map[string]time.Duration{},
+		records: map[string]int{},
+		started: time.Now(),
+
+		phaseRequests: map[string]int{},
+		phaseBytes:    map[string]int64{},
+		waits:         map[string]time.Duration{},
+		endpoints:     map[string]*endpointTelemetry{},
+		cacheHits:     map[string]int{},
+	}
+}
+
+// AddRequest registers finished HTTP request with received body size
+func (s *Stats) AddRequest(bytes int) {
+	s.AddPhaseRequest("", bytes)
+}
+
+// AddPhaseRequest registers finished HTTP request of the phase, empty phase is counted in totals only
+func (s *Stats) AddPhaseRequest(phase string, bytes int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests += 1
+	s.bytes += int64(bytes)
+	if phase != "" {
+		s.phaseRequests[phase] += 1
+		s.phaseBytes[phase] += int64(bytes)
+	}
+}
+
+// AddWait adds time spent waiting for rate limiter of the phase
+func (s *Stats) AddWait(phase string, d time.Duration) {
+	if s == nil || d == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waits[phase] += d
+}
+
+// AddCacheHit registers request of the phase served from file cache, without reaching the archive
+func (s *Stats) AddCacheHit(phase string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheHits[phase] += 1
+}
+
+func (s *Stats) AddRetry() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries += 1
+}
+
+// AddRecords registers n records with given outcome
+func (s *Stats) AddRecords(outcome string, n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[outcome] += n
+}
+
+// AddPhase adds time spent in the phase
+func (s *Stats) AddPhase(phase string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phases[phase] += d
+}
+
+// StartPhase starts phase timer, call returned function to stop it.
+//
+//	defer stats.StartPhase(PhaseIndex)()
+func (s *Stats) StartPhase(phase string) func() {
+	start := time.Now()
+	return func() {
+		s.AddPhase(phase, time.Since(start))
+	}
+}
+
+func (s *Stats) Summary() StatsSummary {
+	if s == nil {
+		return StatsSummary{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := StatsSummary{
+		Requests: s.requests,
+		Retries:  s.retries,
+		Bytes:    s.bytes,
+		Phases:   map[string]time.Duration{},
+		Records:  map[string]int{},
+		WallTime: time.Since(s.started),
+
+		PhaseRequests: map[string]int{},
+		PhaseBytes:    map[string]int64{},
+		Waits:         map[string]time.Duration{},
+		Endpoints:     map[string]EndpointSummary{},
+		CacheHits:     map[string]int{},
+	}
+	for k, v := range s.phases {
+		summary.Phases[k] = v
+	}
+	for k, v := range s.records {
+		summary.Records[k] = v
+	}
+	for k, v := range s.phaseRequests {
+		summary.PhaseRequests[k] = v
+	}
+	for k, v := range s.phaseBytes {
+		summary.PhaseBytes[k] = v
+	}
+	for k, v := range s.waits {
+		summary.Waits[k] = v
+	}
+	for k, v := range s.endpoints {
+		summary.Endpoints[k] = v.summary()
+	}
+	for k, v := range s.cacheHits {
+		summary.CacheHits[k] = v
+	}
+	return summary
+}
+
+func (s StatsSummary) String() string {
+	parts := []string{
+		fmt.Sprintf("requests=%v", s.Requests),
+		fmt.Sprintf("retries=%v", s.Retries),
+		fmt.Sprintf("bytes=%v", s.Bytes),
+		fmt.Sprintf("wall=%v", s.WallTime.Round(time.Millisecond)),
+	}
+
+	for _, k := range sortedKeys(s.Phases) {
+		parts = append(parts, fmt.Sprintf("%v_time=%v", k, s.Phases[k].Round(time.Millisecond)))
+	}
+	for _, k := range sortedKeys(s.PhaseRequests) {
+		parts = append(parts, fmt.Sprintf("%v_requests=%v %v_bytes=%v", k, s.PhaseRequests[k], k, s.PhaseBytes[k]))
+	}
+	for _, k := range sortedKeys(s.Waits) {
+		parts = append(parts, fmt.Sprintf("%v_wait=%v", k, s.Waits[k].Round(time.Millisecond)))
+	}
+	for _, k := range sortedKeys(s.CacheHits) {
+		parts = append(parts, fmt.Sprintf("%v_cache_hits=%v", k, s.CacheHits[k]))
+	}
+	for _, k := range sortedKeys(s.Records) {
+		parts = append(parts, fmt.Sprintf("%v=%v", k, s.Records[k]))
+	}
+	for _, k := range sortedKeys(s.Endpoints) {
+		parts = append(parts, fmt.Sprintf("[%v %v]", k, s.Endpoints[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsSummary(t *testing.T) {
+	stats := NewStats()
+	stats.AddRequest(100)
+	stats.AddRetry()
+	stats.AddRequest(50)
+	stats.AddRecords(RecordFound, 3)
+	stats.AddRecords(RecordSaved, 2)
+	stats.AddPhase(PhaseIndex, time.Second)
+
+	summary := stats.Summary()
+	if summary.Requests != 2 || summary.Retries != 1 || summary.Bytes != 150 {
+		t.Fatalf("Incorrect request accounting: %v", summary)
+	}
+
+	if summary.Records[RecordFound] != 3 || summary.Records[RecordSaved] != 2 {
+		t.Fatalf("Incorrect records accounting: %v", summary.Records)
+	}
+
+	if summary.Phases[PhaseIndex] != time.Second {
+		t.Fatalf("Incorrect phase time: %v", summary.Phases)
+	}
+}
+
+func TestAttachRecords(t *testing.T) {
+	config := RequestConfig{URL: "example.com", Stats: NewStats()}
+	records := []*CdxResponse{{Original: "http://example.com/"}, {Original: "http://example.com/1"}}
+
+	config.AttachRecords(records)
+
+	if records[1].Stats() != config.Stats {
+		t.Fatalf("Record is not bound to config stats")
+	}
+	if got := config.Stats.Summary().Records[RecordFound]; got != 2 {
+		t.Fatalf("Found records: want=2, got=%v", got)
+	}
+}
@@ -0,0 +1,289 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageInfo describes stored object
+type StorageInfo struct {
+	Size     int64
+	ModTime  time.Time
+	Metadata map[string]string // Metadata given on Put, if the backend keeps it
+}
+
+// Storage is a backend files are put into, like local disk, S3 bucket or content addressable store.
+// Paths are slash separated and relative to the storage root. Must be safe for concurrent use.
+// Put must be idempotent and never leave partial file at the path, so retried and resumed jobs can write again:
+// disk storage renames complete temporary file, object stores should use single request or conditional put.
+type Storage interface {
+	Put(path string, r io.Reader, metadata map[string]string) error
+	Exists(path string) (bool, error)
+	Stat(path string) (*StorageInfo, error)
+}
+
+// Ways DiskStorage links files with duplicate content
+const (
+	LinkHard    = "hardlink"
+	LinkReflink = "reflink" // Copy-on-write clone, on filesystems supporting it like Btrfs and XFS
+)
+
+// DiskStorage stores files in local directory, metadata is not kept.
+// With Links set, file with the same content as already written one is linked to it instead of written again,
+// so directory layout stays the same while duplicate payloads take no space. Linking falls back to writing.
+// Files already in the directory are hashed on the first Put, so duplicates of earlier runs are linked too.
+type DiskStorage struct {
+	Dir   string
+	Links string // LinkHard, LinkReflink or empty to always write
+
+	mu     sync.Mutex
+	stored map[[sha256.Size]byte][]string // Content hashes of files and paths having the content
+	hashes map[string][sha256.Size]byte   // Paths of files and their content hashes
+}
+
+func NewDiskStorage(dir string) *DiskStorage {
+	return &DiskStorage{Dir: dir}
+}
+
+// NewLinkingDiskStorage ... Creates storage which links duplicate files with given LinkHard or LinkReflink way
+func NewLinkingDiskStorage(dir, links string) (*DiskStorage, error) {
+	switch links {
+	case "", LinkHard, LinkReflink:
+	default:
+		return nil, fmt.Errorf("[DiskStorage] Unknown link way '%v', use %v or %v", links, LinkHard, LinkReflink)
+	}
+	return &DiskStorage{Dir: dir, Links: links}, nil
+}
+
+// Resolves path inside the directory, paths escaping it with ".." are rejected
+func (s *DiskStorage) fullPath(path string) (string, error) {
+	full := filepath.Join(s.Dir, filepath.FromSlash(path))
+	rel, err := filepath.Rel(s.Dir, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("[DiskStorage] Path '%v' is outside of storage directory", path)
+	}
+	return full, nil
+}
+
+// Put ... Writes file atomically, missing subdirectories of the path are created
+func (s *DiskStorage) Put(path string, r io.Reader, metadata map[string]string) error {
+	full, err := s.fullPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), os.ModePerm); err != nil {
+		return fmt.Errorf("[DiskStorage] Cannot create directory: %w", err)
+	}
+	if s.Links == "" {
+		return s.write(path, full, r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("[DiskStorage] Cannot read '%v': %w", path, err)
+	}
+	hash := sha256.Sum256(data)
+
+	s.mu.Lock()
+	s.index()
+	current, written := s.hashes[full]
+	paths := s.stored[hash]
+	s.mu.Unlock()
+	if written && current == hash {
+		return nil
+	}
+
+	linked := false
+	if len(paths) > 0 {
+		if err := s.link(paths[0], full, int64(len(data))); err != nil {
+			log.Printf("[DiskStorage] Cannot link '%v', writing it: %v", path, err)
+		} else {
+			linked = true
+		}
+	}
+	// Rewritten file is renamed over the path, so files linked to it keep their content
+	if !linked {
+		if err := s.write(path, full, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(full, hash)
+	return nil
+}
+
+// Hashes files of the directory once, must be called with lock held
+func (s *DiskStorage) index() {
+	if s.stored != nil {
+		return
+	}
+	s.stored, s.hashes = map[[sha256.Size]byte][]string{}, map[string][sha256.Size]byte{}
+
+	filepath.WalkDir(s.Dir, func(full string, entry fs.DirEntry, err error) error {
+		// Temporary files of unfinished writes are skipped
+		if err != nil || !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".part") {
+			return nil
+		}
+		file, err := os.Open(full)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil
+		}
+		var sum [sha256.Size]byte
+		copy(sum[:], hash.Sum(nil))
+		s.add(full, sum)
+		return nil
+	})
+}
+
+// Records content of the path, it is no longer linked to its previous content. Must be called with lock held.
+func (s *DiskStorage) add(full string, hash [sha256.Size]byte) {
+	if old, ok := s.hashes[full]; ok {
+		paths := []string{}
+		for _, p := range s.stored[old] {
+			if p != full {
+				paths = append(paths, p)
+			}
+		}
+		// Content is kept while other paths still have it
+		if len(paths) == 0 {
+			delete(s.stored, old)
+		} else {
+			s.stored[old] = paths
+		}
+	}
+	s.stored[hash] = append(s.stored[hash], full)
+	s.hashes[full] = hash
+}
+
+// Links file to the original one if it was not changed since it was written
+func (s *DiskStorage) link(original, full string, size int64) error {
+	info, err := os.Stat(original)
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("original '%v' was changed", original)
+	}
+
+	// Link does not replace existing file, so it is made under temporary name and renamed over the path
+	tmp, err := CreateAtomic(full)
+	if err != nil {
+		return err
+	}
+	tmp.Abort()
+	if s.Links == LinkReflink {
+		err = reflink(original, tmp.Name())
+	} else {
+		err = os.Link(original, tmp.Name())
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), full); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *DiskStorage) write(path, full string, r io.Reader) error {
+	file, err := CreateAtomic(full)
+	if err != nil {
+		return fmt.Errorf("[DiskStorage] Cannot create '%v': %w", path, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Abort()
+		return fmt.Errorf("[DiskStorage] Cannot write '%v': %w", path, err)
+	}
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("[DiskStorage] Cannot commit '%v': %w", path, err)
+	}
+	return nil
+}
+
+func (s *DiskStorage) Exists(path string) (bool, error) {
+	info, err := s.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return info != nil, err
+}
+
+func (s *DiskStorage) Stat(path string) (*StorageInfo, error) {
+	full, err := s.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// StorageOutput writes files into storage, with metadata of their records
+type StorageOutput struct {
+	Storage Storage
+}
+
+func NewStorageOutput(storage Storage) *StorageOutput {
+	return &StorageOutput{Storage: storage}
+}
+
+func (o *StorageOutput) Write(name string, data []byte) error {
+	return o.Storage.Put(name, bytes.NewReader(data), nil)
+}
+
+func (o *StorageOutput) WriteRecord(name string, res *CdxResponse, data []byte) error {
+	return o.Storage.Put(name, bytes.NewReader(data), RecordMetadata(res))
+}
+
+func (o *StorageOutput) Close() error {
+	if closer, ok := o.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// RecordMetadata ... Returns metadata of the record to store with its file, tags are prefixed with "tag-"
+func RecordMetadata(res *CdxResponse) map[string]string {
+	metadata := map[string]string{}
+	for k, v := range map[string]string{
+		"url":       res.Original,
+		"timestamp": res.Timestamp,
+		"mime":      res.MimeType,
+		"status":    res.StatusCode,
+		"digest":    res.Digest,
+		"robots":    res.Robots.String(),
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	if res.Source != nil {
+		metadata["source"] = res.Source.Name()
+	}
+	for k, v := range res.Tags() {
+		metadata["tag-"+k] = v
+	}
+	for k, v := range res.Fetch.Metadata() {
+		metadata[k] = v
+	}
+	return metadata
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskStorage(t *testing.T) {
+	storage := NewDiskStorage(t.TempDir())
+	output := NewStorageOutput(storage)
+
+	if err := output.Write("example.com/index.html", []byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := storage.Exists("example.com/index.html")
+	if err != nil || !ok {
+		t.Fatalf("File should exist: %v", err)
+	}
+	if ok, _ := storage.Exists("missing.html"); ok {
+		t.Fatal("Missing file should not exist")
+	}
+
+	info, err := storage.Stat("example.com/index.html")
+	if err != nil || info.Size != 13 {
+		t.Fatalf("Unexpected info: %+v, %v", info, err)
+	}
+
+	if err := output.Write("../escape.html", []byte("x")); err == nil {
+		t.Fatal("Path outside of storage should be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(storage.Dir, "..", "escape.html")); err == nil {
+		t.Fatal("File written outside of storage")
+	}
+}
+
+func TestRecordMetadata(t *testing.T) {
+	config := &RequestConfig{Tags: map[string]string{"case": "17"}}
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20230101000000", Digest: "AAA", Source: planSource{}, Config: config}
+
+	metadata := RecordMetadata(res)
+	if metadata["url"] != "http://example.com/" || metadata["source"] != "Stub" || metadata["tag-case"] != "17" {
+		t.Fatalf("Unexpected metadata: %v", metadata)
+	}
+	if _, ok := metadata["mime"]; ok {
+		t.Fatal("Empty fields should be omitted")
+	}
+}
+
+func TestDiskStorageLinks(t *testing.T) {
+	if _, err := NewLinkingDiskStorage(t.TempDir(), "symlink"); err == nil {
+		t.Fatal("Unknown link way should fail")
+	}
+
+	for _, links := range []string{LinkHard, LinkReflink} {
+		storage, err := NewLinkingDiskStorage(t.TempDir(), links)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := NewStorageOutput(storage)
+
+		for _, name := range []string{"a.com/index.html", "b.com/index.html", "a.com/index.html"} {
+			if err := output.Write(name, []byte("<html>same</html>")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := output.Write("c.com/index.html", []byte("<html>other</html>")); err != nil {
+			t.Fatal(err)
+		}
+
+		a, _ := os.Stat(filepath.Join(storage.Dir, "a.com", "index.html"))
+		b, err := os.Stat(filepath.Join(storage.Dir, "b.com", "index.html"))
+		if err != nil || b.Size() != 17 {
+			t.Fatalf("Duplicate should be stored: %v", err)
+		}
+		c, _ := os.Stat(filepath.Join(storage.Dir, "c.com", "index.html"))
+		if os.SameFile(a, c) {
+			t.Fatal("Different content should not be linked")
+		}
+		// Reflinks are not supported everywhere, then duplicate is written
+		if links == LinkHard && !os.SameFile(a, b) {
+			t.Fatal("Duplicate should be hard linked")
+		}
+
+		// Changing file does not change its duplicates
+		if err := output.Write("a.com/index.html", []byte("<html>new</html>")); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(storage.Dir, "b.com", "index.html")); string(data) != "<html>same</html>" {
+			t.Fatalf("Duplicate was changed: %q", data)
+		}
+		if links != LinkHard {
+			continue
+		}
+
+		// Content is still linked to the remaining copy, also by storage of the next run
+		restarted, _ := NewLinkingDiskStorage(storage.Dir, links)
+		for _, s := range []*DiskStorage{storage, restarted} {
+			if err := s.Put("d.com/index.html", strings.NewReader("<html>same</html>"), nil); err != nil {
+				t.Fatal(err)
+			}
+			d, _ := os.Stat(filepath.Join(storage.Dir, "d.com", "index.html"))
+			b, _ := os.Stat(filepath.Join(storage.Dir, "b.com", "index.html"))
+			if !os.SameFile(b, d) {
+				t.Fatal("Duplicate of remaining copy should be hard linked")
+			}
+			os.Remove(filepath.Join(storage.Dir, "d.com", "index.html"))
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Formats of StreamOutput
+const (
+	StreamRaw    = "raw"    // Payloads written one after another
+	StreamLength = "length" // Each payload is prefixed with "<length> <name>\n" line
+	StreamWarc   = "warc"   // Each payload is written as WARC resource record
+)
+
+// RecordOutput is implemented by outputs that need record metadata besides payload
+type RecordOutput interface {
+	WriteRecord(name string, res *CdxResponse, data []byte) error
+}
+
+// StreamOutput writes payloads into single stream, like stdout, to pipe them into other processes
+type StreamOutput struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func NewStreamOutput(w io.Writer, format string) (*StreamOutput, error) {
+	switch format {
+	case StreamRaw, StreamLength, StreamWarc:
+	default:
+		return nil, fmt.Errorf("[NewStreamOutput] Unknown stream format: '%v'", format)
+	}
+	return &StreamOutput{w: w, format: format}, nil
+}
+
+func (o *StreamOutput) Write(name string, data []byte) error {
+	return o.WriteRecord(name, &CdxResponse{Original: name}, data)
+}
+
+func (o *StreamOutput) WriteRecord(name string, res *CdxResponse, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var err error
+	switch o.format {
+	case StreamRaw:
+		_, err = o.w.Write(data)
+	case StreamLength:
+		if _, err = fmt.Fprintf(o.w, "%v %v\n", len(data), name); err == nil {
+			_, err = o.w.Write(data)
+		}
+	case StreamWarc:
+		_, err = NewResourceRecord(res, data).WriteTo(o.w)
+	}
+
+	if err != nil {
+		return fmt.Errorf("[StreamOutput] Cannot write '%v': %w", name, err)
+	}
+	return nil
+}
+
+func (o *StreamOutput) Close() error {
+	return nil
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStreamOutputLength(t *testing.T) {
+	buf := bytes.Buffer{}
+	output, _ := NewStreamOutput(&buf, StreamLength)
+
+	output.Write("a.html", []byte("hello"))
+	output.Write("b.html", []byte("hi"))
+
+	want := "5 a.html\nhello2 b.html\nhi"
+	if buf.String() != want {
+		t.Fatalf("Incorrect stream: want=%q, got=%q", want, buf.String())
+	}
+}
+
+func TestStreamOutputWarc(t *testing.T) {
+	buf := bytes.Buffer{}
+	output, _ := NewStreamOutput(&buf, StreamWarc)
+
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", MimeType: "text/html"}
+	if err := output.WriteRecord("a.html", res, []byte("hello")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"WARC/1.0\r\n",
+		"WARC-Type: resource\r\n",
+		"WARC-Target-URI: http://example.com/\r\n",
+		"WARC-Date: 2013-05-22T12:14:21Z\r\n",
+		"Content-Length: 5\r\n\r\nhello\r\n\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("WARC record doesn't contain %q: %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"net/url"
+	"strings"
+)
+
+// SURT ... Converts URL into Sort-friendly URI Reordering Transform form used as CDX urlkey.
+//
+//	ex: https://www.example.com/path?b=1 -> com,example)/path?b=1
+func SURT(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return strings.ToLower(rawURL)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	parts := strings.Split(host, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	key := strings.Join(parts, ",")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		key += ":" + port
+	}
+
+	path := strings.ToLower(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + path
+
+	if u.RawQuery != "" {
+		key += "?" + strings.ToLower(u.RawQuery)
+	}
+	return key
+}
@@ -0,0 +1,17 @@
+package common
+
+import "testing"
+
+func TestSURT(t *testing.T) {
+	cases := map[string]string{
+		"https://www.Example.com/Path?b=1": "com,example)/path?b=1",
+		"example.com":                      "com,example)/",
+		"http://sub.example.com:8080/a":    "com,example,sub:8080)/a",
+		"https://example.com:443/":         "com,example)/",
+	}
+	for in, expected := range cases {
+		if got := SURT(in); got != expected {
+			t.Fatalf("SURT(%v) = %v, expected %v", in, got, expected)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tags of the query the record was found with, nil if there are none
+func (r *CdxResponse) Tags() map[string]string {
+	if r.Config == nil {
+		return nil
+	}
+	return r.Config.Tags
+}
+
+// ParseTags ... Parses tags given as "key=value" pairs, like "case=2023-17"
+func ParseTags(pairs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("[ParseTags] Tag must look like key=value, got '%v'", pair)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// FormatTags ... Formats tags as sorted "key=value" pairs separated by "; ", empty string if there are none
+func FormatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range sortedKeys(tags) {
+		pairs = append(pairs, k+"="+tags[k])
+	}
+	return strings.Join(pairs, "; ")
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags([]string{"case=2023-17", "project = audit"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got := FormatTags(tags); got != "case=2023-17; project=audit" {
+		t.Fatalf("Incorrect tags: %v", got)
+	}
+
+	if _, err := ParseTags([]string{"case"}); err == nil {
+		t.Fatalf("Tag without value should fail")
+	}
+}
+
+func TestTagsPropagation(t *testing.T) {
+	config := &RequestConfig{Tags: map[string]string{"case": "17"}}
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", Config: config}
+
+	buf := bytes.Buffer{}
+	NewNDJSONWriter(&buf).Write([]*CdxResponse{res})
+	if !strings.Contains(buf.String(), `"tags":{"case":"17"}`) {
+		t.Fatalf("Tags are not in NDJSON: %v", buf.String())
+	}
+
+	buf.Reset()
+	NewResourceRecord(res, []byte("data")).WriteTo(&buf)
+	if !strings.Contains(buf.String(), "WARC-Tags: case=17\r\n") {
+		t.Fatalf("Tags are not in WARC: %v", buf.String())
+	}
+}
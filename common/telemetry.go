@@ -0,0 +1,121 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Shares of throttled responses the advice is based on
+const (
+	healthyThrottleRate = 0.01 // Under this rate the endpoint keeps up with requests
+	heavyThrottleRate   = 0.1  // Over this rate the request rate should be halved
+	minAdviceRequests   = 20   // Fewer requests are not enough to advise
+)
+
+// Responses of archive endpoints observed during the run
+type endpointTelemetry struct {
+	requests   int
+	throttled  int
+	failed     int
+	latency    time.Duration
+	maxLatency time.Duration
+	first      time.Time
+	last       time.Time
+}
+
+// EndpointSummary is observed behaviour of archive endpoint with suggested access limits
+type EndpointSummary struct {
+	Requests     int           `json:"requests"`      // Request attempts
+	Throttled    int           `json:"throttled"`     // Responses with 429 or 503 status
+	Failed       int           `json:"failed"`        // Attempts without response
+	ThrottleRate float64       `json:"throttle_rate"` // Share of throttled responses
+	AvgLatency   time.Duration `json:"avg_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+	ObservedRPS  float64       `json:"observed_rps"` // Requests per second while the endpoint was used
+
+	SuggestedRPS         float64 `json:"suggested_rps,omitempty"`         // Rate to use with --index-rate, --storage-rate or politeness max_rps
+	SuggestedConcurrency int     `json:"suggested_concurrency,omitempty"` // Requests in flight needed to reach suggested rate
+	Advice               string  `json:"advice"`
+}
+
+// AddEvent registers response status and latency of the request attempt by its endpoint host
+func (s *Stats) AddEvent(event RequestEvent) {
+	if s == nil {
+		return
+	}
+	u, err := url.Parse(event.URL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	host := strings.ToLower(u.Host)
+	end := time.Now()
+	start := end.Add(-event.Duration)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.endpoints[host]
+	if !ok {
+		t = &endpointTelemetry{first: start}
+		s.endpoints[host] = t
+	}
+
+	t.requests++
+	switch {
+	case isThrottled(event.Status):
+		t.throttled++
+	case event.Status == 0:
+		t.failed++
+	}
+	t.latency += event.Duration
+	if event.Duration > t.maxLatency {
+		t.maxLatency = event.Duration
+	}
+	if start.Before(t.first) {
+		t.first = start
+	}
+	if end.After(t.last) {
+		t.last = end
+	}
+}
+
+func (t *endpointTelemetry) summary() EndpointSummary {
+	es := EndpointSummary{Requests: t.requests, Throttled: t.throttled, Failed: t.failed, MaxLatency: t.maxLatency}
+	if t.requests == 0 {
+		return es
+	}
+	es.ThrottleRate = float64(t.throttled) / float64(t.requests)
+	es.AvgLatency = t.latency / time.Duration(t.requests)
+	if span := t.last.Sub(t.first).Seconds(); span > 0 {
+		es.ObservedRPS = float64(t.requests) / span
+	}
+
+	switch {
+	case t.requests < minAdviceRequests || es.ObservedRPS == 0:
+		es.Advice = "too few requests to advise"
+		return es
+	case es.ThrottleRate >= heavyThrottleRate:
+		es.SuggestedRPS = es.ObservedRPS / 2
+		es.Advice = "heavily throttled, halve the request rate"
+	case es.ThrottleRate >= healthyThrottleRate:
+		es.SuggestedRPS = es.ObservedRPS * 0.8
+		es.Advice = "occasionally throttled, lower the request rate"
+	default:
+		es.SuggestedRPS = es.ObservedRPS
+		es.Advice = "not throttled, the rate can be kept or raised carefully"
+	}
+
+	// Little's law: requests in flight = rate * latency
+	es.SuggestedConcurrency = int(math.Max(1, math.Ceil(es.SuggestedRPS*es.AvgLatency.Seconds())))
+	return es
+}
+
+func (es EndpointSummary) String() string {
+	s := fmt.Sprintf("throttled=%v/%v latency=%v", es.Throttled, es.Requests, es.AvgLatency.Round(time.Millisecond))
+	if es.SuggestedRPS > 0 {
+		s += fmt.Sprintf(" suggested_rps=%.2f suggested_concurrency=%v", es.SuggestedRPS, es.SuggestedConcurrency)
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAddEvent(t *testing.T) {
+	stats := NewStats()
+	stats.AddEvent(RequestEvent{URL: "https://web.archive.org/cdx/search/cdx?url=a", Status: 200, Duration: time.Second})
+	stats.AddEvent(RequestEvent{URL: "https://Web.Archive.org/web/x", Status: 429, Duration: 3 * time.Second})
+	stats.AddEvent(RequestEvent{URL: "https://index.commoncrawl.org/", Err: errors.New("timeout")})
+
+	endpoints := stats.Summary().Endpoints
+	wb := endpoints["web.archive.org"]
+	if wb.Requests != 2 || wb.Throttled != 1 || wb.ThrottleRate != 0.5 || wb.AvgLatency != 2*time.Second || wb.MaxLatency != 3*time.Second {
+		t.Fatalf("Unexpected endpoint summary: %+v", wb)
+	}
+	if endpoints["index.commoncrawl.org"].Failed != 1 {
+		t.Fatalf("Failed attempt is not counted: %+v", endpoints)
+	}
+}
+
+func TestEndpointAdvice(t *testing.T) {
+	start := time.Now()
+	telemetry := func(requests, throttled int) *endpointTelemetry {
+		return &endpointTelemetry{
+			requests:  requests,
+			throttled: throttled,
+			latency:   time.Duration(requests) * 2 * time.Second,
+			first:     start,
+			last:      start.Add(time.Duration(requests) * time.Second),
+		}
+	}
+
+	heavy := telemetry(100, 20).summary()
+	if heavy.ObservedRPS != 1 || heavy.SuggestedRPS != 0.5 || heavy.SuggestedConcurrency != 1 {
+		t.Fatalf("Unexpected advice for throttled endpoint: %+v", heavy)
+	}
+
+	healthy := telemetry(100, 0).summary()
+	if healthy.SuggestedRPS != 1 || healthy.SuggestedConcurrency != 2 {
+		t.Fatalf("Unexpected advice for healthy endpoint: %+v", healthy)
+	}
+
+	if few := telemetry(5, 0).summary(); few.SuggestedRPS != 0 {
+		t.Fatalf("Few requests should not be advised: %+v", few)
+	}
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Format of CDX timestamps, they are always in UTC
+const CdxTimeFormat = "20060102150405"
+
+// WarcRecord composes single WARC/1.0 record
+type WarcRecord struct {
+	Type    string            // WARC-Type, like "resource", "response" or "warcinfo"
+	Headers map[string]string // Additional WARC headers
+	Content []byte
+}
+
+// NewWarcRecordID ... Generates WARC-Record-ID value as urn:uuid
+func NewWarcRecordID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	buf[6] = (buf[6] & 0x0f) | 0x40
+	buf[8] = (buf[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+// ContentRecordID ... Derives WARC-Record-ID from type, headers and content of the record as name-based urn:uuid,
+// so the same record always gets the same ID
+func ContentRecordID(r *WarcRecord) string {
+	keys := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		if k != "WARC-Record-ID" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	hash := sha1.New()
+	hash.Write([]byte(r.Type + "\n"))
+	for _, k := range keys {
+		hash.Write([]byte(k + ": " + r.Headers[k] + "\n"))
+	}
+	hash.Write(r.Content)
+	buf := hash.Sum(nil)[:16]
+	buf[6] = (buf[6] & 0x0f) | 0x50
+	buf[8] = (buf[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+// NewResourceRecord ... Creates WARC resource record for payload of the CDX record, digested as written
+func NewResourceRecord(res *CdxResponse, data []byte) *WarcRecord {
+	date := time.Now().UTC()
+	if t, err := res.Time(); err == nil {
+		date = t
+	}
+
+	headers := map[string]string{
+		"WARC-Date":       date.Format(time.RFC3339),
+		"WARC-Target-URI": res.Original,
+	}
+	if res.MimeType != "" {
+		headers["Content-Type"] = res.MimeType
+	}
+	// Payload may be transformed before it is written, so digest of the CDX record is not used
+	headers["WARC-Payload-Digest"] = "sha1:" + PayloadDigest(data)
+	if tags := FormatTags(res.Tags()); tags != "" {
+		headers["WARC-Tags"] = tags
+	}
+
+	return &WarcRecord{Type: "resource", Headers: headers, Content: data}
+}
+
+// WriteTo ... Serializes record, returns number of bytes written
+func (r *WarcRecord) WriteTo(w io.Writer) (int64, error) {
+	buf := []byte("WARC/1.0\r\n")
+	buf = append(buf, "WARC-Type: "+r.Type+"\r\n"...)
+
+	recordID := r.Headers["WARC-Record-ID"]
+	if recordID == "" {
+		recordID = NewWarcRecordID()
+	}
+	buf = append(buf, "WARC-Record-ID: "+recordID+"\r\n"...)
+
+	keys := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		if k != "WARC-Record-ID" && k != "Content-Length" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf = append(buf, k+": "+r.Headers[k]+"\r\n"...)
+	}
+	buf = append(buf, "Content-Length: "+strconv.Itoa(len(r.Content))+"\r\n\r\n"...)
+
+	n, err := w.Write(buf)
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	n, err = w.Write(r.Content)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	n, err = w.Write([]byte("\r\n\r\n"))
+	return total + int64(n), err
+}
+
+// NewWarcInfoRecord ... Creates warcinfo record describing WARC file, fields are written as application/warc-fields
+func NewWarcInfoRecord(filename string, fields map[string]string) *WarcRecord {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	content := []byte{}
+	for _, k := range keys {
+		content = append(content, k+": "+fields[k]+"\r\n"...)
+	}
+
+	headers := map[string]string{
+		"WARC-Date":     time.Now().UTC().Format(time.RFC3339),
+		"WARC-Filename": filename,
+		"Content-Type":  "application/warc-fields",
+	}
+	return &WarcRecord{Type: "warcinfo", Headers: headers, Content: content}
+}
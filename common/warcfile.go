@@ -0,0 +1,162 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default size WARC files are rotated at, as used by common crawlers
+const DefaultWarcSize = 1 << 30
+
+// Suffix of WARC file which is still written
+const openSuffix = ".open"
+
+// WarcOutput writes records into gzipped WARC files of the directory, safe for concurrent use.
+// Files are named <prefix>-<timestamp>-<serial>-<hostname>.warc.gz, each one starts with warcinfo record
+// and a new one is started once size limit is reached. File being written has ".open" suffix, as Heritrix does,
+// it is renamed once the file is complete.
+type WarcOutput struct {
+	Dir     string
+	Prefix  string
+	MaxSize int64             // Size in bytes to rotate file at, 0 to write single file
+	Info    map[string]string // Fields of warcinfo records, like "software" or "operator"
+	Epoch   time.Time         // Fixed time of file names and warcinfo records for reproducible files, record IDs are derived from content then (optional)
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	serial   int
+	files    []string
+	hostname string
+}
+
+// NewWarcOutput ... Creates directory for WARC files, first file is created on first written record
+func NewWarcOutput(dir, prefix string, maxSize int64, info map[string]string) (*WarcOutput, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("[NewWarcOutput] Cannot create directory: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	if prefix == "" {
+		prefix = "gogetcrawl"
+	}
+	return &WarcOutput{Dir: dir, Prefix: prefix, MaxSize: maxSize, Info: info, hostname: hostname}, nil
+}
+
+func (o *WarcOutput) Write(name string, data []byte) error {
+	return o.WriteRecord(name, &CdxResponse{Original: name}, data)
+}
+
+// WriteRecord ... Appends resource record of the capture as separate gzip member
+func (o *WarcOutput) WriteRecord(name string, res *CdxResponse, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file == nil || (o.MaxSize > 0 && o.size >= o.MaxSize) {
+		if err := o.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := o.writeMember(NewResourceRecord(res, data)); err != nil {
+		return fmt.Errorf("[WarcOutput] Cannot write record '%v': %w", name, err)
+	}
+	return nil
+}
+
+// Closes current file and starts the next one with warcinfo record
+func (o *WarcOutput) rotate() error {
+	if err := o.closeFile(); err != nil {
+		return err
+	}
+
+	created, hostname := time.Now(), o.hostname
+	if !o.Epoch.IsZero() {
+		// Files of reproducible runs do not depend on the machine
+		created, hostname = o.Epoch, "localhost"
+	}
+	filename := fmt.Sprintf("%v-%v-%05d-%v.warc.gz", o.Prefix, created.UTC().Format(CdxTimeFormat), o.serial, hostname)
+	path := filepath.Join(o.Dir, filename)
+	file, err := os.OpenFile(path+openSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("[WarcOutput] Cannot create WARC file: %w", err)
+	}
+	o.file, o.size = file, 0
+	o.serial++
+	o.files = append(o.files, path)
+
+	fields := map[string]string{
+		"software":   "gogetcrawl",
+		"format":     "WARC File Format 1.0",
+		"conformsTo": "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.0/",
+		"hostname":   hostname,
+	}
+	for k, v := range o.Info {
+		fields[k] = v
+	}
+	info := NewWarcInfoRecord(filename, fields)
+	if !o.Epoch.IsZero() {
+		info.Headers["WARC-Date"] = o.Epoch.UTC().Format(time.RFC3339)
+	}
+	if err := o.writeMember(info); err != nil {
+		return fmt.Errorf("[WarcOutput] Cannot write warcinfo: %w", err)
+	}
+	return nil
+}
+
+// Each record is compressed as separate gzip member, so records can be read by offset
+func (o *WarcOutput) writeMember(record *WarcRecord) error {
+	if !o.Epoch.IsZero() && record.Headers["WARC-Record-ID"] == "" {
+		record.Headers["WARC-Record-ID"] = ContentRecordID(record)
+	}
+	member := bytes.Buffer{}
+	gz := gzip.NewWriter(&member)
+	if _, err := record.WriteTo(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	n, err := o.file.Write(member.Bytes())
+	o.size += int64(n)
+	return err
+}
+
+func (o *WarcOutput) closeFile() error {
+	if o.file == nil {
+		return nil
+	}
+	open := o.file.Name()
+	err := o.file.Close()
+	o.file = nil
+	if err != nil {
+		return fmt.Errorf("[WarcOutput] Cannot close WARC file: %w", err)
+	}
+	if err := os.Rename(open, strings.TrimSuffix(open, openSuffix)); err != nil {
+		return fmt.Errorf("[WarcOutput] Cannot finish WARC file: %w", err)
+	}
+	return nil
+}
+
+// Files ... Returns paths of written WARC files, the current one gets its path once output is closed
+func (o *WarcOutput) Files() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string{}, o.files...)
+}
+
+func (o *WarcOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closeFile()
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWarcOutputRotation(t *testing.T) {
+	dir := t.TempDir()
+	output, err := NewWarcOutput(dir, "example", 1000, map[string]string{"operator": "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Random payload is not compressed below the limit
+	payload := make([]byte, 2000)
+	rand.Read(payload)
+	for i := 0; i < 3; i++ {
+		if err := output.WriteRecord("a", &CdxResponse{Original: "http://example.com/", Timestamp: "20230101000000"}, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// File being written is not complete yet
+	current := output.Files()[2]
+	if _, err := os.Stat(current + ".open"); err != nil {
+		t.Fatalf("Current file should have .open suffix: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(current + ".open"); !os.IsNotExist(err) {
+		t.Fatal("Closed file should be renamed")
+	}
+
+	files := output.Files()
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %v", files)
+	}
+
+	name := regexp.MustCompile(`^example-\d{14}-0000[0-2]-.+\.warc\.gz$`)
+	for i, path := range files {
+		if !name.MatchString(filepath.Base(path)) {
+			t.Fatalf("Unexpected file name %v", path)
+		}
+
+		file, _ := os.Open(path)
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(gz)
+		file.Close()
+
+		content := string(data)
+		if !strings.HasPrefix(content, "WARC/1.0\r\nWARC-Type: warcinfo\r\n") {
+			t.Fatalf("File %v does not start with warcinfo", i)
+		}
+		if !strings.Contains(content, "WARC-Filename: "+filepath.Base(path)) || !strings.Contains(content, "operator: tester\r\n") {
+			t.Fatalf("Unexpected warcinfo of file %v", i)
+		}
+		if strings.Count(content, "WARC-Type: resource") != 1 {
+			t.Fatalf("Expected single resource record in file %v", i)
+		}
+	}
+}
+
+func TestResourceRecordDigest(t *testing.T) {
+	// Digest of the CDX record is of the original payload, written one is rewritten
+	original, written := []byte("<a href=\"http://example.com/\">"), []byte("<a href=\"index.html\">")
+	res := &CdxResponse{Original: "http://example.com/", Timestamp: "20230101000000", Digest: PayloadDigest(original)}
+
+	record := NewResourceRecord(res, written)
+	if record.Headers["WARC-Payload-Digest"] != "sha1:"+PayloadDigest(written) {
+		t.Fatalf("Digest should be of written payload: %v", record.Headers["WARC-Payload-Digest"])
+	}
+}
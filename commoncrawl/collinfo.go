@@ -0,0 +1,132 @@
+package commoncrawl
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Snapshot of collinfo.json shipped with the package, used when neither server nor cache can tell the indexes
+//
+//go:embed collinfo.json
+var embeddedCollinfo []byte
+
+// IndexCachePath is where the last fetched collinfo.json is kept for index server outages, empty to disable
+var IndexCachePath = defaultIndexCachePath()
+
+// IndexRetryInterval is how often the index listing is fetched again while source uses the fallback one
+var IndexRetryInterval = time.Minute
+
+func defaultIndexCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gogetcrawl", "collinfo.json")
+}
+
+func parseIndexes(data []byte) ([]Index, error) {
+	indexes := []Index{}
+	if err := jsoniter.Unmarshal(data, &indexes); err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("No indexes listed")
+	}
+	return indexes, nil
+}
+
+// Keeps fetched listing for the next outage, failures are only logged
+func saveIndexCache(indexes []Index) {
+	if IndexCachePath == "" {
+		return
+	}
+	data, err := jsoniter.Marshal(indexes)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(IndexCachePath), os.ModePerm)
+	}
+	if err == nil {
+		tmp := IndexCachePath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, IndexCachePath)
+		}
+	}
+	if err != nil {
+		log.Printf("[saveIndexCache] %v", err)
+	}
+}
+
+// FallbackIndexes ... Returns listing of cache at IndexCachePath or the embedded snapshot, whichever lists newer crawl
+func FallbackIndexes() ([]Index, error) {
+	indexes, err := parseIndexes(embeddedCollinfo)
+	if err != nil {
+		return nil, fmt.Errorf("[FallbackIndexes] Embedded listing: %w", err)
+	}
+	if IndexCachePath == "" {
+		return indexes, nil
+	}
+
+	data, err := os.ReadFile(IndexCachePath)
+	if err != nil {
+		return indexes, nil
+	}
+	cached, err := parseIndexes(data)
+	if err != nil {
+		log.Printf("[FallbackIndexes] Ignoring cache %v: %v", IndexCachePath, err)
+		return indexes, nil
+	}
+	// IDs like "CC-MAIN-2023-14" sort by time of crawl
+	if cached[0].Id >= indexes[0].Id {
+		return cached, nil
+	}
+	return indexes, nil
+}
+
+// UsesFallbackIndexes ... Tells if the index listing is from cache or embedded snapshot, as index server was unavailable
+func (cc *CommonCrawl) UsesFallbackIndexes() bool {
+	cc.indexesMu.Lock()
+	defer cc.indexesMu.Unlock()
+	return cc.fallback
+}
+
+// Known indexes, newest first. Fallback listing is replaced with the server one once it answers again,
+// tried at most every IndexRetryInterval, queries use the fallback one meanwhile.
+func (cc *CommonCrawl) knownIndexes() []Index {
+	cc.indexesMu.Lock()
+	if !cc.fallback || time.Since(cc.lastIndexFetch) < IndexRetryInterval {
+		defer cc.indexesMu.Unlock()
+		return cc.indexes
+	}
+	cc.lastIndexFetch = time.Now()
+	cc.indexesMu.Unlock()
+
+	indexes, err := cc.GetIndexes()
+	if err == nil && len(indexes) == 0 {
+		err = fmt.Errorf("No indexes listed")
+	}
+
+	cc.indexesMu.Lock()
+	defer cc.indexesMu.Unlock()
+	if err != nil {
+		log.Printf("[knownIndexes] Index server is still unavailable: %v", err)
+		return cc.indexes
+	}
+	log.Printf("Index listing fetched, %v indexes", len(indexes))
+	cc.indexes, cc.fallback = indexes, false
+	saveIndexCache(indexes)
+	return cc.indexes
+}
+
+// Newest known index
+func (cc *CommonCrawl) latestIndex() (string, error) {
+	indexes := cc.knownIndexes()
+	if len(indexes) == 0 {
+		return "", fmt.Errorf("No indexes known")
+	}
+	return indexes[0].Id, nil
+}
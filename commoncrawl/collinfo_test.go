@@ -0,0 +1,96 @@
+package commoncrawl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestFallbackIndexes(t *testing.T) {
+	defer func(path string) { IndexCachePath = path }(IndexCachePath)
+
+	IndexCachePath = ""
+	embedded, err := FallbackIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(embedded); i++ {
+		if embedded[i-1].Id <= embedded[i].Id {
+			t.Fatalf("Embedded indexes are not newest first: %v, %v", embedded[i-1].Id, embedded[i].Id)
+		}
+		if time.Time(embedded[i].From).IsZero() || embedded[i].CdxAPI == "" {
+			t.Fatalf("Embedded index is incomplete: %+v", embedded[i])
+		}
+	}
+
+	IndexCachePath = filepath.Join(t.TempDir(), "gogetcrawl", "collinfo.json")
+	from := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := []Index{{Id: "CC-MAIN-2099-01", From: CustomTime(from), To: CustomTime(from.AddDate(0, 0, 9))}}
+	saveIndexCache(newer)
+	indexes, err := FallbackIndexes()
+	if err != nil || len(indexes) != 1 || indexes[0].Id != "CC-MAIN-2099-01" || !time.Time(indexes[0].From).Equal(from) {
+		t.Fatalf("Newer cache should be used: %+v, %v", indexes, err)
+	}
+
+	saveIndexCache([]Index{{Id: "CC-MAIN-2008-01"}})
+	if indexes, _ := FallbackIndexes(); indexes[0].Id != embedded[0].Id {
+		t.Fatalf("Older cache should not be used: %v", indexes[0].Id)
+	}
+
+	os.WriteFile(IndexCachePath, []byte("{broken"), 0o644)
+	if indexes, _ := FallbackIndexes(); indexes[0].Id != embedded[0].Id {
+		t.Fatalf("Broken cache should be ignored: %v", indexes[0].Id)
+	}
+}
+
+func TestFallbackExplicitIndexes(t *testing.T) {
+	cc := &CommonCrawl{indexes: []Index{{Id: "CC-MAIN-2023-14"}}, fallback: true, lastIndexFetch: time.Now()}
+	if !cc.UsesFallbackIndexes() {
+		t.Fatalf("Source should use fallback indexes")
+	}
+
+	// Crawls made after the fallback listing can still be named
+	config := common.RequestConfig{Indexes: []string{"CC-MAIN-2099-01", "CC-MAIN-2023-14"}}
+	if indexes := cc.Indexes(config); len(indexes) != 2 || indexes[0] != "CC-MAIN-2099-01" {
+		t.Fatalf("Named indexes should be queried with fallback listing: %v", indexes)
+	}
+	if index, err := cc.latestIndex(); err != nil || index != "CC-MAIN-2023-14" {
+		t.Fatalf("Unexpected latest index: %v, %v", index, err)
+	}
+
+	if _, err := (&CommonCrawl{}).latestIndex(); err == nil {
+		t.Fatalf("Source without indexes should fail")
+	}
+}
+
+func TestFallbackIndexForDate(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	cc := &CommonCrawl{indexes: []Index{
+		{Id: "CC-MAIN-2023-14", From: CustomTime(day("2023-03-20")), To: CustomTime(day("2023-04-02"))},
+		{Id: "CC-MAIN-2022-05", From: CustomTime(day("2022-01-16")), To: CustomTime(day("2022-01-29"))},
+	}, fallback: true, lastIndexFetch: time.Now()}
+
+	if idx, err := cc.IndexForDate(day("2022-06-01")); err != nil || idx.Id != "CC-MAIN-2022-05" {
+		t.Fatalf("Date inside fallback listing: %v, %v", idx.Id, err)
+	}
+	// Crawls of older dates are missing from the listing, so none is picked
+	for _, date := range []string{"2019-03-16", "2024-06-01"} {
+		if idx, err := cc.IndexForDate(day(date)); err == nil {
+			t.Fatalf("Date %v out of fallback listing should fail, got %v", date, idx.Id)
+		}
+	}
+	if indexes := cc.Indexes(common.RequestConfig{IndexDate: day("2019-03-16")}); len(indexes) != 0 {
+		t.Fatalf("Unexpected indexes: %v", indexes)
+	}
+
+	cc.fallback = false
+	if idx, err := cc.IndexForDate(day("2019-03-16")); err != nil || idx.Id != "CC-MAIN-2022-05" {
+		t.Fatalf("Server listing should give the closest crawl: %v, %v", idx.Id, err)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -17,6 +20,7 @@ import (
 const (
 	INDEX_SERVER  = "https://index.commoncrawl.org/"
 	CRAWL_STORAGE = "https://data.commoncrawl.org/" // https://commoncrawl.s3.amazonaws.com/
+	CRAWL_BUCKET  = "commoncrawl"                   // S3 bucket of CRAWL_STORAGE, in us-east-1
 )
 
 // CustomTime is a wrapper for time.Time to implement custom JSON unmarshaling
@@ -26,7 +30,7 @@ type CustomTime time.Time
 func (ct *CustomTime) UnmarshalJSON(b []byte) error {
 	s := string(b)
 
-	// Remove any surrounding quotes
+	// Remove any surrounding quotes, collinfo dates have no zone and are in UTC
 	s = strings.Trim(s, "\"")
 
 	t, err := time.Parse("2006-01-02T15:04:05", s)
@@ -37,14 +41,20 @@ func (ct *CustomTime) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-// JSON response containing latest index name at http://index.commoncrawl.org/collinfo.json
-type latestIndex struct {
-	Id       string     `json:"id"`
-	Name     string     `json:"name"`
-	Timegate string     `json:"timegate"`
-	CdxAPI   string     `json:"cdx-api"`
-	From     CustomTime `json:"from"`
-	To       CustomTime `json:"to"`
+// MarshalJSON implements json.Marshaler interface
+func (ct CustomTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(ct).Format("2006-01-02T15:04:05") + `"`), nil
+}
+
+// Index of a crawl, as listed at http://index.commoncrawl.org/collinfo.json
+type Index struct {
+	Id       string      `json:"id"`
+	Name     string      `json:"name"`
+	Timegate string      `json:"timegate"`
+	CdxAPI   string      `json:"cdx-api"`
+	From     CustomTime  `json:"from"`
+	To       CustomTime  `json:"to"`
+	Stats    *IndexStats `json:"stats,omitempty"` // Crawl statistics, set by GetIndexStats
 }
 
 // ex: http://index.commoncrawl.org/CC-MAIN-2015-11-index?url=*.wikipedia.org/&showNumPages=true
@@ -55,124 +65,236 @@ type numPagesResponse struct {
 }
 
 type CommonCrawl struct {
-	MaxTimeout int           // Request timeout
-	MaxRetries int           // Max number of request retries if timeouted
-	indexes    []latestIndex // CDX Indexes versions cache
+	MaxTimeout int     // Request timeout
+	MaxRetries int     // Max number of request retries if timeouted
+	indexes    []Index // CDX Indexes versions cache
+
+	indexesMu      sync.Mutex
+	fallback       bool      // Indexes are from cache or embedded listing, server listing is fetched lazily
+	lastIndexFetch time.Time // Last attempt to fetch listing while using fallback one
+
+	Decoding common.CdxDecoding // JSON library and strictness of index responses decoding
+	S3       *common.S3Client   // Reads files from CRAWL_BUCKET with signed requests instead of CRAWL_STORAGE (optional)
+	Storage  string             // Base URL of crawl files and indexes, CRAWL_STORAGE if empty (optional)
+
+	// Base URL of index server, INDEX_SERVER if empty (optional). Like "http://localhost:8080/cc/" of `serve`
+	// caching proxy, so workers share cached index responses. Listing of New is fetched from INDEX_SERVER.
+	IndexServer string
 }
 
+// Base URL of index server, with trailing slash
+func (cc *CommonCrawl) indexServer() string {
+	if cc.IndexServer != "" {
+		return strings.TrimSuffix(cc.IndexServer, "/") + "/"
+	}
+	return INDEX_SERVER
+}
+
+// Base URL of crawl files and indexes
+func (cc *CommonCrawl) storage() string {
+	if cc.Storage != "" {
+		return cc.Storage
+	}
+	return CRAWL_STORAGE
+}
+
+// New ... Creates source with indexes listed at collinfo.json. If index server is unavailable, listing of
+// cache or embedded snapshot is used (see FallbackIndexes) and fetched again later, so explicitly named indexes can still be queried.
 func New(timeout, retries int) (*CommonCrawl, error) {
 	source := &CommonCrawl{MaxTimeout: timeout, MaxRetries: retries}
-	var err error
-	source.indexes, err = source.GetIndexes()
-	if err != nil {
-		log.Printf("Error fetching indexes: %v", err)
-		return nil, err
+	indexes, err := source.GetIndexes()
+	if err == nil && len(indexes) > 0 {
+		source.indexes = indexes
+		saveIndexCache(indexes)
+		return source, nil
 	}
+	log.Printf("Error fetching indexes: %v", err)
 
+	if source.indexes, err = FallbackIndexes(); err != nil {
+		return nil, err
+	}
+	log.Printf("Using fallback listing of %v indexes, newest %v", len(source.indexes), source.indexes[0].Id)
+	source.fallback, source.lastIndexFetch = true, time.Now()
 	return source, nil
 }
 
-func (CommonCrawl) Name() string {
+func (*CommonCrawl) Name() string {
 	return "CommonCrawl"
 }
 
 // Get latest CDX indexes from http://index.commoncrawl.org/collinfo.json
-func (cc *CommonCrawl) GetIndexes() ([]latestIndex, error) {
-	response, err := common.Get(INDEX_SERVER+"collinfo.json", cc.MaxTimeout, cc.MaxRetries)
+func (cc *CommonCrawl) GetIndexes() ([]Index, error) {
+	response, err := common.Get(cc.indexServer()+"collinfo.json", cc.MaxTimeout, cc.MaxRetries)
 	if err != nil {
 		return nil, fmt.Errorf("[GetIndexes] response read error: %v", err)
 	}
 
-	latestIndexes := []latestIndex{}
-	err = jsoniter.Unmarshal(response, &latestIndexes)
+	indexes := []Index{}
+	err = jsoniter.Unmarshal(response, &indexes)
 	if err != nil {
 		log.Printf("JSON Unmarshal error: %v", err)
 		log.Printf("Response content: %s", string(response))
-		return latestIndexes, fmt.Errorf("[GetIndexes] Cannot get latest index ID: %v", err)
+		return indexes, fmt.Errorf("[GetIndexes] Cannot get latest index ID: %v", err)
 	}
 
-	return latestIndexes, nil
+	return indexes, nil
 }
 
 // Returns the number of pages located in CommonCrawl for given url
 //
 //	index: needs to be set manually here like "CC-MAIN-2023-14"
 func (cc *CommonCrawl) GetNumPagesIndex(url, index string) (int, error) {
-	requestURI := fmt.Sprintf("%v%v-index?url=%v&showNumPages=true", INDEX_SERVER, index, url)
+	return cc.getNumPagesIndex(url, index, common.RequestOptions{Timeout: cc.MaxTimeout, MaxRetries: cc.MaxRetries})
+}
 
-	response, err := common.Get(requestURI, cc.MaxTimeout, cc.MaxRetries)
+func (cc *CommonCrawl) getNumPagesIndex(url, index string, opts common.RequestOptions) (int, error) {
+	numPagesResp, err := cc.getNumPagesResponse(url, index, opts)
+	return numPagesResp.Pages, err
+}
+
+func (cc *CommonCrawl) getNumPagesResponse(url, index string, opts common.RequestOptions) (numPagesResponse, error) {
+	requestURI := fmt.Sprintf("%v%v-index?url=%v&showNumPages=true", cc.indexServer(), index, url)
+	numPagesResp := numPagesResponse{}
+
+	response, err := common.GetWithOptions(requestURI, opts)
 	if err != nil {
-		return 0, fmt.Errorf("[GetNumPagesIndex] Request error: %v", err)
+		return numPagesResp, fmt.Errorf("[GetNumPagesIndex] Request error: %v", err)
 	}
 
-	numPagesResp := numPagesResponse{}
 	err = jsoniter.Unmarshal(response, &numPagesResp)
 	if err != nil {
-		return 0, fmt.Errorf("[GetNumPagesIndex] JSON decode error: %v", err)
+		return numPagesResp, fmt.Errorf("[GetNumPagesIndex] JSON decode error: %v", err)
 	}
 
-	return numPagesResp.Pages, nil
+	return numPagesResp, nil
+}
+
+// Lines in single block of ZipNum index
+const linesPerBlock = 3000
+
+// PlanSteps ... Breaks query down by indexes matching config dates, with number of pages in each of them
+func (cc *CommonCrawl) PlanSteps(config common.RequestConfig) ([]common.PlanStep, error) {
+	opts := config.RequestOptions(cc.MaxTimeout, cc.MaxRetries)
+	steps := []common.PlanStep{}
+
+	for _, idx := range cc.Indexes(config) {
+		step := common.PlanStep{Index: idx, Endpoint: fmt.Sprintf("%v%v-index", cc.indexServer(), idx), Pages: 1}
+
+		if !config.SinglePage {
+			numPages, err := cc.getNumPagesResponse(config.URL, idx, opts)
+			if err != nil {
+				return nil, config.Errorf("[PlanSteps] %w", err)
+			}
+			step.Pages = numPages.Pages
+			step.RecordsPerPage = numPages.PageSize * linesPerBlock
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
 }
 
 // Returns the number of pages located in CommonCrawl for given url
 // Use latest index from http://index.commoncrawl.org/collinfo.json
 func (cc *CommonCrawl) GetNumPages(url string) (int, error) {
-	return cc.GetNumPagesIndex(url, cc.indexes[0].Id)
+	index, err := cc.latestIndex()
+	if err != nil {
+		return 0, fmt.Errorf("[GetNumPages] %w", err)
+	}
+	return cc.GetNumPagesIndex(url, index)
 }
 
 // Parse response from http://index.commoncrawl.org/[Index Version]-index index server
 func (cc *CommonCrawl) ParseResponse(resp []byte) ([]*common.CdxResponse, error) {
-	pages := []*common.CdxResponse{}
+	return cc.DecodeResponse(bytes.NewReader(resp), 0)
+}
 
-	if len(resp) == 0 {
-		return nil, fmt.Errorf("Empty response provided")
+// Decoding options, default ones for records parsed without initialized source
+func (cc *CommonCrawl) decoding() common.CdxDecoding {
+	if cc == nil {
+		return common.CdxDecoding{}
 	}
+	return cc.Decoding
+}
+
+// DecodeResponse ... Decodes index server response while it is read, stops after max records if max is positive
+func (cc *CommonCrawl) DecodeResponse(r io.Reader, max int) ([]*common.CdxResponse, error) {
+	pages := []*common.CdxResponse{}
+
+	// The response contains JSON objects separated with new line
+	decoding := cc.decoding()
+	decoder := decoding.NewDecoder(r)
+	for decoder.More() && (max <= 0 || len(pages) < max) {
+		var fields map[string]any
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, fmt.Errorf("[ParseResponse] Cannot decode JSON line: %w", err)
+		}
 
-	// Parse the response that contains JSON objects separated with new line
-	for _, line := range bytes.Split(resp[:len(resp)-1], []byte{'\n'}) {
-		var indexVal common.CdxResponse
-		if err := jsoniter.Unmarshal(line, &indexVal); err != nil {
-			return nil, fmt.Errorf("[ParseResponse] Cannot decode JSON line: %w. Response: %v", err, string(line))
+		indexVal := &common.CdxResponse{Source: cc}
+		if err := decoding.SetObject(indexVal, fields); err != nil {
+			return nil, fmt.Errorf("[ParseResponse] Cannot decode record: %w", err)
 		}
-		indexVal.Source = cc
-		pages = append(pages, &indexVal)
+		pages = append(pages, indexVal)
 	}
 
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("Empty response provided")
+	}
 	return pages, nil
 }
 
+// Requests page of the index and decodes up to max records, all of them if max is not positive
+func (cc *CommonCrawl) getPage(reqURL string, opts common.RequestOptions, max int) ([]*common.CdxResponse, error) {
+	var records []*common.CdxResponse
+	err := common.GetDecoded(reqURL, opts, func(r io.Reader) error {
+		var err error
+		records, err = cc.DecodeResponse(r, max)
+		return err
+	})
+	return records, err
+}
+
 // GetPagesIndex ... Makes request to WebArchive index API to gather all url observations
 //
 //	index: needs to be set manually here like "CC-MAIN-2023-14"
+//
+// Accounting is collected into config.Stats if provided.
 func (cc *CommonCrawl) GetPagesIndex(config common.RequestConfig, index string) ([]*common.CdxResponse, error) {
 	var pages int
 	var err error
 
+	defer config.Stats.StartPhase(common.PhaseIndex)()
+	opts := config.RequestOptions(cc.MaxTimeout, cc.MaxRetries)
+
 	if config.SinglePage {
 		pages = 1
 	} else {
-		pages, err = cc.GetNumPagesIndex(config.URL, index)
+		pages, err = cc.getNumPagesIndex(config.URL, index, opts)
 		if err != nil {
-			return nil, err
+			return nil, config.Errorf("%w", err)
 		}
 	}
+	config.Emit(common.Event{Type: common.EventIndexResolved, Source: cc.Name(), Index: index, Pages: pages})
 
 	var results []*common.CdxResponse
 	numResults := 0
 
-	for page := 0; page < pages; page++ {
-		indexURL := fmt.Sprintf("%v%v-index", INDEX_SERVER, index)
-		reqURL := config.GetUrl(indexURL, page)
-
-		response, err := common.Get(reqURL, cc.MaxTimeout, cc.MaxRetries)
-		if err != nil {
-			return results, fmt.Errorf("[GetPagesIndex] Request error: %w", err)
+	for page := config.ResumePage(cc.Name(), index); page < pages; page++ {
+		if !config.Partition.HasPage(page) {
+			continue
 		}
+		indexURL := fmt.Sprintf("%v%v-index", cc.indexServer(), index)
+		reqURL := config.GetUrl(indexURL, page) + config.SortParams()
 
-		parsedResponse, err := cc.ParseResponse(response)
+		remaining := config.Remaining(numResults)
+		parsedResponse, err := cc.getPage(reqURL, opts, remaining)
 		if err != nil {
-			return results, fmt.Errorf("[GetPagesIndex] Cannot parse response: %w", err)
+			config.EmitPage(cc.Name(), index, page, 0, err)
+			return results, config.Errorf("[GetPagesIndex] Request error: %w", err)
 		}
+		config.AttachRecords(parsedResponse)
+		common.SetResumeToken(parsedResponse, config.NextPageToken(cc.Name(), index, page, remaining > 0 && len(parsedResponse) == remaining))
+		parsedResponse = config.SelectRecords(parsedResponse)
+		config.EmitPage(cc.Name(), index, page, len(parsedResponse), nil)
 		results = append(results, parsedResponse...)
 		numResults += len(parsedResponse)
 
@@ -181,14 +303,34 @@ func (cc *CommonCrawl) GetPagesIndex(config common.RequestConfig, index string)
 		}
 	}
 
+	// Server sorts each page only
+	config.SortRecords(results)
 	return results, nil
 }
 
 // Makes request to the Commoncrawl index API to gather all offsets that contain chosen URL.
 //
-//	Uses the latest CommonCrawl index.
+//	Uses the latest CommonCrawl index, the first of config.Indexes or the one closest to config.IndexDate if set.
 func (cc *CommonCrawl) GetPages(config common.RequestConfig) ([]*common.CdxResponse, error) {
-	return cc.GetPagesIndex(config, cc.indexes[0].Id)
+	if len(config.Indexes) > 0 {
+		indexes := cc.filterIndices(config)
+		if len(indexes) == 0 {
+			return nil, config.Errorf("[GetPages] None of indexes %v is known", config.Indexes)
+		}
+		return cc.GetPagesIndex(config, indexes[0])
+	}
+	if !config.IndexDate.IsZero() {
+		idx, err := cc.IndexForDate(config.IndexDate)
+		if err != nil {
+			return nil, config.Errorf("[GetPages] %w", err)
+		}
+		return cc.GetPagesIndex(config, idx.Id)
+	}
+	index, err := cc.latestIndex()
+	if err != nil {
+		return nil, config.Errorf("[GetPages] %w", err)
+	}
+	return cc.GetPagesIndex(config, index)
 }
 
 // FetchPages is a concurrent way to GetPages.
@@ -199,29 +341,51 @@ func (cc *CommonCrawl) FetchPages(config common.RequestConfig, results chan []*c
 	var err error
 
 	numResults := 0
+	opts := config.RequestOptions(cc.MaxTimeout, cc.MaxRetries)
+
+	indices := cc.Indexes(config)
+	// Indexes queried before the resumed one are done
+	if token := config.ResumeFor(cc.Name()); token != nil {
+		for i, idx := range indices {
+			if idx == token.Index {
+				indices = indices[i:]
+				break
+			}
+		}
+	}
 
-	for _, idx := range cc.filterIndices(config) {
+	for _, idx := range indices {
 		pages := 1
 		if !config.SinglePage {
-			pages, err = cc.GetNumPagesIndex(config.URL, idx)
+			pages, err = cc.getNumPagesIndex(config.URL, idx, opts)
 			if err != nil {
-				errors <- err
+				errors <- config.Errorf("%w", err)
 			}
 		}
+		config.Emit(common.Event{Type: common.EventIndexResolved, Source: cc.Name(), Index: idx, Pages: pages})
 
-		indexURL := fmt.Sprintf("%v%v-index", INDEX_SERVER, idx)
-		for page := 0; page < pages; page++ {
-			reqURL := config.GetUrl(indexURL, page)
-
-			response, err := common.Get(reqURL, cc.MaxTimeout, cc.MaxRetries)
-			if err != nil {
-				errors <- fmt.Errorf("[FetchPages] Request error: %w", err)
+		indexURL := fmt.Sprintf("%v%v-index", cc.indexServer(), idx)
+		for page := config.ResumePage(cc.Name(), idx); page < pages; page++ {
+			if !config.Partition.HasPage(page) {
+				continue
 			}
+			reqURL := config.GetUrl(indexURL, page) + config.SortParams()
+			stopPhase := config.Stats.StartPhase(common.PhaseIndex)
 
-			parsedResponse, err := cc.ParseResponse(response)
+			remaining := config.Remaining(numResults)
+			parsedResponse, err := cc.getPage(reqURL, opts, remaining)
 			if err != nil {
-				errors <- fmt.Errorf("[FetchPages] Cannot parse response: %w", err)
+				config.EmitPage(cc.Name(), idx, page, 0, err)
+				errors <- config.Errorf("[FetchPages] Request error: %w", err)
+				stopPhase()
+				continue
 			}
+			config.AttachRecords(parsedResponse)
+			common.SetResumeToken(parsedResponse, config.NextPageToken(cc.Name(), idx, page, remaining > 0 && len(parsedResponse) == remaining))
+			parsedResponse = config.SelectRecords(parsedResponse)
+			config.SortRecords(parsedResponse)
+			config.EmitPage(cc.Name(), idx, page, len(parsedResponse), nil)
+			stopPhase()
 			numResults += len(parsedResponse)
 			results <- parsedResponse
 
@@ -232,15 +396,57 @@ func (cc *CommonCrawl) FetchPages(config common.RequestConfig, results chan []*c
 	}
 }
 
+// Indexes ... Returns IDs of indexes queried for the config, only those of its slice if indexes are partitioned
+func (cc *CommonCrawl) Indexes(config common.RequestConfig) []string {
+	return config.Partition.Shards(cc.filterIndices(config))
+}
+
 // Get indices that match the filter date criteria
 func (cc *CommonCrawl) filterIndices(config common.RequestConfig) []string {
+	known := cc.knownIndexes()
+	if len(config.Indexes) > 0 {
+		ids := map[string]bool{}
+		for _, idx := range known {
+			ids[idx.Id] = true
+		}
+		// Fallback listing misses crawls made after it, so they are queried anyway
+		fallback := cc.UsesFallbackIndexes()
+		indices := []string{}
+		for _, id := range config.Indexes {
+			switch {
+			case ids[id]:
+				indices = append(indices, id)
+			case fallback:
+				log.Printf("[filterIndices] Index '%v' is not in fallback listing, querying anyway", id)
+				indices = append(indices, id)
+			default:
+				log.Printf("[filterIndices] Unknown index '%v'", id)
+			}
+		}
+		return indices
+	}
+
+	if !config.IndexDate.IsZero() {
+		idx, err := cc.IndexForDate(config.IndexDate)
+		if err != nil {
+			log.Printf("[filterIndices] %v", err)
+			return []string{}
+		}
+		log.Printf("Index for %v: %v", config.IndexDate.Format("2006-01-02"), idx.Id)
+		return []string{idx.Id}
+	}
+
 	// no date filter, just use the first index
 	if config.FromDate.IsZero() && config.ToDate.IsZero() {
-		return []string{cc.indexes[0].Id}
+		if len(known) == 0 {
+			log.Printf("[filterIndices] No indexes known")
+			return []string{}
+		}
+		return []string{known[0].Id}
 	}
 
 	indices := []string{}
-	for _, idx := range cc.indexes {
+	for _, idx := range known {
 		if !config.FromDate.IsZero() && config.FromDate.After(time.Time(idx.From)) {
 			continue
 		}
@@ -249,37 +455,119 @@ func (cc *CommonCrawl) filterIndices(config common.RequestConfig) []string {
 		}
 		indices = append(indices, idx.Id)
 	}
+	// Fallback listing misses older crawls, so they are not silently left out of the range
+	if cc.UsesFallbackIndexes() && len(known) > 0 && config.FromDate.Before(time.Time(known[len(known)-1].From)) {
+		log.Printf("[filterIndices] Crawls before %v are not in fallback listing and are not queried, index server is unavailable", known[len(known)-1].Id)
+	}
 	log.Printf("Filtered indices: %v", indices)
 	return indices
 }
 
+// IndexForDate ... Returns the crawl whose window contains the date, or the closest one to it if none does.
+// Answers "what did it look like around March 2019" with a single crawl instead of scanning all of them,
+// for such partial dates pass the middle of the period (see common.ParsePeriod), as its start may be closer to previous crawl.
+func (cc *CommonCrawl) IndexForDate(t time.Time) (Index, error) {
+	indexes := cc.knownIndexes()
+	if len(indexes) == 0 {
+		return Index{}, fmt.Errorf("[IndexForDate] No indexes known")
+	}
+	// Closest crawl of fallback listing may be years away from the date, while server lists the right one
+	oldest, newest := indexes[len(indexes)-1], indexes[0]
+	if cc.UsesFallbackIndexes() && (t.Before(time.Time(oldest.From)) || t.After(time.Time(newest.To))) {
+		return Index{}, fmt.Errorf("[IndexForDate] Date %v is out of fallback listing range, from %v to %v, index server is unavailable",
+			t.Format("2006-01-02"), oldest.Id, newest.Id)
+	}
+
+	best, bestDistance := 0, time.Duration(math.MaxInt64)
+	for i, idx := range indexes {
+		from, to := time.Time(idx.From), time.Time(idx.To)
+		var distance time.Duration
+		switch {
+		case t.Before(from):
+			distance = from.Sub(t)
+		case t.After(to):
+			distance = t.Sub(to)
+		}
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return indexes[best], nil
+}
+
 // Gets files from CommonCrawl storage using info from CdxResponse server
 //
 //	page: info about found web page in CdxResponse
 //	timeout: timeout in seconds
 func (cc *CommonCrawl) GetFile(page *common.CdxResponse) ([]byte, error) {
+	if data, ok := page.CachedFile(); ok {
+		return data, nil
+	}
+
 	offset, _ := strconv.Atoi(page.Offset)
 	length, _ := strconv.Atoi(page.Length)
 	offsetEnd := offset + length + 1
 
-	headers := map[string]string{
-		"Range": fmt.Sprintf("bytes=%v-%v", page.Offset, offsetEnd),
+	opts := page.RequestOptions(cc.MaxTimeout, 0)
+	var resp []byte
+	var err error
+	if cc.S3 != nil {
+		resp, err = cc.S3.GetRange(CRAWL_BUCKET, page.Filename, int64(offset), int64(length), opts)
+	} else {
+		opts.Headers = map[string]string{
+			"Range": fmt.Sprintf("bytes=%v-%v", page.Offset, offsetEnd),
+		}
+		opts.Expect = []int{http.StatusOK, http.StatusPartialContent}
+		resp, err = common.DoRequestWithOptions(cc.storage()+page.Filename, opts)
 	}
-	resp, err := common.DoRequest(CRAWL_STORAGE+page.Filename, cc.MaxTimeout, headers)
 	if err != nil {
-		return nil, fmt.Errorf("[GetFile] Request error: %v", err)
+		return nil, page.Errorf("[GetFile] Request error: %v", err)
 	}
 
 	reader, err := warc.NewReader(bytes.NewReader(resp))
 	if err != nil {
-		return nil, fmt.Errorf("[GetFile] Cannot decode WARC: %v", err)
+		return nil, page.Errorf("[GetFile] Cannot decode WARC: %v", err)
 	}
 	defer reader.Close()
 
 	record, err := reader.ReadRecord()
 	if err != nil {
-		return nil, fmt.Errorf("[GetFile] Cannot decode WARC: %v", err)
+		return nil, page.Errorf("[GetFile] Cannot decode WARC: %v", err)
 	}
 
-	return io.ReadAll(record.Content)
+	data, err := io.ReadAll(record.Content)
+	if err != nil {
+		return nil, page.Errorf("[GetFile] Cannot read WARC record: %v", err)
+	}
+	page.FileCache().Put(page, data)
+	return data, nil
+}
+
+// GetFileAt ... Gets file by WARC coordinates known without index query, like from Athena or third-party CDX dumps.
+// The filename is relative to CRAWL_STORAGE, like "crawl-data/CC-MAIN-2023-14/segments/.../warc/...warc.gz".
+func (cc *CommonCrawl) GetFileAt(filename string, offset, length int) ([]byte, error) {
+	if filename == "" || offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("[GetFileAt] Bad WARC coordinates: filename=%q offset=%v length=%v", filename, offset, length)
+	}
+	page := &common.CdxResponse{
+		Filename: strings.TrimPrefix(filename, CRAWL_STORAGE),
+		Offset:   strconv.Itoa(offset),
+		Length:   strconv.Itoa(length),
+		Source:   cc,
+	}
+	return cc.GetFile(page)
+}
+
+// GetHeaders ... Returns archived response headers of the capture, parsed from its WARC record
+func (cc *CommonCrawl) GetHeaders(page *common.CdxResponse) (http.Header, error) {
+	data, err := cc.GetFile(page)
+	if err != nil {
+		return nil, err
+	}
+
+	header, ok := common.ParseHTTPHeaders(data)
+	if !ok {
+		return nil, page.Errorf("[GetHeaders] Record does not contain HTTP response")
+	}
+	return header, nil
 }
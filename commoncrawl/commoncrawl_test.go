@@ -1,6 +1,7 @@
 package commoncrawl
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +39,44 @@ func TestGetIndexes(t *testing.T) {
 	}
 }
 
+func TestDecodeResponse(t *testing.T) {
+	source := &CommonCrawl{}
+
+	parsedResp, err := source.DecodeResponse(strings.NewReader(RESPONSE), 3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(parsedResp) != 3 || parsedResp[2].Digest != "EJJMOG5QPWIV7YXADIFOPML45UTJKYWW" {
+		t.Fatalf("Expected to stop after 3 records, got %v", parsedResp)
+	}
+
+	if _, err := source.DecodeResponse(strings.NewReader(""), 0); err == nil {
+		t.Fatalf("Expected error for empty response")
+	}
+}
+
+func TestDecodeResponseModes(t *testing.T) {
+	for _, library := range []string{common.JSONIter, common.JSONStd} {
+		source := &CommonCrawl{Decoding: common.CdxDecoding{Library: library, Strict: true}}
+		parsedResp, err := source.DecodeResponse(strings.NewReader(RESPONSE), 0)
+		if err != nil {
+			t.Fatalf("%v: %v", library, err)
+		}
+		if len(parsedResp) != 6 || parsedResp[0].MimeDetected != "application/pdf" || parsedResp[0].Original == "" {
+			t.Fatalf("%v: unexpected records %v", library, parsedResp[0])
+		}
+	}
+
+	renamed := `{"urlkey": "com,example)/", "timestamp": "20230320100841", "uri": "http://example.com/", "status": "200"}`
+	if _, err := (&CommonCrawl{}).DecodeResponse(strings.NewReader(renamed), 0); err != nil {
+		t.Fatalf("Lenient mode should ignore unknown fields: %v", err)
+	}
+	strict := &CommonCrawl{Decoding: common.CdxDecoding{Strict: true}}
+	if _, err := strict.DecodeResponse(strings.NewReader(renamed), 0); err == nil || !strings.Contains(err.Error(), "uri") {
+		t.Fatalf("Strict mode should fail on unknown field, got %v", err)
+	}
+}
+
 // Commented due to excessive request to test
 // func TestGetNumPagesIndex(t *testing.T) {
 // 	want := 989
@@ -182,3 +221,22 @@ func TestGetFile(t *testing.T) {
 	}
 	t.Logf("Obtained file length: %v", len(file))
 }
+
+func TestGetFileAt(t *testing.T) {
+	pages, err := cc.ParseResponse([]byte(RESPONSE))
+	if err != nil {
+		t.Fatalf("Cannot parse response: %v", err)
+	}
+
+	file, err := cc.GetFileAt(pages[4].Filename, 1136155166, 226484)
+	if err != nil {
+		t.Fatalf("Cannot get file: %v", err)
+	}
+	if !strings.HasPrefix(string(file), "HTTP/") {
+		t.Fatalf("File is not HTTP response: %q", file[:16])
+	}
+
+	if _, err := cc.GetFileAt("", 0, 10); err == nil {
+		t.Fatalf("Empty filename should fail")
+	}
+}
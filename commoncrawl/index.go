@@ -0,0 +1,175 @@
+package commoncrawl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+// Average size of compressed WARC file of a crawl, used to estimate data size
+const averageWarcBytes = 1 << 30
+
+// IndexStats describes size of a crawl, computed from its published metadata
+type IndexStats struct {
+	Captures   int64 `json:"captures"`    // Approximate number of captured pages, blocks * 3000
+	Blocks     int   `json:"blocks"`      // ZipNum blocks listed in cluster.idx
+	Shards     int   `json:"shards"`      // CDX index shards (cdx-*.gz files)
+	IndexBytes int64 `json:"index_bytes"` // Compressed size of CDX index
+	Segments   int   `json:"segments"`    // Crawl segments
+	WarcFiles  int   `json:"warc_files"`  // WARC files of the crawl
+	DataBytes  int64 `json:"data_bytes"`  // Approximate compressed size of WARC data
+}
+
+// ErrCrawlNotFound is returned when files of the crawl are missing on storage, like for mistyped crawl ID
+var ErrCrawlNotFound = errors.New("Crawl not found")
+
+// GetIndexStats ... Fetches statistics of the crawl from its metadata on CRAWL_STORAGE:
+// segment.paths.gz, warc.paths.gz and cluster.idx. Notice that cluster.idx is around 100MB.
+//
+//	index: crawl ID like "CC-MAIN-2023-14"
+func (cc *CommonCrawl) GetIndexStats(index string) (*IndexStats, error) {
+	stats := &IndexStats{}
+	opts := common.RequestOptions{Timeout: cc.MaxTimeout, MaxRetries: cc.MaxRetries}
+
+	var err error
+	if stats.Segments, err = cc.countStorageLines(fmt.Sprintf("crawl-data/%v/segment.paths.gz", index), opts); err != nil {
+		return nil, fmt.Errorf("[GetIndexStats] Cannot count segments: %w", err)
+	}
+	if stats.WarcFiles, err = cc.countStorageLines(fmt.Sprintf("crawl-data/%v/warc.paths.gz", index), opts); err != nil {
+		return nil, fmt.Errorf("[GetIndexStats] Cannot count WARC files: %w", err)
+	}
+	stats.DataBytes = int64(stats.WarcFiles) * averageWarcBytes
+
+	body, err := cc.openStorage(fmt.Sprintf("cc-index/collections/%v/indexes/cluster.idx", index), opts)
+	if err != nil {
+		return nil, fmt.Errorf("[GetIndexStats] %w", err)
+	}
+	defer body.Close()
+
+	if err := parseClusterIndex(body, stats); err != nil {
+		return nil, fmt.Errorf("[GetIndexStats] %w", err)
+	}
+	return stats, nil
+}
+
+// GetIndexesStats ... Fills Stats of cached indexes which match config dates, like the ones FetchPages queries
+func (cc *CommonCrawl) GetIndexesStats(config common.RequestConfig) ([]Index, error) {
+	ids := map[string]bool{}
+	for _, id := range cc.Indexes(config) {
+		ids[id] = true
+	}
+
+	indexes := []Index{}
+	for _, idx := range cc.knownIndexes() {
+		if ids[idx.Id] {
+			indexes = append(indexes, idx)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(indexes))
+	for i := range indexes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			indexes[i].Stats, errs[i] = cc.GetIndexStats(indexes[i].Id)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return indexes, fmt.Errorf("[GetIndexesStats] %v: %w", indexes[i].Id, err)
+		}
+	}
+	return indexes, nil
+}
+
+func (cc *CommonCrawl) openStorage(path string, opts common.RequestOptions) (io.ReadCloser, error) {
+	body, err := common.GetStream(cc.storage()+path, opts)
+	// Storage answers missing keys of unknown crawls with 404 (or 403 of S3) and XML error body
+	var statusErr *common.StatusError
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusNotFound || statusErr.Status == http.StatusForbidden) {
+		return nil, fmt.Errorf("%w, no %v on storage: %w", ErrCrawlNotFound, path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Request error: %w", err)
+	}
+
+	reader, err := common.Decompress(body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &decompressReader{ReadCloser: reader, body: body}, nil
+}
+
+func (cc *CommonCrawl) countStorageLines(path string, opts common.RequestOptions) (int, error) {
+	body, err := cc.openStorage(path, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return countLines(body)
+}
+
+// Closes both decompressor and underlying response body
+type decompressReader struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	r.ReadCloser.Close()
+	return r.body.Close()
+}
+
+func countLines(r io.Reader) (int, error) {
+	lines := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			lines++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return lines, fmt.Errorf("Cannot read listing: %w", err)
+	}
+	return lines, nil
+}
+
+// Parses cluster.idx lines like "<SURT> <timestamp>\tcdx-00000.gz\t<offset>\t<length>\t<shard block>"
+func parseClusterIndex(r io.Reader, stats *IndexStats) error {
+	shards := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			continue
+		}
+
+		length, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Bad cluster.idx line '%v': %w", scanner.Text(), err)
+		}
+
+		stats.Blocks++
+		stats.IndexBytes += length
+		shards[fields[1]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Cannot read cluster.idx: %w", err)
+	}
+
+	stats.Shards = len(shards)
+	stats.Captures = int64(stats.Blocks) * linesPerBlock
+	return nil
+}
@@ -0,0 +1,124 @@
+package commoncrawl
+
+import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestParseClusterIndex(t *testing.T) {
+	cluster := "com,example)/ 20230320000000\tcdx-00000.gz\t0\t1000\t1\n" +
+		"com,example)/a 20230320000000\tcdx-00000.gz\t1000\t2000\t2\n" +
+		"org,example)/ 20230320000000\tcdx-00001.gz\t0\t500\t3\n"
+
+	stats := &IndexStats{}
+	if err := parseClusterIndex(strings.NewReader(cluster), stats); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if stats.Blocks != 3 || stats.Shards != 2 || stats.IndexBytes != 3500 || stats.Captures != 3*linesPerBlock {
+		t.Fatalf("Incorrect stats: %+v", stats)
+	}
+}
+
+func TestGetIndexStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/CC-MAIN-2023-14/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<?xml version=\"1.0\"?><Error><Code>NoSuchKey</Code></Error>\n"))
+			return
+		}
+		gz := gzip.NewWriter(w)
+		if strings.HasSuffix(r.URL.Path, "cluster.idx") {
+			gz.Write([]byte(CLUSTER))
+		} else {
+			gz.Write([]byte("first\nsecond\n"))
+		}
+		gz.Close()
+	}))
+	defer server.Close()
+
+	source := &CommonCrawl{MaxTimeout: 5, MaxRetries: 3, Storage: server.URL + "/"}
+	stats, err := source.GetIndexStats("CC-MAIN-2023-14")
+	if err != nil || stats.Segments != 2 || stats.WarcFiles != 2 || stats.Blocks != 5 {
+		t.Fatalf("Unexpected stats: %+v, %v", stats, err)
+	}
+
+	// Error body of unknown crawl is not counted
+	if stats, err := source.GetIndexStats("CC-MAIN-2099-01"); !errors.Is(err, ErrCrawlNotFound) {
+		t.Fatalf("Expected ErrCrawlNotFound, got %+v, %v", stats, err)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	lines, err := countLines(strings.NewReader("crawl-data/a\ncrawl-data/b\n\n"))
+	if err != nil || lines != 2 {
+		t.Fatalf("Got %v lines, err: %v", lines, err)
+	}
+}
+
+func TestIndexForDate(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	source := &CommonCrawl{indexes: []Index{
+		{Id: "CC-MAIN-2019-22", From: CustomTime(day("2019-05-19")), To: CustomTime(day("2019-05-27"))},
+		{Id: "CC-MAIN-2019-13", From: CustomTime(day("2019-03-18")), To: CustomTime(day("2019-03-27"))},
+		{Id: "CC-MAIN-2019-09", From: CustomTime(day("2019-02-15")), To: CustomTime(day("2019-02-24"))},
+	}}
+
+	cases := map[string]string{
+		"2019-03-20": "CC-MAIN-2019-13", // Inside the window
+		"2019-03-05": "CC-MAIN-2019-09", // 9 days after, 13 days before the next one
+		"2019-04-30": "CC-MAIN-2019-22",
+		"2025-01-01": "CC-MAIN-2019-22",
+		"2000-01-01": "CC-MAIN-2019-09",
+	}
+	for date, expected := range cases {
+		idx, err := source.IndexForDate(day(date))
+		if err != nil || idx.Id != expected {
+			t.Fatalf("Index for %v: %v, %v, expected %v", date, idx.Id, err, expected)
+		}
+	}
+
+	// Month is taken as a period, its start is closer to the February crawl
+	from, to, _ := common.ParsePeriod("201903")
+	if idx, _ := source.IndexForDate(from.Add(to.Sub(from) / 2)); idx.Id != "CC-MAIN-2019-13" {
+		t.Fatalf("Index for 201903: %v, expected CC-MAIN-2019-13", idx.Id)
+	}
+
+	config := common.RequestConfig{IndexDate: day("2019-03-20")}
+	if indexes := source.Indexes(config); len(indexes) != 1 || indexes[0] != "CC-MAIN-2019-13" {
+		t.Fatalf("Unexpected indexes: %v", indexes)
+	}
+
+	if _, err := (&CommonCrawl{}).IndexForDate(day("2019-03-20")); err == nil {
+		t.Fatalf("Source without indexes should fail")
+	}
+}
+
+func TestFilterIndexes(t *testing.T) {
+	cc := &CommonCrawl{indexes: []Index{
+		{Id: "CC-MAIN-2023-14"},
+		{Id: "CC-MAIN-2019-13"},
+		{Id: "CC-MAIN-2018-05"},
+	}}
+
+	config := common.RequestConfig{Indexes: []string{"CC-MAIN-2018-05", "CC-MAIN-2000-01", "CC-MAIN-2023-14"}}
+	indexes := cc.Indexes(config)
+	if len(indexes) != 2 || indexes[0] != "CC-MAIN-2018-05" || indexes[1] != "CC-MAIN-2023-14" {
+		t.Fatalf("Unexpected indexes: %v", indexes)
+	}
+
+	config.Indexes = []string{"CC-MAIN-2000-01"}
+	if indexes := cc.Indexes(config); len(indexes) != 0 {
+		t.Fatalf("Unknown indexes should not be queried: %v", indexes)
+	}
+}
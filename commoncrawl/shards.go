@@ -0,0 +1,103 @@
+package commoncrawl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+// Max length of a single line in CDX shard
+const maxShardLine = 1 << 20
+
+// GetShardPaths ... Returns paths of the bulk CDX index shards of the crawl, relative to CRAWL_STORAGE.
+// ex: cc-index/collections/CC-MAIN-2023-14/indexes/cdx-00000.gz
+// Several machines can each read own share of them with Partition.Shards.
+//
+//	index: crawl ID like "CC-MAIN-2023-14"
+func (cc *CommonCrawl) GetShardPaths(index string) ([]string, error) {
+	requestPath := fmt.Sprintf("crawl-data/%v/cc-index.paths.gz", index)
+
+	reader, err := cc.openStorage(requestPath, common.RequestOptions{Timeout: cc.MaxTimeout, MaxRetries: cc.MaxRetries})
+	if err != nil {
+		return nil, fmt.Errorf("[GetShardPaths] %w", err)
+	}
+	defer reader.Close()
+
+	paths := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		// Besides shards, listing contains cluster.idx and metadata files
+		if strings.HasPrefix(path[strings.LastIndex(path, "/")+1:], "cdx-") {
+			paths = append(paths, path)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return paths, fmt.Errorf("[GetShardPaths] Cannot read listing: %w", err)
+	}
+	return paths, nil
+}
+
+// ReadShard ... Streams records of the bulk CDX index shard, calling fn for each of them.
+// Shards compressed with gzip, zstd or xz are decompressed transparently.
+// Stops reading if fn returns error.
+//
+//	path: shard path returned by GetShardPaths
+func (cc *CommonCrawl) ReadShard(path string, fn func(*common.CdxResponse) error) error {
+	body, err := common.GetStream(cc.storage()+path, common.RequestOptions{Timeout: cc.MaxTimeout, MaxRetries: cc.MaxRetries})
+	if err != nil {
+		return fmt.Errorf("[ReadShard] Request error: %w", err)
+	}
+	defer body.Close()
+
+	return cc.ParseShard(body, fn)
+}
+
+// ParseShard ... Parses CDX shard stream with lines like "<SURT> <timestamp> <JSON>".
+func (cc *CommonCrawl) ParseShard(r io.Reader, fn func(*common.CdxResponse) error) error {
+	reader, err := common.Decompress(r)
+	if err != nil {
+		return fmt.Errorf("[ParseShard] %w", err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxShardLine)
+
+	for scanner.Scan() {
+		record, err := cc.parseShardLine(scanner.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("[ParseShard] Cannot read shard: %w", err)
+	}
+	return nil
+}
+
+func (cc *CommonCrawl) parseShardLine(line []byte) (*common.CdxResponse, error) {
+	fields := bytes.SplitN(line, []byte{' '}, 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("[ParseShard] Malformed line: %v", string(line))
+	}
+
+	record := common.CdxResponse{}
+	if err := cc.decoding().UnmarshalRecord(fields[2], &record); err != nil {
+		return nil, fmt.Errorf("[ParseShard] Cannot decode JSON: %w. Line: %v", err, string(line))
+	}
+	record.Urlkey = string(fields[0])
+	record.Timestamp = string(fields[1])
+	record.Source = cc
+	return &record, nil
+}
@@ -0,0 +1,58 @@
+package commoncrawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const SHARD = `com,tutorialspoint)/accounting_basics/accounting_basics_tutorial.pdf 20230320100841 {"url": "http://www.tutorialspoint.com/accounting_basics/accounting_basics_tutorial.pdf", "mime": "application/pdf", "status": "200", "digest": "2JQ2AQ3HQZIMXHB5CJGSADUGOHYBIRJJ", "length": "787172", "offset": "102849414", "filename": "crawl-data/CC-MAIN-2023-14/segments/1679296943471.24/warc/CC-MAIN-20230320083513-20230320113513-00267.warc.gz"}
+com,tutorialspoint)/adding_and_subtracting_decimals/pdf/addition_with_money_worksheet8_1.pdf 20230330141211 {"url": "https://www.tutorialspoint.com/adding_and_subtracting_decimals/pdf/addition_with_money_worksheet8_1.pdf", "mime": "application/pdf", "status": "200", "digest": "MOODQKFMHRVSZK4UOZO3E6H2MGHTK2VW", "length": "226484", "offset": "1136155166", "filename": "crawl-data/CC-MAIN-2023-14/segments/1679296949331.26/warc/CC-MAIN-20230330132508-20230330162508-00514.warc.gz"}
+`
+
+func TestParseShard(t *testing.T) {
+	compressors := map[string]func([]byte) []byte{
+		"plain": func(b []byte) []byte { return b },
+		"gzip": func(b []byte) []byte {
+			buf := bytes.Buffer{}
+			w := gzip.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(b []byte) []byte {
+			w, _ := zstd.NewWriter(nil)
+			return w.EncodeAll(b, nil)
+		},
+		"xz": func(b []byte) []byte {
+			buf := bytes.Buffer{}
+			w, _ := xz.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		},
+	}
+
+	source := &CommonCrawl{}
+	for name, compress := range compressors {
+		records := []*common.CdxResponse{}
+		err := source.ParseShard(bytes.NewReader(compress([]byte(SHARD))), func(r *common.CdxResponse) error {
+			records = append(records, r)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		if len(records) != 2 {
+			t.Fatalf("%v: Incorrect number of records: %v, want=2", name, len(records))
+		}
+		if records[1].Timestamp != "20230330141211" || records[1].Offset != "1136155166" {
+			t.Fatalf("%v: Incorrectly parsed record: %+v", name, records[1])
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package commoncrawl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+// Returned by callback to stop reading blocks
+var errLimitReached = errors.New("limit reached")
+
+// ClusterBlock is a ZipNum block of CDX shard, listed in cluster.idx.
+// Each block is a separate gzip member with up to 3000 sorted CDX lines.
+type ClusterBlock struct {
+	Key    string // SURT key and timestamp of the first line
+	Shard  string // ex: cdx-00000.gz
+	Offset int64
+	Length int64
+}
+
+// SuffixKey ... Converts registered-domain suffix to SURT host prefix.
+//
+//	ex: gov.br -> br,gov
+func SuffixKey(suffix string) string {
+	parts := strings.Split(strings.Trim(strings.ToLower(suffix), ".*"), ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, ",")
+}
+
+// Checks if SURT key belongs to the host prefix, including its subdomains
+func matchesSuffix(urlkey, prefix string) bool {
+	if !strings.HasPrefix(urlkey, prefix) || len(urlkey) == len(prefix) {
+		return false
+	}
+	next := urlkey[len(prefix)]
+	return next == ',' || next == ')' || next == ':'
+}
+
+// GetClusterBlocks ... Returns blocks of the crawl index which may contain records of the suffix, like "gov.br".
+// Notice that cluster.idx of the crawl is around 100MB.
+//
+//	index: crawl ID like "CC-MAIN-2023-14"
+func (cc *CommonCrawl) GetClusterBlocks(config common.RequestConfig, index, suffix string) ([]ClusterBlock, error) {
+	opts := config.RequestOptions(cc.MaxTimeout, cc.MaxRetries)
+	body, err := cc.openStorage(fmt.Sprintf("cc-index/collections/%v/indexes/cluster.idx", index), opts)
+	if err != nil {
+		return nil, config.Errorf("[GetClusterBlocks] %w", err)
+	}
+	defer body.Close()
+
+	blocks, err := findClusterBlocks(body, SuffixKey(suffix))
+	if err != nil {
+		return nil, config.Errorf("[GetClusterBlocks] %w", err)
+	}
+	return blocks, nil
+}
+
+// Selects blocks overlapping key range of the prefix. Block covers keys up to the first key of the next block,
+// so the block before the first matching one is included too.
+func findClusterBlocks(r io.Reader, prefix string) ([]ClusterBlock, error) {
+	blocks := []ClusterBlock{}
+	var prev *ClusterBlock
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			continue
+		}
+
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad cluster.idx line '%v': %w", scanner.Text(), err)
+		}
+		length, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad cluster.idx line '%v': %w", scanner.Text(), err)
+		}
+		block := ClusterBlock{Key: fields[0], Shard: fields[1], Offset: offset, Length: length}
+		urlkey, _, _ := strings.Cut(block.Key, " ")
+
+		if urlkey > prefix && !strings.HasPrefix(urlkey, prefix) {
+			// Past the prefix range, the previous block may still hold its last records
+			if len(blocks) == 0 && prev != nil {
+				blocks = append(blocks, *prev)
+			}
+			break
+		}
+		if urlkey >= prefix {
+			if len(blocks) == 0 && prev != nil {
+				blocks = append(blocks, *prev)
+			}
+			blocks = append(blocks, block)
+		}
+		prev = &block
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Cannot read cluster.idx: %w", err)
+	}
+	return blocks, nil
+}
+
+// ReadBlock ... Downloads single block of the CDX shard and calls fn for each of its records
+func (cc *CommonCrawl) ReadBlock(config common.RequestConfig, index string, block ClusterBlock, fn func(*common.CdxResponse) error) error {
+	opts := config.RequestOptions(cc.MaxTimeout, cc.MaxRetries)
+	opts.Headers = map[string]string{"Range": fmt.Sprintf("bytes=%v-%v", block.Offset, block.Offset+block.Length-1)}
+	opts.Expect = []int{http.StatusPartialContent, http.StatusOK}
+
+	data, err := common.GetWithOptions(fmt.Sprintf("%vcc-index/collections/%v/indexes/%v", cc.storage(), index, block.Shard), opts)
+	if err != nil {
+		return config.Errorf("[ReadBlock] Request error: %w", err)
+	}
+	return cc.ParseShard(bytes.NewReader(data), fn)
+}
+
+// FetchSuffix ... Streams records of all hosts under registered-domain suffix from bulk index of the crawl,
+// like all *.gov.br captures, which is impractical through the index server.
+// Config filters (CDX syntax), dates and limit are applied locally, config URL is ignored.
+//
+//	index: crawl ID like "CC-MAIN-2023-14"
+//	suffix: domain suffix like "gov.br" or "gov"
+func (cc *CommonCrawl) FetchSuffix(config common.RequestConfig, index, suffix string, fn func(*common.CdxResponse) error) error {
+	filters, err := common.ParseFilters(config.Filters)
+	if err != nil {
+		return config.Errorf("[FetchSuffix] %w", err)
+	}
+
+	blocks, err := cc.GetClusterBlocks(config, index, suffix)
+	if err != nil {
+		return err
+	}
+
+	// Blocks before the resumed one are done
+	if token := config.ResumeFor(cc.Name()); token != nil && token.Shard != "" {
+		for i, block := range blocks {
+			if block.Shard == token.Shard && block.Offset == token.Offset {
+				blocks = blocks[i:]
+				break
+			}
+		}
+	}
+
+	prefix := SuffixKey(suffix)
+	found := uint(0)
+	for i, block := range blocks {
+		// Records of the last block resume after all blocks, so token points past the end of its shard
+		next := &common.ResumeToken{Source: cc.Name(), URL: config.URL, Index: index, Shard: block.Shard, Offset: block.Offset + block.Length}
+		if i+1 < len(blocks) {
+			next = &common.ResumeToken{Source: cc.Name(), URL: config.URL, Index: index, Shard: blocks[i+1].Shard, Offset: blocks[i+1].Offset}
+		}
+
+		err := cc.ReadBlock(config, index, block, func(res *common.CdxResponse) error {
+			if !matchesSuffix(res.Urlkey, prefix) || !common.MatchAll(res, filters) || !inDateRange(res, config) || !config.MatchRecord(res) {
+				return nil
+			}
+
+			config.AttachRecords([]*common.CdxResponse{res})
+			res.Resume = next
+			if err := fn(res); err != nil {
+				return err
+			}
+
+			found++
+			if config.Limit != 0 && found >= config.Limit {
+				return errLimitReached
+			}
+			return nil
+		})
+
+		if errors.Is(err, errLimitReached) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inDateRange(res *common.CdxResponse, config common.RequestConfig) bool {
+	if config.FromDate.IsZero() && config.ToDate.IsZero() {
+		return true
+	}
+	t, err := res.Time()
+	if err != nil {
+		return false
+	}
+	return !t.Before(config.FromDate) && (config.ToDate.IsZero() || !t.After(config.ToDate))
+}
@@ -0,0 +1,96 @@
+package commoncrawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+const CLUSTER = "br,com,shop)/ 20230320000000\tcdx-00100.gz\t0\t100\t1\n" +
+	"br,gov,camara)/ 20230320000000\tcdx-00100.gz\t100\t100\t2\n" +
+	"br,gov,senado)/ 20230320000000\tcdx-00100.gz\t200\t100\t3\n" +
+	"br,gov-fake)/ 20230320000000\tcdx-00100.gz\t300\t100\t4\n" +
+	"br,org,wiki)/ 20230320000000\tcdx-00100.gz\t400\t100\t5\n"
+
+func TestSuffixKey(t *testing.T) {
+	if got := SuffixKey("*.gov.br"); got != "br,gov" {
+		t.Fatalf("Got %v", got)
+	}
+	if !matchesSuffix("br,gov,camara)/", "br,gov") || !matchesSuffix("br,gov)/", "br,gov") || matchesSuffix("br,governo)/", "br,gov") {
+		t.Fatalf("Incorrect suffix matching")
+	}
+}
+
+func TestFindClusterBlocks(t *testing.T) {
+	blocks, err := findClusterBlocks(strings.NewReader(CLUSTER), "br,gov")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Block of br,com may end with br,gov records, br,gov-fake is filtered later by records
+	if len(blocks) != 4 || blocks[0].Offset != 0 || blocks[3].Offset != 300 {
+		t.Fatalf("Incorrect blocks: %+v", blocks)
+	}
+
+	// Prefix inside a single block
+	blocks, _ = findClusterBlocks(strings.NewReader(CLUSTER), "br,gov,planalto")
+	if len(blocks) != 1 || blocks[0].Offset != 100 {
+		t.Fatalf("Incorrect blocks: %+v", blocks)
+	}
+}
+
+func TestFetchSuffix(t *testing.T) {
+	// Shard of two gzip members, one per block
+	shard, cluster := bytes.Buffer{}, strings.Builder{}
+	for _, host := range []string{"camara", "senado"} {
+		offset := shard.Len()
+		w := gzip.NewWriter(&shard)
+		fmt.Fprintf(w, "br,gov,%v)/ 20230320000000 {\"url\": \"http://%v.gov.br/\", \"status\": \"200\"}\n", host, host)
+		w.Close()
+		fmt.Fprintf(&cluster, "br,gov,%v)/ 20230320000000\tcdx-00100.gz\t%v\t%v\t1\n", host, offset, shard.Len()-offset)
+	}
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/cc-index/collections/CC-MAIN-2023-14/indexes/cluster.idx":
+			w.Write([]byte(cluster.String()))
+		case "/cc-index/collections/CC-MAIN-2023-14/indexes/cdx-00100.gz":
+			// Ranged requests are answered with 206
+			http.ServeContent(w, r, "cdx-00100.gz", time.Time{}, bytes.NewReader(shard.Bytes()))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := &CommonCrawl{MaxTimeout: 5, MaxRetries: 3, Storage: server.URL + "/"}
+	urls := []string{}
+	err := source.FetchSuffix(common.RequestConfig{}, "CC-MAIN-2023-14", "gov.br", func(res *common.CdxResponse) error {
+		urls = append(urls, res.Original)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 2 || urls[0] != "http://camara.gov.br/" || urls[1] != "http://senado.gov.br/" {
+		t.Fatalf("Unexpected records: %v", urls)
+	}
+
+	// Single request is made per block
+	if n := requests["/cc-index/collections/CC-MAIN-2023-14/indexes/cdx-00100.gz"]; n != 2 {
+		t.Fatalf("Expected 2 block requests, made %v", n)
+	}
+}
@@ -0,0 +1,3 @@
+// Package duckdb writes CDX metadata and extracted text of captures into DuckDB database file,
+// which can be queried right after the harvest. It needs cgo and is built only with "duckdb" build tag.
+package duckdb
@@ -0,0 +1,174 @@
+//go:build duckdb
+
+package duckdb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	common "github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/process"
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS captures (
+	urlkey VARCHAR,
+	timestamp VARCHAR,
+	captured TIMESTAMP,
+	url VARCHAR,
+	mime VARCHAR,
+	mime_detected VARCHAR,
+	status INTEGER,
+	digest VARCHAR,
+	length BIGINT,
+	"offset" BIGINT,
+	filename VARCHAR,
+	languages VARCHAR,
+	charset VARCHAR,
+	source VARCHAR,
+	job_id VARCHAR,
+	tags VARCHAR,
+	title VARCHAR,
+	text VARCHAR,
+	fetch_ms BIGINT,
+	fetch_endpoint VARCHAR,
+	fetch_attempts INTEGER,
+	verified VARCHAR
+)`
+
+// Columns added after the first release, so older files get them too
+var migrations = []string{
+	`ALTER TABLE captures ADD COLUMN IF NOT EXISTS fetch_ms BIGINT`,
+	`ALTER TABLE captures ADD COLUMN IF NOT EXISTS fetch_endpoint VARCHAR`,
+	`ALTER TABLE captures ADD COLUMN IF NOT EXISTS fetch_attempts INTEGER`,
+	`ALTER TABLE captures ADD COLUMN IF NOT EXISTS verified VARCHAR`,
+}
+
+const insert = `INSERT INTO captures (
+	urlkey, timestamp, captured, url, mime, mime_detected, status, digest, length, "offset", filename,
+	languages, charset, source, job_id, tags, title, text, fetch_ms, fetch_endpoint, fetch_attempts, verified
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Sink writes records into "captures" table of DuckDB file, safe for concurrent use.
+// Rows are appended, so several harvests can share one file.
+type Sink struct {
+	Path string
+
+	mu     sync.Mutex
+	db     *sql.DB
+	insert *sql.Stmt
+	failed int // Captures processor could not insert
+}
+
+// New ... Opens or creates DuckDB file with "captures" table
+func New(path string) (*Sink, error) {
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		return nil, fmt.Errorf("[DuckDB] Cannot open '%v': %w", path, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[DuckDB] Cannot create table: %w", err)
+	}
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("[DuckDB] Cannot migrate table: %w", err)
+		}
+	}
+	stmt, err := db.Prepare(insert)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[DuckDB] Cannot prepare insert: %w", err)
+	}
+	return &Sink{Path: path, db: db, insert: stmt}, nil
+}
+
+// Missing or malformed numbers are stored as NULL
+func nullInt(s string) sql.NullInt64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return sql.NullInt64{Int64: n, Valid: err == nil}
+}
+
+func (s *Sink) write(res *common.CdxResponse, title, text string) error {
+	captured := sql.NullTime{}
+	if t, err := res.Time(); err == nil {
+		captured = sql.NullTime{Time: t, Valid: true}
+	}
+	source, jobID := "", ""
+	if res.Source != nil {
+		source = res.Source.Name()
+	}
+	if res.Config != nil {
+		jobID = res.Config.JobID
+	}
+	// Records which were not downloaded have no fetch columns
+	var latency, attempts sql.NullInt64
+	var endpoint, verified sql.NullString
+	if res.Fetch != nil {
+		latency = sql.NullInt64{Int64: res.Fetch.LatencyMs, Valid: true}
+		attempts = sql.NullInt64{Int64: int64(res.Fetch.Attempts), Valid: true}
+		endpoint = sql.NullString{String: res.Fetch.Endpoint, Valid: true}
+		verified = sql.NullString{String: res.Fetch.Verified, Valid: true}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.insert.Exec(
+		res.Urlkey, res.Timestamp, captured, res.Original, res.MimeType, res.MimeDetected,
+		nullInt(res.StatusCode), res.Digest, nullInt(res.Length), nullInt(res.Offset), res.Filename,
+		res.Languages, res.Charset, source, jobID, common.FormatTags(res.Tags()), title, text,
+		latency, endpoint, attempts, verified,
+	)
+	if err != nil {
+		return fmt.Errorf("[DuckDB] Cannot insert '%v': %w", res.Original, err)
+	}
+	return nil
+}
+
+// WriteRecords ... Inserts CDX metadata of records, their text columns are empty
+func (s *Sink) WriteRecords(records []*common.CdxResponse) error {
+	for _, res := range records {
+		if err := s.write(res, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Processor ... Returns processor which inserts metadata with title and text of downloaded captures,
+// payload is passed unchanged. Can be used as Downloader.Process.
+// Failed insert does not fail the capture, it is logged and counted by Failed.
+func (s *Sink) Processor() func(*common.CdxResponse, []byte) ([]byte, error) {
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		title, text := process.ExtractText(res, data)
+		if err := s.write(res, title, text); err != nil {
+			log.Printf("%v, capture is kept", err)
+			s.mu.Lock()
+			s.failed++
+			s.mu.Unlock()
+		}
+		return data, nil
+	}
+}
+
+// Failed ... Returns number of captures processor could not insert
+func (s *Sink) Failed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed
+}
+
+// Close ... Flushes and closes database file
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert.Close()
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("[DuckDB] Cannot close '%v': %w", s.Path, err)
+	}
+	return nil
+}
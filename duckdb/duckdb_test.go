@@ -0,0 +1,84 @@
+//go:build duckdb
+
+package duckdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captures.duckdb")
+	sink, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &common.RequestConfig{JobID: "job1", Tags: map[string]string{"case": "17"}}
+	page := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20200101120000", MimeType: "text/html", StatusCode: "200", Length: "120", Config: config}
+	page.Fetch = &common.FetchInfo{LatencyMs: 350, Endpoint: "web.archive.org", Attempts: 2, Verified: common.VerifyOK}
+	image := &common.CdxResponse{Original: "http://example.com/a.png", Timestamp: "2020", MimeType: "image/png", StatusCode: "-"}
+
+	if err := sink.WriteRecords([]*common.CdxResponse{image}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("<html><head><title>Example</title></head><body><p>Hello <b>world</b></p></body></html>")
+	if out, err := sink.Processor()(page, data); err != nil || string(out) != string(data) {
+		t.Fatalf("Processor changed payload or failed: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened file keeps rows
+	sink, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	var count int
+	if err := sink.db.QueryRow("SELECT count(*) FROM captures WHERE status IS NULL AND captured IS NULL").Scan(&count); err != nil || count != 1 {
+		t.Fatalf("Expected image row with NULL status and time, got %v: %v", count, err)
+	}
+
+	var title, text, jobID, tags string
+	var status, length int
+	row := sink.db.QueryRow("SELECT title, text, job_id, tags, status, length FROM captures WHERE url = 'http://example.com/' AND year(captured) = 2020")
+	if err := row.Scan(&title, &text, &jobID, &tags, &status, &length); err != nil {
+		t.Fatal(err)
+	}
+	if title != "Example" || text != "Example Hello world" || jobID != "job1" || tags != "case=17" || status != 200 || length != 120 {
+		t.Fatalf("Unexpected row: %q %q %q %q %v %v", title, text, jobID, tags, status, length)
+	}
+
+	var latency, attempts int
+	var endpoint, verified string
+	row = sink.db.QueryRow("SELECT fetch_ms, fetch_endpoint, fetch_attempts, verified FROM captures WHERE url = 'http://example.com/'")
+	if err := row.Scan(&latency, &endpoint, &attempts, &verified); err != nil {
+		t.Fatal(err)
+	}
+	if latency != 350 || endpoint != "web.archive.org" || attempts != 2 || verified != common.VerifyOK {
+		t.Fatalf("Unexpected fetch columns: %v %q %v %q", latency, endpoint, attempts, verified)
+	}
+}
+
+func TestSinkInsertFailure(t *testing.T) {
+	sink, err := New(filepath.Join(t.TempDir(), "captures.duckdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// Capture is kept when its row cannot be inserted
+	data := []byte("<html></html>")
+	page := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20200101120000", MimeType: "text/html"}
+	if out, err := sink.Processor()(page, data); err != nil || string(out) != string(data) {
+		t.Fatalf("Processor should pass payload on insert failure: %v", err)
+	}
+	if sink.Failed() != 1 {
+		t.Fatalf("Expected 1 failed insert, got %v", sink.Failed())
+	}
+}
@@ -0,0 +1,275 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// Kinds of page assets
+const (
+	AssetStylesheet = "stylesheet"
+	AssetScript     = "script"
+	AssetImage      = "image"
+	AssetFrame      = "frame"
+	AssetMedia      = "media"
+	AssetIcon       = "icon"
+)
+
+// Asset page depends on
+type Asset struct {
+	URL     string              `json:"url"`
+	Kind    string              `json:"kind"`
+	Capture *common.CdxResponse `json:"capture,omitempty"` // Closest capture of the asset, nil if not archived
+}
+
+// AssetGraph of a single HTML capture
+type AssetGraph struct {
+	Page      string  `json:"page"`
+	Timestamp string  `json:"timestamp"`
+	Assets    []Asset `json:"assets"`
+}
+
+// Missing ... Returns assets which have no captures
+func (g *AssetGraph) Missing() []Asset {
+	missing := []Asset{}
+	for _, a := range g.Assets {
+		if a.Capture == nil {
+			missing = append(missing, a)
+		}
+	}
+	return missing
+}
+
+// ExtractAssets ... Finds CSS, JS, image, frame and media references of HTML document
+func ExtractAssets(doc []byte, base *url.URL) ([]Asset, error) {
+	assets := []Asset{}
+	seen := map[string]bool{}
+
+	add := func(kind, val string) {
+		link, err := base.Parse(strings.TrimSpace(val))
+		if err != nil || val == "" || (link.Scheme != "http" && link.Scheme != "https") {
+			return
+		}
+		link.Fragment = ""
+		if seen[link.String()] {
+			return
+		}
+		seen[link.String()] = true
+		assets = append(assets, Asset{URL: link.String(), Kind: kind})
+	}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if tokenizer.Err() == io.EOF {
+				return assets, nil
+			}
+			return assets, fmt.Errorf("[ExtractAssets] Cannot parse HTML: %w", tokenizer.Err())
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		attrs := map[string]string{}
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+
+		switch token.Data {
+		case "link":
+			rel := strings.ToLower(attrs["rel"])
+			if strings.Contains(rel, "stylesheet") {
+				add(AssetStylesheet, attrs["href"])
+			} else if strings.Contains(rel, "icon") {
+				add(AssetIcon, attrs["href"])
+			}
+		case "script":
+			add(AssetScript, attrs["src"])
+		case "img":
+			add(AssetImage, attrs["src"])
+			for _, src := range parseSrcset(attrs["srcset"]) {
+				add(AssetImage, src)
+			}
+		case "iframe", "frame":
+			add(AssetFrame, attrs["src"])
+		case "video", "audio", "source", "track", "embed":
+			add(AssetMedia, attrs["src"])
+			add(AssetImage, attrs["poster"])
+		}
+	}
+}
+
+// URLs of the srcset attribute like "a.png 1x, b.png 2x"
+func parseSrcset(srcset string) []string {
+	urls := []string{}
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// CaptureIndex finds captures of URLs, ignoring scheme and "www." differences
+type CaptureIndex struct {
+	byURL map[string][]*common.CdxResponse
+}
+
+func NewCaptureIndex(records []*common.CdxResponse) *CaptureIndex {
+	index := &CaptureIndex{byURL: map[string][]*common.CdxResponse{}}
+	for _, r := range records {
+		index.Add(r)
+	}
+	return index
+}
+
+func (ci *CaptureIndex) Add(res *common.CdxResponse) {
+	key := captureKey(res.Original)
+	ci.byURL[key] = append(ci.byURL[key], res)
+}
+
+// Closest ... Returns capture of URL with the closest timestamp, nil if there is none
+func (ci *CaptureIndex) Closest(rawURL, timestamp string) *common.CdxResponse {
+	target, _ := strconv.ParseInt(timestamp, 10, 64)
+
+	var closest *common.CdxResponse
+	var closestDiff int64
+	for _, r := range ci.byURL[captureKey(rawURL)] {
+		ts, _ := strconv.ParseInt(r.Timestamp, 10, 64)
+		diff := ts - target
+		if diff < 0 {
+			diff = -diff
+		}
+		if closest == nil || diff < closestDiff {
+			closest, closestDiff = r, diff
+		}
+	}
+	return closest
+}
+
+func captureKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	key := host + u.EscapedPath()
+	if u.Path == "" {
+		key += "/"
+	}
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+// BuildAssetGraph ... Extracts assets of HTML capture and resolves them to the closest known captures
+func BuildAssetGraph(res *common.CdxResponse, data []byte, index *CaptureIndex) (*AssetGraph, error) {
+	page, err := url.Parse(res.Original)
+	if err != nil {
+		return nil, fmt.Errorf("[BuildAssetGraph] Cannot parse URL '%v': %w", res.Original, err)
+	}
+
+	assets, err := ExtractAssets(data, page)
+	if err != nil {
+		return nil, fmt.Errorf("[BuildAssetGraph] %w", err)
+	}
+
+	if index != nil {
+		for i := range assets {
+			assets[i].Capture = index.Closest(assets[i].URL, res.Timestamp)
+		}
+	}
+
+	return &AssetGraph{Page: res.Original, Timestamp: res.Timestamp, Assets: assets}, nil
+}
+
+// AssetGraphs collects asset graphs of harvested HTML captures, which are resolved to the closest
+// captures of the same harvest once it is done. Safe for concurrent use.
+type AssetGraphs struct {
+	mu     sync.Mutex
+	index  *CaptureIndex
+	graphs []*AssetGraph
+}
+
+func NewAssetGraphs() *AssetGraphs {
+	return &AssetGraphs{index: NewCaptureIndex(nil)}
+}
+
+// Add ... Indexes the capture, assets of HTML one are extracted
+func (g *AssetGraphs) Add(res *common.CdxResponse, data []byte) error {
+	var graph *AssetGraph
+	if IsHTML(res) {
+		var err error
+		if graph, err = BuildAssetGraph(res, common.HTTPBody(data), nil); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.index.Add(res)
+	if graph != nil {
+		g.graphs = append(g.graphs, graph)
+	}
+	return nil
+}
+
+// Processor ... Returns processor adding captures into graphs, payload is passed unchanged.
+// Can be used as Downloader.Process.
+func (g *AssetGraphs) Processor() func(*common.CdxResponse, []byte) ([]byte, error) {
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		return data, g.Add(res, data)
+	}
+}
+
+// Graphs ... Returns graphs sorted by page and timestamp, with assets resolved to the closest captures added
+func (g *AssetGraphs) Graphs() []*AssetGraph {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graphs := make([]*AssetGraph, len(g.graphs))
+	for i, graph := range g.graphs {
+		resolved := &AssetGraph{Page: graph.Page, Timestamp: graph.Timestamp, Assets: make([]Asset, len(graph.Assets))}
+		for j, asset := range graph.Assets {
+			asset.Capture = g.index.Closest(asset.URL, graph.Timestamp)
+			resolved.Assets[j] = asset
+		}
+		graphs[i] = resolved
+	}
+	sort.SliceStable(graphs, func(i, j int) bool {
+		if graphs[i].Page != graphs[j].Page {
+			return graphs[i].Page < graphs[j].Page
+		}
+		return graphs[i].Timestamp < graphs[j].Timestamp
+	})
+	return graphs
+}
+
+// WriteNDJSON ... Writes graphs as NDJSON, one page capture per line
+func (g *AssetGraphs) WriteNDJSON(w io.Writer) error {
+	for _, graph := range g.Graphs() {
+		line, err := jsoniter.Marshal(graph)
+		if err != nil {
+			return fmt.Errorf("[AssetGraphs] %w", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("[AssetGraphs] %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package process
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestBuildAssetGraph(t *testing.T) {
+	doc := `<html><head><link rel="stylesheet" href="/css/main.css"><script src="app.js"></script></head>
+<body><img src="logo.png" srcset="logo.png 1x, logo@2x.png 2x"><iframe src="https://ads.com/frame"></iframe></body></html>`
+
+	index := NewCaptureIndex([]*common.CdxResponse{
+		{Original: "https://www.example.com/css/main.css", Timestamp: "20200101000000"},
+		{Original: "http://example.com/css/main.css", Timestamp: "20150101000000"},
+		{Original: "http://example.com/app.js", Timestamp: "20150101000000"},
+	})
+
+	res := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20190601000000", MimeType: "text/html"}
+	graph, err := BuildAssetGraph(res, []byte(doc), index)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(graph.Assets) != 5 {
+		t.Fatalf("Incorrect number of assets: %+v", graph.Assets)
+	}
+
+	css := graph.Assets[0]
+	if css.Kind != AssetStylesheet || css.Capture == nil || css.Capture.Timestamp != "20200101000000" {
+		t.Fatalf("Stylesheet resolved to wrong capture: %+v", css)
+	}
+
+	if missing := graph.Missing(); len(missing) != 3 {
+		t.Fatalf("Incorrect missing assets: %+v", missing)
+	}
+}
+
+func TestAssetGraphs(t *testing.T) {
+	graphs := NewAssetGraphs()
+	page := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20190601000000", MimeType: "text/html"}
+	graphs.Add(page, []byte(`<html><head><link rel="stylesheet" href="/main.css"><script src="/app.js"></script></head></html>`))
+	// Asset captured after the page is still resolved
+	graphs.Add(&common.CdxResponse{Original: "https://www.example.com/main.css", Timestamp: "20190602000000", MimeType: "text/css"}, []byte("p{}"))
+
+	buf := bytes.Buffer{}
+	if err := graphs.WriteNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"page":"http://example.com/"`) {
+		t.Fatalf("Expected single graph of HTML page: %v", buf.String())
+	}
+
+	graph := graphs.Graphs()[0]
+	if len(graph.Assets) != 2 || graph.Assets[0].Capture == nil || graph.Assets[0].Capture.Timestamp != "20190602000000" || graph.Assets[1].Capture != nil {
+		t.Fatalf("Unexpected assets: %+v", graph.Assets)
+	}
+}
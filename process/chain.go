@@ -0,0 +1,19 @@
+package process
+
+import common "github.com/karust/gogetcrawl/common"
+
+// Chain ... Combines processors to run one after another, nil processors are skipped
+func Chain(processors ...func(*common.CdxResponse, []byte) ([]byte, error)) func(*common.CdxResponse, []byte) ([]byte, error) {
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		var err error
+		for _, p := range processors {
+			if p == nil {
+				continue
+			}
+			if data, err = p(res, data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+}
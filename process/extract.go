@@ -0,0 +1,152 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	jsoniter "github.com/json-iterator/go"
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// FieldSelector extracts named field of HTML captures by CSS selector or XPath expression.
+// Value is text of matched elements with collapsed whitespace, or their attribute if it is set.
+type FieldSelector struct {
+	Name  string
+	Query string
+	XPath bool
+	Attr  string
+
+	css  cascadia.SelectorGroup
+	expr *xpath.Expr
+}
+
+// ParseFieldSelector ... Parses field given as name=css:selector or name=xpath:expression, "css:" may be omitted.
+// Attribute of CSS matches is taken with "@attr" suffix, XPath can select attributes itself.
+//
+//	ex: "price=css:span.price", "title=h1, h2", "link=a.more@href", "author=xpath://meta[@name='author']/@content"
+func ParseFieldSelector(s string) (*FieldSelector, error) {
+	name, query, found := strings.Cut(s, "=")
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+	if !found || name == "" || query == "" {
+		return nil, fmt.Errorf("[ParseFieldSelector] Field must look like name=selector, got '%v'", s)
+	}
+
+	f := &FieldSelector{Name: name}
+	if expr, ok := strings.CutPrefix(query, "xpath:"); ok {
+		compiled, err := xpath.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("[ParseFieldSelector] Bad XPath '%v': %w", expr, err)
+		}
+		f.Query, f.XPath, f.expr = expr, true, compiled
+		return f, nil
+	}
+
+	query = strings.TrimPrefix(query, "css:")
+	if i := strings.LastIndex(query, "@"); i > 0 && !strings.ContainsAny(query[i:], "]) ") {
+		query, f.Attr = query[:i], query[i+1:]
+	}
+	// Group of selectors, like "h1, h2", matches elements of any of them
+	sel, err := cascadia.ParseGroup(query)
+	if err != nil {
+		return nil, fmt.Errorf("[ParseFieldSelector] Bad CSS selector '%v': %w", query, err)
+	}
+	f.Query, f.css = query, sel
+	return f, nil
+}
+
+// Returns values of matched elements in document order
+func (f *FieldSelector) extract(doc *html.Node) []string {
+	var nodes []*html.Node
+	if f.XPath {
+		nodes = htmlquery.QuerySelectorAll(doc, f.expr)
+	} else {
+		nodes = cascadia.QueryAll(doc, f.css)
+	}
+
+	values := []string{}
+	for _, node := range nodes {
+		var value string
+		if f.Attr != "" {
+			for _, attr := range node.Attr {
+				if attr.Key == f.Attr {
+					value = attr.Val
+				}
+			}
+		} else {
+			value = htmlquery.InnerText(node)
+		}
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ExtractedRow is a structured row of fields extracted from capture
+type ExtractedRow struct {
+	URL       string              `json:"url"`
+	Timestamp string              `json:"timestamp"`
+	Digest    string              `json:"digest,omitempty"`
+	Fields    map[string][]string `json:"fields"` // Values by field name, empty if nothing matched
+}
+
+// ExtractFields ... Extracts fields of HTML capture, nil for other types
+func ExtractFields(res *common.CdxResponse, data []byte, fields []*FieldSelector) (*ExtractedRow, error) {
+	if !IsHTML(res) {
+		return nil, nil
+	}
+
+	doc, err := html.Parse(bytes.NewReader(common.HTTPBody(data)))
+	if err != nil {
+		return nil, fmt.Errorf("[ExtractFields] Cannot parse HTML: %w", err)
+	}
+
+	row := &ExtractedRow{URL: res.Original, Timestamp: res.Timestamp, Digest: res.Digest, Fields: map[string][]string{}}
+	for _, f := range fields {
+		values := f.extract(doc)
+		if prev, ok := row.Fields[f.Name]; ok {
+			values = append(prev, values...)
+		}
+		row.Fields[f.Name] = values
+	}
+	return row, nil
+}
+
+// NewFieldExtractor ... Returns processor which writes fields of HTML captures to writer as newline-delimited JSON,
+// payload is passed unchanged. Captures without any matched field are skipped. Can be used as Downloader.Process.
+func NewFieldExtractor(w io.Writer, fields []*FieldSelector) func(*common.CdxResponse, []byte) ([]byte, error) {
+	mu := sync.Mutex{}
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		row, err := ExtractFields(res, data, fields)
+		if err != nil || row == nil {
+			return data, err
+		}
+
+		matched := false
+		for _, values := range row.Fields {
+			matched = matched || len(values) > 0
+		}
+		if !matched {
+			return data, nil
+		}
+
+		line, err := jsoniter.Marshal(row)
+		if err != nil {
+			return data, fmt.Errorf("[FieldExtractor] Cannot encode row: %w", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return data, fmt.Errorf("[FieldExtractor] Cannot write row: %w", err)
+		}
+		return data, nil
+	}
+}
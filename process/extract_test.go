@@ -0,0 +1,83 @@
+package process
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	common "github.com/karust/gogetcrawl/common"
+)
+
+const productPage = `<html><head><meta name="author" content="Shop"></head><body>
+<article><h1> Blue
+ kettle </h1><span class="price">$25</span><span class="price">$20</span>
+<a class="more" href="/kettles">More</a></article></body></html>`
+
+func TestExtractFields(t *testing.T) {
+	fields := []*FieldSelector{}
+	for _, s := range []string{"title=css:article h1", "price=span.price", "link=a.more@href", "author=xpath://meta[@name='author']/@content", "missing=xpath://table"} {
+		f, err := ParseFieldSelector(s)
+		if err != nil {
+			t.Fatalf("%v: %v", s, err)
+		}
+		fields = append(fields, f)
+	}
+
+	res := &common.CdxResponse{Original: "http://shop.example/kettle", Timestamp: "20230101000000", MimeType: "text/html"}
+	row, err := ExtractFields(res, []byte(productPage), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"title": {"Blue kettle"}, "price": {"$25", "$20"}, "link": {"/kettles"}, "author": {"Shop"}, "missing": {}}
+	if !reflect.DeepEqual(row.Fields, want) {
+		t.Fatalf("Unexpected fields: %v", row.Fields)
+	}
+
+	if row, _ := ExtractFields(&common.CdxResponse{MimeType: "image/png"}, []byte("png"), fields); row != nil {
+		t.Fatalf("Non-HTML capture should have no row: %v", row)
+	}
+
+	// Commas inside selectors, as --extract values are not split
+	for s, want := range map[string][]string{
+		"heading=h1, span.price": {"Blue kettle", "$25", "$20"},
+		`link=xpath://a[contains(concat(" ", @class, " "), " more ")]/@href`: {"/kettles"},
+	} {
+		f, err := ParseFieldSelector(s)
+		if err != nil {
+			t.Fatalf("%v: %v", s, err)
+		}
+		row, _ := ExtractFields(res, []byte(productPage), []*FieldSelector{f})
+		if !reflect.DeepEqual(row.Fields[f.Name], want) {
+			t.Fatalf("Unexpected values of %v: %v", s, row.Fields[f.Name])
+		}
+	}
+
+	for _, bad := range []string{"price", "=span", "price=css:span[", "price=xpath://span["} {
+		if _, err := ParseFieldSelector(bad); err == nil {
+			t.Fatalf("Expected error for '%v'", bad)
+		}
+	}
+}
+
+func TestFieldExtractor(t *testing.T) {
+	price, _ := ParseFieldSelector("price=.price")
+	out := bytes.Buffer{}
+	extract := NewFieldExtractor(&out, []*FieldSelector{price})
+
+	page := &common.CdxResponse{Original: "http://shop.example/kettle", MimeType: "text/html"}
+	if data, err := extract(page, []byte(productPage)); err != nil || string(data) != productPage {
+		t.Fatalf("Payload should be passed unchanged: %v", err)
+	}
+	extract(page, []byte("<html><body>No prices</body></html>"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected single row, got %q", out.String())
+	}
+	row := ExtractedRow{}
+	if err := jsoniter.Unmarshal([]byte(lines[0]), &row); err != nil || len(row.Fields["price"]) != 2 {
+		t.Fatalf("Unexpected row: %v, %v", lines[0], err)
+	}
+}
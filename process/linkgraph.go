@@ -0,0 +1,255 @@
+package process
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// ExtractPageLinks ... Returns unique absolute http(s) targets of <a> and <area> links of HTML document, without fragments
+func ExtractPageLinks(doc []byte, base *url.URL) []string {
+	links := []string{}
+	seen := map[string]bool{}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" && token.Data != "area" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				link, err := base.Parse(strings.TrimSpace(attr.Val))
+				if err != nil || attr.Val == "" || (link.Scheme != "http" && link.Scheme != "https") {
+					continue
+				}
+				link.Fragment = ""
+				if target := link.String(); !seen[target] {
+					seen[target] = true
+					links = append(links, target)
+				}
+			}
+		}
+	}
+}
+
+// LinkNode is a page of the link graph, linked pages which were not harvested are not captured
+type LinkNode struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Host      string `json:"host"`
+	Captured  bool   `json:"captured"`
+	Timestamp string `json:"timestamp,omitempty"` // Earliest harvested capture
+}
+
+// LinkEdge is a link between pages, counted once per capture of the source page
+type LinkEdge struct {
+	Source string `json:"source"` // Node IDs
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
+
+// LinkGraph collects hyperlinks of harvested HTML captures, safe for concurrent use
+type LinkGraph struct {
+	mu       sync.Mutex
+	captured map[string]string // Earliest capture timestamp of harvested pages
+	links    map[[2]string]int
+}
+
+func NewLinkGraph() *LinkGraph {
+	return &LinkGraph{captured: map[string]string{}, links: map[[2]string]int{}}
+}
+
+// Add ... Adds links of HTML capture into graph, other captures are skipped
+func (g *LinkGraph) Add(res *common.CdxResponse, data []byte) error {
+	if !IsHTML(res) {
+		return nil
+	}
+	page, err := url.Parse(res.Original)
+	if err != nil {
+		return fmt.Errorf("[LinkGraph] Cannot parse URL '%v': %w", res.Original, err)
+	}
+	page.Fragment = ""
+	links := ExtractPageLinks(common.HTTPBody(data), page)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	from := page.String()
+	if ts, ok := g.captured[from]; !ok || res.Timestamp < ts {
+		g.captured[from] = res.Timestamp
+	}
+	for _, to := range links {
+		g.links[[2]string{from, to}]++
+	}
+	return nil
+}
+
+// Processor ... Returns processor adding links of captures into graph, payload is passed unchanged.
+// Can be used as Downloader.Process.
+func (g *LinkGraph) Processor() func(*common.CdxResponse, []byte) ([]byte, error) {
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		return data, g.Add(res, data)
+	}
+}
+
+// Graph ... Returns nodes sorted by URL and edges sorted by their node IDs, IDs are stable for the same graph
+func (g *LinkGraph) Graph() ([]LinkNode, []LinkEdge) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	urls := map[string]bool{}
+	for u := range g.captured {
+		urls[u] = true
+	}
+	for link := range g.links {
+		urls[link[0]], urls[link[1]] = true, true
+	}
+	sorted := make([]string, 0, len(urls))
+	for u := range urls {
+		sorted = append(sorted, u)
+	}
+	sort.Strings(sorted)
+
+	nodes := make([]LinkNode, len(sorted))
+	ids := map[string]int{}
+	for i, u := range sorted {
+		ids[u] = i
+		nodes[i] = LinkNode{ID: "n" + strconv.Itoa(i), URL: u}
+		if parsed, err := url.Parse(u); err == nil {
+			nodes[i].Host = strings.ToLower(parsed.Hostname())
+		}
+		nodes[i].Timestamp, nodes[i].Captured = g.captured[u]
+	}
+
+	type indexedEdge struct{ from, to, count int }
+	indexed := make([]indexedEdge, 0, len(g.links))
+	for link, count := range g.links {
+		indexed = append(indexed, indexedEdge{ids[link[0]], ids[link[1]], count})
+	}
+	sort.Slice(indexed, func(i, j int) bool {
+		if indexed[i].from != indexed[j].from {
+			return indexed[i].from < indexed[j].from
+		}
+		return indexed[i].to < indexed[j].to
+	})
+
+	edges := make([]LinkEdge, len(indexed))
+	for i, e := range indexed {
+		edges[i] = LinkEdge{Source: nodes[e.from].ID, Target: nodes[e.to].ID, Count: e.count}
+	}
+	return nodes, edges
+}
+
+// GraphML structure
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// WriteGraphML ... Writes graph as directed GraphML with url, host, captured and timestamp of nodes and count of edges
+func (g *LinkGraph) WriteGraphML(w io.Writer) error {
+	nodes, edges := g.Graph()
+
+	doc := graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Keys = []graphMLKey{
+		{ID: "url", For: "node", Name: "url", Type: "string"},
+		{ID: "host", For: "node", Name: "host", Type: "string"},
+		{ID: "captured", For: "node", Name: "captured", Type: "boolean"},
+		{ID: "timestamp", For: "node", Name: "timestamp", Type: "string"},
+		{ID: "count", For: "edge", Name: "count", Type: "int"},
+	}
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range nodes {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{{"url", n.URL}, {"host", n.Host}, {"captured", strconv.FormatBool(n.Captured)}}}
+		if n.Timestamp != "" {
+			node.Data = append(node.Data, graphMLData{"timestamp", n.Timestamp})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.Source, Target: e.Target, Data: []graphMLData{{"count", strconv.Itoa(e.Count)}}})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("[WriteGraphML] Cannot write graph: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("[WriteGraphML] Cannot write graph: %w", err)
+	}
+	return nil
+}
+
+// WriteNeo4jCSV ... Writes nodes and relationships CSV files in neo4j-admin import format:
+//
+//	neo4j-admin database import full --nodes=Page=nodes.csv --relationships=LINKS_TO=relationships.csv
+func (g *LinkGraph) WriteNeo4jCSV(nodesW, relationshipsW io.Writer) error {
+	nodes, edges := g.Graph()
+
+	cw := csv.NewWriter(nodesW)
+	cw.Write([]string{"id:ID", "url", "host", "captured:boolean", "timestamp"})
+	for _, n := range nodes {
+		cw.Write([]string{n.ID, n.URL, n.Host, strconv.FormatBool(n.Captured), n.Timestamp})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("[WriteNeo4jCSV] Cannot write nodes: %w", err)
+	}
+
+	cw = csv.NewWriter(relationshipsW)
+	cw.Write([]string{":START_ID", ":END_ID", "count:int"})
+	for _, e := range edges {
+		cw.Write([]string{e.Source, e.Target, strconv.Itoa(e.Count)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("[WriteNeo4jCSV] Cannot write relationships: %w", err)
+	}
+	return nil
+}
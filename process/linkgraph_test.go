@@ -0,0 +1,65 @@
+package process
+
+import (
+	"bytes"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestExtractPageLinks(t *testing.T) {
+	base, _ := url.Parse("http://example.com/docs/")
+	doc := `<a href="intro.html#top">Intro</a><a href="intro.html">Again</a><area href="/map">` +
+		`<a href="mailto:me@example.com">Mail</a><link href="style.css"><a href="https://other.org/">Other</a>`
+
+	want := []string{"http://example.com/docs/intro.html", "http://example.com/map", "https://other.org/"}
+	if links := ExtractPageLinks([]byte(doc), base); !reflect.DeepEqual(links, want) {
+		t.Fatalf("Unexpected links: %v", links)
+	}
+}
+
+func TestLinkGraph(t *testing.T) {
+	graph := NewLinkGraph()
+	process := graph.Processor()
+
+	home := []byte(`<a href="/about">About</a><a href="https://other.org/">Other</a>`)
+	process(&common.CdxResponse{Original: "http://example.com/", Timestamp: "20210101000000", MimeType: "text/html"}, home)
+	process(&common.CdxResponse{Original: "http://example.com/", Timestamp: "20200101000000", MimeType: "text/html"}, home)
+	process(&common.CdxResponse{Original: "http://example.com/about", Timestamp: "20200101000000", MimeType: "text/html"}, []byte(`<a href="/">Home</a>`))
+	process(&common.CdxResponse{Original: "http://example.com/logo.png", MimeType: "image/png"}, []byte(`<a href="/x">`))
+
+	nodes, edges := graph.Graph()
+	wantNodes := []LinkNode{
+		{ID: "n0", URL: "http://example.com/", Host: "example.com", Captured: true, Timestamp: "20200101000000"},
+		{ID: "n1", URL: "http://example.com/about", Host: "example.com", Captured: true, Timestamp: "20200101000000"},
+		{ID: "n2", URL: "https://other.org/", Host: "other.org"},
+	}
+	wantEdges := []LinkEdge{{"n0", "n1", 2}, {"n0", "n2", 2}, {"n1", "n0", 1}}
+	if !reflect.DeepEqual(nodes, wantNodes) || !reflect.DeepEqual(edges, wantEdges) {
+		t.Fatalf("Unexpected graph:\n%+v\n%+v", nodes, edges)
+	}
+
+	graphML := bytes.Buffer{}
+	if err := graph.WriteGraphML(&graphML); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{`<graph edgedefault="directed">`, `<data key="url">https://other.org/</data>`, `<edge source="n1" target="n0">`} {
+		if !strings.Contains(graphML.String(), part) {
+			t.Fatalf("GraphML has no %v:\n%v", part, graphML.String())
+		}
+	}
+
+	nodesCSV, relsCSV := bytes.Buffer{}, bytes.Buffer{}
+	if err := graph.WriteNeo4jCSV(&nodesCSV, &relsCSV); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(nodesCSV.String(), "id:ID,url,host,captured:boolean,timestamp\nn0,http://example.com/,example.com,true,20200101000000\n") {
+		t.Fatalf("Unexpected nodes:\n%v", nodesCSV.String())
+	}
+	if relsCSV.String() != ":START_ID,:END_ID,count:int\nn0,n1,2\nn0,n2,2\nn1,n0,1\n" {
+		t.Fatalf("Unexpected relationships:\n%v", relsCSV.String())
+	}
+}
@@ -0,0 +1,192 @@
+// Package process contains processors and analyzers of downloaded captures
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	common "github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/wayback"
+	"golang.org/x/net/html"
+)
+
+// Link rewriting modes
+const (
+	RewriteLocal  = "local"  // Internal links point to relative paths of mirrored files
+	RewriteReplay = "replay" // All links point to Wayback replay URLs
+)
+
+// Attributes of tags containing links to pages or assets
+var linkAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"poster":     true,
+	"data":       true,
+	"background": true,
+}
+
+// IsHTML ... Checks if CDX record contains HTML page
+func IsHTML(res *common.CdxResponse) bool {
+	mimeType := strings.ToLower(res.MimeType)
+	return strings.HasPrefix(mimeType, "text/html") || strings.HasPrefix(mimeType, "application/xhtml")
+}
+
+// MirrorPath ... Returns path of the URL in mirror layout, like <host>/<path>.
+// Directory URLs get index.html, query is kept in file name.
+// Files without extension get .html, so "/docs" and "/docs/" are both kept and do not collide as file and directory.
+//
+//	ex: http://example.com/docs/?p=1 -> example.com/docs/index.html?p=1
+//	ex: http://example.com/docs -> example.com/docs.html
+func MirrorPath(u *url.URL) string {
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	} else if !strings.Contains(path.Base(p), ".") {
+		p += ".html"
+	}
+
+	// Clean path from ".." to not escape the host directory
+	p = path.Clean("/" + p)
+
+	if u.RawQuery != "" {
+		p += "?" + strings.ReplaceAll(u.RawQuery, "/", "%2F")
+	}
+	return strings.ToLower(u.Host) + p
+}
+
+// MirrorFileName ... Names files by mirror layout, can be used as Downloader.FileName
+func MirrorFileName(res *common.CdxResponse) (string, error) {
+	u, err := url.Parse(res.Original)
+	if err != nil {
+		return "", fmt.Errorf("[MirrorFileName] Cannot parse URL '%v': %w", res.Original, err)
+	}
+	return MirrorPath(u), nil
+}
+
+// RewriteLinks ... Rewrites link attributes of HTML document.
+// Rewrite function receives absolute link URL and returns new value, empty to keep original.
+func RewriteLinks(doc []byte, base *url.URL, rewrite func(*url.URL) string) ([]byte, error) {
+	out := bytes.Buffer{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(doc))
+
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if tokenizer.Err() == io.EOF {
+				return out.Bytes(), nil
+			}
+			return nil, fmt.Errorf("[RewriteLinks] Cannot parse HTML: %w", tokenizer.Err())
+		}
+
+		raw := tokenizer.Raw()
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+
+		// Raw is reused by tokenizer, so token is taken from its copy
+		rawCopy := append([]byte{}, raw...)
+		token := tokenizer.Token()
+		changed := false
+
+		for i, attr := range token.Attr {
+			if !linkAttrs[attr.Key] || attr.Val == "" {
+				continue
+			}
+			link, err := base.Parse(strings.TrimSpace(attr.Val))
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+				continue
+			}
+			if newVal := rewrite(link); newVal != "" {
+				token.Attr[i].Val = newVal
+				changed = true
+			}
+		}
+
+		if changed {
+			out.WriteString(token.String())
+		} else {
+			out.Write(rawCopy)
+		}
+	}
+}
+
+// LocalRewriter ... Returns rewrite function pointing same host links to relative mirror paths
+func LocalRewriter(page *url.URL) func(*url.URL) string {
+	pageDir := path.Dir(MirrorPath(page))
+
+	return func(link *url.URL) string {
+		if !strings.EqualFold(link.Host, page.Host) {
+			return ""
+		}
+
+		fragment := ""
+		if link.Fragment != "" {
+			fragment = "#" + link.Fragment
+		}
+
+		rel, err := relativePath(pageDir, MirrorPath(link))
+		if err != nil {
+			return ""
+		}
+		return rel + fragment
+	}
+}
+
+// ReplayRewriter ... Returns rewrite function pointing links to Wayback replay of the closest capture
+func ReplayRewriter(timestamp string) func(*url.URL) string {
+	return func(link *url.URL) string {
+		return wayback.ReplayURL(&common.CdxResponse{Timestamp: timestamp, Original: link.String()})
+	}
+}
+
+// NewLinkProcessor ... Creates processor rewriting links of HTML captures, can be used as Downloader.Process
+func NewLinkProcessor(mode string) (func(*common.CdxResponse, []byte) ([]byte, error), error) {
+	if mode != RewriteLocal && mode != RewriteReplay {
+		return nil, fmt.Errorf("[NewLinkProcessor] Unknown rewrite mode: '%v'", mode)
+	}
+
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		if !IsHTML(res) {
+			return data, nil
+		}
+
+		page, err := url.Parse(res.Original)
+		if err != nil {
+			return nil, fmt.Errorf("[LinkProcessor] Cannot parse URL '%v': %w", res.Original, err)
+		}
+
+		if mode == RewriteLocal {
+			return RewriteLinks(data, page, LocalRewriter(page))
+		}
+		return RewriteLinks(data, page, ReplayRewriter(res.Timestamp))
+	}, nil
+}
+
+// Relative path from directory to target, both are slash separated
+func relativePath(fromDir, target string) (string, error) {
+	from := strings.Split(path.Clean(fromDir), "/")
+	to := strings.Split(path.Clean(target), "/")
+
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	if i == 0 {
+		return "", fmt.Errorf("no common root")
+	}
+
+	parts := []string{}
+	for j := i; j < len(from); j++ {
+		parts = append(parts, "..")
+	}
+	for _, part := range to[i:] {
+		parts = append(parts, url.PathEscape(part))
+	}
+	return strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,61 @@
+package process
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+const PAGE = `<html><head><link rel="stylesheet" href="/css/main.css"></head>
+<body><a href="about/">About</a> <a href="https://other.com/x">Other</a> <img src="img/logo.png?v=2"></body></html>`
+
+func TestMirrorPath(t *testing.T) {
+	cases := map[string]string{
+		"http://Example.com":            "example.com/index.html",
+		"http://example.com/docs/":      "example.com/docs/index.html",
+		"http://example.com/docs":       "example.com/docs.html",
+		"http://example.com/a/../b.css": "example.com/b.css",
+		"http://example.com/p?id=1":     "example.com/p.html?id=1",
+	}
+
+	for raw, want := range cases {
+		u, _ := url.Parse(raw)
+		if got := MirrorPath(u); got != want {
+			t.Fatalf("%v: want=%v, got=%v", raw, want, got)
+		}
+	}
+}
+
+func TestRewriteLocal(t *testing.T) {
+	process, _ := NewLinkProcessor(RewriteLocal)
+	res := &common.CdxResponse{Original: "http://example.com/blog/post.html", MimeType: "text/html"}
+
+	out, err := process(res, []byte(PAGE))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	got := string(out)
+	for _, want := range []string{`href="../css/main.css"`, `href="about/index.html"`, `href="https://other.com/x"`, `src="img/logo.png%3Fv=2"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Rewritten page doesn't contain %v: %v", want, got)
+		}
+	}
+}
+
+func TestRewriteReplay(t *testing.T) {
+	process, _ := NewLinkProcessor(RewriteReplay)
+	res := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", MimeType: "text/html"}
+
+	out, err := process(res, []byte(PAGE))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	want := `href="https://web.archive.org/web/20130522121421if_/https://other.com/x"`
+	if !strings.Contains(string(out), want) {
+		t.Fatalf("Rewritten page doesn't contain %v: %s", want, out)
+	}
+}
@@ -0,0 +1,314 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements which are not part of the readable content
+var markdownSkipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Button: true, atom.Select: true,
+}
+
+// Elements which start new block of Markdown
+var markdownBlocks = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Main: true, atom.Header: true, atom.Footer: true, atom.Nav: true, atom.Aside: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Hr: true, atom.Table: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Address: true, atom.Details: true, atom.Summary: true,
+}
+
+var markdownHeadings = map[atom.Atom]int{atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6}
+
+// HTMLToMarkdown ... Converts HTML document into Markdown keeping headings, paragraphs, links, lists, quotes,
+// code and tables. Scripts, styles and other non-readable elements are dropped.
+// Links and images are made absolute against base if it is set.
+func HTMLToMarkdown(doc []byte, base *url.URL) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("[HTMLToMarkdown] Cannot parse HTML: %w", err)
+	}
+
+	c := markdownConverter{base: base}
+	blocks := c.blocks(root)
+	if len(blocks) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(blocks, "\n\n") + "\n"), nil
+}
+
+// MarkdownProcessor ... Converts HTML captures into Markdown, other captures are kept. Can be used as Downloader.Process
+func MarkdownProcessor(res *common.CdxResponse, data []byte) ([]byte, error) {
+	if !IsHTML(res) {
+		return data, nil
+	}
+
+	page, err := url.Parse(res.Original)
+	if err != nil {
+		return nil, fmt.Errorf("[MarkdownProcessor] Cannot parse URL '%v': %w", res.Original, err)
+	}
+	return HTMLToMarkdown(common.HTTPBody(data), page)
+}
+
+// MarkdownFileName ... Wraps file naming to give HTML captures converted by MarkdownProcessor .md extension
+func MarkdownFileName(fileName func(*common.CdxResponse) (string, error)) func(*common.CdxResponse) (string, error) {
+	return func(res *common.CdxResponse) (string, error) {
+		name, err := fileName(res)
+		if err != nil || !IsHTML(res) {
+			return name, err
+		}
+		if ext := strings.ToLower(path.Ext(name)); ext == ".html" || ext == ".htm" {
+			name = name[:len(name)-len(ext)]
+		}
+		return name + ".md", nil
+	}
+}
+
+type markdownConverter struct {
+	base *url.URL
+}
+
+// Converts children of the node into Markdown blocks, inline content between blocks becomes paragraphs
+func (c *markdownConverter) blocks(n *html.Node) []string {
+	blocks := []string{}
+	inline := strings.Builder{}
+	flush := func() {
+		if text := collapseInline(inline.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && (markdownBlocks[child.DataAtom] || markdownSkipped[child.DataAtom]) {
+			flush()
+			blocks = append(blocks, c.block(child)...)
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return blocks
+}
+
+func (c *markdownConverter) block(n *html.Node) []string {
+	if markdownSkipped[n.DataAtom] {
+		return nil
+	}
+	if level, ok := markdownHeadings[n.DataAtom]; ok {
+		if text := collapseInline(c.inlineChildren(n)); text != "" {
+			return []string{strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")}
+		}
+		return nil
+	}
+
+	switch n.DataAtom {
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if code == "" {
+			return nil
+		}
+		return []string{"```\n" + code + "\n```"}
+	case atom.Blockquote:
+		lines := strings.Split(strings.Join(c.blocks(n), "\n\n"), "\n")
+		if len(lines) == 1 && lines[0] == "" {
+			return nil
+		}
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return []string{strings.Join(lines, "\n")}
+	case atom.Hr:
+		return []string{"---"}
+	case atom.Table:
+		return c.table(n)
+	}
+	return c.blocks(n)
+}
+
+func (c *markdownConverter) list(n *html.Node) []string {
+	items := []string{}
+	number := 1
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		// Nested lists and paragraphs of the item are indented under its marker
+		lines := strings.Split(strings.Join(c.blocks(li), "\n"), "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = strings.Repeat(" ", len(marker)) + lines[i]
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+	return []string{strings.Join(items, "\n")}
+}
+
+func (c *markdownConverter) table(n *html.Node) []string {
+	rows := []string{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				walk(child)
+				continue
+			}
+
+			cells := []string{}
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					text := strings.ReplaceAll(collapseInline(c.inlineChildren(cell)), "\n", " ")
+					cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+			// First row is the header
+			if len(rows) == 1 {
+				rows = append(rows, strings.TrimSuffix(strings.Repeat("| --- ", len(cells)), " ")+" |")
+			}
+		}
+	}
+	walk(n)
+
+	if len(rows) == 0 {
+		return nil
+	}
+	return []string{strings.Join(rows, "\n")}
+}
+
+func (c *markdownConverter) inlineChildren(n *html.Node) string {
+	s := strings.Builder{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		s.WriteString(c.inline(child))
+	}
+	return s.String()
+}
+
+func (c *markdownConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return strings.ReplaceAll(n.Data, "\n", " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if markdownSkipped[n.DataAtom] {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.A:
+		text := c.inlineChildren(n)
+		href := c.link(attrValue(n, "href"))
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return "[" + strings.TrimSpace(text) + "](" + href + ")"
+	case atom.Img:
+		src := c.link(attrValue(n, "src"))
+		if src == "" {
+			return ""
+		}
+		return "![" + attrValue(n, "alt") + "](" + src + ")"
+	case atom.Strong, atom.B:
+		return wrapInline("**", c.inlineChildren(n))
+	case atom.Em, atom.I:
+		return wrapInline("*", c.inlineChildren(n))
+	case atom.Code:
+		return wrapInline("`", textContent(n))
+	}
+	// Block elements nested into inline ones are kept inline
+	if markdownBlocks[n.DataAtom] {
+		return " " + c.inlineChildren(n) + " "
+	}
+	return c.inlineChildren(n)
+}
+
+// Resolves link against base, script links are dropped
+func (c *markdownConverter) link(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	if c.base == nil {
+		return href
+	}
+	u, err := c.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return strings.ReplaceAll(u.String(), " ", "%20")
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	s := strings.Builder{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		s.WriteString(textContent(child))
+	}
+	return s.String()
+}
+
+// Wraps text into emphasis marks, surrounding spaces are kept outside of them
+func wrapInline(mark, s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	start := strings.Index(s, trimmed)
+	return s[:start] + mark + trimmed + mark + s[start+len(trimmed):]
+}
+
+// Collapses whitespace of every line, line breaks come from <br> only
+func collapseInline(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := []string{}
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
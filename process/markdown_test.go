@@ -0,0 +1,62 @@
+package process
+
+import (
+	"net/url"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	doc := `<html><head><title>Guide</title><style>p{}</style></head><body>
+<nav><a href="/">Home</a></nav>
+<h1>Getting   started</h1>
+<p>Read the <a href="docs/intro.html">intro</a> and <b>install</b> it:<br>now <code>go get</code></p>
+<script>track()</script>
+<ul><li>One</li><li>Two<ol><li>Nested</li></ol></li></ul>
+<blockquote><p>Quote</p></blockquote>
+<pre>line 1
+  line 2</pre>
+<table><tr><th>Name</th><th>Size</th></tr><tr><td>a|b</td><td>1</td></tr></table>
+<img src="/logo.png" alt="Logo"><a href="javascript:void(0)">Click</a>
+</body></html>`
+
+	want := "[Home](http://example.com/)\n\n" +
+		"# Getting started\n\n" +
+		"Read the [intro](http://example.com/guide/docs/intro.html) and **install** it:\nnow `go get`\n\n" +
+		"- One\n- Two\n  1. Nested\n\n" +
+		"> Quote\n\n" +
+		"```\nline 1\n  line 2\n```\n\n" +
+		"| Name | Size |\n| --- | --- |\n| a\\|b | 1 |\n\n" +
+		"![Logo](http://example.com/logo.png)Click\n"
+
+	base, _ := url.Parse("http://example.com/guide/")
+	md, err := HTMLToMarkdown([]byte(doc), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(md) != want {
+		t.Fatalf("Unexpected Markdown:\n%v\nwant:\n%v", string(md), want)
+	}
+}
+
+func TestMarkdownProcessor(t *testing.T) {
+	page := &common.CdxResponse{Original: "http://example.com/a", MimeType: "text/html"}
+	md, err := MarkdownProcessor(page, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<h2>Title</h2>"))
+	if err != nil || string(md) != "## Title\n" {
+		t.Fatalf("Unexpected result: %q, %v", md, err)
+	}
+
+	image := &common.CdxResponse{MimeType: "image/png"}
+	if data, _ := MarkdownProcessor(image, []byte("png")); string(data) != "png" {
+		t.Fatalf("Non-HTML capture should be kept")
+	}
+
+	name := MarkdownFileName(func(res *common.CdxResponse) (string, error) { return "example.com/a/index.html", nil })
+	if got, _ := name(page); got != "example.com/a/index.md" {
+		t.Fatalf("Unexpected name: %v", got)
+	}
+	if got, _ := name(image); got != "example.com/a/index.html" {
+		t.Fatalf("Name of non-HTML capture should be kept: %v", got)
+	}
+}
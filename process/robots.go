@@ -0,0 +1,72 @@
+package process
+
+import (
+	"bytes"
+	"strings"
+
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// Crawlers whose meta tags are recorded besides generic "robots" one
+var robotsMetaNames = map[string]bool{
+	"robots": true, "googlebot": true, "googlebot-news": true, "bingbot": true, "msnbot": true,
+	"slurp": true, "yandex": true, "baiduspider": true, "ia_archiver": true, "archive.org_bot": true,
+}
+
+// ParseRobots ... Returns directives of robots meta tags and X-Robots-Tag headers of the capture, nil if it has none.
+// Headers are only known when data is full HTTP response, like Common Crawl files.
+func ParseRobots(res *common.CdxResponse, data []byte) *common.RobotsDirectives {
+	robots := &common.RobotsDirectives{}
+	if header, ok := common.ParseHTTPHeaders(data); ok {
+		robots.Header = common.ParseRobotsDirectives("", header.Values("X-Robots-Tag")...)
+	}
+	if IsHTML(res) {
+		robots.Meta = parseRobotsMeta(common.HTTPBody(data))
+	}
+
+	if len(robots.Meta) == 0 && len(robots.Header) == 0 {
+		return nil
+	}
+	return robots
+}
+
+// Reads robots meta tags, which are only allowed in head
+func parseRobotsMeta(doc []byte) []string {
+	directives := []string{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return directives
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "body" {
+				return directives
+			}
+			if token.Data != "meta" {
+				continue
+			}
+
+			var name, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "name":
+					name = strings.ToLower(strings.TrimSpace(attr.Val))
+				case "content":
+					content = attr.Val
+				}
+			}
+			if robotsMetaNames[name] {
+				directives = append(directives, common.ParseRobotsDirectives(name, content)...)
+			}
+		}
+	}
+}
+
+// RobotsProcessor ... Records robots directives of the capture into its Robots field, so outputs like manifest keep them.
+// Payload is passed unchanged. Can be used as Downloader.Process.
+func RobotsProcessor(res *common.CdxResponse, data []byte) ([]byte, error) {
+	res.Robots = ParseRobots(res, data)
+	return data, nil
+}
@@ -0,0 +1,30 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestParseRobots(t *testing.T) {
+	data := []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nX-Robots-Tag: noarchive\r\nX-Robots-Tag: otherbot: noindex\r\n\r\n" +
+		`<html><head><meta name="robots" content="noindex, follow"><meta name="GoogleBot" content="nosnippet"><meta name="description" content="none"></head>` +
+		`<body><meta name="robots" content="nofollow"></body></html>`)
+	res := &common.CdxResponse{MimeType: "text/html"}
+
+	if _, err := RobotsProcessor(res, data); err != nil {
+		t.Fatal(err)
+	}
+	want := &common.RobotsDirectives{Meta: []string{"noindex", "follow", "googlebot: nosnippet"}, Header: []string{"noarchive", "otherbot: noindex"}}
+	if !reflect.DeepEqual(res.Robots, want) {
+		t.Fatalf("Unexpected directives: %+v", res.Robots)
+	}
+
+	if robots := ParseRobots(res, []byte("<html><head><title>Open</title></head></html>")); robots != nil {
+		t.Fatalf("Page without directives should have none: %+v", robots)
+	}
+	if robots := ParseRobots(&common.CdxResponse{MimeType: "application/pdf"}, []byte(`<meta name="robots" content="noindex">`)); robots != nil {
+		t.Fatalf("Meta tags are only read from HTML: %+v", robots)
+	}
+}
@@ -0,0 +1,193 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// Score from which capture is considered soft-404
+const soft404Threshold = 0.5
+
+// Bodies smaller than this are suspicious for a 200 response
+const tinyBodySize = 512
+
+// Phrases of error pages, compared with lowercased text
+var notFoundPatterns = []string{
+	"page not found",
+	"404 not found",
+	"error 404",
+	"404 error",
+	"not be found",
+	"no longer available",
+	"does not exist",
+	"doesn't exist",
+	"page you requested",
+	"nothing was found",
+	"página no encontrada",
+	"seite nicht gefunden",
+	"page introuvable",
+}
+
+// Soft404 is a verdict of soft-404 classifier
+type Soft404 struct {
+	URL       string   `json:"url"`
+	Timestamp string   `json:"timestamp"`
+	IsSoft404 bool     `json:"soft404"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+// DetectSoft404 ... Checks if capture with 200 status is actually an error page.
+// Signals are tiny body, "page not found" phrases in title or text and canonical or refresh redirect to home page.
+func DetectSoft404(res *common.CdxResponse, data []byte) Soft404 {
+	verdict := Soft404{URL: res.Original, Timestamp: res.Timestamp}
+	if res.StatusCode != "" && res.StatusCode != "200" {
+		return verdict
+	}
+
+	add := func(score float64, reason string) {
+		verdict.Score += score
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+
+	if len(bytes.TrimSpace(data)) < tinyBodySize {
+		add(0.3, "tiny body")
+	}
+
+	if IsHTML(res) || res.MimeType == "" {
+		page := parsePageSignals(data)
+		if pattern := findPattern(page.title); pattern != "" {
+			add(0.6, fmt.Sprintf("title contains '%v'", pattern))
+		} else if pattern := findPattern(page.headings); pattern != "" {
+			add(0.5, fmt.Sprintf("heading contains '%v'", pattern))
+		} else if pattern := findPattern(page.text); pattern != "" {
+			add(0.3, fmt.Sprintf("text contains '%v'", pattern))
+		}
+
+		for _, target := range page.redirects {
+			if isHomeRedirect(res.Original, target) {
+				add(0.5, "redirects to home page")
+				break
+			}
+		}
+	}
+
+	if verdict.Score > 1 {
+		verdict.Score = 1
+	}
+	verdict.IsSoft404 = verdict.Score >= soft404Threshold
+	return verdict
+}
+
+func findPattern(text string) string {
+	text = strings.ToLower(text)
+	for _, pattern := range notFoundPatterns {
+		if strings.Contains(text, pattern) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+type pageSignals struct {
+	title     string
+	headings  string
+	text      string
+	redirects []string // Canonical and meta refresh targets
+}
+
+func parsePageSignals(doc []byte) pageSignals {
+	signals := pageSignals{}
+	text := strings.Builder{}
+	current := ""
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			signals.text = text.String()
+			return signals
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			current = token.Data
+			attrs := map[string]string{}
+			for _, attr := range token.Attr {
+				attrs[attr.Key] = attr.Val
+			}
+
+			if token.Data == "link" && strings.EqualFold(attrs["rel"], "canonical") {
+				signals.redirects = append(signals.redirects, attrs["href"])
+			}
+			if token.Data == "meta" && strings.EqualFold(attrs["http-equiv"], "refresh") {
+				// Content looks like "0; url=/"
+				content := attrs["content"]
+				if i := strings.Index(strings.ToLower(content), "url="); i != -1 {
+					signals.redirects = append(signals.redirects, strings.Trim(content[i+4:], `'" `))
+				}
+			}
+		case html.EndTagToken:
+			current = ""
+		case html.TextToken:
+			// Text can only be read once from tokenizer
+			data := tokenizer.Text()
+			switch current {
+			case "script", "style":
+				continue
+			case "title":
+				signals.title += string(data)
+			case "h1", "h2":
+				signals.headings += string(data) + " "
+			}
+			text.Write(data)
+			text.WriteByte(' ')
+		}
+	}
+}
+
+// Checks if link of the page points to root of the site while page itself is not the root
+func isHomeRedirect(pageURL, target string) bool {
+	page, err := url.Parse(pageURL)
+	if err != nil || target == "" {
+		return false
+	}
+	link, err := page.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return false
+	}
+
+	isRoot := func(u *url.URL) bool { return (u.Path == "" || u.Path == "/") && u.RawQuery == "" }
+	samesite := strings.TrimPrefix(strings.ToLower(link.Host), "www.") == strings.TrimPrefix(strings.ToLower(page.Host), "www.")
+	return samesite && isRoot(link) && !isRoot(page)
+}
+
+// NewSoft404Reporter ... Returns processor which writes verdicts of soft-404 captures to writer
+// as newline-delimited JSON, payload is passed unchanged. Can be used as Downloader.Process.
+func NewSoft404Reporter(w io.Writer) func(*common.CdxResponse, []byte) ([]byte, error) {
+	mu := sync.Mutex{}
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		verdict := DetectSoft404(res, data)
+		if !verdict.IsSoft404 {
+			return data, nil
+		}
+
+		line, err := jsoniter.Marshal(verdict)
+		if err != nil {
+			return data, fmt.Errorf("[Soft404Reporter] Cannot encode verdict: %w", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return data, fmt.Errorf("[Soft404Reporter] Cannot write verdict: %w", err)
+		}
+		return data, nil
+	}
+}
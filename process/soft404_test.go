@@ -0,0 +1,50 @@
+package process
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func TestDetectSoft404(t *testing.T) {
+	article := "<html><head><title>Annual report</title></head><body><h1>Report</h1><p>" + strings.Repeat("Revenue grew this year. ", 50) + "</p></body></html>"
+
+	cases := []struct {
+		name     string
+		res      *common.CdxResponse
+		doc      string
+		expected bool
+	}{
+		{"regular page", &common.CdxResponse{Original: "http://example.com/report", StatusCode: "200", MimeType: "text/html"}, article, false},
+		{"not found title", &common.CdxResponse{Original: "http://example.com/a", StatusCode: "200", MimeType: "text/html"},
+			"<html><head><title>Page Not Found | Example</title></head><body>" + strings.Repeat("<p>Try search</p>", 50) + "</body></html>", true},
+		{"home canonical", &common.CdxResponse{Original: "http://example.com/old", StatusCode: "200", MimeType: "text/html"},
+			`<html><head><link rel="canonical" href="https://www.example.com/"></head><body>` + strings.Repeat("<p>Welcome</p>", 50) + "</body></html>", true},
+		{"tiny error", &common.CdxResponse{Original: "http://example.com/b", StatusCode: "200", MimeType: "text/html"},
+			"<html><body>Sorry, this does not exist</body></html>", true},
+		{"real 404", &common.CdxResponse{Original: "http://example.com/c", StatusCode: "404", MimeType: "text/html"}, "<title>Page not found</title>", false},
+	}
+
+	for _, c := range cases {
+		verdict := DetectSoft404(c.res, []byte(c.doc))
+		if verdict.IsSoft404 != c.expected {
+			t.Fatalf("%v: got %+v", c.name, verdict)
+		}
+	}
+}
+
+func TestSoft404Reporter(t *testing.T) {
+	buf := bytes.Buffer{}
+	process := Chain(NewSoft404Reporter(&buf), nil)
+
+	res := &common.CdxResponse{Original: "http://example.com/a", Timestamp: "20200101000000", StatusCode: "200", MimeType: "text/html"}
+	data, err := process(res, []byte("<title>404 Not Found</title>"))
+	if err != nil || string(data) != "<title>404 Not Found</title>" {
+		t.Fatalf("Payload is changed: %s, %v", data, err)
+	}
+	if !strings.Contains(buf.String(), `"url":"http://example.com/a"`) || strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("Incorrect report: %v", buf.String())
+	}
+}
@@ -0,0 +1,215 @@
+package process
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	common "github.com/karust/gogetcrawl/common"
+	"golang.org/x/net/html"
+)
+
+// Technology detected in a capture
+type Technology struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Evidence string `json:"evidence"` // What the technology was detected by
+}
+
+// Signature of technology in script or stylesheet URLs, version is the first regexp group if any
+type techSignature struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var assetSignatures = []techSignature{
+	{"jQuery", regexp.MustCompile(`jquery[.-]?(\d+(?:\.\d+){1,2})?(?:\.min|\.slim)*\.js`)},
+	{"jQuery", regexp.MustCompile(`/jquery/(\d+(?:\.\d+){1,2})/`)},
+	{"jQuery UI", regexp.MustCompile(`jquery-ui[.-]?(\d+(?:\.\d+){1,2})?`)},
+	{"Bootstrap", regexp.MustCompile(`bootstrap(?:/|[.-])(\d+(?:\.\d+){1,2})?`)},
+	{"React", libraryFile(`react(?:-dom)?`)},
+	{"React", libraryDir(`react(?:-dom)?`)},
+	{"AngularJS", libraryFile(`angular(?:js)?`)},
+	{"AngularJS", libraryDir(`angular(?:js)?`)},
+	{"Vue.js", libraryFile(`vue`)},
+	{"Vue.js", libraryDir(`vue`)},
+	{"Modernizr", regexp.MustCompile(`modernizr[.-]?(\d+(?:\.\d+){1,2})?`)},
+	{"Font Awesome", regexp.MustCompile(`font-?awesome(?:/|[.-])(\d+(?:\.\d+){1,2})?`)},
+	// Versions of theme and plugin assets are their own, only core assets tell version of WordPress
+	{"WordPress", regexp.MustCompile(`/wp-includes/.*?(?:ver=(\d+(?:\.\d+){1,2}))?$`)},
+	{"WordPress", regexp.MustCompile(`/wp-content/`)},
+	{"Drupal", regexp.MustCompile(`/(?:sites/(?:default|all)|core/misc)/`)},
+	{"Joomla", regexp.MustCompile(`/media/(?:jui|system)/js/`)},
+	{"Shopify", regexp.MustCompile(`cdn\.shopify\.com`)},
+	{"Google Analytics", regexp.MustCompile(`google-analytics\.com/(?:ga|analytics|urchin)\.js|googletagmanager\.com/gtag`)},
+}
+
+// Script file of the library, name starts path segment so other libraries ending with it do not match (preact.js).
+// Like react.js, react-dom.production.min.js or vue-2.6.11.min.js.
+func libraryFile(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|/)` + name + `(?:[.-](\d+(?:\.\d+){1,2}))?(?:\.[a-z]+)*\.js(?:$|[?#])`)
+}
+
+// Script in directory of the library, like CDN paths /react@16.8.0/umd/react.min.js or /vue/2.6.11/vue.min.js
+func libraryDir(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|/)` + name + `(?:@|/)(\d+(?:\.\d+){1,2})?[^"?#]*\.js(?:$|[?#])`)
+}
+
+// Generator meta tags, like "WordPress 5.8.1"
+var generatorPattern = regexp.MustCompile(`^\s*([A-Za-z][\w .!-]*?)\s*v?(\d+(?:\.\d+)*)?\s*(?:[-(].*)?$`)
+
+// DetectTechnologies ... Finds frameworks, CMS and libraries of HTML capture by generator meta tags and asset paths
+func DetectTechnologies(res *common.CdxResponse, data []byte) []Technology {
+	found := map[string]Technology{}
+	add := func(tech Technology) {
+		// Keep the most specific detection, the one with version
+		if prev, ok := found[tech.Name]; ok && (prev.Version != "" || tech.Version == "") {
+			return
+		}
+		found[tech.Name] = tech
+	}
+
+	base, _ := url.Parse(res.Original)
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for tt := tokenizer.Next(); tt != html.ErrorToken; tt = tokenizer.Next() {
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		attrs := map[string]string{}
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+
+		switch token.Data {
+		case "meta":
+			if strings.EqualFold(attrs["name"], "generator") {
+				if m := generatorPattern.FindStringSubmatch(attrs["content"]); m != nil {
+					add(Technology{Name: strings.TrimSpace(m[1]), Version: m[2], Evidence: "generator: " + attrs["content"]})
+				}
+			}
+		case "script", "link":
+			link := attrs["src"]
+			if token.Data == "link" {
+				link = attrs["href"]
+			}
+			if link == "" {
+				continue
+			}
+			if base != nil {
+				if u, err := base.Parse(link); err == nil {
+					link = u.String()
+				}
+			}
+
+			for _, sig := range assetSignatures {
+				m := sig.pattern.FindStringSubmatch(strings.ToLower(link))
+				if m == nil {
+					continue
+				}
+				tech := Technology{Name: sig.name, Evidence: link}
+				if len(m) > 1 {
+					tech.Version = m[1]
+				}
+				add(tech)
+			}
+		}
+	}
+
+	techs := make([]Technology, 0, len(found))
+	for _, tech := range found {
+		techs = append(techs, tech)
+	}
+	sort.Slice(techs, func(i, j int) bool { return techs[i].Name < techs[j].Name })
+	return techs
+}
+
+// TimelineEntry is a period a technology version was seen on the host
+type TimelineEntry struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	FirstSeen string `json:"first_seen"` // CDX timestamp of the first capture
+	LastSeen  string `json:"last_seen"`  // CDX timestamp of the last capture
+	Captures  int    `json:"captures"`
+}
+
+// TechTimeline collects technologies of captures per host over time, safe for concurrent use
+type TechTimeline struct {
+	mu    sync.Mutex
+	hosts map[string]map[string]*TimelineEntry // host -> name@version -> entry
+}
+
+func NewTechTimeline() *TechTimeline {
+	return &TechTimeline{hosts: map[string]map[string]*TimelineEntry{}}
+}
+
+// Add ... Registers technologies detected in the capture
+func (tl *TechTimeline) Add(res *common.CdxResponse, techs []Technology) {
+	host := res.Original
+	if u, err := url.Parse(res.Original); err == nil {
+		host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	entries, ok := tl.hosts[host]
+	if !ok {
+		entries = map[string]*TimelineEntry{}
+		tl.hosts[host] = entries
+	}
+
+	for _, tech := range techs {
+		key := tech.Name + "@" + tech.Version
+		entry, ok := entries[key]
+		if !ok {
+			entry = &TimelineEntry{Name: tech.Name, Version: tech.Version, FirstSeen: res.Timestamp, LastSeen: res.Timestamp}
+			entries[key] = entry
+		}
+		// CDX timestamps are compared as strings as they have fixed length
+		if res.Timestamp < entry.FirstSeen {
+			entry.FirstSeen = res.Timestamp
+		}
+		if res.Timestamp > entry.LastSeen {
+			entry.LastSeen = res.Timestamp
+		}
+		entry.Captures++
+	}
+}
+
+// Timeline ... Returns entries of each host, ordered by first appearance
+func (tl *TechTimeline) Timeline() map[string][]TimelineEntry {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	timeline := map[string][]TimelineEntry{}
+	for host, entries := range tl.hosts {
+		list := []TimelineEntry{}
+		for _, entry := range entries {
+			list = append(list, *entry)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].FirstSeen != list[j].FirstSeen {
+				return list[i].FirstSeen < list[j].FirstSeen
+			}
+			return list[i].Name < list[j].Name
+		})
+		timeline[host] = list
+	}
+	return timeline
+}
+
+// Processor ... Returns processor which adds technologies of HTML captures to the timeline, payload is passed unchanged.
+// Can be used as Downloader.Process.
+func (tl *TechTimeline) Processor() func(*common.CdxResponse, []byte) ([]byte, error) {
+	return func(res *common.CdxResponse, data []byte) ([]byte, error) {
+		if IsHTML(res) {
+			tl.Add(res, DetectTechnologies(res, data))
+		}
+		return data, nil
+	}
+}
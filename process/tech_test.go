@@ -0,0 +1,89 @@
+package process
+
+import (
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+const TECH_PAGE = `<html><head>
+<meta name="generator" content="WordPress 5.8.1">
+<link rel="stylesheet" href="/wp-content/themes/x/style.css?ver=5.8.1">
+<script src="https://code.jquery.com/jquery-3.5.1.min.js"></script>
+<script src="/js/bootstrap.min.js"></script>
+</head><body></body></html>`
+
+func TestDetectTechnologies(t *testing.T) {
+	res := &common.CdxResponse{Original: "http://example.com/", MimeType: "text/html"}
+	techs := DetectTechnologies(res, []byte(TECH_PAGE))
+
+	versions := map[string]string{}
+	for _, tech := range techs {
+		versions[tech.Name] = tech.Version
+	}
+
+	if versions["WordPress"] != "5.8.1" || versions["jQuery"] != "3.5.1" {
+		t.Fatalf("Versions are not detected: %+v", techs)
+	}
+	if _, ok := versions["Bootstrap"]; !ok || len(techs) != 3 {
+		t.Fatalf("Incorrect technologies: %+v", techs)
+	}
+}
+
+func TestAssetSignatures(t *testing.T) {
+	cases := []struct {
+		asset, name, version string // Empty name if nothing is detected
+	}{
+		{"/js/react.js", "React", ""},
+		{"/js/react.min.js", "React", ""},
+		{"/js/react-dom.production.min.js", "React", ""},
+		{"https://unpkg.com/react@16.8.0/umd/react.production.min.js", "React", "16.8.0"},
+		{"/js/preact.min.js", "", ""},
+		{"/js/vue.js", "Vue.js", ""},
+		{"/js/vue-2.6.11.min.js?v=3", "Vue.js", "2.6.11"},
+		{"https://cdnjs.cloudflare.com/ajax/libs/vue/2.6.11/vue.min.js", "Vue.js", "2.6.11"},
+		{"/revue/app.js", "", ""},
+		{"/js/vue-router.js", "", ""},
+		{"/js/angular.js", "AngularJS", ""},
+		{"https://ajax.googleapis.com/ajax/libs/angularjs/1.8.2/angular.min.js", "AngularJS", "1.8.2"},
+		{"/js/rectangular.js", "", ""},
+		{"/wp-includes/js/wp-emoji-release.min.js?ver=5.8.1", "WordPress", "5.8.1"},
+		{"/wp-content/plugins/contact-form-7/includes/js/index.js?ver=5.4.2", "WordPress", ""},
+	}
+
+	for _, c := range cases {
+		res := &common.CdxResponse{Original: "http://example.com/", MimeType: "text/html"}
+		techs := DetectTechnologies(res, []byte(`<script src="`+c.asset+`"></script>`))
+		if c.name == "" {
+			if len(techs) != 0 {
+				t.Fatalf("Nothing should be detected in %v: %+v", c.asset, techs)
+			}
+			continue
+		}
+		if len(techs) != 1 || techs[0].Name != c.name || techs[0].Version != c.version {
+			t.Fatalf("Expected %v %v in %v: %+v", c.name, c.version, c.asset, techs)
+		}
+	}
+}
+
+func TestTechTimeline(t *testing.T) {
+	tl := NewTechTimeline()
+	process := tl.Processor()
+
+	old := `<script src="/js/jquery-1.12.4.min.js"></script>`
+	for _, c := range []struct{ ts, doc string }{
+		{"20180101000000", old},
+		{"20160101000000", old},
+		{"20210101000000", `<script src="/js/jquery-3.5.1.min.js"></script>`},
+	} {
+		process(&common.CdxResponse{Original: "http://www.example.com/", Timestamp: c.ts, MimeType: "text/html"}, []byte(c.doc))
+	}
+
+	entries := tl.Timeline()["example.com"]
+	if len(entries) != 2 || entries[0].Version != "1.12.4" || entries[0].FirstSeen != "20160101000000" || entries[0].LastSeen != "20180101000000" || entries[0].Captures != 2 {
+		t.Fatalf("Incorrect timeline: %+v", entries)
+	}
+	if entries[1].Version != "3.5.1" {
+		t.Fatalf("Incorrect timeline order: %+v", entries)
+	}
+}
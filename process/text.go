@@ -0,0 +1,22 @@
+package process
+
+import (
+	"strings"
+
+	"github.com/karust/gogetcrawl/common"
+)
+
+// ExtractText ... Returns title and readable text of HTML capture, text captures are returned as is.
+// Other types have no text.
+func ExtractText(res *common.CdxResponse, data []byte) (title, text string) {
+	data = common.HTTPBody(data)
+
+	switch {
+	case IsHTML(res):
+		signals := parsePageSignals(data)
+		return strings.Join(strings.Fields(signals.title), " "), strings.Join(strings.Fields(signals.text), " ")
+	case strings.HasPrefix(res.MimeType, "text/"):
+		return "", string(data)
+	}
+	return "", ""
+}
@@ -0,0 +1,23 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/karust/gogetcrawl/common"
+)
+
+func TestExtractText(t *testing.T) {
+	page := []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html><head><title> Example\n Domain </title><style>p{}</style></head><body><h1>Hello</h1>\n<p>World  <script>var x;</script>text</p></body></html>")
+
+	title, text := ExtractText(&common.CdxResponse{MimeType: "text/html"}, page)
+	if title != "Example Domain" || text != "Example Domain Hello World text" {
+		t.Fatalf("Unexpected text: %q, %q", title, text)
+	}
+
+	if _, text := ExtractText(&common.CdxResponse{MimeType: "text/plain"}, []byte("plain")); text != "plain" {
+		t.Fatalf("Unexpected plain text: %q", text)
+	}
+	if _, text := ExtractText(&common.CdxResponse{MimeType: "image/png"}, []byte("\x89PNG")); text != "" {
+		t.Fatalf("Binary capture should have no text: %q", text)
+	}
+}
@@ -0,0 +1,174 @@
+// Package render makes screenshots of archived pages using headless Chrome.
+// Chrome or Chromium needs to be installed to use it.
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	common "github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/wayback"
+)
+
+// Output formats
+const (
+	PNG = "png"
+	PDF = "pdf"
+)
+
+type Renderer struct {
+	Format  string        // Output format: PNG or PDF
+	Timeout time.Duration // Max time to render single page
+	Width   int64         // Viewport width
+	Height  int64         // Viewport height
+
+	ReplayServer string // Wayback replay server captures are loaded from, wayback.CRAWL_STORAGE if empty
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New ... Starts headless browser, call Close to stop it.
+//
+//	timeout: max time in seconds to render a page
+func New(format string, timeout int) (*Renderer, error) {
+	if format != PNG && format != PDF {
+		return nil, fmt.Errorf("[render.New] Unknown format: '%v', use png or pdf", format)
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), chromedp.DefaultExecAllocatorOptions[:]...)
+	ctx, ctxCancel := chromedp.NewContext(allocCtx)
+
+	// Start browser right away to report missing Chrome early
+	if err := chromedp.Run(ctx); err != nil {
+		ctxCancel()
+		allocCancel()
+		return nil, fmt.Errorf("[render.New] Cannot start browser: %w", err)
+	}
+
+	r := &Renderer{
+		Format:  format,
+		Timeout: time.Duration(timeout) * time.Second,
+		Width:   1280,
+		Height:  1024,
+		ctx:     ctx,
+		cancel: func() {
+			ctxCancel()
+			allocCancel()
+		},
+	}
+	return r, nil
+}
+
+// Stops the browser
+func (r *Renderer) Close() {
+	r.cancel()
+}
+
+// Returns replay URL of Wayback captures, sources under middlewares included, or downloaded payload of others
+func (r *Renderer) page(res *common.CdxResponse) (string, []byte, error) {
+	if _, ok := common.UnwrapSource(res.Source).(*wayback.Wayback); ok {
+		server := r.ReplayServer
+		if server == "" {
+			server = wayback.CRAWL_STORAGE
+		}
+		return wayback.ReplayURLAt(server, res), nil, nil
+	}
+
+	data, err := res.Source.GetFile(res)
+	if err != nil {
+		return "", nil, fmt.Errorf("[Render] Cannot get file: %w", err)
+	}
+	return "", withBase(data, res.Original), nil
+}
+
+var headTag = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+// Adds base URL of the capture to the document, so its relative assets are loaded from original site.
+// Documents having their own base are kept as they are.
+func withBase(doc []byte, original string) []byte {
+	lower := bytes.ToLower(doc)
+	if bytes.Contains(lower, []byte("<base")) {
+		return doc
+	}
+	base := []byte(`<base href="` + html.EscapeString(original) + `">`)
+
+	// Base goes first into head, it applies to URLs after it only
+	pos := 0
+	if head := headTag.FindIndex(doc); head != nil {
+		pos = head[1]
+	}
+	out := make([]byte, 0, len(doc)+len(base))
+	out = append(out, doc[:pos]...)
+	out = append(out, base...)
+	return append(out, doc[pos:]...)
+}
+
+// Render ... Makes screenshot of the capture.
+// Wayback captures are loaded through replay server, other sources are rendered from downloaded payload.
+func (r *Renderer) Render(res *common.CdxResponse) ([]byte, error) {
+	replayURL, data, err := r.page(res)
+	if err != nil {
+		return nil, err
+	}
+	load := setContent(string(data))
+	if replayURL != "" {
+		load = chromedp.Navigate(replayURL)
+	}
+
+	// Each record is rendered in a new tab
+	tabCtx, tabCancel := chromedp.NewContext(r.ctx)
+	defer tabCancel()
+	ctx, cancel := context.WithTimeout(tabCtx, r.Timeout)
+	defer cancel()
+
+	var out []byte
+	var capture chromedp.Action
+
+	switch r.Format {
+	case PNG:
+		capture = chromedp.FullScreenshot(&out, 100)
+	case PDF:
+		capture = chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			out, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+			return err
+		})
+	}
+
+	if err := chromedp.Run(ctx, chromedp.EmulateViewport(r.Width, r.Height), load, capture); err != nil {
+		return nil, fmt.Errorf("[Render] Cannot render '%v': %w", res.Original, err)
+	}
+	return out, nil
+}
+
+// Save ... Renders capture and writes it to the output
+//
+//	ex: http%3A%2F%2Fexample.com%2F-20130522121421-Wayback.png
+func (r *Renderer) Save(res *common.CdxResponse, output common.Output) error {
+	data, err := r.Render(res)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%v-%v-%v.%v", res.Original, res.Timestamp, res.Source.Name(), r.Format)
+	return output.Write(url.QueryEscape(name), data)
+}
+
+// Replaces document of the blank tab with given HTML
+func setContent(html string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		frameTree, err := page.GetFrameTree().Do(ctx)
+		if err != nil {
+			return err
+		}
+		return page.SetDocumentContent(frameTree.Frame.ID, html).Do(ctx)
+	})
+}
@@ -0,0 +1,77 @@
+package render
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+	"github.com/karust/gogetcrawl/wayback"
+)
+
+// Source downloading payloads from test server
+type serverSource struct {
+	common.Source
+	server string
+}
+
+func (s serverSource) Name() string { return "stub" }
+
+func (s serverSource) GetFile(res *common.CdxResponse) ([]byte, error) {
+	return common.GetWithOptions(s.server+"/file", common.RequestOptions{Timeout: 5, MaxRetries: 1})
+}
+
+func TestRenderPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			w.Write([]byte("<html>payload</html>"))
+			return
+		}
+		// Replay of the capture
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	r := &Renderer{ReplayServer: server.URL}
+	wb, _ := wayback.New(5, 1)
+
+	// Wayback captures are replayed, also through source middlewares
+	for _, source := range []common.Source{wb, common.WrapSource(wb, &common.LoggingSource{Logger: log.New(io.Discard, "", 0)})} {
+		res := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", Source: source}
+		replayURL, data, err := r.page(res)
+		if err != nil || data != nil {
+			t.Fatalf("Wayback capture should not be downloaded: %v, %q", err, data)
+		}
+		resp, err := http.Get(replayURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(path) != "/20130522121421if_/http://example.com/" {
+			t.Fatalf("Unexpected replay of %T: %q", source, path)
+		}
+	}
+
+	// Other captures are rendered from downloaded payload
+	res := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", Source: serverSource{server: server.URL}}
+	replayURL, data, err := r.page(res)
+	if err != nil || replayURL != "" || string(data) != `<base href="http://example.com/"><html>payload</html>` {
+		t.Fatalf("Unexpected page: %q, %q, %v", replayURL, data, err)
+	}
+}
+
+func TestWithBase(t *testing.T) {
+	cases := map[string]string{
+		`<html><HEAD lang="en"><link href="a.css"></head></html>`: `<html><HEAD lang="en"><base href="http://example.com/a?b=1&amp;c=2"><link href="a.css"></head></html>`,
+		`<header>no head</header>`:                                `<base href="http://example.com/a?b=1&amp;c=2"><header>no head</header>`,
+		`<head><base href="/x/"></head>`:                          `<head><base href="/x/"></head>`,
+	}
+	for doc, want := range cases {
+		if got := string(withBase([]byte(doc), "http://example.com/a?b=1&c=2")); got != want {
+			t.Fatalf("%v: want=%v, got=%v", doc, want, got)
+		}
+	}
+}
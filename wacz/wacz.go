@@ -0,0 +1,366 @@
+// Package wacz writes downloaded captures into WACZ (Web Archive Collection Zipped) packages
+// which can be replayed by tools like ReplayWeb.page, optionally signed with Ed25519 key.
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	common "github.com/karust/gogetcrawl/common"
+)
+
+const (
+	waczVersion = "1.1.1"
+	software    = "gogetcrawl"
+
+	warcPath   = "archive/data.warc.gz"
+	indexPath  = "indexes/index.cdxj"
+	pagesPath  = "pages/pages.jsonl"
+	dataPath   = "datapackage.json"
+	digestPath = "datapackage-digest.json"
+)
+
+type resource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int    `json:"bytes"`
+}
+
+type dataPackage struct {
+	Profile     string     `json:"profile"`
+	WaczVersion string     `json:"wacz_version"`
+	Created     string     `json:"created"`
+	Software    string     `json:"software"`
+	Resources   []resource `json:"resources"`
+}
+
+// Signature of datapackage.json hash
+type SignedData struct {
+	Hash      string `json:"hash"`
+	Created   string `json:"created"`
+	Software  string `json:"software"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"` // Base64 encoded Ed25519 public key
+	Signature string `json:"signature"` // Base64 encoded signature of Hash
+}
+
+type digestFile struct {
+	Path       string      `json:"path"`
+	Hash       string      `json:"hash"`
+	SignedData *SignedData `json:"signedData,omitempty"`
+}
+
+type cdxjEntry struct {
+	key  string
+	line []byte
+}
+
+// Output collects captures and writes WACZ package on Close
+type Output struct {
+	mu      sync.Mutex
+	path    string
+	key     ed25519.PrivateKey
+	warc    *os.File // Temporary WARC file, copied into package on Close
+	size    int64
+	entries []cdxjEntry
+	pages   [][]byte
+}
+
+// New ... Creates WACZ output, package is signed if key is not nil
+func New(path string, key ed25519.PrivateKey) (*Output, error) {
+	warc, err := os.CreateTemp("", "gogetcrawl-*.warc.gz")
+	if err != nil {
+		return nil, fmt.Errorf("[WACZ] Cannot create temporary WARC: %w", err)
+	}
+	return &Output{path: path, key: key, warc: warc}, nil
+}
+
+// LoadKey ... Reads Ed25519 private key from PKCS #8 PEM file, as made by `openssl genpkey -algorithm ed25519`
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadKey] Cannot read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("[LoadKey] No PEM data found in '%v'", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("[LoadKey] Cannot parse key: %w", err)
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("[LoadKey] Key is not Ed25519")
+	}
+	return key, nil
+}
+
+func (o *Output) Write(name string, data []byte) error {
+	return o.WriteRecord(name, &common.CdxResponse{Original: name}, data)
+}
+
+// WriteRecord ... Appends capture to WARC as separate gzip member and indexes it
+func (o *Output) WriteRecord(name string, res *common.CdxResponse, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	member := bytes.Buffer{}
+	gz := gzip.NewWriter(&member)
+	if _, err := common.NewResourceRecord(res, data).WriteTo(gz); err != nil {
+		return fmt.Errorf("[WACZ] Cannot write record '%v': %w", name, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("[WACZ] Cannot write record '%v': %w", name, err)
+	}
+
+	offset := o.size
+	if _, err := o.warc.Write(member.Bytes()); err != nil {
+		return fmt.Errorf("[WACZ] Cannot write record '%v': %w", name, err)
+	}
+	o.size += int64(member.Len())
+
+	timestamp := res.Timestamp
+	if timestamp == "" {
+		timestamp = time.Now().UTC().Format(common.CdxTimeFormat)
+	}
+
+	urlkey := common.SURT(res.Original)
+	entry, _ := jsoniter.Marshal(map[string]string{
+		"url":      res.Original,
+		"mime":     res.MimeType,
+		"status":   res.StatusCode,
+		"digest":   common.PayloadDigest(data), // Of the written payload, as in WARC-Payload-Digest
+		"offset":   fmt.Sprint(offset),
+		"length":   fmt.Sprint(member.Len()),
+		"filename": strings.TrimPrefix(warcPath, "archive/"),
+	})
+	line := []byte(fmt.Sprintf("%v %v %s\n", urlkey, timestamp, entry))
+	o.entries = append(o.entries, cdxjEntry{key: urlkey + " " + timestamp, line: line})
+
+	if strings.HasPrefix(res.MimeType, "text/html") {
+		entry := map[string]any{"url": res.Original, "ts": timestamp}
+		if tags := res.Tags(); len(tags) > 0 {
+			entry["tags"] = tags
+		}
+		if robots := res.Robots.All(); len(robots) > 0 {
+			entry["robots"] = robots
+		}
+		page, _ := jsoniter.Marshal(entry)
+		o.pages = append(o.pages, page)
+	}
+	return nil
+}
+
+// Close ... Writes WACZ package
+func (o *Output) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	defer os.Remove(o.warc.Name())
+	defer o.warc.Close()
+
+	// Package appears at its path only when it is complete
+	file, err := common.CreateAtomic(o.path)
+	if err != nil {
+		return fmt.Errorf("[WACZ] Cannot create package: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			file.Abort()
+		}
+	}()
+
+	zw := zip.NewWriter(file)
+	created := time.Now().UTC().Format(time.RFC3339)
+	pkg := dataPackage{Profile: "data-package", WaczVersion: waczVersion, Created: created, Software: software}
+
+	// CDXJ must be sorted by key for replay tools
+	sort.SliceStable(o.entries, func(i, j int) bool { return o.entries[i].key < o.entries[j].key })
+	index := bytes.Buffer{}
+	for _, e := range o.entries {
+		index.Write(e.line)
+	}
+
+	pages := bytes.Buffer{}
+	pages.WriteString(`{"format":"json-pages-1.0","id":"pages","title":"All Pages"}` + "\n")
+	for _, p := range o.pages {
+		pages.Write(p)
+		pages.WriteByte('\n')
+	}
+
+	// WARC is already compressed and needs random access by offsets, so it is stored as is
+	if _, err := o.warc.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("[WACZ] Cannot read temporary WARC: %w", err)
+	}
+	warcResource, err := copyZipFile(zw, warcPath, o.warc, zip.Store)
+	if err != nil {
+		return err
+	}
+	pkg.Resources = append(pkg.Resources, warcResource)
+
+	for path, data := range map[string][]byte{indexPath: index.Bytes(), pagesPath: pages.Bytes()} {
+		res, err := copyZipFile(zw, path, bytes.NewReader(data), zip.Deflate)
+		if err != nil {
+			return err
+		}
+		pkg.Resources = append(pkg.Resources, res)
+	}
+	sort.Slice(pkg.Resources, func(i, j int) bool { return pkg.Resources[i].Path < pkg.Resources[j].Path })
+
+	pkgData, _ := jsoniter.MarshalIndent(pkg, "", "  ")
+	if err := writeZipFile(zw, dataPath, pkgData, zip.Deflate); err != nil {
+		return err
+	}
+
+	digest := digestFile{Path: dataPath, Hash: hashOf(pkgData)}
+	if o.key != nil {
+		digest.SignedData = sign(o.key, digest.Hash, created)
+	}
+	digestData, _ := jsoniter.MarshalIndent(digest, "", "  ")
+	if err := writeZipFile(zw, digestPath, digestData, zip.Deflate); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("[WACZ] Cannot finish package: %w", err)
+	}
+	committed = true
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("[WACZ] Cannot commit package: %w", err)
+	}
+	return nil
+}
+
+func sign(key ed25519.PrivateKey, hash, created string) *SignedData {
+	return &SignedData{
+		Hash:      hash,
+		Created:   created,
+		Software:  software,
+		Algorithm: "ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(hash))),
+	}
+}
+
+func writeZipFile(zw *zip.Writer, path string, data []byte, method uint16) error {
+	_, err := copyZipFile(zw, path, bytes.NewReader(data), method)
+	return err
+}
+
+// Copies data into package file and describes it as datapackage resource
+func copyZipFile(zw *zip.Writer, path string, r io.Reader, method uint16) (resource, error) {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: path, Method: method, Modified: time.Now()})
+	if err != nil {
+		return resource{}, fmt.Errorf("[WACZ] Cannot create '%v': %w", path, err)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), r)
+	if err != nil {
+		return resource{}, fmt.Errorf("[WACZ] Cannot write '%v': %w", path, err)
+	}
+
+	return resource{
+		Name:  path[strings.LastIndex(path, "/")+1:],
+		Path:  path,
+		Hash:  "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Bytes: int(n),
+	}, nil
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Verify ... Checks hashes of package resources and signature of the datapackage.
+// Returns signature info, nil if package is not signed.
+func Verify(path string) (*SignedData, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Verify] Cannot open package: %w", err)
+	}
+	defer zr.Close()
+
+	// Only package descriptors are read into memory, other files are hashed while streaming
+	hashes := map[string]string{}
+	descriptors := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("[Verify] Cannot open '%v': %w", f.Name, err)
+		}
+
+		hash := sha256.New()
+		var w io.Writer = hash
+		buf := bytes.Buffer{}
+		if f.Name == dataPath || f.Name == digestPath {
+			w = io.MultiWriter(hash, &buf)
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("[Verify] Cannot read '%v': %w", f.Name, err)
+		}
+
+		hashes[f.Name] = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+		descriptors[f.Name] = buf.Bytes()
+	}
+
+	digest := digestFile{}
+	if err := jsoniter.Unmarshal(descriptors[digestPath], &digest); err != nil {
+		return nil, fmt.Errorf("[Verify] Cannot decode %v: %w", digestPath, err)
+	}
+	if hashes[dataPath] != digest.Hash {
+		return nil, fmt.Errorf("[Verify] %v hash mismatch", dataPath)
+	}
+
+	pkg := dataPackage{}
+	if err := jsoniter.Unmarshal(descriptors[dataPath], &pkg); err != nil {
+		return nil, fmt.Errorf("[Verify] Cannot decode %v: %w", dataPath, err)
+	}
+	for _, r := range pkg.Resources {
+		if hashes[r.Path] != r.Hash {
+			return nil, fmt.Errorf("[Verify] %v hash mismatch", r.Path)
+		}
+	}
+
+	signed := digest.SignedData
+	if signed == nil {
+		return nil, nil
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(signed.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("[Verify] Bad public key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("[Verify] Bad signature encoding")
+	}
+	if signed.Hash != digest.Hash || !ed25519.Verify(publicKey, []byte(signed.Hash), signature) {
+		return nil, fmt.Errorf("[Verify] Signature is not valid")
+	}
+	return signed, nil
+}
@@ -0,0 +1,118 @@
+package wacz
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	common "github.com/karust/gogetcrawl/common"
+)
+
+func writePackage(t *testing.T, key ed25519.PrivateKey) string {
+	path := filepath.Join(t.TempDir(), "test.wacz")
+	output, err := New(path, key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	page := &common.CdxResponse{Original: "https://example.com/", Timestamp: "20200101000000", MimeType: "text/html", StatusCode: "200"}
+	image := &common.CdxResponse{Original: "https://example.com/a.png", Timestamp: "20200101000001", MimeType: "image/png", StatusCode: "200"}
+	output.WriteRecord("page", page, []byte("<html>example</html>"))
+	output.WriteRecord("image", image, []byte("png"))
+	if err := output.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path, name string) string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer zr.Close()
+
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+func TestSignedPackage(t *testing.T) {
+	public, key, _ := ed25519.GenerateKey(rand.Reader)
+	path := writePackage(t, key)
+
+	signed, err := Verify(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if signed == nil || signed.Algorithm != "ed25519" {
+		t.Fatalf("Package is not signed: %+v", signed)
+	}
+	if !public.Equal(ed25519.PublicKey(mustDecode(t, signed.PublicKey))) {
+		t.Fatalf("Wrong public key in signature")
+	}
+
+	index := readFile(t, path, indexPath)
+	if !strings.HasPrefix(index, "com,example)/ 20200101000000") || strings.Count(index, "\n") != 2 {
+		t.Fatalf("Incorrect index: %v", index)
+	}
+	if pages := readFile(t, path, pagesPath); strings.Count(pages, "\n") != 2 {
+		t.Fatalf("Only HTML page should be listed: %v", pages)
+	}
+}
+
+func TestUnsignedPackage(t *testing.T) {
+	signed, err := Verify(writePackage(t, nil))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if signed != nil {
+		t.Fatalf("Package should not be signed")
+	}
+}
+
+func TestTamperedPackage(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	path := writePackage(t, key)
+
+	// Rebuild package with replaced index
+	zr, _ := zip.OpenReader(path)
+	tampered := filepath.Join(t.TempDir(), "tampered.wacz")
+	file, _ := os.Create(tampered)
+	zw := zip.NewWriter(file)
+	for _, f := range zr.File {
+		w, _ := zw.Create(f.Name)
+		if f.Name == indexPath {
+			w.Write([]byte("com,evil)/ 20200101000000 {}\n"))
+			continue
+		}
+		rc, _ := f.Open()
+		io.Copy(w, rc)
+		rc.Close()
+	}
+	zw.Close()
+	file.Close()
+	zr.Close()
+
+	if _, err := Verify(tampered); err == nil {
+		t.Fatalf("Tampered package should not be verified")
+	}
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return data
+}
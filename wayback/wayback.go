@@ -1,10 +1,12 @@
 package wayback
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
 	"strconv"
 
-	jsoniter "github.com/json-iterator/go"
 	common "github.com/karust/gogetcrawl/common"
 )
 
@@ -14,6 +16,14 @@ const CRAWL_STORAGE = "https://web.archive.org/web"
 type Wayback struct {
 	MaxTimeout int // Request timeout
 	MaxRetries int // Max number of request retries if timeouted
+	PageSize   int // Index blocks per page of pagination API (pageSize parameter), server default if 0
+
+	Decoding common.CdxDecoding // JSON library and strictness of responses decoding
+	Storage  string             // Base URL of archived captures, CRAWL_STORAGE if empty (optional)
+
+	// Base URL of CDX server, INDEX_SERVER if empty (optional).
+	// Like "http://localhost:8080/wb/" of `serve` caching proxy, so workers share cached index responses.
+	IndexServer string
 }
 
 func New(timeout, retries int) (*Wayback, error) {
@@ -21,15 +31,37 @@ func New(timeout, retries int) (*Wayback, error) {
 	return source, nil
 }
 
+// Base URL of CDX server
+func (wb *Wayback) indexServer() string {
+	if wb.IndexServer != "" {
+		return wb.IndexServer
+	}
+	return INDEX_SERVER
+}
+
+// Base URL of archived captures
+func (wb *Wayback) storage() string {
+	if wb.Storage != "" {
+		return wb.Storage
+	}
+	return CRAWL_STORAGE
+}
+
 func (Wayback) Name() string {
 	return "Wayback"
 }
 
 // Return the number of pages located in WebArchive for given url
 func (wb *Wayback) GetNumPages(url string) (int, error) {
+	return wb.getNumPages(url, common.RequestOptions{Timeout: wb.MaxTimeout, MaxRetries: wb.MaxRetries})
+}
 
-	requestURI := fmt.Sprintf("%v?url=%v&showNumPages=true", INDEX_SERVER, url)
-	response, err := common.Get(requestURI, wb.MaxTimeout, wb.MaxRetries)
+func (wb *Wayback) getNumPages(url string, opts common.RequestOptions) (int, error) {
+	requestURI := fmt.Sprintf("%v?url=%v&showNumPages=true", wb.indexServer(), url)
+	if wb.PageSize > 0 {
+		requestURI = fmt.Sprintf("%v&pageSize=%v", requestURI, wb.PageSize)
+	}
+	response, err := common.GetWithOptions(requestURI, opts)
 	if err != nil {
 		return 0, fmt.Errorf("[GetNumPages] Request error: %v", err)
 	}
@@ -44,68 +76,145 @@ func (wb *Wayback) GetNumPages(url string) (int, error) {
 	return res, nil
 }
 
-// Parse response from https://web.archive.org/cdx/search/cdx CDX server
-func (wb *Wayback) ParseResponse(resp []byte) ([]*common.CdxResponse, error) {
-	var results [][]string
+// PlanSteps ... Returns single step for Wayback CDX server with number of pages to query
+func (wb *Wayback) PlanSteps(config common.RequestConfig) ([]common.PlanStep, error) {
+	step := common.PlanStep{Endpoint: wb.indexServer(), Pages: 1}
 
-	err := jsoniter.Unmarshal(resp, &results)
-	if err != nil {
-		return nil, fmt.Errorf("[ParseResponse] Failed to decode Wayback results '%v'", err)
+	if !config.SinglePage {
+		pages, err := wb.getNumPages(config.URL, config.RequestOptions(wb.MaxTimeout, wb.MaxRetries))
+		if err != nil {
+			return nil, config.Errorf("[PlanSteps] %w", err)
+		}
+		step.Pages = pages
 	}
+	return []common.PlanStep{step}, nil
+}
+
+// Parse response from https://web.archive.org/cdx/search/cdx CDX server
+func (wb *Wayback) ParseResponse(resp []byte) ([]*common.CdxResponse, error) {
+	return wb.DecodeResponse(bytes.NewReader(resp), 0)
+}
 
+// DecodeResponse ... Decodes CDX server response while it is read, stops after max records if max is positive.
+// Columns are matched by names of the header row, unknown ones fail only in strict decoding mode.
+func (wb *Wayback) DecodeResponse(r io.Reader, max int) ([]*common.CdxResponse, error) {
 	parsedResults := []*common.CdxResponse{}
-	for i, entry := range results {
-		// Skip header
-		if i == 0 {
-			continue
+
+	var header []string
+	err := wb.Decoding.DecodeArray(r, func(decode func(v any) error) (bool, error) {
+		if header == nil {
+			if err := decode(&header); err != nil {
+				return false, err
+			}
+			if header == nil {
+				header = []string{}
+			}
+			// Header is checked once, so strict mode fails before any record is decoded
+			return true, wb.Decoding.SetFields(&common.CdxResponse{}, header, make([]any, len(header)))
 		}
 
-		parsed := common.CdxResponse{
-			Urlkey:     entry[0],
-			Timestamp:  entry[1],
-			Original:   entry[2],
-			MimeType:   entry[3],
-			StatusCode: entry[4],
-			Digest:     entry[5],
-			Length:     entry[6],
+		var entry []any
+		if err := decode(&entry); err != nil {
+			return false, err
+		}
+		if len(entry) < len(header) {
+			return false, fmt.Errorf("entry has %v fields, header has %v", len(entry), len(header))
 		}
 
-		parsed.Source = wb
-		parsedResults = append(parsedResults, &parsed)
-	}
+		parsed := &common.CdxResponse{Source: wb}
+		if err := wb.Decoding.SetFields(parsed, header, entry); err != nil {
+			return false, err
+		}
+		parsedResults = append(parsedResults, parsed)
+		return max <= 0 || len(parsedResults) < max, nil
+	})
 
+	if err != nil {
+		return nil, fmt.Errorf("[ParseResponse] Failed to decode Wayback results '%v'", err)
+	}
 	return parsedResults, nil
 }
 
+// Composes query of the page, page size is the same as the number of pages was got with
+func (wb *Wayback) pageURL(config common.RequestConfig, page int) string {
+	reqURL := config.GetUrl(wb.indexServer(), page)
+	if wb.PageSize > 0 && !config.SinglePage {
+		reqURL = fmt.Sprintf("%v&pageSize=%v", reqURL, wb.PageSize)
+	}
+	return reqURL
+}
+
+// Requests page of the index and decodes up to max records, all of them if max is not positive.
+// Page is requested gzipped and decompressed while it is decoded, so big pages are transferred faster.
+func (wb *Wayback) getPage(reqURL string, opts common.RequestOptions, max int) ([]*common.CdxResponse, error) {
+	headers := map[string]string{"Accept-Encoding": "gzip"}
+	for k, v := range opts.Headers {
+		headers[k] = v
+	}
+	opts.Headers = headers
+
+	var records []*common.CdxResponse
+	err := common.GetDecoded(reqURL, opts, func(r io.Reader) error {
+		// Server may still answer uncompressed, it is passed as is then
+		body, err := common.Decompress(r)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		// Limit applies to decompressed page too, it is what is kept in memory
+		limited := common.NewLimitedReader(body, reqURL, opts.MaxBytes)
+		records, err = wb.DecodeResponse(limited, max)
+		if tooLarge := limited.Err(); tooLarge != nil {
+			return tooLarge
+		}
+		return err
+	})
+	return records, err
+}
+
 // GetPages ... Makes request to WebArchive CDX API to gather all url observations
+// Accounting is collected into config.Stats if provided.
 func (wb *Wayback) GetPages(config common.RequestConfig) ([]*common.CdxResponse, error) {
 	var pages int
 	var err error
 
+	// Wayback is a single index, taken by the first slice of index partition
+	if !config.Partition.HasIndex(0) {
+		return nil, nil
+	}
+
+	defer config.Stats.StartPhase(common.PhaseIndex)()
+	opts := config.RequestOptions(wb.MaxTimeout, wb.MaxRetries)
+
 	if config.SinglePage {
 		pages = 1
 	} else {
-		pages, err = wb.GetNumPages(config.URL)
+		pages, err = wb.getNumPages(config.URL, opts)
 		if err != nil {
-			return nil, err
+			return nil, config.Errorf("%w", err)
 		}
 	}
+	config.Emit(common.Event{Type: common.EventIndexResolved, Source: wb.Name(), Pages: pages})
 
 	var results []*common.CdxResponse
 	numResults := 0
 
-	for page := 0; page < pages; page++ {
-		reqURL := config.GetUrl(INDEX_SERVER, page)
-
-		response, err := common.Get(reqURL, wb.MaxTimeout, wb.MaxRetries)
-		if err != nil {
-			return results, fmt.Errorf("[GetPages] Request error: %v", err)
+	for page := config.ResumePage(wb.Name(), ""); page < pages; page++ {
+		if !config.Partition.HasPage(page) {
+			continue
 		}
+		reqURL := wb.pageURL(config, page)
 
-		parsedResponse, err := wb.ParseResponse(response)
+		remaining := config.Remaining(numResults)
+		parsedResponse, err := wb.getPage(reqURL, opts, remaining)
 		if err != nil {
-			return results, fmt.Errorf("[GetPages] Cannot parse response: %v", err)
+			config.EmitPage(wb.Name(), "", page, 0, err)
+			return results, config.Errorf("[GetPages] Request error: %w", err)
 		}
+		config.AttachRecords(parsedResponse)
+		common.SetResumeToken(parsedResponse, config.NextPageToken(wb.Name(), "", page, remaining > 0 && len(parsedResponse) == remaining))
+		parsedResponse = config.SelectRecords(parsedResponse)
+		config.EmitPage(wb.Name(), "", page, len(parsedResponse), nil)
 		results = append(results, parsedResponse...)
 		numResults += len(parsedResponse)
 
@@ -114,6 +223,8 @@ func (wb *Wayback) GetPages(config common.RequestConfig) ([]*common.CdxResponse,
 		}
 	}
 
+	// Wayback CDX server has no sort parameter
+	config.SortRecords(results)
 	return results, nil
 }
 
@@ -123,29 +234,44 @@ func (wb *Wayback) FetchPages(config common.RequestConfig, results chan []*commo
 	var pages int
 	var err error
 
+	if !config.Partition.HasIndex(0) {
+		return
+	}
+	opts := config.RequestOptions(wb.MaxTimeout, wb.MaxRetries)
+
 	if config.SinglePage {
 		pages = 1
 	} else {
-		pages, err = wb.GetNumPages(config.URL)
+		pages, err = wb.getNumPages(config.URL, opts)
 		if err != nil {
-			errors <- err
+			errors <- config.Errorf("%w", err)
 		}
 	}
+	config.Emit(common.Event{Type: common.EventIndexResolved, Source: wb.Name(), Pages: pages})
 
 	numResults := 0
 
-	for page := 0; page < pages; page++ {
-		reqURL := config.GetUrl(INDEX_SERVER, page)
-
-		response, err := common.Get(reqURL, wb.MaxTimeout, wb.MaxRetries)
-		if err != nil {
-			errors <- fmt.Errorf("[FetchPages] Request error: %v", err)
+	for page := config.ResumePage(wb.Name(), ""); page < pages; page++ {
+		if !config.Partition.HasPage(page) {
+			continue
 		}
+		reqURL := wb.pageURL(config, page)
+		stopPhase := config.Stats.StartPhase(common.PhaseIndex)
 
-		parsedResponse, err := wb.ParseResponse(response)
+		remaining := config.Remaining(numResults)
+		parsedResponse, err := wb.getPage(reqURL, opts, remaining)
 		if err != nil {
-			errors <- fmt.Errorf("[FetchPages] Cannot parse response: %v", err)
+			config.EmitPage(wb.Name(), "", page, 0, err)
+			errors <- config.Errorf("[FetchPages] Request error: %w", err)
+			stopPhase()
+			continue
 		}
+		config.AttachRecords(parsedResponse)
+		common.SetResumeToken(parsedResponse, config.NextPageToken(wb.Name(), "", page, remaining > 0 && len(parsedResponse) == remaining))
+		parsedResponse = config.SelectRecords(parsedResponse)
+		config.SortRecords(parsedResponse)
+		config.EmitPage(wb.Name(), "", page, len(parsedResponse), nil)
+		stopPhase()
 		numResults += len(parsedResponse)
 
 		results <- parsedResponse
@@ -158,10 +284,40 @@ func (wb *Wayback) FetchPages(config common.RequestConfig, results chan []*commo
 
 // Download file from WebArchive using a link from CDX response
 func (wb *Wayback) GetFile(page *common.CdxResponse) ([]byte, error) {
-	requestURI := fmt.Sprintf("%v/%vid_/%v", CRAWL_STORAGE, page.Timestamp, page.Original)
-	response, err := common.Get(requestURI, wb.MaxTimeout, wb.MaxRetries)
+	if data, ok := page.CachedFile(); ok {
+		return data, nil
+	}
+
+	requestURI := fmt.Sprintf("%v/%vid_/%v", wb.storage(), page.Timestamp, page.Original)
+	opts := page.RequestOptions(wb.MaxTimeout, wb.MaxRetries)
+	response, err := common.GetWithOptions(requestURI, opts)
 	if err != nil {
-		return nil, fmt.Errorf("[GetFile] Request error: %v", err)
+		return nil, page.Errorf("[GetFile] Request error: %v", err)
 	}
+	// Only payloads of 2xx responses get here, so error pages are not cached
+	page.FileCache().Put(page, response)
 	return response, nil
 }
+
+// GetHeaders ... Returns archived response headers of the capture, without downloading its body
+func (wb *Wayback) GetHeaders(page *common.CdxResponse) (http.Header, error) {
+	requestURI := fmt.Sprintf("%v/%vid_/%v", wb.storage(), page.Timestamp, page.Original)
+	// Archived 404 and 5xx are replayed with their status, they are captures and not failures to retry
+	opts := page.RequestOptions(wb.MaxTimeout, wb.MaxRetries)
+	opts.Expect = []int{common.AnyStatus}
+	header, err := common.GetHeaders(requestURI, opts)
+	if err != nil {
+		return nil, page.Errorf("[GetHeaders] Request error: %v", err)
+	}
+	return common.ArchivedHeaders(header), nil
+}
+
+// ReplayURL ... Returns Wayback replay URL that reconstructs the capture with its assets, without Wayback toolbar
+func ReplayURL(page *common.CdxResponse) string {
+	return ReplayURLAt(CRAWL_STORAGE, page)
+}
+
+// ReplayURLAt ... Returns replay URL of the capture on given Wayback replay server
+func ReplayURLAt(server string, page *common.CdxResponse) string {
+	return fmt.Sprintf("%v/%vif_/%v", server, page.Timestamp, page.Original)
+}
@@ -1,6 +1,12 @@
 package wayback
 
 import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,6 +41,93 @@ func TestParseResponse(t *testing.T) {
 	}
 }
 
+func TestDecodeResponse(t *testing.T) {
+	source := &Wayback{}
+
+	parsedResp, err := source.DecodeResponse(strings.NewReader(RESPONSE), 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(parsedResp) != 2 || parsedResp[1].Original != "http://kamaloff.ru/favicon.ico" {
+		t.Fatalf("Expected to stop after 2 records, got %v", parsedResp)
+	}
+
+	if _, err := source.DecodeResponse(strings.NewReader(RESPONSE[:300]), 0); err == nil {
+		t.Fatalf("Expected error for truncated response")
+	}
+}
+
+func TestDecodeResponseModes(t *testing.T) {
+	for _, library := range []string{common.JSONIter, common.JSONStd} {
+		source := &Wayback{Decoding: common.CdxDecoding{Library: library, Strict: true}}
+		parsedResp, err := source.DecodeResponse(strings.NewReader(RESPONSE), 3)
+		if err != nil {
+			t.Fatalf("%v: %v", library, err)
+		}
+		if len(parsedResp) != 3 || parsedResp[2].StatusCode != "200" || parsedResp[2].Original != "https://kamaloff.ru/login/?next=/" {
+			t.Fatalf("%v: unexpected records %v", library, parsedResp)
+		}
+	}
+
+	// Columns are matched by header, not by position
+	reordered := `[["original","timestamp","status_code"],["http://example.com/","20200101000000","200"]]`
+	parsedResp, err := (&Wayback{}).DecodeResponse(strings.NewReader(reordered), 0)
+	if err != nil || len(parsedResp) != 1 || parsedResp[0].Original != "http://example.com/" || parsedResp[0].StatusCode != "" {
+		t.Fatalf("Lenient mode should skip unknown column: %v, %v", parsedResp, err)
+	}
+
+	strict := &Wayback{Decoding: common.CdxDecoding{Strict: true}}
+	if _, err := strict.DecodeResponse(strings.NewReader(reordered), 0); err == nil || !strings.Contains(err.Error(), "status_code") {
+		t.Fatalf("Strict mode should fail on unknown column, got %v", err)
+	}
+}
+
+func TestGetPageGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("plain") != "" || r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(RESPONSE))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(RESPONSE))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	source := &Wayback{}
+	stats := common.NewStats()
+	opts := common.RequestOptions{Timeout: 5, MaxRetries: 1, Stats: stats}
+	for _, reqURL := range []string{server.URL, server.URL + "?plain=1"} {
+		records, err := source.getPage(reqURL, opts, 0)
+		if err != nil || len(records) != 4 {
+			t.Fatalf("Unexpected records of %v: %v, %v", reqURL, records, err)
+		}
+	}
+	if got := stats.Summary().Bytes; got >= int64(2*len(RESPONSE)) {
+		t.Fatalf("Compressed page should be counted by transferred bytes, got %v", got)
+	}
+	// Gzipped page fits the limit on the wire, but not once decompressed
+	opts.MaxBytes = int64(len(RESPONSE)) - 1
+	var tooLarge *common.ResponseTooLargeError
+	if _, err := source.getPage(server.URL, opts, 0); !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected ResponseTooLargeError, got %v", err)
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	config := common.RequestConfig{URL: "example.com/*"}
+	source := &Wayback{PageSize: 5}
+	if got := source.pageURL(config, 3); !strings.HasSuffix(got, "&page=3&pageSize=5") {
+		t.Fatalf("Unexpected page URL: %v", got)
+	}
+
+	config.SinglePage = true
+	if got := source.pageURL(config, 0); strings.Contains(got, "pageSize") {
+		t.Fatalf("Single page query should not be paginated: %v", got)
+	}
+}
+
 func TestGetNumPages(t *testing.T) {
 	want := 1
 
@@ -148,3 +241,67 @@ func TestGetFile(t *testing.T) {
 		t.Fatalf("Got incorrect length file")
 	}
 }
+
+func TestGetFileCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Archive is unavailable on the first run
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	cache, err := common.NewFileCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := common.NewStats()
+	config := &common.RequestConfig{FileCache: cache, Stats: stats}
+	page := &common.CdxResponse{Original: "http://example.com/", Timestamp: "20130522121421", Length: "7", Config: config}
+	source := &Wayback{MaxTimeout: 5, MaxRetries: 1, Storage: server.URL}
+
+	// Error response is not cached, next run fetches the file again
+	if _, err := source.GetFile(page); err == nil {
+		t.Fatal("Expected error of 503 response")
+	}
+	for i := 0; i < 2; i++ {
+		if data, err := source.GetFile(page); err != nil || string(data) != "payload" {
+			t.Fatalf("Unexpected file: %q, %v", data, err)
+		}
+	}
+
+	summary := stats.Summary()
+	if n := atomic.LoadInt32(&requests); n != 2 || summary.CacheHits[common.PhaseDownload] != 1 || summary.PhaseRequests[common.PhaseDownload] != 2 {
+		t.Fatalf("Unexpected accounting after %v requests: %+v", n, summary)
+	}
+}
+
+func TestIndexProxy(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(RESPONSE))
+	}))
+	defer upstream.Close()
+
+	// Mounted as by serve command
+	mux := http.NewServeMux()
+	mux.Handle("/wb/", http.StripPrefix("/wb", common.NewCachingProxy(upstream.URL, time.Minute, common.RequestOptions{Timeout: 5, MaxRetries: 1})))
+	proxy := httptest.NewServer(mux)
+	defer proxy.Close()
+
+	source := &Wayback{MaxTimeout: 5, MaxRetries: 1, IndexServer: proxy.URL + "/wb/"}
+	config := common.RequestConfig{URL: "kamaloff.ru/*", SinglePage: true}
+	for i := 0; i < 2; i++ {
+		records, err := source.GetPages(config)
+		if err != nil || len(records) != 4 {
+			t.Fatalf("Unexpected records through proxy: %v, %v", records, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("Repeated query should be served from proxy cache, upstream got %v requests", n)
+	}
+}